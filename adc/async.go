@@ -0,0 +1,87 @@
+package adc
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/direct-connect/go-dc/lineproto"
+)
+
+// PacketPriority returns the send queue priority for the packet.
+//
+// Chat messages have the highest priority, search requests and results have the lowest one.
+// All other packets, including user info and control messages, have the normal priority,
+// thus their relative order is preserved.
+func PacketPriority(p Packet) lineproto.Priority {
+	m := p.Message()
+	if m == nil {
+		return lineproto.PriorityNormal
+	}
+	switch m.Cmd() {
+	case (ChatMessage{}).Cmd():
+		return lineproto.PriorityHigh
+	case (SearchRequest{}).Cmd(), (SearchResult{}).Cmd():
+		return lineproto.PriorityLow
+	}
+	return lineproto.PriorityNormal
+}
+
+// NewAsyncWriter creates an asynchronous packet writer on top of w. The config is optional.
+//
+// The writer takes ownership of w: it must not be used directly until the AsyncWriter is closed.
+// Line hooks of w are called from a separate goroutine.
+func NewAsyncWriter(w *Writer, conf *lineproto.AsyncConfig) *AsyncWriter {
+	return &AsyncWriter{
+		AsyncWriter: lineproto.NewAsyncWriter(w.Writer, conf),
+		w:           w,
+	}
+}
+
+// AsyncWriter is an ADC packet writer that is safe for concurrent use. Packets are queued with
+// a priority chosen by PacketPriority and are written by a separate goroutine.
+// See lineproto.AsyncWriter for details.
+type AsyncWriter struct {
+	*lineproto.AsyncWriter
+	w *Writer
+}
+
+// asyncBufs is a pool of encoding buffers. Each caller uses a separate buffer,
+// thus a write that waits for the space in the queue doesn't block other writes.
+var asyncBufs = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// WritePacket encodes and queues the packet. It blocks if the queue is full.
+func (w *AsyncWriter) WritePacket(p Packet) error {
+	return w.WritePacketPriority(PacketPriority(p), p)
+}
+
+// WritePacketPriority encodes and queues the packet with a given priority.
+func (w *AsyncWriter) WritePacketPriority(pr lineproto.Priority, p Packet) error {
+	buf := asyncBufs.Get().(*bytes.Buffer)
+	defer asyncBufs.Put(buf)
+	buf.Reset()
+	if err := p.MarshalPacketADC(buf); err != nil {
+		return err
+	}
+	// the line is copied by the queue
+	return w.WriteLinePriority(pr, buf.Bytes())
+}
+
+// ZOn writes all queued packets, sends IZON and enables the compression (ZLIF extension).
+// Packets queued after this call are compressed.
+func (w *AsyncWriter) ZOn() error {
+	return w.Barrier(func() error {
+		if err := w.w.WriteInfo(ZOn{}); err != nil {
+			return err
+		}
+		return w.w.EnableZlib()
+	})
+}
+
+// DisableZlib writes all queued packets, and disables the compression.
+func (w *AsyncWriter) DisableZlib() error {
+	return w.Barrier(w.w.DisableZlib)
+}
@@ -0,0 +1,117 @@
+package adc
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/direct-connect/go-dc/adc/types"
+	"github.com/stretchr/testify/require"
+)
+
+// gateWriter blocks the first write until the gate is closed.
+type gateWriter struct {
+	gate    chan struct{}
+	started chan struct{}
+	once    sync.Once
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func newGateWriter() *gateWriter {
+	return &gateWriter{gate: make(chan struct{}), started: make(chan struct{})}
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() {
+		close(w.started)
+		<-w.gate
+	})
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *gateWriter) Bytes() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]byte(nil), w.buf.Bytes()...)
+}
+
+func readAllLines(t *testing.T, data []byte) []string {
+	r := NewReader(bytes.NewReader(data))
+	var out []string
+	for {
+		line, err := r.ReadLine()
+		if err == io.EOF {
+			return out
+		}
+		require.NoError(t, err)
+		if string(line) == "IZON"+delim {
+			require.NoError(t, r.EnableZlib())
+		}
+		out = append(out, string(line))
+	}
+}
+
+func TestPacketPriority(t *testing.T) {
+	sid := types.SIDFromString("AAAB")
+	for _, c := range []struct {
+		p   Packet
+		exp int
+	}{
+		{&BroadcastPacket{ID: sid, Msg: ChatMessage{Text: "hi"}}, 2},
+		{&BroadcastPacket{ID: sid, Msg: &RawMessage{Type: (ChatMessage{}).Cmd()}}, 2},
+		{&BroadcastPacket{ID: sid, Msg: UserInfo{Name: "bob"}}, 1},
+		{&InfoPacket{Msg: ZOn{}}, 1},
+		{&BroadcastPacket{ID: sid, Msg: SearchRequest{And: []string{"a"}}}, 0},
+		{&DirectPacket{ID: sid, To: sid, Msg: SearchResult{Path: "a"}}, 0},
+	} {
+		require.Equal(t, c.exp, int(PacketPriority(c.p)), "%T", c.p.Message())
+	}
+}
+
+func TestAsyncWriterPriority(t *testing.T) {
+	sid := types.SIDFromString("AAAB")
+	gw := newGateWriter()
+	w := NewAsyncWriter(NewWriter(gw), nil)
+	require.NoError(t, w.WritePacket(&InfoPacket{Msg: Status{Msg: "first"}}))
+	<-gw.started
+
+	require.NoError(t, w.WritePacket(&BroadcastPacket{ID: sid, Msg: SearchRequest{And: []string{"a"}}}))
+	require.NoError(t, w.WritePacket(&InfoPacket{Msg: Status{Msg: "second"}}))
+	require.NoError(t, w.WritePacket(&BroadcastPacket{ID: sid, Msg: ChatMessage{Text: "hi"}}))
+	close(gw.gate)
+	require.NoError(t, w.Close())
+
+	require.Equal(t, []string{
+		"ISTA 000 first" + delim,
+		"BMSG AAAB hi" + delim,
+		"ISTA 000 second" + delim,
+		"BSCH AAAB ANa" + delim,
+	}, readAllLines(t, gw.Bytes()))
+}
+
+func TestAsyncWriterZOn(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := NewAsyncWriter(NewWriter(buf), nil)
+	require.NoError(t, w.WritePacket(&InfoPacket{Msg: Status{Msg: "first"}}))
+	require.NoError(t, w.ZOn())
+	require.NoError(t, w.WritePacket(&InfoPacket{Msg: Status{Msg: "second"}}))
+	require.NoError(t, w.Flush())
+	require.NoError(t, w.DisableZlib())
+	require.NoError(t, w.WritePacket(&InfoPacket{Msg: Status{Msg: "third"}}))
+	require.NoError(t, w.Close())
+
+	data := buf.Bytes()
+	// zlib header follows IZON
+	require.Contains(t, string(data), "IZON"+delim+"\x78")
+	require.Equal(t, []string{
+		"ISTA 000 first" + delim,
+		"IZON" + delim,
+		"ISTA 000 second" + delim,
+		"ISTA 000 third" + delim,
+	}, readAllLines(t, data))
+}
@@ -0,0 +1,251 @@
+package adc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/direct-connect/go-dc/adc/types"
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+const (
+	// DefaultPingName is the name used by Ping if no name is set in the config.
+	DefaultPingName = "pinger"
+	// DefaultPingIdle is the time Ping waits for new messages after the login, before leaving the hub.
+	DefaultPingIdle = 3 * time.Second
+)
+
+var errPingPassword = errors.New("adc: ping: password required")
+
+// PingConfig is an optional configuration for Ping.
+type PingConfig struct {
+	// Name of the pinger. DefaultPingName is used if not set.
+	Name     string
+	Password string
+	// Share size reported in INF. Some hubs require a minimal share even for pingers.
+	Share uint64
+	Slots int
+	// PID of the pinger. A random PID is generated if not set.
+	PID *PID
+	// TLS config for adcs:// addresses. See DialHub.
+	TLS *tls.Config
+	// Idle is the time to wait for new messages after the login. DefaultPingIdle is used if not set.
+	Idle time.Duration
+}
+
+// PingInfo is the information about the hub collected by Ping.
+type PingInfo struct {
+	// Features is the list of features supported by the hub.
+	Features ModFeatures
+	// HubInfo contains additional fields if the hub supports PING extension.
+	HubInfo HubInfo
+	// Users is the list of users, sorted by name.
+	Users []UserInfo
+	// Redirect is set if the hub redirected the pinger.
+	Redirect string
+}
+
+// ShareSize returns the total share size of all users.
+func (p *PingInfo) ShareSize() uint64 {
+	var size uint64
+	for _, u := range p.Users {
+		if u.ShareSize > 0 {
+			size += uint64(u.ShareSize)
+		}
+	}
+	return size
+}
+
+// Ping connects to the hub as a pinger bot and collects information about it.
+//
+// The pinger announces PING extension, logs in as a bot, collects the hub info and the user list,
+// and leaves after no messages are received for the idle time (see PingConfig).
+// The context controls the whole process, including the connection.
+//
+// If the hub redirects the pinger, the info is returned with the Redirect set.
+func Ping(ctx context.Context, addr string, conf *PingConfig) (*PingInfo, error) {
+	var c PingConfig
+	if conf != nil {
+		c = *conf
+	}
+	if c.Name == "" {
+		c.Name = DefaultPingName
+	}
+	if c.Idle <= 0 {
+		c.Idle = DefaultPingIdle
+	}
+	if c.PID == nil {
+		pid, err := types.NewPID()
+		if err != nil {
+			return nil, err
+		}
+		c.PID = &pid
+	}
+	conn, err := DialHub(ctx, addr, c.TLS)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// unblock reads if the context is canceled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+
+	p := &pinger{
+		conf:  &c,
+		r:     NewReader(conn),
+		w:     NewWriter(conn),
+		users: make(map[SID]*UserInfo),
+	}
+	err = p.writePacket(&HubPacket{Msg: Supported{Features: ModFeatures{
+		FeaBASE: true, FeaTIGR: true, FeaPING: true,
+	}}})
+	for err == nil && !p.stop {
+		if p.joined {
+			_ = conn.SetReadDeadline(time.Now().Add(c.Idle))
+		}
+		var pkt Packet
+		pkt, err = p.r.ReadPacketRaw()
+		if e, ok := err.(net.Error); ok && e.Timeout() && p.joined {
+			err = nil
+			break
+		} else if err != nil {
+			break
+		}
+		err = p.handle(pkt)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			return nil, err
+		} else if !p.joined {
+			return nil, ctx.Err()
+		}
+		// return what was collected
+	}
+	for _, u := range p.users {
+		p.info.Users = append(p.info.Users, *u)
+	}
+	sort.Slice(p.info.Users, func(i, j int) bool {
+		return p.info.Users[i].Name < p.info.Users[j].Name
+	})
+	return &p.info, nil
+}
+
+type pinger struct {
+	conf   *PingConfig
+	r      *Reader
+	w      *Writer
+	sid    SID
+	users  map[SID]*UserInfo
+	joined bool // the hub sent our own INF
+	stop   bool // the hub disconnected or redirected the pinger
+	info   PingInfo
+}
+
+func (p *pinger) writePacket(pkt Packet) error {
+	if err := p.w.WritePacket(pkt); err != nil {
+		return err
+	}
+	return p.w.Flush()
+}
+
+// handle processes a single packet from the hub.
+func (p *pinger) handle(pkt Packet) error {
+	switch pkt := pkt.(type) {
+	case *InfoPacket:
+		switch pkt.Msg.Cmd() {
+		case (Supported{}).Cmd():
+			var m Supported
+			if err := pkt.DecodeMessageTo(&m); err != nil {
+				return err
+			}
+			p.info.Features = m.Features
+		case (SIDAssign{}).Cmd():
+			var m SIDAssign
+			if err := pkt.DecodeMessageTo(&m); err != nil {
+				return err
+			}
+			p.sid = m.SID
+			return p.writePacket(&BroadcastPacket{ID: p.sid, Msg: UserInfo{
+				Id:          p.conf.PID.Hash(),
+				Pid:         p.conf.PID,
+				Name:        p.conf.Name,
+				Application: "go-dc",
+				Version:     "pinger",
+				ShareSize:   int64(p.conf.Share),
+				Slots:       p.conf.Slots,
+				SlotsFree:   p.conf.Slots,
+				HubsNormal:  1,
+				Type:        UserTypeBot,
+				Features:    ExtFeatures{},
+			}})
+		case (HubInfo{}).Cmd():
+			// hub info may be sent in multiple messages
+			return pkt.DecodeMessageTo(&p.info.HubInfo)
+		case (GetPassword{}).Cmd():
+			var m GetPassword
+			if err := pkt.DecodeMessageTo(&m); err != nil {
+				return err
+			}
+			if p.conf.Password == "" {
+				return errPingPassword
+			}
+			data := append([]byte(p.conf.Password), m.Salt...)
+			return p.writePacket(&HubPacket{Msg: Password{Hash: tiger.HashBytes(data)}})
+		case (Status{}).Cmd():
+			var m Status
+			if err := pkt.DecodeMessageTo(&m); err != nil {
+				return err
+			}
+			if m.Sev == Fatal {
+				return m.Err()
+			}
+		case (Disconnect{}).Cmd():
+			var m Disconnect
+			if err := pkt.DecodeMessageTo(&m); err != nil {
+				return err
+			}
+			if _, ok := p.users[m.ID]; ok {
+				delete(p.users, m.ID)
+				return nil
+			}
+			p.stop = true
+			p.info.Redirect = m.Redirect
+			if m.Redirect == "" && !p.joined {
+				if m.Message != "" {
+					return errors.New("adc: ping: disconnected: " + m.Message)
+				}
+				return errors.New("adc: ping: disconnected")
+			}
+		}
+	case *BroadcastPacket:
+		if pkt.Msg.Cmd() != (UserInfo{}).Cmd() {
+			return nil
+		}
+		u := p.users[pkt.ID]
+		if u == nil {
+			u = &UserInfo{}
+		}
+		if err := pkt.DecodeMessageTo(u); err != nil {
+			return nil // skip broken user info
+		}
+		if pkt.ID == p.sid {
+			// hub sends our own info at the end of the user list
+			p.joined = true
+			return nil
+		}
+		p.users[pkt.ID] = u
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package adc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+// testPingHub serves a single pinger connection and returns the packets received from it.
+func testPingHub(t *testing.T, l net.Listener, redirect string) <-chan []Packet {
+	out := make(chan []Packet, 1)
+	go func() {
+		defer close(out)
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r, w := NewReader(conn), NewWriter(conn)
+		var got []Packet
+		send := func(p ...Packet) {
+			for _, p := range p {
+				_ = w.WritePacket(p)
+			}
+			_ = w.Flush()
+		}
+		read := func() Packet {
+			p, err := r.ReadPacket()
+			if err != nil {
+				return nil
+			}
+			got = append(got, p)
+			return p
+		}
+		pinger, alice, bob := SID{'A', 'A', 'A', 'B'}, SID{'A', 'A', 'A', 'C'}, SID{'A', 'A', 'A', 'D'}
+		read() // SUP
+		if redirect != "" {
+			send(&InfoPacket{Msg: Disconnect{ID: pinger, Redirect: redirect}})
+			out <- got
+			return
+		}
+		send(
+			&InfoPacket{Msg: Supported{Features: ModFeatures{FeaBASE: true, FeaTIGR: true, FeaPING: true}}},
+			&InfoPacket{Msg: SIDAssign{SID: pinger}},
+			&InfoPacket{Msg: HubInfo{
+				Name: "Test hub", Version: "1.0", Application: "hub", Desc: "desc",
+				Users: 2, Share: 150, UsersLimit: 1000, MinSlots: 2,
+			}},
+		)
+		read() // INF
+		send(&InfoPacket{Msg: GetPassword{Salt: []byte("salt")}})
+		read() // PAS
+		send(
+			&BroadcastPacket{ID: alice, Msg: UserInfo{Name: "alice", ShareSize: 100}},
+			&BroadcastPacket{ID: bob, Msg: UserInfo{Name: "bob", ShareSize: 50}},
+			&BroadcastPacket{ID: pinger, Msg: UserInfo{Name: "pinger"}},
+			&BroadcastPacket{ID: alice, Msg: UserInfo{Name: "alice", ShareSize: 100, Desc: "updated"}},
+		)
+		// wait for the pinger to leave
+		for read() != nil {
+		}
+		out <- got
+	}()
+	return out
+}
+
+func TestPing(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	pkts := testPingHub(t, l, "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	info, err := Ping(ctx, "adc://"+l.Addr().String(), &PingConfig{
+		Password: "secret",
+		Idle:     200 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.True(t, info.Features.IsSet(FeaPING))
+	require.Equal(t, "Test hub", info.HubInfo.Name)
+	require.Equal(t, "desc", info.HubInfo.Desc)
+	require.Equal(t, 1000, info.HubInfo.UsersLimit)
+	require.Equal(t, 2, info.HubInfo.MinSlots)
+	require.Len(t, info.Users, 2)
+	require.Equal(t, "alice", info.Users[0].Name)
+	require.Equal(t, "updated", info.Users[0].Desc)
+	require.Equal(t, "bob", info.Users[1].Name)
+	require.Equal(t, uint64(150), info.ShareSize())
+
+	got := <-pkts
+	require.Len(t, got, 3)
+	require.True(t, got[0].Message().(Supported).Features.IsSet(FeaPING))
+	inf := got[1].Message().(UserInfo)
+	require.Equal(t, DefaultPingName, inf.Name)
+	require.Equal(t, UserTypeBot, inf.Type)
+	require.Equal(t, Password{Hash: tiger.HashBytes([]byte("secretsalt"))}, got[2].Message())
+}
+
+func TestPingPassword(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	testPingHub(t, l, "")
+
+	_, err = Ping(context.Background(), "adc://"+l.Addr().String(), nil)
+	require.Equal(t, errPingPassword, err)
+}
+
+func TestPingRedirect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	testPingHub(t, l, "adc://example.com:411")
+
+	info, err := Ping(context.Background(), "adc://"+l.Addr().String(), nil)
+	require.NoError(t, err)
+	require.Equal(t, "adc://example.com:411", info.Redirect)
+}
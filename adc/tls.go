@@ -0,0 +1,42 @@
+package adc
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	"github.com/direct-connect/go-dc/keyprint"
+	"github.com/direct-connect/go-dc/keyprint/tlskp"
+)
+
+// DialHub connects to the ADC hub at a given address. If the address has adcs:// scheme,
+// the connection is wrapped in TLS.
+//
+// If the address contains a keyprint (kp= query parameter), the hub certificate is verified
+// against it instead of the certificate chain, since most hubs use self-signed certificates.
+// Otherwise, the certificate chain is verified as usual. To connect to a hub with a self-signed
+// certificate and no keyprint, the verification must be disabled explicitly with InsecureSkipVerify.
+// See tlskp.Client.
+func DialHub(ctx context.Context, addr string, conf *tls.Config) (net.Conn, error) {
+	u, err := ParseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err = net.SplitHostPort(u.Host); err != nil {
+		return nil, fmt.Errorf("no port in address: %q", addr)
+	}
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != SchemaADCS {
+		return c, nil
+	}
+	tc, err := tlskp.Client(ctx, c, u.Hostname(), keyprint.FromURL(u), conf)
+	if err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
@@ -0,0 +1,173 @@
+package dc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/keyprint"
+	"github.com/direct-connect/go-dc/nmdc"
+)
+
+// Protocol is a DC protocol used by the hub.
+type Protocol int
+
+const (
+	ProtoNMDC = Protocol(iota + 1)
+	ProtoADC
+)
+
+func (p Protocol) String() string {
+	switch p {
+	case ProtoNMDC:
+		return "NMDC"
+	case ProtoADC:
+		return "ADC"
+	}
+	return "Protocol(" + strconv.Itoa(int(p)) + ")"
+}
+
+const (
+	// DefaultPortNMDC is the default port for NMDC hubs.
+	DefaultPortNMDC = nmdc.DefaultPort
+	// DefaultPortADC is the port customarily used by ADC hubs. ADC has no default port, thus it's only
+	// used when the address has no port.
+	DefaultPortADC = 412
+)
+
+var errNoHost = errors.New("dc: no hostname in address")
+
+// Address is a parsed DC hub address.
+//
+// Two addresses refer to the same hub if their Key is the same. Address is comparable,
+// but the comparison with == is sensitive to the default port and the keyprint.
+type Address struct {
+	Proto  Protocol
+	Secure bool
+	// Host is a lower-case hostname or an IP address. IPv6 addresses are stored without brackets.
+	Host string
+	// Port is the port of the hub. Zero means the default port for the protocol.
+	Port int
+	// KeyPrint is the keyprint of the hub certificate (kp= parameter).
+	KeyPrint string
+}
+
+// ParseAddress parses a DC hub address. If the address has no scheme, dchub:// is assumed.
+//
+// Both nmdc:// and dchub:// schemes are accepted for NMDC. Scheme and host are case-insensitive,
+// and trailing slashes are ignored.
+func ParseAddress(s string) (Address, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "://") {
+		s = nmdc.SchemeNMDC + "://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return Address{}, err
+	}
+	var a Address
+	switch strings.ToLower(u.Scheme) {
+	case nmdc.SchemeNMDC, "nmdc":
+		a.Proto = ProtoNMDC
+	case nmdc.SchemeNMDCS:
+		a.Proto, a.Secure = ProtoNMDC, true
+	case adc.SchemaADC:
+		a.Proto = ProtoADC
+	case adc.SchemaADCS:
+		a.Proto, a.Secure = ProtoADC, true
+	default:
+		return Address{}, fmt.Errorf("unsupported protocol: %q", u.Scheme)
+	}
+	if strings.Trim(u.Path, "/") != "" {
+		return Address{}, fmt.Errorf("unexpected path in address: %q", u.Path)
+	}
+	a.Host = strings.ToLower(u.Hostname())
+	if a.Host == "" {
+		return Address{}, errNoHost
+	}
+	if p := u.Port(); p != "" {
+		a.Port, err = strconv.Atoi(p)
+		if err != nil || a.Port <= 0 || a.Port > 0xffff {
+			return Address{}, fmt.Errorf("invalid port: %q", p)
+		}
+	}
+	a.KeyPrint = keyprint.FromURL(u)
+	return a, nil
+}
+
+// Scheme returns the URL scheme for the address.
+func (a Address) Scheme() string {
+	switch {
+	case a.Proto == ProtoADC && a.Secure:
+		return adc.SchemaADCS
+	case a.Proto == ProtoADC:
+		return adc.SchemaADC
+	case a.Secure:
+		return nmdc.SchemeNMDCS
+	default:
+		return nmdc.SchemeNMDC
+	}
+}
+
+// DefaultPort returns the default port for the protocol.
+func (a Address) DefaultPort() int {
+	if a.Proto == ProtoADC {
+		return DefaultPortADC
+	}
+	return DefaultPortNMDC
+}
+
+// HostPort returns the host and port of the hub in a form accepted by net.Dial.
+// The default port is used if the port is not set.
+func (a Address) HostPort() string {
+	port := a.Port
+	if port == 0 {
+		port = a.DefaultPort()
+	}
+	return net.JoinHostPort(a.Host, strconv.Itoa(port))
+}
+
+// Normalize returns an address with an explicit port.
+func (a Address) Normalize() Address {
+	if a.Port == 0 {
+		a.Port = a.DefaultPort()
+	}
+	return a
+}
+
+// Key returns a normalized address without the keyprint. Addresses that refer to the same hub have the same key.
+func (a Address) Key() string {
+	a = a.Normalize()
+	a.KeyPrint = ""
+	return a.String()
+}
+
+// Equal checks if two addresses refer to the same hub. The keyprint is ignored.
+func (a Address) Equal(b Address) bool {
+	return a.Key() == b.Key()
+}
+
+// URL returns the address as a URL.
+func (a Address) URL() *url.URL {
+	u := &url.URL{Scheme: a.Scheme(), Host: a.Host}
+	if a.Port != 0 {
+		u.Host = net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
+	} else if strings.Contains(a.Host, ":") {
+		// IPv6 literal
+		u.Host = "[" + a.Host + "]"
+	}
+	if a.KeyPrint != "" {
+		u.Path = "/"
+		u.RawQuery = "kp=" + a.KeyPrint
+	}
+	return u
+}
+
+// String formats the address as scheme://host[:port][/?kp=keyprint].
+func (a Address) String() string {
+	return a.URL().String()
+}
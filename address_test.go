@@ -0,0 +1,90 @@
+package dc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var addressCases = []struct {
+	addr string
+	exp  Address
+	str  string
+	key  string
+	err  bool
+}{
+	{
+		addr: "example.com",
+		exp:  Address{Proto: ProtoNMDC, Host: "example.com"},
+		str:  "dchub://example.com",
+		key:  "dchub://example.com:411",
+	},
+	{
+		addr: "NMDC://Example.COM:411/",
+		exp:  Address{Proto: ProtoNMDC, Host: "example.com", Port: 411},
+		str:  "dchub://example.com:411",
+		key:  "dchub://example.com:411",
+	},
+	{
+		addr: "nmdcs://example.com:4111",
+		exp:  Address{Proto: ProtoNMDC, Secure: true, Host: "example.com", Port: 4111},
+		str:  "nmdcs://example.com:4111",
+		key:  "nmdcs://example.com:4111",
+	},
+	{
+		addr: "adc://[::1]:412",
+		exp:  Address{Proto: ProtoADC, Host: "::1", Port: 412},
+		str:  "adc://[::1]:412",
+		key:  "adc://[::1]:412",
+	},
+	{
+		addr: "adcs://[2001:DB8::1]",
+		exp:  Address{Proto: ProtoADC, Secure: true, Host: "2001:db8::1"},
+		str:  "adcs://[2001:db8::1]",
+		key:  "adcs://[2001:db8::1]:412",
+	},
+	{
+		addr: "adcs://example.com:2780/?kp=SHA256/ABCD",
+		exp:  Address{Proto: ProtoADC, Secure: true, Host: "example.com", Port: 2780, KeyPrint: "SHA256/ABCD"},
+		str:  "adcs://example.com:2780/?kp=SHA256/ABCD",
+		key:  "adcs://example.com:2780",
+	},
+	{addr: "http://example.com", err: true},
+	{addr: "adc://:412", err: true},
+	{addr: "adc://example.com:99999", err: true},
+	{addr: "dchub://example.com/path", err: true},
+}
+
+func TestParseAddress(t *testing.T) {
+	for _, c := range addressCases {
+		t.Run(c.addr, func(t *testing.T) {
+			a, err := ParseAddress(c.addr)
+			if c.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.exp, a)
+			require.Equal(t, c.str, a.String())
+			require.Equal(t, c.key, a.Key())
+
+			a2, err := ParseAddress(a.String())
+			require.NoError(t, err)
+			require.Equal(t, a, a2)
+		})
+	}
+}
+
+func TestAddressEqual(t *testing.T) {
+	parse := func(s string) Address {
+		a, err := ParseAddress(s)
+		require.NoError(t, err)
+		return a
+	}
+	require.True(t, parse("nmdc://Hub.example.com/").Equal(parse("dchub://hub.example.com:411")))
+	require.True(t, parse("adcs://hub:412/?kp=SHA256/ABCD").Equal(parse("ADCS://hub")))
+	require.False(t, parse("adc://hub:412").Equal(parse("adcs://hub:412")))
+	require.False(t, parse("dchub://hub:412").Equal(parse("adc://hub:412")))
+	require.Equal(t, "hub:411", parse("hub").HostPort())
+	require.Equal(t, "[::1]:412", parse("adc://[::1]").HostPort())
+}
@@ -0,0 +1,317 @@
+// Package bot implements a framework for chat bots running on ADC and NMDC hubs.
+//
+// A bot is a set of commands that are triggered by messages with a given prefix, either in the main chat
+// or in private messages:
+//
+//	b := bot.New(&bot.Config{Name: "faq"})
+//	b.Handle(bot.Command{
+//		Name: "rules",
+//		Help: "show the hub rules",
+//		Run: func(c *bot.Context) error {
+//			return c.Reply("be nice")
+//		},
+//	})
+//	h, err := dc.Dial(ctx, addr, &dc.Options{Name: "faq", Bot: true})
+//	...
+//	b.Attach(h)
+//
+// Commands may require a minimal user level, and users are rate limited.
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dc "github.com/direct-connect/go-dc"
+)
+
+const (
+	// DefaultPrefix is the default command prefix.
+	DefaultPrefix = "+"
+	// DefaultRate is the default average interval between commands of a single user.
+	DefaultRate = 2 * time.Second
+	// DefaultBurst is the default number of commands a user can send without waiting.
+	DefaultBurst = 5
+)
+
+var (
+	// ErrUsage can be returned by a command to print its usage.
+	ErrUsage = errors.New("bot: invalid usage")
+
+	errNoName      = errors.New("bot: command name is not set")
+	errNoRun       = errors.New("bot: command function is not set")
+	errCommandUsed = errors.New("bot: command is already registered")
+)
+
+// Level is a user level on the hub.
+type Level int
+
+const (
+	LevelUser       = Level(0)
+	LevelRegistered = Level(1)
+	LevelOperator   = Level(2)
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelUser:
+		return "user"
+	case LevelRegistered:
+		return "registered"
+	case LevelOperator:
+		return "operator"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// LevelOf returns the level of the user. Operators are determined by OpList on NMDC
+// and by the client type on ADC. NMDC hubs do not report registered users.
+func LevelOf(u dc.User) Level {
+	switch {
+	case u.Op:
+		return LevelOperator
+	case u.Reg:
+		return LevelRegistered
+	}
+	return LevelUser
+}
+
+// ReplyMode controls where the replies to commands from the main chat are sent.
+// Commands received in private messages are always answered privately.
+type ReplyMode int
+
+const (
+	// ReplyChat sends replies to the main chat.
+	ReplyChat = ReplyMode(iota)
+	// ReplyPM sends replies in a private message.
+	ReplyPM
+	// ReplyChatTo sends replies to the main chat, but only the user who sent the command can see them.
+	// On NMDC it requires MCTo support from the hub.
+	ReplyChatTo
+)
+
+// Config for the bot.
+type Config struct {
+	// Name of the bot on the hub. Messages from this name are ignored.
+	Name string
+	// Prefix of the commands. DefaultPrefix is used if not set.
+	Prefix string
+	// Reply sets where the replies to commands from the main chat are sent.
+	Reply ReplyMode
+	// Rate is the average interval between commands of a single user. DefaultRate is used if not set.
+	// Negative value disables the rate limit. Operators are never limited.
+	Rate time.Duration
+	// Burst is the number of commands a user can send without waiting. DefaultBurst is used if not set.
+	Burst int
+	// NoHelp disables the built-in help command.
+	NoHelp bool
+}
+
+// New creates a new bot.
+func New(conf *Config) *Bot {
+	b := &Bot{
+		cmds:   make(map[string]*Command),
+		limits: make(map[limitKey]*bucket),
+		now:    time.Now,
+	}
+	if conf != nil {
+		b.conf = *conf
+	}
+	if b.conf.Prefix == "" {
+		b.conf.Prefix = DefaultPrefix
+	}
+	if b.conf.Rate == 0 {
+		b.conf.Rate = DefaultRate
+	}
+	if b.conf.Burst <= 0 {
+		b.conf.Burst = DefaultBurst
+	}
+	if !b.conf.NoHelp {
+		b.cmds["help"] = &Command{
+			Name:  "help",
+			Usage: "[command]",
+			Help:  "list commands or show the help for a command",
+			Max:   1,
+			Run:   b.help,
+		}
+	}
+	return b
+}
+
+// Bot dispatches chat commands to handlers. It's safe for concurrent use.
+type Bot struct {
+	conf Config
+	now  func() time.Time
+
+	mu     sync.RWMutex
+	cmds   map[string]*Command // by name and aliases
+	limits map[limitKey]*bucket
+
+	onError []func(c *Context, err error)
+}
+
+// Handle registers a command. Commands and their aliases must be unique.
+func (b *Bot) Handle(cmd Command) error {
+	if cmd.Name == "" {
+		return errNoName
+	} else if cmd.Run == nil {
+		return errNoRun
+	}
+	c := &cmd
+	names := append([]string{c.Name}, c.Aliases...)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, name := range names {
+		if _, ok := b.cmds[strings.ToLower(name)]; ok {
+			return errCommandUsed
+		}
+	}
+	for _, name := range names {
+		b.cmds[strings.ToLower(name)] = c
+	}
+	return nil
+}
+
+// OnError registers a hook that is called when a command fails. ErrUsage is not reported.
+//
+// This method is not concurrent-safe.
+func (b *Bot) OnError(fnc func(c *Context, err error)) {
+	b.onError = append(b.onError, fnc)
+}
+
+// Commands returns all registered commands, sorted by name.
+func (b *Bot) Commands() []*Command {
+	b.mu.RLock()
+	list := make([]*Command, 0, len(b.cmds))
+	for name, c := range b.cmds {
+		if strings.EqualFold(name, c.Name) {
+			list = append(list, c)
+		}
+	}
+	b.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Attach starts handling chat messages from the hub. Bot can be attached to multiple hubs.
+func (b *Bot) Attach(h dc.Hub) {
+	h.OnChat(func(m dc.ChatMessage) {
+		b.HandleChat(h, m)
+	})
+	h.OnUserLeave(func(u dc.User) {
+		b.mu.Lock()
+		delete(b.limits, limitKey{hub: h, name: u.Name})
+		b.mu.Unlock()
+	})
+}
+
+// HandleChat handles a single chat message received from the hub. It reports if the message was a command.
+func (b *Bot) HandleChat(h dc.Hub, m dc.ChatMessage) bool {
+	if m.From == "" || m.From == b.conf.Name {
+		return false
+	}
+	if !strings.HasPrefix(m.Text, b.conf.Prefix) {
+		return false
+	}
+	text := strings.TrimSpace(m.Text[len(b.conf.Prefix):])
+	name, rest := text, ""
+	if i := strings.IndexAny(text, " \t\r\n"); i >= 0 {
+		name, rest = text[:i], strings.TrimSpace(text[i+1:])
+	}
+	b.mu.RLock()
+	cmd := b.cmds[strings.ToLower(name)]
+	b.mu.RUnlock()
+	if cmd == nil {
+		return false
+	}
+	u := findUser(h, m.From)
+	c := &Context{
+		Bot: b, Hub: h, User: u, Level: LevelOf(u),
+		Command: cmd, Text: rest, PM: m.PM,
+	}
+	if c.Level < LevelOperator && !b.allow(h, u.Name) {
+		return true // silently drop to avoid flooding the chat
+	}
+	if c.Level < cmd.Level {
+		b.report(c, c.Replyf("%s%s: access denied", b.conf.Prefix, cmd.Name))
+		return true
+	}
+	c.Args = splitArgs(rest)
+	var err error
+	if len(c.Args) < cmd.Min || (cmd.Max > 0 && len(c.Args) > cmd.Max) {
+		err = ErrUsage
+	} else {
+		err = cmd.Run(c)
+	}
+	if err == ErrUsage {
+		err = c.Reply(b.usage(cmd))
+	} else if err != nil {
+		b.report(c, err)
+		err = c.Replyf("%s%s: %v", b.conf.Prefix, cmd.Name, err)
+	}
+	// report reply errors
+	b.report(c, err)
+	return true
+}
+
+func (b *Bot) report(c *Context, err error) {
+	if err == nil || err == ErrUsage {
+		return
+	}
+	for _, fnc := range b.onError {
+		fnc(c, err)
+	}
+}
+
+// findUser finds the user by name. If the user is not in the list, only the name is set.
+func findUser(h dc.Hub, name string) dc.User {
+	if u, ok := h.User(name); ok {
+		return u
+	}
+	return dc.User{Name: name}
+}
+
+func (b *Bot) usage(c *Command) string {
+	s := "usage: " + b.conf.Prefix + c.Name
+	if c.Usage != "" {
+		s += " " + c.Usage
+	}
+	return s
+}
+
+func (b *Bot) help(c *Context) error {
+	if len(c.Args) == 1 {
+		b.mu.RLock()
+		cmd := b.cmds[strings.ToLower(strings.TrimPrefix(c.Args[0], b.conf.Prefix))]
+		b.mu.RUnlock()
+		if cmd == nil || c.Level < cmd.Level {
+			return c.Replyf("unknown command: %s", c.Args[0])
+		}
+		s := b.usage(cmd)
+		if len(cmd.Aliases) != 0 {
+			s += "\naliases: " + strings.Join(cmd.Aliases, ", ")
+		}
+		if cmd.Help != "" {
+			s += "\n" + cmd.Help
+		}
+		return c.Reply(s)
+	}
+	var buf strings.Builder
+	buf.WriteString("commands:")
+	for _, cmd := range b.Commands() {
+		if c.Level < cmd.Level || cmd.Hidden {
+			continue
+		}
+		buf.WriteString("\n" + b.conf.Prefix + cmd.Name)
+		if cmd.Help != "" {
+			buf.WriteString(" - " + cmd.Help)
+		}
+	}
+	return c.Reply(buf.String())
+}
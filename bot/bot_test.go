@@ -0,0 +1,175 @@
+package bot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	dc "github.com/direct-connect/go-dc"
+)
+
+var _ dc.Hub = (*testHub)(nil)
+
+// testHub records messages sent by the bot.
+type testHub struct {
+	dc.Hub // panics on unused methods
+	users  []dc.User
+	sent   []string
+}
+
+func (h *testHub) User(name string) (dc.User, bool) {
+	for _, u := range h.users {
+		if u.Name == name {
+			return u, true
+		}
+	}
+	return dc.User{}, false
+}
+
+func (h *testHub) SendChat(text string) error {
+	h.sent = append(h.sent, "chat: "+text)
+	return nil
+}
+
+func (h *testHub) SendPM(to, text string) error {
+	h.sent = append(h.sent, "pm "+to+": "+text)
+	return nil
+}
+
+func (h *testHub) SendChatTo(to, text string) error {
+	h.sent = append(h.sent, "chatto "+to+": "+text)
+	return nil
+}
+
+func (h *testHub) flush() []string {
+	out := h.sent
+	h.sent = nil
+	return out
+}
+
+func newTestBot(t *testing.T, conf *Config) (*Bot, *testHub) {
+	b := New(conf)
+	h := &testHub{users: []dc.User{
+		{Name: "alice"},
+		{Name: "bob", Op: true, Reg: true},
+		{Name: "carol", Reg: true},
+	}}
+	err := b.Handle(Command{
+		Name: "echo", Aliases: []string{"say"}, Usage: "<text>...", Help: "repeat the text",
+		Min: 1,
+		Run: func(c *Context) error {
+			return c.Reply(strings.Join(c.Args, "|"))
+		},
+	})
+	require.NoError(t, err)
+	err = b.Handle(Command{
+		Name: "kick", Usage: "<user> [reason]", Help: "kick the user",
+		Level: LevelOperator, Min: 1, Max: 2,
+		Run: func(c *Context) error {
+			if c.Args[0] == c.User.Name {
+				return errors.New("cannot kick yourself")
+			}
+			return c.ReplyChat(c.User.Name + " kicked " + c.Args[0])
+		},
+	})
+	require.NoError(t, err)
+	return b, h
+}
+
+func TestBotCommands(t *testing.T) {
+	b, h := newTestBot(t, &Config{Name: "bot"})
+
+	require.False(t, b.HandleChat(h, dc.ChatMessage{From: "alice", Text: "hello"}))
+	require.False(t, b.HandleChat(h, dc.ChatMessage{From: "alice", Text: "+unknown"}))
+	require.False(t, b.HandleChat(h, dc.ChatMessage{From: "bot", Text: "+echo loop"}))
+	require.Empty(t, h.flush())
+
+	require.True(t, b.HandleChat(h, dc.ChatMessage{From: "alice", Text: `+echo a "b c"  d`}))
+	require.True(t, b.HandleChat(h, dc.ChatMessage{From: "alice", Text: `+SAY x`, PM: true}))
+	require.True(t, b.HandleChat(h, dc.ChatMessage{From: "alice", Text: `+echo`}))
+	require.Equal(t, []string{
+		"chat: a|b c|d",
+		"pm alice: x",
+		"chat: usage: +echo <text>...",
+	}, h.flush())
+
+	b.HandleChat(h, dc.ChatMessage{From: "alice", Text: "+kick carol"})
+	b.HandleChat(h, dc.ChatMessage{From: "bob", Text: "+kick carol flood"})
+	b.HandleChat(h, dc.ChatMessage{From: "bob", Text: "+kick carol flood again"})
+	b.HandleChat(h, dc.ChatMessage{From: "bob", Text: "+kick bob"})
+	require.Equal(t, []string{
+		"chat: +kick: access denied",
+		"chat: bob kicked carol",
+		"chat: usage: +kick <user> [reason]",
+		"chat: +kick: cannot kick yourself",
+	}, h.flush())
+}
+
+func TestBotHelp(t *testing.T) {
+	b, h := newTestBot(t, &Config{Name: "bot", Prefix: "!", Reply: ReplyPM})
+
+	b.HandleChat(h, dc.ChatMessage{From: "alice", Text: "!help"})
+	b.HandleChat(h, dc.ChatMessage{From: "bob", Text: "!help"})
+	b.HandleChat(h, dc.ChatMessage{From: "alice", Text: "!help say"})
+	b.HandleChat(h, dc.ChatMessage{From: "alice", Text: "!help kick"})
+	require.Equal(t, []string{
+		"pm alice: commands:\n!echo - repeat the text\n!help - list commands or show the help for a command",
+		"pm bob: commands:\n!echo - repeat the text\n!help - list commands or show the help for a command\n!kick - kick the user",
+		"pm alice: usage: !echo <text>...\naliases: say\nrepeat the text",
+		"pm alice: unknown command: kick",
+	}, h.flush())
+}
+
+func TestBotRateLimit(t *testing.T) {
+	b, h := newTestBot(t, &Config{Name: "bot", Reply: ReplyChatTo, Rate: time.Second, Burst: 2})
+	now := time.Unix(0, 0)
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		b.HandleChat(h, dc.ChatMessage{From: "alice", Text: "+echo a"})
+		b.HandleChat(h, dc.ChatMessage{From: "bob", Text: "+echo b"})
+	}
+	now = now.Add(time.Second)
+	b.HandleChat(h, dc.ChatMessage{From: "alice", Text: "+echo c"})
+	b.HandleChat(h, dc.ChatMessage{From: "alice", Text: "+echo d"})
+	require.Equal(t, []string{
+		"chatto alice: a", "chatto bob: b",
+		"chatto alice: a", "chatto bob: b",
+		"chatto bob: b",
+		"chatto alice: c",
+	}, h.flush())
+}
+
+func TestBotRateLimitHubs(t *testing.T) {
+	b, h := newTestBot(t, &Config{Name: "bot", Reply: ReplyChatTo, Rate: time.Second, Burst: 1})
+	h2 := &testHub{users: h.users}
+	now := time.Unix(0, 0)
+	b.now = func() time.Time { return now }
+
+	// the same name on a different hub has a separate limit
+	for i := 0; i < 2; i++ {
+		b.HandleChat(h, dc.ChatMessage{From: "alice", Text: "+echo a"})
+		b.HandleChat(h2, dc.ChatMessage{From: "alice", Text: "+echo b"})
+	}
+	require.Equal(t, []string{"chatto alice: a"}, h.flush())
+	require.Equal(t, []string{"chatto alice: b"}, h2.flush())
+}
+
+func TestBotHandle(t *testing.T) {
+	b, _ := newTestBot(t, nil)
+	run := func(c *Context) error { return nil }
+	require.Equal(t, errNoName, b.Handle(Command{Run: run}))
+	require.Equal(t, errNoRun, b.Handle(Command{Name: "x"}))
+	require.Equal(t, errCommandUsed, b.Handle(Command{Name: "x", Aliases: []string{"Echo"}, Run: run}))
+	require.NoError(t, b.Handle(Command{Name: "x", Run: run}))
+	require.Len(t, b.Commands(), 4)
+}
+
+func TestSplitArgs(t *testing.T) {
+	require.Equal(t, []string(nil), splitArgs("  "))
+	require.Equal(t, []string{"a", "", "b c"}, splitArgs(`a "" "b c`))
+	require.Equal(t, []string{"ab c"}, splitArgs(`a"b c"`))
+}
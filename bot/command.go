@@ -0,0 +1,150 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	dc "github.com/direct-connect/go-dc"
+)
+
+// Command is a bot command.
+type Command struct {
+	// Name of the command, without the prefix. Names are case-insensitive.
+	Name    string
+	Aliases []string
+	// Usage describes the arguments, for example "<user> [reason]".
+	Usage string
+	// Help is a short description of the command.
+	Help string
+	// Level is the minimal user level required to run the command.
+	Level Level
+	// Min and Max set the number of arguments. Zero Max means no limit.
+	// The usage is printed if the number of arguments doesn't match.
+	Min, Max int
+	// Hidden commands are not listed by the help command.
+	Hidden bool
+	// Run is called to execute the command. It may return ErrUsage to print the usage.
+	// Other errors are sent as a reply.
+	Run func(c *Context) error
+}
+
+// Context is a single command invocation.
+type Context struct {
+	Bot     *Bot
+	Hub     dc.Hub
+	Command *Command
+	// User who sent the command. If the user is not in the hub user list, only the name is set.
+	User  dc.User
+	Level Level
+	// Args are the parsed arguments. Arguments are separated by spaces, and can be quoted with '"'.
+	Args []string
+	// Text is the unparsed text after the command name.
+	Text string
+	// PM is set if the command was received in a private message.
+	PM bool
+}
+
+// Reply sends a reply to the user. Commands received in private messages are answered privately,
+// while commands from the main chat are answered according to the bot config.
+func (c *Context) Reply(text string) error {
+	if c.PM {
+		return c.ReplyPM(text)
+	}
+	switch c.Bot.conf.Reply {
+	case ReplyPM:
+		return c.ReplyPM(text)
+	case ReplyChatTo:
+		return c.Hub.SendChatTo(c.User.Name, text)
+	}
+	return c.ReplyChat(text)
+}
+
+// Replyf is like Reply, but formats the text.
+func (c *Context) Replyf(format string, args ...interface{}) error {
+	return c.Reply(fmt.Sprintf(format, args...))
+}
+
+// ReplyChat sends the text to the main chat.
+func (c *Context) ReplyChat(text string) error {
+	return c.Hub.SendChat(text)
+}
+
+// ReplyPM sends the text in a private message to the user.
+func (c *Context) ReplyPM(text string) error {
+	return c.Hub.SendPM(c.User.Name, text)
+}
+
+// splitArgs splits the command arguments by spaces. Arguments can be quoted with '"'.
+// An unterminated quote extends to the end of the text.
+func splitArgs(s string) []string {
+	var (
+		args  []string
+		cur   strings.Builder
+		inArg bool
+		quote bool
+	)
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quote = !quote
+			inArg = true
+		case !quote && unicode.IsSpace(r):
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args
+}
+
+// limitKey identifies a user on a specific hub. Users with the same name on different hubs are limited separately.
+type limitKey struct {
+	hub  dc.Hub
+	name string
+}
+
+// allow checks the rate limit for the user on a given hub.
+func (b *Bot) allow(h dc.Hub, name string) bool {
+	if b.conf.Rate < 0 {
+		return true
+	}
+	now := b.now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := limitKey{hub: h, name: name}
+	l := b.limits[key]
+	if l == nil {
+		l = &bucket{tokens: float64(b.conf.Burst), last: now}
+		b.limits[key] = l
+	}
+	return l.take(now, b.conf.Rate, b.conf.Burst)
+}
+
+// bucket is a token bucket for rate limiting.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (l *bucket) take(now time.Time, rate time.Duration, burst int) bool {
+	l.tokens += float64(now.Sub(l.last)) / float64(rate)
+	if max := float64(burst); l.tokens > max {
+		l.tokens = max
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
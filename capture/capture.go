@@ -0,0 +1,267 @@
+// Package capture implements a file format for recording DC protocol traffic and a replayer for it.
+//
+// A capture is a text file that starts with a header line:
+//
+//	#dc-capture 1
+//
+// The header is followed by records, one per line:
+//
+//	<time> <dir> <kind> [<data>]
+//
+// Time is the offset from the start of the capture, in seconds with microsecond precision, for example 1.000250.
+// Dir is '<' for data received from the peer and '>' for data sent to the peer.
+// Kind is one of:
+//
+//	line   - a protocol line, including the delimiter
+//	zon    - the start of a zlib-compressed section, no data
+//	zoff   - the end of a zlib-compressed section, no data
+//	bbegin - the start of a binary section, for example a file transfer; "zlib" flag marks a compressed block
+//	bend   - the end of a binary section, no data
+//	bin    - binary data
+//
+// Data is a Go-quoted string in the connection encoding. Lines and binary data in compressed
+// sections and blocks are recorded after decompression, thus both directions are recorded the same way.
+// Empty lines and lines starting with '#' are ignored, so captures can be annotated and edited by hand,
+// for example to remove passwords.
+package capture
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Header is the first line of the capture file.
+	Header = "#dc-capture 1"
+	// Ext is a recommended file extension for captures.
+	Ext = ".dccap"
+)
+
+var errNoHeader = errors.New("capture: not a capture file")
+
+// Dir is a direction of the traffic.
+type Dir byte
+
+const (
+	// Recv is the data received from the peer.
+	Recv = Dir('<')
+	// Sent is the data sent to the peer.
+	Sent = Dir('>')
+)
+
+func (d Dir) String() string {
+	return string(d)
+}
+
+// Kind is a kind of the record.
+type Kind int
+
+const (
+	KindLine = Kind(iota)
+	KindZlibOn
+	KindZlibOff
+	KindBinary
+	KindBinaryBegin
+	KindBinaryEnd
+)
+
+var kindNames = []string{
+	KindLine:        "line",
+	KindZlibOn:      "zon",
+	KindZlibOff:     "zoff",
+	KindBinary:      "bin",
+	KindBinaryBegin: "bbegin",
+	KindBinaryEnd:   "bend",
+}
+
+// flagZlib marks a compressed binary section.
+const flagZlib = "zlib"
+
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return "Kind(" + strconv.Itoa(int(k)) + ")"
+	}
+	return kindNames[k]
+}
+
+// hasData reports if the record of this kind carries the data.
+func (k Kind) hasData() bool {
+	return k == KindLine || k == KindBinary
+}
+
+func parseKind(s string) (Kind, bool) {
+	for i, name := range kindNames {
+		if name == s {
+			return Kind(i), true
+		}
+	}
+	return 0, false
+}
+
+// Record is a single event in the capture.
+type Record struct {
+	// Time is the offset from the start of the capture.
+	Time time.Duration
+	Dir  Dir
+	Kind Kind
+	// Data is set for lines and binary data.
+	Data []byte
+	// Compressed is set for the start of a compressed binary section.
+	// The data of the section is recorded without the compression.
+	Compressed bool
+}
+
+// NewWriter creates a capture writer. The header is written with the first record.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Writer writes records in the capture format.
+type Writer struct {
+	w      *bufio.Writer
+	header bool
+	buf    []byte
+}
+
+// WriteRecord writes a single record. The writer is buffered, thus Flush must be called at the end.
+func (w *Writer) WriteRecord(r *Record) error {
+	if r.Dir != Recv && r.Dir != Sent {
+		return fmt.Errorf("capture: invalid direction: %q", r.Dir)
+	} else if r.Kind < 0 || int(r.Kind) >= len(kindNames) {
+		return fmt.Errorf("capture: invalid record kind: %v", r.Kind)
+	}
+	b := w.buf[:0]
+	if !w.header {
+		w.header = true
+		b = append(b, Header...)
+		b = append(b, '\n')
+	}
+	b = strconv.AppendFloat(b, r.Time.Seconds(), 'f', 6, 64)
+	b = append(b, ' ', byte(r.Dir), ' ')
+	b = append(b, r.Kind.String()...)
+	if r.Kind.hasData() {
+		b = append(b, ' ')
+		b = strconv.AppendQuote(b, string(r.Data))
+	} else if r.Kind == KindBinaryBegin && r.Compressed {
+		b = append(b, ' ')
+		b = append(b, flagZlib...)
+	}
+	b = append(b, '\n')
+	w.buf = b
+	_, err := w.w.Write(b)
+	return err
+}
+
+// Flush writes all buffered records.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// NewReader creates a capture reader.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Reader reads records in the capture format.
+type Reader struct {
+	r      *bufio.Reader
+	line   int
+	header bool
+}
+
+// ReadRecord reads a single record. It returns io.EOF at the end of the capture.
+func (r *Reader) ReadRecord() (*Record, error) {
+	for {
+		line, err := r.r.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		} else if err != nil {
+			if err == io.EOF && !r.header {
+				return nil, errNoHeader
+			}
+			return nil, err
+		}
+		r.line++
+		line = strings.TrimRight(line, "\r\n")
+		if !r.header {
+			if line != Header {
+				return nil, errNoHeader
+			}
+			r.header = true
+			continue
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		rec, err := parseRecord(line)
+		if err != nil {
+			return nil, fmt.Errorf("capture: line %d: %v", r.line, err)
+		}
+		return rec, nil
+	}
+}
+
+func parseRecord(line string) (*Record, error) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) < 3 {
+		return nil, errors.New("invalid record")
+	}
+	sec, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || sec < 0 {
+		return nil, fmt.Errorf("invalid time: %q", fields[0])
+	}
+	rec := &Record{Time: time.Duration(math.Round(sec*1e6)) * time.Microsecond}
+	if d := Dir(fields[1][0]); len(fields[1]) == 1 && (d == Recv || d == Sent) {
+		rec.Dir = d
+	} else {
+		return nil, fmt.Errorf("invalid direction: %q", fields[1])
+	}
+	kind, ok := parseKind(fields[2])
+	if !ok {
+		return nil, fmt.Errorf("invalid record kind: %q", fields[2])
+	}
+	rec.Kind = kind
+	if kind == KindBinaryBegin && len(fields) > 3 {
+		if fields[3] != flagZlib {
+			return nil, fmt.Errorf("invalid flag for %v record: %q", kind, fields[3])
+		}
+		rec.Compressed = true
+		return rec, nil
+	}
+	if !kind.hasData() {
+		if len(fields) > 3 {
+			return nil, fmt.Errorf("unexpected data for %v record", kind)
+		}
+		return rec, nil
+	}
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("no data for %v record", kind)
+	}
+	data, err := strconv.Unquote(fields[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid data: %v", err)
+	}
+	rec.Data = []byte(data)
+	return rec, nil
+}
+
+// ReadAll reads all records from the capture.
+func ReadAll(r io.Reader) ([]Record, error) {
+	cr := NewReader(r)
+	var out []Record
+	for {
+		rec, err := cr.ReadRecord()
+		if err == io.EOF {
+			return out, nil
+		} else if err != nil {
+			return out, err
+		}
+		out = append(out, *rec)
+	}
+}
@@ -0,0 +1,221 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dc/nmdc"
+)
+
+const testCapture = `#dc-capture 1
+0.000000 < line "$Lock _test Pk=test|"
+0.001500 > line "$Key \x01\x02|"
+# compressed section
+0.002000 < zon
+0.002000 < line "<hub> hi|"
+0.002000 < zoff
+
+1.250000 > bin "data\n"
+1.300000 < bbegin zlib
+1.300000 < bin "block"
+1.300000 < bend
+`
+
+var testRecords = []Record{
+	{Time: 0, Dir: Recv, Kind: KindLine, Data: []byte("$Lock _test Pk=test|")},
+	{Time: 1500 * time.Microsecond, Dir: Sent, Kind: KindLine, Data: []byte("$Key \x01\x02|")},
+	{Time: 2 * time.Millisecond, Dir: Recv, Kind: KindZlibOn},
+	{Time: 2 * time.Millisecond, Dir: Recv, Kind: KindLine, Data: []byte("<hub> hi|")},
+	{Time: 2 * time.Millisecond, Dir: Recv, Kind: KindZlibOff},
+	{Time: 1250 * time.Millisecond, Dir: Sent, Kind: KindBinary, Data: []byte("data\n")},
+	{Time: 1300 * time.Millisecond, Dir: Recv, Kind: KindBinaryBegin, Compressed: true},
+	{Time: 1300 * time.Millisecond, Dir: Recv, Kind: KindBinary, Data: []byte("block")},
+	{Time: 1300 * time.Millisecond, Dir: Recv, Kind: KindBinaryEnd},
+}
+
+func TestFormat(t *testing.T) {
+	recs, err := ReadAll(strings.NewReader(testCapture))
+	require.NoError(t, err)
+	require.Equal(t, testRecords, recs)
+
+	buf := bytes.NewBuffer(nil)
+	w := NewWriter(buf)
+	for i := range recs {
+		require.NoError(t, w.WriteRecord(&recs[i]))
+	}
+	require.NoError(t, w.Flush())
+	exp := strings.Replace(testCapture, "# compressed section\n", "", 1)
+	exp = strings.Replace(exp, "\n\n", "\n", 1)
+	require.Equal(t, exp, buf.String())
+}
+
+func TestFormatErrors(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		data string
+		err  string
+	}{
+		{name: "empty", data: "", err: errNoHeader.Error()},
+		{name: "no header", data: "0.0 < line \"|\"\n", err: errNoHeader.Error()},
+		{name: "time", data: Header + "\nx < line \"|\"\n", err: `capture: line 2: invalid time: "x"`},
+		{name: "dir", data: Header + "\n0 ? line \"|\"\n", err: `capture: line 2: invalid direction: "?"`},
+		{name: "kind", data: Header + "\n0 < text \"|\"\n", err: `capture: line 2: invalid record kind: "text"`},
+		{name: "no data", data: Header + "\n0 < line\n", err: `capture: line 2: no data for line record`},
+		{name: "extra data", data: Header + "\n0 < zon \"|\"\n", err: `capture: line 2: unexpected data for zon record`},
+		{name: "flag", data: Header + "\n0 < bbegin gzip\n", err: `capture: line 2: invalid flag for bbegin record: "gzip"`},
+		{name: "quote", data: Header + "\n0 < line |\n", err: `capture: line 2: invalid data: invalid syntax`},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ReadAll(strings.NewReader(c.data))
+			require.EqualError(t, err, c.err)
+		})
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	capture := bytes.NewBuffer(nil)
+	rec := NewRecorder(capture)
+
+	// record the sending side, and read the same stream back to record the receiving side
+	conn := bytes.NewBuffer(nil)
+	w := nmdc.NewWriter(conn)
+	rec.Writer(w.Writer)
+	require.NoError(t, w.WriteMsg(&nmdc.ChatMessage{Name: "bob", Text: "plain"}))
+	require.NoError(t, w.ZOn())
+	require.NoError(t, w.WriteMsg(&nmdc.ChatMessage{Name: "bob", Text: "compressed"}))
+	require.NoError(t, w.DisableZlib())
+	require.NoError(t, w.WriteMsg(&nmdc.Sending{Bytes: 6}))
+	require.NoError(t, w.WriteBlock(strings.NewReader("binary"), 6, false))
+	require.NoError(t, w.WriteMsg(&nmdc.Sending{Bytes: 5}))
+	require.NoError(t, w.WriteBlock(strings.NewReader("zdata"), 5, true))
+	require.NoError(t, w.WriteMsg(&nmdc.ChatMessage{Name: "bob", Text: "end"}))
+	require.NoError(t, w.Flush())
+
+	r := nmdc.NewReader(bytes.NewReader(conn.Bytes()))
+	rec.Reader(r.Reader)
+	expect := func(r *nmdc.Reader) {
+		var m nmdc.ChatMessage
+		require.NoError(t, r.ReadMsgTo(&m))
+		require.Equal(t, "plain", m.Text)
+		require.NoError(t, r.ReadMsgTo(&nmdc.ZOn{}))
+		require.NoError(t, r.EnableZlib())
+		require.NoError(t, r.ReadMsgTo(&m))
+		require.Equal(t, "compressed", m.Text)
+		for _, exp := range []struct {
+			data       string
+			compressed bool
+		}{
+			{"binary", false},
+			{"zdata", true},
+		} {
+			var s nmdc.Sending
+			require.NoError(t, r.ReadMsgTo(&s))
+			b, err := r.ReadBlock(uint64(s.Bytes), exp.compressed)
+			require.NoError(t, err)
+			data, err := ioutil.ReadAll(b)
+			require.NoError(t, err)
+			require.Equal(t, exp.data, string(data))
+			require.NoError(t, b.Close())
+		}
+		require.NoError(t, r.ReadMsgTo(&m))
+		require.Equal(t, "end", m.Text)
+	}
+	expect(r)
+	require.NoError(t, rec.Err())
+
+	recs, err := ReadAll(bytes.NewReader(capture.Bytes()))
+	require.NoError(t, err)
+	require.Len(t, recs, 28)
+	// both directions are recorded the same way
+	var kinds []Kind
+	for i := 0; i < 14; i++ {
+		s, r := recs[i], recs[i+14]
+		require.Equal(t, Sent, s.Dir)
+		require.Equal(t, Recv, r.Dir)
+		require.Equal(t, s.Kind, r.Kind)
+		require.Equal(t, s.Data, r.Data)
+		require.Equal(t, s.Compressed, r.Compressed)
+		kinds = append(kinds, s.Kind)
+	}
+	require.Equal(t, []Kind{
+		KindLine, KindLine, KindZlibOn, KindLine, KindZlibOff,
+		KindLine, KindBinaryBegin, KindBinary, KindBinaryEnd,
+		KindLine, KindBinaryBegin, KindBinary, KindBinaryEnd,
+		KindLine,
+	}, kinds)
+	require.False(t, recs[6].Compressed)
+	require.True(t, recs[10].Compressed)
+	require.Equal(t, "zdata", string(recs[11].Data))
+	require.Equal(t, "zdata", string(recs[11+14].Data))
+
+	p := &Player{Dir: Sent}
+	pr := p.Reader(NewReader(bytes.NewReader(capture.Bytes())))
+	defer pr.Close()
+	expect(nmdc.NewReader(pr))
+	_, err = pr.Read(make([]byte, 1))
+	require.Equal(t, io.EOF, err)
+
+	c := (&Player{Dir: Recv}).Conn(NewReader(bytes.NewReader(capture.Bytes())))
+	defer c.Close()
+	_, err = c.Write([]byte("ignored|"))
+	require.NoError(t, err)
+	expect(nmdc.NewReader(c))
+}
+
+func TestPlayCompressedBlock(t *testing.T) {
+	// recorded by the downloader side of GetZBlock
+	data := Header + "\n" +
+		"0 < line \"$Sending 5|\"\n" +
+		"0 < bbegin zlib\n" +
+		"0 < bin \"wor\"\n" +
+		"0 < bin \"ld\"\n" +
+		"0 < bend\n" +
+		"0 < line \"$Sending|\"\n"
+
+	buf := bytes.NewBuffer(nil)
+	p := &Player{Dir: Recv}
+	require.NoError(t, p.Play(context.Background(), buf, NewReader(strings.NewReader(data))))
+
+	// the block is compressed again, starting with a zlib header
+	require.Contains(t, buf.String(), "$Sending 5|\x78")
+	r := nmdc.NewReader(buf)
+	var m nmdc.Sending
+	require.NoError(t, r.ReadMsgTo(&m))
+	rc, err := r.ReadBlock(uint64(m.Bytes), true)
+	require.NoError(t, err)
+	got, err := ioutil.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, "world", string(got))
+	require.NoError(t, r.ReadMsgTo(&m))
+	require.Equal(t, int64(-1), m.Bytes)
+
+	err = p.Play(context.Background(), ioutil.Discard, NewReader(strings.NewReader(Header+"\n0 < bend\n")))
+	require.Error(t, err)
+}
+
+func TestPlayerSpeed(t *testing.T) {
+	data := Header + "\n" +
+		"0 < line \"a|\"\n" +
+		"0.200000 < line \"b|\"\n"
+
+	start := time.Now()
+	p := &Player{Dir: Recv, Speed: 2}
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, p.Play(context.Background(), buf, NewReader(strings.NewReader(data))))
+	require.Equal(t, "a|b|", buf.String())
+	require.True(t, time.Since(start) >= 100*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	p.Speed = 1
+	err := p.Play(ctx, ioutil.Discard, NewReader(strings.NewReader(data)))
+	require.Equal(t, context.DeadlineExceeded, err)
+}
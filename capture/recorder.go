@@ -0,0 +1,100 @@
+package capture
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dc/lineproto"
+)
+
+// NewRecorder creates a recorder that writes the capture to w. The capture starts immediately.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: NewWriter(w), start: time.Now()}
+}
+
+// Recorder records the traffic of a single connection. Records are flushed immediately, so the capture
+// is usable even if the process crashes. All methods are safe for concurrent use.
+//
+// Errors of the underlying writer don't affect the connection, they are reported by Err.
+type Recorder struct {
+	start time.Time
+
+	mu  sync.Mutex
+	w   *Writer
+	err error
+}
+
+// Record adds a record with a current timestamp.
+func (r *Recorder) Record(dir Dir, kind Kind, data []byte) {
+	r.record(&Record{Dir: dir, Kind: kind, Data: data})
+}
+
+func (r *Recorder) record(rec *Record) {
+	rec.Time = time.Since(r.start)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	r.err = r.w.WriteRecord(rec)
+	if r.err == nil {
+		r.err = r.w.Flush()
+	}
+}
+
+// Reader registers hooks on the protocol reader to record the received traffic.
+// It works with nmdc.Reader and adc.Reader as well.
+func (r *Recorder) Reader(lr *lineproto.Reader) {
+	lr.OnLine(func(line []byte) (bool, error) {
+		r.Record(Recv, KindLine, line)
+		return true, nil
+	})
+	lr.OnZlib(func(on bool) {
+		r.Record(Recv, zlibKind(on), nil)
+	})
+	lr.OnBinaryBegin(func(compressed bool) {
+		r.record(&Record{Dir: Recv, Kind: KindBinaryBegin, Compressed: compressed})
+	})
+	lr.OnBinary(func(data []byte) {
+		r.Record(Recv, KindBinary, data)
+	})
+	lr.OnBinaryEnd(func() {
+		r.Record(Recv, KindBinaryEnd, nil)
+	})
+}
+
+// Writer registers hooks on the protocol writer to record the sent traffic.
+// It works with nmdc.Writer and adc.Writer as well.
+func (r *Recorder) Writer(lw *lineproto.Writer) {
+	lw.OnLine(func(line []byte) (bool, error) {
+		r.Record(Sent, KindLine, line)
+		return true, nil
+	})
+	lw.OnZlib(func(on bool) {
+		r.Record(Sent, zlibKind(on), nil)
+	})
+	lw.OnBinaryBegin(func(compressed bool) {
+		r.record(&Record{Dir: Sent, Kind: KindBinaryBegin, Compressed: compressed})
+	})
+	lw.OnBinary(func(data []byte) {
+		r.Record(Sent, KindBinary, data)
+	})
+	lw.OnBinaryEnd(func() {
+		r.Record(Sent, KindBinaryEnd, nil)
+	})
+}
+
+// Err returns the first error encountered when writing the capture.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func zlibKind(on bool) Kind {
+	if on {
+		return KindZlibOn
+	}
+	return KindZlibOff
+}
@@ -0,0 +1,136 @@
+package capture
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/direct-connect/go-dc/lineproto"
+)
+
+// Player replays the traffic from the capture.
+type Player struct {
+	// Dir selects the records to replay. For example, Recv replays the traffic that the recording side
+	// received from its peer, thus the player acts as the peer.
+	Dir Dir
+	// Speed is a multiplier for the replay speed. 1 is the original speed, 2 is twice as fast.
+	// Zero or negative values replay the traffic without delays.
+	Speed float64
+}
+
+// Play writes the traffic from the capture to w, compressing zlib sections and compressed binary blocks again.
+func (p *Player) Play(ctx context.Context, w io.Writer, r *Reader) error {
+	lw := lineproto.NewWriter(w)
+	var (
+		timer *time.Timer
+		bin   io.WriteCloser // current binary section
+	)
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	start := time.Now()
+	for {
+		rec, err := r.ReadRecord()
+		if err == io.EOF {
+			return lw.Flush()
+		} else if err != nil {
+			return err
+		}
+		if rec.Dir != p.Dir {
+			continue
+		}
+		if p.Speed > 0 {
+			at := time.Duration(float64(rec.Time) / p.Speed)
+			if d := at - time.Since(start); d > 0 {
+				if err = lw.Flush(); err != nil {
+					return err
+				}
+				if timer == nil {
+					timer = time.NewTimer(d)
+				} else {
+					timer.Reset(d)
+				}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		switch rec.Kind {
+		case KindLine:
+			err = lw.WriteLine(rec.Data)
+		case KindZlibOn:
+			err = lw.EnableZlib()
+		case KindZlibOff:
+			err = lw.DisableZlib()
+		case KindBinaryBegin:
+			if bin != nil {
+				return errors.New("capture: nested binary section")
+			}
+			bin, err = lw.Binary(rec.Compressed)
+		case KindBinaryEnd:
+			if bin == nil {
+				return errors.New("capture: binary section is not started")
+			}
+			err, bin = bin.Close(), nil
+		case KindBinary:
+			if bin != nil {
+				_, err = bin.Write(rec.Data)
+			} else {
+				_, err = lw.Write(rec.Data)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Reader returns a stream with the replayed traffic that can be passed to nmdc.NewReader or adc.NewReader.
+// The stream ends with an error if the capture is invalid. The replay stops when the reader is closed.
+func (p *Player) Reader(r *Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		err := p.Play(ctx, pw, r)
+		_ = pw.CloseWithError(err)
+	}()
+	return &pipeReader{PipeReader: pr, cancel: cancel}
+}
+
+type pipeReader struct {
+	*io.PipeReader
+	cancel func()
+}
+
+func (r *pipeReader) Close() error {
+	r.cancel()
+	return r.PipeReader.Close()
+}
+
+// Conn returns a connection that replays the traffic from the capture. Data written to the connection
+// is discarded. The connection is closed by the player at the end of the capture.
+func (p *Player) Conn(r *Reader) net.Conn {
+	c1, c2 := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, c2)
+		cancel()
+	}()
+	go func() {
+		_ = p.Play(ctx, c2, r)
+		_ = c2.Close()
+	}()
+	return c1
+}
@@ -0,0 +1,184 @@
+// Command dc-dump connects to an ADC or NMDC hub and prints decoded protocol messages in both directions.
+//
+// Usage:
+//
+//	dc-dump [flags] address
+//
+// Received messages are marked with '<', sent messages are marked with '>'. Messages that cannot be
+// decoded are printed as raw lines. The traffic can be saved to a file with -capture
+// and replayed later with the capture package.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"time"
+
+	dc "github.com/direct-connect/go-dc"
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/capture"
+	"github.com/direct-connect/go-dc/lineproto"
+	"github.com/direct-connect/go-dc/nmdc"
+)
+
+var (
+	fName     = flag.String("name", "dc-dump", "user name")
+	fPass     = flag.String("pass", "", "user password")
+	fShare    = flag.Uint64("share", 0, "share size reported to the hub, in bytes")
+	fSlots    = flag.Int("slots", 1, "number of slots reported to the hub")
+	fTimeout  = flag.Duration("timeout", 30*time.Second, "connection timeout")
+	fDuration = flag.Duration("duration", 0, "disconnect after a given time; zero means until interrupted")
+	fRaw      = flag.Bool("raw", false, "print raw lines instead of decoded messages")
+	fCapture  = flag.String("capture", "", "save the traffic to a capture file")
+	fInsecure = flag.Bool("insecure", false, "don't verify the TLS certificate of a hub without a keyprint")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: dc-dump [flags] address")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0)); err != nil {
+		fmt.Fprintln(os.Stderr, "dc-dump:", err)
+		os.Exit(1)
+	}
+}
+
+func run(addr string) error {
+	a, err := dc.ParseAddress(addr)
+	if err != nil {
+		return err
+	}
+	d := &dumper{w: os.Stdout, adc: a.Proto == dc.ProtoADC}
+	var rec *capture.Recorder
+	if *fCapture != "" {
+		f, err := os.Create(*fCapture)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		rec = capture.NewRecorder(f)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *fTimeout)
+	defer cancel()
+	h, err := dc.Dial(ctx, addr, &dc.Options{
+		Name:     *fName,
+		Password: *fPass,
+		Share:    *fShare,
+		Slots:    *fSlots,
+		TLS:      tlsConfig(),
+		Trace: func(r *lineproto.Reader, w *lineproto.Writer) {
+			if rec != nil {
+				rec.Reader(r)
+				rec.Writer(w)
+			}
+			r.OnLine(d.hook(capture.Recv))
+			w.OnLine(d.hook(capture.Sent))
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	var timeout <-chan time.Time
+	if *fDuration > 0 {
+		timeout = time.After(*fDuration)
+	}
+	select {
+	case <-h.Done():
+	case <-sig:
+	case <-timeout:
+	}
+	if rec != nil {
+		return rec.Err()
+	}
+	return nil
+}
+
+// dumper prints protocol lines. It's safe for concurrent use.
+type dumper struct {
+	adc bool
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (d *dumper) hook(dir capture.Dir) func(line []byte) (bool, error) {
+	return func(line []byte) (bool, error) {
+		d.print(dir, line)
+		return true, nil
+	}
+}
+
+func (d *dumper) print(dir capture.Dir, line []byte) {
+	var text string
+	if *fRaw {
+		text = strconv.Quote(string(line))
+	} else if d.adc {
+		text = formatADC(line)
+	} else {
+		text = formatNMDC(line)
+	}
+	if text == "" {
+		return // keep-alive
+	}
+	ts := time.Now().Format("15:04:05.000")
+	d.mu.Lock()
+	fmt.Fprintf(d.w, "%s %s %s\n", ts, dir, text)
+	d.mu.Unlock()
+}
+
+func formatNMDC(line []byte) string {
+	if bytes.Equal(line, []byte("|")) {
+		return ""
+	}
+	m, err := nmdc.Unmarshal(nil, line)
+	if err != nil {
+		return fmt.Sprintf("%q (%v)", line, err)
+	}
+	return fmt.Sprintf("$%s %+v", m.Type(), m)
+}
+
+func formatADC(line []byte) string {
+	if bytes.Equal(line, []byte("\n")) {
+		return ""
+	}
+	p, err := adc.DecodePacket(line)
+	if err != nil {
+		return fmt.Sprintf("%q (%v)", line, err)
+	}
+	m := p.Message()
+	route := ""
+	if pp, ok := p.(adc.PeerPacket); ok {
+		route = " " + pp.Source().String()
+	}
+	if tp, ok := p.(adc.TargetPacket); ok {
+		route += " -> " + tp.Target().String()
+	}
+	return fmt.Sprintf("%c%s%s %+v", p.Kind(), m.Cmd(), route, m)
+}
+
+// tlsConfig returns a TLS config for secure hubs, according to the flags.
+func tlsConfig() *tls.Config {
+	if *fInsecure {
+		return &tls.Config{InsecureSkipVerify: true}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/direct-connect/go-dc/filelist"
+)
+
+// ChangeType is the type of a change between two file lists.
+type ChangeType byte
+
+const (
+	Added    = ChangeType('+')
+	Removed  = ChangeType('-')
+	Modified = ChangeType('~')
+)
+
+// Change is a single difference between two file lists.
+type Change struct {
+	Type ChangeType
+	// Path of the file, with '/' separators.
+	Path string
+	// Old and New are set for removed and added files respectively, and both are set for modified files.
+	Old, New *filelist.File
+}
+
+func (c Change) String() string {
+	switch c.Type {
+	case Added:
+		return fmt.Sprintf("+ %s\t%d\t%s", c.Path, c.New.Size, c.New.TTH.Base32())
+	case Removed:
+		return fmt.Sprintf("- %s\t%d\t%s", c.Path, c.Old.Size, c.Old.TTH.Base32())
+	}
+	return fmt.Sprintf("~ %s\t%d -> %d\t%s -> %s", c.Path, c.Old.Size, c.New.Size, c.Old.TTH.Base32(), c.New.TTH.Base32())
+}
+
+// flatten returns all files from the list, indexed by the path.
+func flatten(l *filelist.FileListing) map[string]*filelist.File {
+	out := make(map[string]*filelist.File)
+	var walk func(dir string, dirs []filelist.Directory, files []filelist.File)
+	walk = func(dir string, dirs []filelist.Directory, files []filelist.File) {
+		for i := range files {
+			out[path.Join(dir, files[i].Name)] = &files[i]
+		}
+		for _, d := range dirs {
+			walk(path.Join(dir, d.Name), d.Dirs, d.Files)
+		}
+	}
+	walk("", l.Dirs, l.Files)
+	return out
+}
+
+// diff compares files in two lists. Only the size and the TTH are compared. Changes are sorted by path.
+func diff(a, b *filelist.FileListing) []Change {
+	fa, fb := flatten(a), flatten(b)
+	var out []Change
+	for p, f := range fa {
+		nf, ok := fb[p]
+		if !ok {
+			out = append(out, Change{Type: Removed, Path: p, Old: f})
+		} else if nf.Size != f.Size || nf.TTH != f.TTH {
+			out = append(out, Change{Type: Modified, Path: p, Old: f, New: nf})
+		}
+	}
+	for p, f := range fb {
+		if _, ok := fa[p]; !ok {
+			out = append(out, Change{Type: Added, Path: p, New: f})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
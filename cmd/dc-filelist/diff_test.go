@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dc/filelist"
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+func TestDiff(t *testing.T) {
+	tth1, tth2 := tiger.HashBytes([]byte("1")), tiger.HashBytes([]byte("2"))
+	a := &filelist.FileListing{
+		Files: []filelist.File{{Name: "root.txt", Size: 1, TTH: tth1}},
+		Dirs: []filelist.Directory{{
+			Name: "dir",
+			Files: []filelist.File{
+				{Name: "same.txt", Size: 1, TTH: tth1},
+				{Name: "changed.txt", Size: 1, TTH: tth1},
+			},
+		}},
+	}
+	b := &filelist.FileListing{
+		Dirs: []filelist.Directory{{
+			Name: "dir",
+			Files: []filelist.File{
+				{Name: "same.txt", Size: 1, TTH: tth1},
+				{Name: "changed.txt", Size: 2, TTH: tth2},
+			},
+			Dirs: []filelist.Directory{{
+				Name:  "sub",
+				Files: []filelist.File{{Name: "new.txt", Size: 2, TTH: tth2}},
+			}},
+		}},
+	}
+	changes := diff(a, b)
+	var got []string
+	for _, c := range changes {
+		got = append(got, string(c.Type)+" "+c.Path)
+	}
+	require.Equal(t, []string{
+		"~ dir/changed.txt",
+		"+ dir/sub/new.txt",
+		"- root.txt",
+	}, got)
+	require.Empty(t, diff(a, a))
+}
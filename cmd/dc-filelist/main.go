@@ -0,0 +1,179 @@
+// Command dc-filelist decodes, converts and compares DC file lists (files.xml and files.xml.bz2).
+//
+// Usage:
+//
+//	dc-filelist print [-json] list
+//	dc-filelist convert [-bz2] input output
+//	dc-filelist diff old new
+//
+// Compressed lists are detected automatically. A "-" reads the list from stdin or writes it to stdout.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/direct-connect/go-dc/filelist"
+)
+
+const usage = `usage:
+	dc-filelist print [-json] list
+	dc-filelist convert [-bz2] input output
+	dc-filelist diff old new
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "print":
+		err = cmdPrint(args)
+	case "convert":
+		err = cmdConvert(args)
+	case "diff":
+		var changed bool
+		changed, err = cmdDiff(args)
+		if err == nil && changed {
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "dc-filelist:", err)
+		os.Exit(1)
+	}
+}
+
+// parseArgs parses subcommand flags and checks the number of positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string, n int) []string {
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != n {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return fs.Args()
+}
+
+func decodeFile(path string) (*filelist.FileListing, error) {
+	if path == "-" {
+		return filelist.Decode(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	l, err := filelist.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return l, nil
+}
+
+func cmdPrint(args []string) error {
+	fs := flag.NewFlagSet("print", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the list as JSON")
+	args = parseArgs(fs, args, 1)
+
+	l, err := decodeFile(args[0])
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(l)
+	}
+	w := bufio.NewWriter(os.Stdout)
+	fmt.Fprintf(w, "CID: %s\nBase: %s\nGenerator: %s\n", l.CID, l.Base, l.Generator)
+	printContent(w, 0, l.Dirs, l.Files)
+	return w.Flush()
+}
+
+func printContent(w io.Writer, depth int, dirs []filelist.Directory, files []filelist.File) {
+	indent := strings.Repeat("  ", depth)
+	for _, d := range dirs {
+		if d.Incomplete {
+			fmt.Fprintf(w, "%s%s/ (incomplete)\n", indent, d.Name)
+		} else {
+			fmt.Fprintf(w, "%s%s/\n", indent, d.Name)
+		}
+		printContent(w, depth+1, d.Dirs, d.Files)
+	}
+	for _, f := range files {
+		fmt.Fprintf(w, "%s%s\t%d\t%s\n", indent, f.Name, f.Size, f.TTH.Base32())
+	}
+}
+
+func cmdConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	bz2 := fs.Bool("bz2", false, "compress the output; the default is based on the output file extension")
+	args = parseArgs(fs, args, 2)
+
+	l, err := decodeFile(args[0])
+	if err != nil {
+		return err
+	}
+	out := args[1]
+	compress := *bz2 || strings.HasSuffix(out, ".bz2")
+	if out == "-" {
+		return writeList(os.Stdout, l, compress)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err = writeList(f, l, compress); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeList(w io.Writer, l *filelist.FileListing, compress bool) error {
+	bw := bufio.NewWriter(w)
+	var err error
+	if compress {
+		err = filelist.EncodeBZip2(bw, l)
+	} else {
+		err = filelist.Encode(bw, l)
+	}
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func cmdDiff(args []string) (bool, error) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	args = parseArgs(fs, args, 2)
+
+	a, err := decodeFile(args[0])
+	if err != nil {
+		return false, err
+	}
+	b, err := decodeFile(args[1])
+	if err != nil {
+		return false, err
+	}
+	changes := diff(a, b)
+	w := bufio.NewWriter(os.Stdout)
+	for _, c := range changes {
+		fmt.Fprintln(w, c.String())
+	}
+	return len(changes) != 0, w.Flush()
+}
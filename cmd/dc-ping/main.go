@@ -0,0 +1,179 @@
+// Command dc-ping pings ADC and NMDC hubs and prints the hub information as JSON.
+//
+// Usage:
+//
+//	dc-ping [flags] address...
+//
+// Addresses without a scheme are assumed to be NMDC. Hubs are pinged concurrently,
+// and the results are printed in the order of the arguments.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	dc "github.com/direct-connect/go-dc"
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/hublist"
+	"github.com/direct-connect/go-dc/nmdc"
+)
+
+var (
+	fName    = flag.String("name", "", "name of the pinger")
+	fPass    = flag.String("pass", "", "password of the pinger")
+	fShare   = flag.Uint64("share", 0, "share size reported to the hub, in bytes")
+	fSlots   = flag.Int("slots", 0, "number of slots reported to the hub")
+	fIdle    = flag.Duration("idle", 2*time.Second, "time to wait for new messages after the login")
+	fTimeout = flag.Duration("timeout", 15*time.Second, "timeout for each hub")
+	fUsers   = flag.Bool("users", false, "include the user list")
+	fCompact = flag.Bool("compact", false, "print one JSON object per line")
+	fInsec   = flag.Bool("insecure", false, "don't verify TLS certificates of hubs without a keyprint")
+)
+
+// Result is the information about a single hub.
+type Result struct {
+	Addr     string       `json:"addr"`
+	Proto    string       `json:"proto"`
+	Hub      *hublist.Hub `json:"hub,omitempty"`
+	Users    int          `json:"users"`
+	Share    uint64       `json:"share"`
+	UserList []string     `json:"user_list,omitempty"`
+	Redirect string       `json:"redirect,omitempty"`
+	Duration float64      `json:"duration"` // seconds
+	Error    string       `json:"error,omitempty"`
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: dc-ping [flags] address...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	addrs := flag.Args()
+	results := make([]Result, len(addrs))
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			results[i] = ping(addr)
+		}(i, addr)
+	}
+	wg.Wait()
+
+	enc := json.NewEncoder(os.Stdout)
+	if !*fCompact {
+		enc.SetIndent("", "  ")
+	}
+	failed := false
+	for _, r := range results {
+		if r.Error != "" {
+			failed = true
+		}
+		if err := enc.Encode(r); err != nil {
+			fmt.Fprintln(os.Stderr, "dc-ping:", err)
+			os.Exit(1)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func ping(addr string) Result {
+	ctx, cancel := context.WithTimeout(context.Background(), *fTimeout)
+	defer cancel()
+	start := time.Now()
+	var r Result
+	a, err := dc.ParseAddress(addr)
+	if err == nil && a.Proto == dc.ProtoADC {
+		r, err = pingADC(ctx, a.Normalize().String())
+	} else if err == nil {
+		r, err = pingNMDC(ctx, a.Normalize().String())
+	}
+	r.Addr = addr
+	r.Duration = time.Since(start).Seconds()
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+func pingADC(ctx context.Context, addr string) (Result, error) {
+	r := Result{Proto: "adc"}
+	info, err := adc.Ping(ctx, addr, &adc.PingConfig{
+		Name: *fName, Password: *fPass, Share: *fShare, Slots: *fSlots, Idle: *fIdle,
+		TLS: tlsConfig(),
+	})
+	if err != nil {
+		return r, err
+	}
+	r.Redirect = info.Redirect
+	if info.HubInfo.Name != "" {
+		h := hublist.FromADC(&info.HubInfo)
+		r.Hub = &h
+	}
+	r.Users, r.Share = len(info.Users), info.ShareSize()
+	if *fUsers {
+		for _, u := range info.Users {
+			r.UserList = append(r.UserList, u.Name)
+		}
+	}
+	return r, nil
+}
+
+func pingNMDC(ctx context.Context, addr string) (Result, error) {
+	r := Result{Proto: "nmdc"}
+	info, err := nmdc.Ping(ctx, addr, &nmdc.PingConfig{
+		Name: *fName, Password: *fPass, Share: *fShare, Slots: *fSlots, Idle: *fIdle,
+		TLS: tlsConfig(),
+	})
+	if err != nil {
+		return r, err
+	}
+	r.Redirect = info.Redirect
+	var h hublist.Hub
+	if info.HubINFO != nil {
+		h = hublist.FromNMDC(info.HubINFO)
+	}
+	if h.Name == "" {
+		h.Name = info.Name
+	}
+	if h.Description == "" {
+		h.Description = info.Topic
+	}
+	if h.Software == "" {
+		h.Software = info.Lock.PK
+	}
+	if h.Name != "" {
+		r.Hub = &h
+	}
+	r.Users, r.Share = len(info.Users), info.ShareSize()
+	if r.Hub != nil {
+		r.Hub.Users, r.Hub.Shared = r.Users, r.Share
+	}
+	if *fUsers {
+		for _, u := range info.Users {
+			r.UserList = append(r.UserList, u.Name)
+		}
+	}
+	return r, nil
+}
+
+// tlsConfig returns a TLS config for secure hubs, according to the flags.
+func tlsConfig() *tls.Config {
+	if *fInsec {
+		return &tls.Config{InsecureSkipVerify: true}
+	}
+	return nil
+}
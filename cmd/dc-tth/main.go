@@ -0,0 +1,110 @@
+// Command dc-tth computes Tiger Tree Hashes (TTH) of files, as used by DC clients.
+//
+// Usage:
+//
+//	dc-tth [-magnet] [-r] file...
+//
+// For each file it prints the TTH and the path, or a magnet link if -magnet is set.
+// Directories are hashed recursively if -r is set. A single "-" reads the data from stdin.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/direct-connect/go-dc/magnet"
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+var (
+	fMagnet    = flag.Bool("magnet", false, "print magnet links instead of hashes")
+	fRecursive = flag.Bool("r", false, "hash directories recursively")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: dc-tth [-magnet] [-r] file...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	failed := false
+	for _, path := range flag.Args() {
+		if err := hashPath(path); err != nil {
+			fmt.Fprintln(os.Stderr, "dc-tth:", err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func hashPath(path string) error {
+	if path == "-" {
+		return hashReader(os.Stdin, "-")
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return hashFile(path)
+	} else if !*fRecursive {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	return filepath.Walk(path, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		return hashFile(path)
+	})
+}
+
+func hashFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return hashReader(f, path)
+}
+
+// countReader counts the number of bytes read.
+type countReader struct {
+	r io.Reader
+	n uint64
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += uint64(n)
+	return n, err
+}
+
+func hashReader(r io.Reader, path string) error {
+	cr := &countReader{r: r}
+	tth, err := tiger.TreeHash(cr)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if !*fMagnet {
+		fmt.Printf("%s  %s\n", tth.Base32(), path)
+		return nil
+	}
+	m := &magnet.Magnet{TTH: &tth, Size: cr.n}
+	if path != "-" {
+		m.Name = filepath.Base(path)
+	}
+	fmt.Println(m.String())
+	return nil
+}
@@ -0,0 +1,239 @@
+package dctest
+
+import (
+	"bytes"
+	"crypto/rand"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+// ADC status codes used by the hub.
+const (
+	codeLoginError  = 20
+	codeNickInvalid = 21
+	codeNickTaken   = 22
+	codeInvalidPass = 23
+	codeProtocolErr = 40
+)
+
+// readADC reads a single packet. The message is not decoded.
+func (s *session) readADC() (adc.Packet, error) {
+	return s.ar.ReadPacketRaw()
+}
+
+// recordADC decodes the packet message and records it. Packets that cannot be decoded are not recorded.
+func (s *session) recordADC(name string, p adc.Packet) {
+	if p.DecodeMessage() != nil {
+		return
+	}
+	s.h.record(Event{From: name, ADC: p})
+}
+
+func (s *session) status(code int, msg string) {
+	s.sendADC(&adc.InfoPacket{Msg: adc.Status{Sev: adc.Fatal, Code: code, Msg: msg}})
+	s.kick("")
+}
+
+// serveADC runs the ADC session. It returns the user if the login was successful.
+func (s *session) serveADC() *user {
+	h := s.h
+	for {
+		p, err := s.readADC()
+		if err != nil {
+			return nil
+		}
+		s.recordADC("", p)
+		if _, ok := p.(*adc.HubPacket); ok && p.Message().Cmd() == (adc.Supported{}).Cmd() {
+			break
+		}
+	}
+	h.mu.Lock()
+	sid := h.nextSID()
+	h.mu.Unlock()
+	s.sid = sid
+	s.sendADC(
+		&adc.InfoPacket{Msg: adc.Supported{Features: adc.ModFeatures{adc.FeaBASE: true, adc.FeaTIGR: true}}},
+		&adc.InfoPacket{Msg: adc.SIDAssign{SID: sid}},
+	)
+	var info adc.UserInfo
+	for {
+		p, err := s.readADC()
+		if err != nil {
+			return nil
+		}
+		if b, ok := p.(*adc.BroadcastPacket); ok && b.ID == sid && p.Message().Cmd() == (adc.UserInfo{}).Cmd() {
+			if err = p.DecodeMessageTo(&info); err != nil {
+				s.status(codeProtocolErr, err.Error())
+				return nil
+			}
+			s.recordADC("", p)
+			break
+		}
+		s.recordADC("", p)
+	}
+	name := info.Name
+	h.mu.Lock()
+	err := h.checkName(name)
+	h.mu.Unlock()
+	switch {
+	case err == errUserExists:
+		s.status(codeNickTaken, err.Error())
+		return nil
+	case err != nil && name == "":
+		s.status(codeNickInvalid, err.Error())
+		return nil
+	case err != nil:
+		s.status(codeLoginError, err.Error())
+		return nil
+	}
+	acc, registered := h.account(name)
+	if registered {
+		salt := make([]byte, 24)
+		if _, err := rand.Read(salt); err != nil {
+			return nil
+		}
+		s.sendADC(&adc.InfoPacket{Msg: adc.GetPassword{Salt: salt}})
+		var pass adc.Password
+		for {
+			p, err := s.readADC()
+			if err != nil {
+				return nil
+			}
+			s.recordADC(name, p)
+			if m, ok := p.Message().(adc.Password); ok {
+				pass = m
+				break
+			}
+		}
+		exp := tiger.HashBytes(append([]byte(acc.Password), salt...))
+		if !bytes.Equal(pass.Hash[:], exp[:]) {
+			s.status(codeInvalidPass, "invalid password")
+			return nil
+		}
+	}
+	s.sendADC(&adc.InfoPacket{Msg: adc.HubInfo{
+		Name: h.conf.Name, Version: "dctest", Application: "dctest", Desc: h.conf.Topic, Type: adc.UserTypeHub,
+	}})
+	u := &user{name: name, sid: sid, op: acc.Op, inf: &info, s: s}
+
+	h.mu.Lock()
+	if h.users[name] != nil {
+		h.mu.Unlock()
+		s.status(codeNickTaken, errUserExists.Error())
+		return nil
+	}
+	h.setUserInfo(u)
+	for _, o := range h.users {
+		s.sendADC(&adc.BroadcastPacket{ID: o.sid, Msg: *o.inf})
+	}
+	// the user info of the user itself is sent last
+	h.join(u)
+	h.mu.Unlock()
+
+	for {
+		p, err := s.readADC()
+		if err != nil {
+			return u
+		}
+		h.mu.Lock()
+		s.handleADC(u, p)
+		h.mu.Unlock()
+	}
+}
+
+// handleADC routes a packet from the user. It must be called with the hub lock held.
+func (s *session) handleADC(u *user, p adc.Packet) {
+	h := s.h
+	if b, ok := p.(*adc.BroadcastPacket); ok && b.ID == u.sid && b.Msg.Cmd() == (adc.UserInfo{}).Cmd() {
+		// user info updates are incremental
+		nu := *u.inf
+		if p.DecodeMessageTo(&nu) == nil {
+			u.inf = &nu
+			h.setUserInfo(u)
+			h.broadcastInfo(u)
+		}
+	}
+	if p.DecodeMessage() != nil {
+		return
+	}
+	h.recordLocked(Event{From: u.name, ADC: p})
+	if h.users[u.name] != u {
+		return // kicked
+	}
+	switch p := p.(type) {
+	case *adc.BroadcastPacket:
+		if p.ID != u.sid {
+			return
+		}
+		h.handleBroadcast(u, p.Msg)
+	case *adc.FeaturePacket:
+		if p.ID != u.sid {
+			return
+		}
+		h.handleBroadcast(u, p.Msg)
+	case *adc.DirectPacket:
+		if p.ID != u.sid {
+			return
+		}
+		h.handleDirect(u, p.To, p.Msg, false)
+	case *adc.EchoPacket:
+		if p.ID != u.sid {
+			return
+		}
+		h.handleDirect(u, p.To, p.Msg, true)
+	}
+}
+
+// handleBroadcast routes a broadcast message from an ADC user. It must be called with the lock held.
+func (h *Hub) handleBroadcast(u *user, m adc.Message) {
+	switch m := m.(type) {
+	case adc.ChatMessage:
+		h.broadcastChat(u, m)
+	case adc.SearchRequest:
+		h.broadcastSearch(u, &m, nil)
+	}
+}
+
+// handleDirect routes a direct message from an ADC user. It must be called with the lock held.
+func (h *Hub) handleDirect(u *user, to adc.SID, m adc.Message, echo bool) {
+	dst := h.bySID[to]
+	if dst == nil {
+		return
+	}
+	switch m := m.(type) {
+	case adc.ChatMessage:
+		if echo {
+			u.s.sendADC(&adc.EchoPacket{ID: u.sid, To: to, Msg: m})
+		}
+		if m.PM != nil {
+			h.sendPM(u, dst, m)
+			return
+		}
+		if dst.s == nil {
+			return
+		}
+		if dst.isADC() {
+			dst.s.sendADC(&adc.DirectPacket{ID: u.sid, To: to, Msg: m})
+			return
+		}
+		cm, _ := h.tr.ChatToNMDC(&m)
+		cm.Name = u.name
+		dst.s.sendNMDC(&cm)
+	case adc.SearchResult:
+		if dst.s == nil {
+			return
+		}
+		if dst.isADC() {
+			dst.s.sendADC(&adc.DirectPacket{ID: u.sid, To: to, Msg: m})
+			return
+		}
+		sr, _ := h.tr.SRToNMDC(&m)
+		sr.From, sr.HubName, sr.HubAddress = u.name, h.conf.Name, h.l.Addr().String()
+		dst.s.sendNMDC(&sr)
+	case adc.ConnectRequest, adc.RevConnectRequest:
+		if dst.isADC() {
+			dst.s.sendADC(&adc.DirectPacket{ID: u.sid, To: to, Msg: m})
+		}
+	}
+}
@@ -0,0 +1,589 @@
+// Package dctest implements an in-process ADC and NMDC hub for integration testing.
+//
+// The hub listens on a loopback address and accepts both protocols on a single port. Users of different
+// protocols see each other: user info, chat, private messages and searches are translated between them.
+// Connection requests and search results are only forwarded between users of the same protocol.
+//
+// The hub is scriptable: it can deny logins, require passwords, inject chat messages and searches
+// from virtual users, kick users, delay or corrupt the traffic sent to a user. All messages received
+// by the hub are recorded and can be inspected with Events, Wait and Expect.
+package dctest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dc "github.com/direct-connect/go-dc"
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/adc/types"
+	"github.com/direct-connect/go-dc/nmdc"
+	"github.com/direct-connect/go-dc/tiger"
+	"github.com/direct-connect/go-dc/translate"
+)
+
+const (
+	// DefaultName is the hub name used if none is set in the config.
+	DefaultName = "dctest"
+	// DefaultTimeout is the default timeout for Expect.
+	DefaultTimeout = 2 * time.Second
+
+	// queueSize is the number of outgoing messages buffered for each user.
+	queueSize = 1024
+	// detectTimeout is the time to wait for the ADC handshake before assuming NMDC.
+	// The hub only listens on loopback, so it can be much lower than the default.
+	detectTimeout = 100 * time.Millisecond
+)
+
+var (
+	// ErrTimeout is returned by Wait if no matching event was received.
+	ErrTimeout = errors.New("dctest: timeout")
+	// ErrNoUser is returned if the user is not on the hub.
+	ErrNoUser = errors.New("dctest: no such user")
+
+	errUserExists = errors.New("dctest: user already exists")
+)
+
+// Account is a registered user.
+type Account struct {
+	Password string
+	Op       bool
+}
+
+// Config is an optional configuration for the hub.
+type Config struct {
+	// Name of the hub. DefaultName is used if not set.
+	Name  string
+	Topic string
+	// Accounts of registered users. Users with these names must provide a password.
+	Accounts map[string]Account
+	// Deny is called for each login. If it returns an error, the login is rejected with the error text.
+	Deny func(name string) error
+	// Timeout for Expect. DefaultTimeout is used if not set.
+	Timeout time.Duration
+}
+
+// Event is a message received by the hub.
+type Event struct {
+	// From is the name of the user, or an empty string if the user is not logged in yet.
+	From string
+	// NMDC is set for messages received from NMDC users.
+	NMDC nmdc.Message
+	// ADC is set for packets received from ADC users. The message in the packet is decoded.
+	ADC adc.Packet
+}
+
+func (e Event) String() string {
+	if e.ADC != nil {
+		return fmt.Sprintf("%s: %s %#v", e.From, e.ADC.Message().Cmd(), e.ADC.Message())
+	}
+	return fmt.Sprintf("%s: %s %#v", e.From, e.NMDC.Type(), e.NMDC)
+}
+
+// Matcher selects events.
+type Matcher func(e Event) bool
+
+// From matches events sent by a given user.
+func From(name string) Matcher {
+	return func(e Event) bool {
+		return e.From == name
+	}
+}
+
+// NMDCType matches NMDC messages of a given type, for example "Search".
+func NMDCType(typ string) Matcher {
+	return func(e Event) bool {
+		return e.NMDC != nil && e.NMDC.Type() == typ
+	}
+}
+
+// ADCCmd matches ADC packets with a given command, for example "SCH".
+func ADCCmd(cmd string) Matcher {
+	return func(e Event) bool {
+		return e.ADC != nil && e.ADC.Message().Cmd().String() == cmd
+	}
+}
+
+// All matches events that match all of the matchers.
+func All(arr ...Matcher) Matcher {
+	return func(e Event) bool {
+		for _, m := range arr {
+			if !m(e) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// NewHub starts a new hub on a loopback address. The hub must be closed after the test.
+func NewHub(conf *Config) (*Hub, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	dl := dc.NewListener(l, nil)
+	dl.Timeout = detectTimeout
+	h := &Hub{
+		l:        dl,
+		sessions: make(map[*session]struct{}),
+		users:    make(map[string]*user),
+		bySID:    make(map[adc.SID]*user),
+		changed:  make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	if conf != nil {
+		h.conf = *conf
+	}
+	if h.conf.Name == "" {
+		h.conf.Name = DefaultName
+	}
+	if h.conf.Timeout <= 0 {
+		h.conf.Timeout = DefaultTimeout
+	}
+	h.wg.Add(1)
+	go h.serve()
+	return h, nil
+}
+
+// Hub is a fake ADC and NMDC hub. All methods are safe for concurrent use.
+type Hub struct {
+	conf Config
+	l    *dc.Listener
+	tr   translate.Translator
+
+	mu       sync.Mutex
+	sessions map[*session]struct{}
+	users    map[string]*user
+	bySID    map[adc.SID]*user
+	lastSID  uint32
+	events   []Event
+	changed  chan struct{} // closed and replaced on each event
+
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// user is a user on the hub. Virtual users have no session.
+type user struct {
+	name string
+	sid  adc.SID
+	op   bool
+	bot  bool
+	// user info in both protocols
+	myINFO *nmdc.MyINFO
+	inf    *adc.UserInfo
+
+	s *session
+}
+
+// isADC reports if the user is connected with ADC.
+func (u *user) isADC() bool {
+	return u.s != nil && u.s.adc
+}
+
+// ADCAddr returns the address of the hub for ADC clients.
+func (h *Hub) ADCAddr() string {
+	return adc.SchemaADC + "://" + h.l.Addr().String()
+}
+
+// NMDCAddr returns the address of the hub for NMDC clients.
+func (h *Hub) NMDCAddr() string {
+	return nmdc.SchemeNMDC + "://" + h.l.Addr().String()
+}
+
+// Close stops the hub and disconnects all users.
+func (h *Hub) Close() error {
+	var err error
+	h.closeOnce.Do(func() {
+		close(h.closed)
+		err = h.l.Close()
+		h.mu.Lock()
+		for s := range h.sessions {
+			s.close()
+		}
+		h.mu.Unlock()
+		h.wg.Wait()
+	})
+	return err
+}
+
+func (h *Hub) serve() {
+	defer h.wg.Done()
+	for {
+		c, err := h.l.AcceptConn()
+		if err != nil {
+			return
+		}
+		s := newSession(h, c)
+		h.mu.Lock()
+		h.sessions[s] = struct{}{}
+		select {
+		case <-h.closed:
+			s.close()
+		default:
+		}
+		h.mu.Unlock()
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			s.serve()
+			h.mu.Lock()
+			delete(h.sessions, s)
+			h.mu.Unlock()
+		}()
+	}
+}
+
+// record adds the event to the log.
+func (h *Hub) record(e Event) {
+	h.mu.Lock()
+	h.recordLocked(e)
+	h.mu.Unlock()
+}
+
+// recordLocked is like record, but must be called with the lock held.
+func (h *Hub) recordLocked(e Event) {
+	h.events = append(h.events, e)
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// Events returns all events received by the hub.
+func (h *Hub) Events() []Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Event(nil), h.events...)
+}
+
+// Count returns the number of events that match.
+func (h *Hub) Count(m Matcher) int {
+	n := 0
+	for _, e := range h.Events() {
+		if m(e) {
+			n++
+		}
+	}
+	return n
+}
+
+// Wait waits for the first event that matches, including events that were already received.
+func (h *Hub) Wait(timeout time.Duration, m Matcher) (Event, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	i := 0
+	for {
+		h.mu.Lock()
+		events, changed := h.events[i:], h.changed
+		i = len(h.events)
+		h.mu.Unlock()
+		for _, e := range events {
+			if m(e) {
+				return e, nil
+			}
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return Event{}, ErrTimeout
+		}
+	}
+}
+
+// Expect waits for an event that matches and fails the test if it's not received in time.
+func (h *Hub) Expect(t testing.TB, m Matcher) Event {
+	t.Helper()
+	e, err := h.Wait(h.conf.Timeout, m)
+	if err != nil {
+		t.Fatalf("dctest: expected event was not received; events:\n%v", h.Events())
+	}
+	return e
+}
+
+// Users returns the names of all users on the hub, including virtual users.
+func (h *Hub) Users() []string {
+	h.mu.Lock()
+	list := make([]string, 0, len(h.users))
+	for name := range h.users {
+		list = append(list, name)
+	}
+	h.mu.Unlock()
+	sort.Strings(list)
+	return list
+}
+
+// nextSID allocates a new SID. It must be called with the lock held.
+func (h *Hub) nextSID() adc.SID {
+	h.lastSID++
+	return types.SIDFromInt(h.lastSID)
+}
+
+// AddUser adds a virtual user without a connection. It can be used to send chat messages and searches.
+func (h *Hub) AddUser(name string, op bool) error {
+	u := &user{
+		name:   name,
+		op:     op,
+		myINFO: &nmdc.MyINFO{Name: name, Mode: nmdc.UserModePassive, HubsNormal: 1, Conn: nmdc.ConnSpeedServer, Flag: nmdc.FlagStatusNormal},
+		inf:    &adc.UserInfo{Name: name, Features: adc.ExtFeatures{}},
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.users[name]; ok {
+		return errUserExists
+	}
+	u.sid = h.nextSID()
+	h.setUserInfo(u)
+	h.join(u)
+	return nil
+}
+
+// RemoveUser removes a virtual user or disconnects a real one.
+func (h *Hub) RemoveUser(name string) error {
+	return h.Kick(name, "")
+}
+
+// Kick disconnects the user with a given reason.
+func (h *Hub) Kick(name, reason string) error {
+	h.mu.Lock()
+	u := h.users[name]
+	if u == nil {
+		h.mu.Unlock()
+		return ErrNoUser
+	}
+	h.leave(u)
+	h.mu.Unlock()
+	if u.s != nil {
+		u.s.kick(reason)
+	}
+	return nil
+}
+
+// Chat sends a message to the main chat. If the sender is empty, the message is sent by the hub.
+func (h *Hub) Chat(from, text string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var u *user
+	if from != "" {
+		if u = h.users[from]; u == nil {
+			return ErrNoUser
+		}
+	}
+	h.broadcastChat(u, adc.ChatMessage{Text: text})
+	return nil
+}
+
+// PM sends a private message from one user to another. The sender may be a virtual user.
+func (h *Hub) PM(from, to, text string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	src, dst := h.users[from], h.users[to]
+	if src == nil || dst == nil {
+		return ErrNoUser
+	}
+	h.sendPM(src, dst, adc.ChatMessage{Text: text, PM: &src.sid})
+	return nil
+}
+
+// Search sends a search request from a given user to all other users.
+func (h *Hub) Search(from string, req dc.SearchRequest) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	u := h.users[from]
+	if u == nil {
+		return ErrNoUser
+	}
+	s := adc.SearchRequest{Token: "dctest", TTH: req.TTH}
+	if req.TTH == nil {
+		s.And = strings.Fields(req.Pattern)
+	}
+	h.broadcastSearch(u, &s, nil)
+	return nil
+}
+
+// SetDelay delays each message sent to the user, simulating a slow connection.
+// If the send queue of the user is full, the user is disconnected, like a slow consumer on a real hub.
+func (h *Hub) SetDelay(name string, d time.Duration) error {
+	s, err := h.session(name)
+	if err != nil {
+		return err
+	}
+	s.setDelay(d)
+	return nil
+}
+
+// SendRaw writes raw data to the user connection. It can be used to send malformed messages.
+func (h *Hub) SendRaw(name string, data []byte) error {
+	s, err := h.session(name)
+	if err != nil {
+		return err
+	}
+	data = append([]byte(nil), data...)
+	s.send(func() error {
+		if err := s.flush(); err != nil {
+			return err
+		}
+		_, err := s.conn.Write(data)
+		return err
+	})
+	return nil
+}
+
+func (h *Hub) session(name string) (*session, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	u := h.users[name]
+	if u == nil || u.s == nil {
+		return nil, ErrNoUser
+	}
+	return u.s, nil
+}
+
+// setUserInfo fills the user info for the other protocol. It must be called with the lock held.
+func (h *Hub) setUserInfo(u *user) {
+	if u.isADC() {
+		m, _ := h.tr.UserInfoToNMDC(u.inf)
+		u.myINFO = &m
+	} else {
+		inf, _ := h.tr.MyINFOToADC(u.myINFO)
+		inf.Id = adc.CID(tiger.HashBytes([]byte(u.name)))
+		u.inf = &inf
+	}
+	// private ID must never be sent to other users
+	u.inf.Pid = nil
+	u.inf.Type &^= adc.UserTypeOperator | adc.UserTypeBot
+	if u.op {
+		u.inf.Type |= adc.UserTypeOperator
+	}
+	if u.bot {
+		u.inf.Type |= adc.UserTypeBot
+	}
+}
+
+// join adds the user to the list and notifies other users. It must be called with the lock held.
+func (h *Hub) join(u *user) {
+	h.users[u.name] = u
+	h.bySID[u.sid] = u
+	h.broadcastInfo(u)
+}
+
+// leave removes the user from the list and notifies other users. It must be called with the lock held.
+func (h *Hub) leave(u *user) {
+	if h.users[u.name] != u {
+		return
+	}
+	delete(h.users, u.name)
+	delete(h.bySID, u.sid)
+	for _, o := range h.users {
+		if o.s == nil {
+			continue
+		}
+		if o.isADC() {
+			o.s.sendADC(&adc.InfoPacket{Msg: adc.Disconnect{ID: u.sid}})
+		} else {
+			o.s.sendNMDC(&nmdc.Quit{Name: nmdc.Name(u.name)})
+		}
+	}
+}
+
+// broadcastInfo sends the user info to all users, including the user itself. It must be called with the lock held.
+func (h *Hub) broadcastInfo(u *user) {
+	for _, o := range h.users {
+		if o.s == nil {
+			continue
+		}
+		if o.isADC() {
+			o.s.sendADC(&adc.BroadcastPacket{ID: u.sid, Msg: *u.inf})
+			continue
+		}
+		o.s.sendNMDC(u.myINFO)
+		if u.op {
+			o.s.sendNMDC(&nmdc.OpList{Names: nmdc.Names{u.name}})
+		}
+		if u.bot {
+			o.s.sendNMDC(&nmdc.BotList{Names: nmdc.Names{u.name}})
+		}
+	}
+}
+
+// broadcastChat sends a chat message to all users. A nil sender means the hub. It must be called with the lock held.
+func (h *Hub) broadcastChat(from *user, m adc.ChatMessage) {
+	nm, _ := h.tr.ChatToNMDC(&m)
+	if from != nil {
+		nm.Name = from.name
+	}
+	for _, o := range h.users {
+		if o.s == nil {
+			continue
+		}
+		if !o.isADC() {
+			o.s.sendNMDC(&nm)
+		} else if from == nil {
+			o.s.sendADC(&adc.InfoPacket{Msg: m})
+		} else {
+			o.s.sendADC(&adc.BroadcastPacket{ID: from.sid, Msg: m})
+		}
+	}
+}
+
+// sendPM sends a private message. The PM field of the message must be set. It must be called with the lock held.
+func (h *Hub) sendPM(from, to *user, m adc.ChatMessage) {
+	if to.s == nil {
+		return
+	}
+	if to.isADC() {
+		to.s.sendADC(&adc.DirectPacket{ID: from.sid, To: to.sid, Msg: m})
+		return
+	}
+	pm, _ := h.tr.PMToNMDC(&m)
+	pm.From, pm.Name, pm.To = from.name, from.name, to.name
+	to.s.sendNMDC(&pm)
+}
+
+// broadcastSearch sends the search to all users except the sender. Either an ADC or an NMDC request must be set.
+// It must be called with the lock held.
+func (h *Hub) broadcastSearch(from *user, as *adc.SearchRequest, ns *nmdc.Search) {
+	if as == nil {
+		s, _ := h.tr.SearchToADC(ns, "")
+		as = &s
+	}
+	if ns == nil {
+		s, _ := h.tr.SearchToNMDC(as)
+		s.User = from.name
+		ns = &s
+	}
+	for _, o := range h.users {
+		if o == from || o.s == nil {
+			continue
+		}
+		if o.isADC() {
+			o.s.sendADC(&adc.BroadcastPacket{ID: from.sid, Msg: *as})
+		} else {
+			o.s.sendNMDC(ns)
+		}
+	}
+}
+
+// checkName validates the user name. It must be called with the lock held.
+func (h *Hub) checkName(name string) error {
+	if name == "" {
+		return errors.New("invalid name")
+	} else if _, ok := h.users[name]; ok {
+		return errUserExists
+	}
+	if h.conf.Deny != nil {
+		return h.conf.Deny(name)
+	}
+	return nil
+}
+
+// account returns the account for a given user name.
+func (h *Hub) account(name string) (Account, bool) {
+	acc, ok := h.conf.Accounts[name]
+	return acc, ok
+}
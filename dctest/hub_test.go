@@ -0,0 +1,338 @@
+package dctest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	dc "github.com/direct-connect/go-dc"
+	"github.com/direct-connect/go-dc/lineproto"
+)
+
+func newHub(t *testing.T, conf *Config) *Hub {
+	h, err := NewHub(conf)
+	require.NoError(t, err)
+	return h
+}
+
+func dial(addr string, opt *dc.Options) (dc.Hub, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return dc.Dial(ctx, addr, opt)
+}
+
+// watchChat returns a channel with chat messages received by the client.
+func watchChat(c dc.Hub) <-chan dc.ChatMessage {
+	ch := make(chan dc.ChatMessage, 10)
+	c.OnChat(func(m dc.ChatMessage) { ch <- m })
+	return ch
+}
+
+func recvChat(t *testing.T, ch <-chan dc.ChatMessage) dc.ChatMessage {
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+		return dc.ChatMessage{}
+	}
+}
+
+// waitUser waits until the client sees a given user.
+func waitUser(t *testing.T, c dc.Hub, name string) dc.User {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, u := range c.Users() {
+			if u.Name == name {
+				return u
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("user %q is not visible", name)
+	return dc.User{}
+}
+
+func TestHubCrossProtocol(t *testing.T) {
+	h := newHub(t, &Config{Name: "test"})
+	defer h.Close()
+
+	alice, err := dial(h.NMDCAddr(), &dc.Options{Name: "alice", Share: 100})
+	require.NoError(t, err)
+	defer alice.Close()
+	achat := watchChat(alice)
+	require.Equal(t, "test", alice.Name())
+
+	bob, err := dial(h.ADCAddr(), &dc.Options{Name: "bob", Share: 200})
+	require.NoError(t, err)
+	defer bob.Close()
+	bchat := watchChat(bob)
+	require.Equal(t, "test", bob.Name())
+
+	require.Equal(t, uint64(200), waitUser(t, alice, "bob").Share)
+	require.Equal(t, uint64(100), waitUser(t, bob, "alice").Share)
+	require.Equal(t, []string{"alice", "bob"}, h.Users())
+
+	require.NoError(t, alice.SendChat("hi from nmdc"))
+	require.Equal(t, dc.ChatMessage{From: "alice", Text: "hi from nmdc"}, recvChat(t, bchat))
+	require.Equal(t, dc.ChatMessage{From: "alice", Text: "hi from nmdc"}, recvChat(t, achat))
+
+	require.NoError(t, bob.SendPM("alice", "psst"))
+	require.Equal(t, dc.ChatMessage{From: "bob", Text: "psst", PM: true}, recvChat(t, achat))
+
+	require.NoError(t, alice.Search(dc.SearchRequest{Pattern: "some file"}))
+	h.Expect(t, All(From("alice"), NMDCType("Search")))
+	require.NoError(t, bob.Search(dc.SearchRequest{Pattern: "other file"}))
+	h.Expect(t, All(From("bob"), ADCCmd("SCH")))
+}
+
+func TestHubNoPID(t *testing.T) {
+	h := newHub(t, &Config{Name: "test"})
+	defer h.Close()
+
+	var (
+		mu    sync.Mutex
+		infos []string
+	)
+	bob, err := dial(h.ADCAddr(), &dc.Options{Name: "bob",
+		Trace: func(r *lineproto.Reader, w *lineproto.Writer) {
+			r.OnLine(func(line []byte) (bool, error) {
+				if strings.HasPrefix(string(line), "BINF ") {
+					mu.Lock()
+					infos = append(infos, string(line))
+					mu.Unlock()
+				}
+				return true, nil
+			})
+		},
+	})
+	require.NoError(t, err)
+	defer bob.Close()
+
+	alice, err := dial(h.ADCAddr(), &dc.Options{Name: "alice"})
+	require.NoError(t, err)
+	defer alice.Close()
+	carol, err := dial(h.NMDCAddr(), &dc.Options{Name: "carol"})
+	require.NoError(t, err)
+	defer carol.Close()
+
+	waitUser(t, bob, "alice")
+	waitUser(t, bob, "carol")
+	mu.Lock()
+	defer mu.Unlock()
+	require.True(t, len(infos) >= 3, "%q", infos)
+	for _, line := range infos {
+		require.NotContains(t, line, " PD", "private ID is sent to other users")
+	}
+}
+
+func TestHubLogin(t *testing.T) {
+	h := newHub(t, &Config{
+		Accounts: map[string]Account{"admin": {Password: "secret", Op: true}},
+		Deny: func(name string) error {
+			if name == "banned" {
+				return errors.New("you are banned")
+			}
+			return nil
+		},
+	})
+	defer h.Close()
+
+	for _, addr := range []string{h.NMDCAddr(), h.ADCAddr()} {
+		_, err := dial(addr, &dc.Options{Name: "banned"})
+		require.Error(t, err, addr)
+
+		_, err = dial(addr, &dc.Options{Name: "admin", Password: "wrong"})
+		require.Error(t, err, addr)
+
+		c, err := dial(addr, &dc.Options{Name: "admin", Password: "secret"})
+		require.NoError(t, err, addr)
+
+		_, err = dial(addr, &dc.Options{Name: "admin", Password: "secret"})
+		require.Error(t, err, addr)
+
+		require.True(t, waitUser(t, c, "admin").Op, addr)
+		require.NoError(t, c.Close())
+		for i := 0; i < 100 && len(h.Users()) != 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		require.Empty(t, h.Users())
+	}
+}
+
+func TestHubVirtualUser(t *testing.T) {
+	h := newHub(t, nil)
+	defer h.Close()
+
+	require.NoError(t, h.AddUser("bot", true))
+	require.Equal(t, errUserExists, h.AddUser("bot", false))
+
+	alice, err := dial(h.NMDCAddr(), &dc.Options{Name: "alice"})
+	require.NoError(t, err)
+	defer alice.Close()
+	achat := watchChat(alice)
+	bob, err := dial(h.ADCAddr(), &dc.Options{Name: "bob"})
+	require.NoError(t, err)
+	defer bob.Close()
+	bchat := watchChat(bob)
+
+	require.True(t, waitUser(t, alice, "bot").Op)
+	require.True(t, waitUser(t, bob, "bot").Op)
+
+	require.NoError(t, h.Chat("bot", "hello"))
+	require.Equal(t, dc.ChatMessage{From: "bot", Text: "hello"}, recvChat(t, achat))
+	require.Equal(t, dc.ChatMessage{From: "bot", Text: "hello"}, recvChat(t, bchat))
+
+	require.NoError(t, h.PM("bot", "bob", "private"))
+	require.Equal(t, dc.ChatMessage{From: "bot", Text: "private", PM: true}, recvChat(t, bchat))
+	require.Equal(t, ErrNoUser, h.PM("bot", "carol", "private"))
+
+	require.NoError(t, h.Search("bot", dc.SearchRequest{Pattern: "file"}))
+	require.NoError(t, h.RemoveUser("bot"))
+	require.Equal(t, []string{"alice", "bob"}, h.Users())
+}
+
+func TestHubKick(t *testing.T) {
+	h := newHub(t, nil)
+	defer h.Close()
+
+	for _, addr := range []string{h.NMDCAddr(), h.ADCAddr()} {
+		c, err := dial(addr, &dc.Options{Name: "alice"})
+		require.NoError(t, err)
+		waitUser(t, c, "alice")
+
+		require.NoError(t, h.Kick("alice", "bye"))
+		select {
+		case <-c.Done():
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout")
+		}
+		require.Equal(t, ErrNoUser, h.Kick("alice", "bye"))
+	}
+}
+
+func TestHubKickADC(t *testing.T) {
+	h := newHub(t, nil)
+	defer h.Close()
+
+	var (
+		mu    sync.Mutex
+		lines []string
+	)
+	c, err := dial(h.ADCAddr(), &dc.Options{Name: "alice",
+		Trace: func(r *lineproto.Reader, w *lineproto.Writer) {
+			r.OnLine(func(line []byte) (bool, error) {
+				s := string(line)
+				if strings.HasPrefix(s, "ISID ") || strings.HasPrefix(s, "IQUI ") {
+					mu.Lock()
+					lines = append(lines, strings.TrimSpace(s))
+					mu.Unlock()
+				}
+				return true, nil
+			})
+		},
+	})
+	require.NoError(t, err)
+	defer c.Close()
+	waitUser(t, c, "alice")
+
+	require.NoError(t, h.Kick("alice", "bye"))
+	select {
+	case <-c.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, lines, 2)
+	sid := strings.TrimPrefix(lines[0], "ISID ")
+	require.Equal(t, "IQUI "+sid+" MSbye", lines[1])
+}
+
+func TestHubSlowConsumer(t *testing.T) {
+	h := newHub(t, nil)
+
+	c, err := dial(h.ADCAddr(), &dc.Options{Name: "alice"})
+	require.NoError(t, err)
+	defer c.Close()
+	waitUser(t, c, "alice")
+
+	require.NoError(t, h.SetDelay("alice", time.Minute))
+	errc := make(chan error, 1)
+	go func() {
+		// the hub must not block on a full queue
+		for i := 0; i < queueSize+10; i++ {
+			if err := h.Chat("", "spam"); err != nil {
+				errc <- err
+				return
+			}
+		}
+		errc <- h.Close()
+	}()
+	select {
+	case err := <-errc:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("hub is blocked by a slow user")
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("slow user is not disconnected")
+	}
+}
+
+func TestHubDelay(t *testing.T) {
+	h := newHub(t, nil)
+	defer h.Close()
+
+	c, err := dial(h.ADCAddr(), &dc.Options{Name: "alice"})
+	require.NoError(t, err)
+	defer c.Close()
+	ch := watchChat(c)
+	waitUser(t, c, "alice")
+
+	const delay = 100 * time.Millisecond
+	require.NoError(t, h.SetDelay("alice", delay))
+	start := time.Now()
+	require.NoError(t, h.Chat("", "slow"))
+	require.Equal(t, "slow", recvChat(t, ch).Text)
+	require.True(t, time.Since(start) >= delay)
+
+	require.Equal(t, ErrNoUser, h.SetDelay("bob", delay))
+}
+
+func TestHubSendRaw(t *testing.T) {
+	h := newHub(t, nil)
+	defer h.Close()
+
+	c, err := dial(h.NMDCAddr(), &dc.Options{Name: "alice"})
+	require.NoError(t, err)
+	defer c.Close()
+	ch := watchChat(c)
+	waitUser(t, c, "alice")
+
+	require.NoError(t, h.SendRaw("alice", []byte("<hub> raw message|")))
+	require.Equal(t, dc.ChatMessage{From: "hub", Text: "raw message"}, recvChat(t, ch))
+}
+
+func TestHubWait(t *testing.T) {
+	h := newHub(t, &Config{Timeout: 50 * time.Millisecond})
+	defer h.Close()
+
+	_, err := h.Wait(10*time.Millisecond, ADCCmd("MSG"))
+	require.Equal(t, ErrTimeout, err)
+
+	c, err := dial(h.ADCAddr(), &dc.Options{Name: "alice"})
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.SendChat("hi"))
+	e := h.Expect(t, All(From("alice"), ADCCmd("MSG")))
+	require.Equal(t, "alice", e.From)
+	require.Equal(t, 1, h.Count(ADCCmd("MSG")))
+}
@@ -0,0 +1,193 @@
+package dctest
+
+import (
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/nmdc"
+	"github.com/direct-connect/go-dc/types"
+)
+
+// readNMDC reads and records a single message.
+func (s *session) readNMDC(name string) (nmdc.Message, error) {
+	m, err := s.nr.ReadMsg()
+	if err != nil {
+		return nil, err
+	}
+	s.h.record(Event{From: name, NMDC: m})
+	return m, nil
+}
+
+// serveNMDC runs the NMDC session. It returns the user if the login was successful.
+func (s *session) serveNMDC() *user {
+	h := s.h
+	s.sendNMDC(&nmdc.Lock{Lock: "_dctest", PK: "dctest"})
+	var name string
+	for name == "" {
+		m, err := s.readNMDC("")
+		if err != nil {
+			return nil
+		}
+		if m, ok := m.(*nmdc.ValidateNick); ok {
+			name = string(m.Name)
+		}
+	}
+	h.mu.Lock()
+	err := h.checkName(name)
+	h.mu.Unlock()
+	if err == errUserExists || name == "" {
+		s.sendNMDC(&nmdc.ValidateDenide{Name: nmdc.Name(name)})
+		s.kick("")
+		return nil
+	} else if err != nil {
+		s.kick(err.Error())
+		return nil
+	}
+	acc, registered := h.account(name)
+	if registered {
+		s.sendNMDC(&nmdc.GetPass{})
+		var pass *nmdc.MyPass
+		for pass == nil {
+			m, err := s.readNMDC(name)
+			if err != nil {
+				return nil
+			}
+			pass, _ = m.(*nmdc.MyPass)
+		}
+		if string(pass.String) != acc.Password {
+			s.sendNMDC(&nmdc.BadPass{})
+			s.kick("")
+			return nil
+		}
+	}
+	s.sendNMDC(
+		&nmdc.Supports{Ext: []string{
+			nmdc.ExtNoHello, nmdc.ExtNoGetINFO, nmdc.ExtMCTo, nmdc.ExtBotINFO, nmdc.ExtHubINFO, nmdc.ExtHubTopic,
+		}},
+		&nmdc.HubName{String: nmdc.String(h.conf.Name)},
+	)
+	if h.conf.Topic != "" {
+		s.sendNMDC(&nmdc.HubTopic{Text: h.conf.Topic})
+	}
+	s.sendNMDC(&nmdc.Hello{Name: nmdc.Name(name)})
+	var info *nmdc.MyINFO
+	for info == nil {
+		m, err := s.readNMDC(name)
+		if err != nil {
+			return nil
+		}
+		if m, ok := m.(*nmdc.MyINFO); ok && m.Name == name {
+			info = m
+		}
+	}
+	u := &user{name: name, op: acc.Op, myINFO: info, s: s}
+
+	h.mu.Lock()
+	if h.users[name] != nil {
+		h.mu.Unlock()
+		s.sendNMDC(&nmdc.ValidateDenide{Name: nmdc.Name(name)})
+		s.kick("")
+		return nil
+	}
+	u.sid = h.nextSID()
+	h.setUserInfo(u)
+	var ops, bots nmdc.Names
+	for _, o := range h.users {
+		s.sendNMDC(o.myINFO)
+		if o.op {
+			ops = append(ops, o.name)
+		}
+		if o.bot {
+			bots = append(bots, o.name)
+		}
+	}
+	if len(ops) != 0 {
+		s.sendNMDC(&nmdc.OpList{Names: ops})
+	}
+	if len(bots) != 0 {
+		s.sendNMDC(&nmdc.BotList{Names: bots})
+	}
+	h.join(u)
+	h.mu.Unlock()
+
+	for {
+		m, err := s.readNMDC(name)
+		if err != nil {
+			return u
+		}
+		h.mu.Lock()
+		s.handleNMDC(u, m)
+		h.mu.Unlock()
+	}
+}
+
+// handleNMDC routes a message from the user. It must be called with the hub lock held.
+func (s *session) handleNMDC(u *user, m nmdc.Message) {
+	h := s.h
+	if h.users[u.name] != u {
+		return // kicked
+	}
+	switch m := m.(type) {
+	case *nmdc.ChatMessage:
+		if m.Name != u.name {
+			return
+		}
+		cm, _ := h.tr.ChatToADC(m)
+		h.broadcastChat(u, cm)
+	case *nmdc.PrivateMessage:
+		if dst := h.users[m.To]; dst != nil {
+			cm, _ := h.tr.PMToADC(m)
+			cm.PM = &u.sid
+			h.sendPM(u, dst, cm)
+		}
+	case *nmdc.MCTo:
+		dst := h.users[m.To]
+		if dst == nil || dst.s == nil {
+			return
+		}
+		if dst.isADC() {
+			cm, _ := h.tr.ChatToADC(&nmdc.ChatMessage{Text: m.Text})
+			dst.s.sendADC(&adc.DirectPacket{ID: u.sid, To: dst.sid, Msg: cm})
+		} else {
+			dst.s.sendNMDC(&nmdc.ChatMessage{Name: u.name, Text: m.Text})
+		}
+	case *nmdc.Search:
+		h.broadcastSearch(u, nil, m)
+	case *nmdc.SR:
+		dst := h.users[m.To]
+		if dst == nil || dst.s == nil {
+			return
+		}
+		if dst.isADC() {
+			res, _ := h.tr.SRToADC(m, "")
+			dst.s.sendADC(&adc.DirectPacket{ID: u.sid, To: dst.sid, Msg: res})
+		} else {
+			sr := *m
+			sr.To = ""
+			dst.s.sendNMDC(&sr)
+		}
+	case *nmdc.ConnectToMe:
+		if dst := h.users[m.Targ]; dst != nil && dst.s != nil && !dst.isADC() {
+			dst.s.sendNMDC(m)
+		}
+	case *nmdc.RevConnectToMe:
+		if dst := h.users[m.To]; dst != nil && dst.s != nil && !dst.isADC() {
+			dst.s.sendNMDC(m)
+		}
+	case *nmdc.MyINFO:
+		if m.Name != u.name {
+			return
+		}
+		u.myINFO = m
+		h.setUserInfo(u)
+		h.broadcastInfo(u)
+	case *nmdc.BotINFO:
+		s.sendNMDC(&nmdc.HubINFO{
+			Name: h.conf.Name, Host: h.l.Addr().String(), Desc: h.conf.Topic,
+			Soft: types.Software{Name: "dctest"}, Encoding: "UTF-8",
+		})
+		if !u.bot {
+			u.bot = true
+			h.setUserInfo(u)
+			h.broadcastInfo(u)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package dctest
+
+import (
+	"sync"
+	"time"
+
+	dc "github.com/direct-connect/go-dc"
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/nmdc"
+)
+
+// session is a connection of a single user. Outgoing messages are queued and written by a separate goroutine.
+type session struct {
+	h    *Hub
+	conn *dc.Conn
+	adc  bool
+	sid  adc.SID // assigned to ADC users during the handshake
+
+	nr *nmdc.Reader
+	nw *nmdc.Writer
+	ar *adc.Reader
+	aw *adc.Writer
+
+	out chan func() error
+
+	mu    sync.Mutex
+	delay time.Duration
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newSession(h *Hub, c *dc.Conn) *session {
+	s := &session{
+		h:    h,
+		conn: c,
+		adc:  c.IsADC(),
+		out:  make(chan func() error, queueSize),
+		done: make(chan struct{}),
+	}
+	if s.adc {
+		s.ar, s.aw = adc.NewReader(c), adc.NewWriter(c)
+	} else {
+		s.nr, s.nw = nmdc.NewReader(c), nmdc.NewWriter(c)
+	}
+	return s
+}
+
+func (s *session) serve() {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.writeLoop()
+	}()
+	var u *user
+	if s.adc {
+		u = s.serveADC()
+	} else {
+		u = s.serveNMDC()
+	}
+	if u != nil {
+		s.h.mu.Lock()
+		s.h.leave(u)
+		s.h.mu.Unlock()
+	}
+	s.close()
+	wg.Wait()
+}
+
+func (s *session) writeLoop() {
+	for {
+		var fnc func() error
+		select {
+		case <-s.done:
+			return
+		case fnc = <-s.out:
+		}
+		s.mu.Lock()
+		delay := s.delay
+		s.mu.Unlock()
+		if delay > 0 {
+			select {
+			case <-s.done:
+				return
+			case <-time.After(delay):
+			}
+		}
+		err := fnc()
+		if err == nil && len(s.out) == 0 {
+			err = s.flush()
+		}
+		if err != nil {
+			s.close()
+			return
+		}
+	}
+}
+
+func (s *session) setDelay(d time.Duration) {
+	s.mu.Lock()
+	s.delay = d
+	s.mu.Unlock()
+}
+
+// send queues a function that writes to the connection. It never blocks, thus it's safe
+// to call it with the hub lock held. If the queue is full, the user is too slow and
+// the connection is closed.
+func (s *session) send(fnc func() error) {
+	select {
+	case s.out <- fnc:
+	case <-s.done:
+	default:
+		s.close()
+	}
+}
+
+func (s *session) sendNMDC(msg ...nmdc.Message) {
+	s.send(func() error {
+		return s.nw.WriteMsg(msg...)
+	})
+}
+
+func (s *session) sendADC(p ...adc.Packet) {
+	s.send(func() error {
+		for _, p := range p {
+			if err := s.aw.WritePacket(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *session) flush() error {
+	if s.adc {
+		return s.aw.Flush()
+	}
+	return s.nw.Flush()
+}
+
+// kick sends the reason to the user and closes the connection after all queued messages are written.
+func (s *session) kick(reason string) {
+	s.send(func() error {
+		var err error
+		if s.adc {
+			err = s.aw.WritePacket(&adc.InfoPacket{Msg: adc.Disconnect{ID: s.sid, Message: reason}})
+		} else if reason != "" {
+			err = s.nw.WriteMsg(&nmdc.ChatMessage{Text: reason})
+		}
+		if err == nil {
+			err = s.flush()
+		}
+		s.close()
+		return err
+	})
+}
+
+func (s *session) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		_ = s.conn.Close()
+	})
+}
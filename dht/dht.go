@@ -0,0 +1,26 @@
+// Package dht implements a DHT node of Direct Connect network, compatible with DHT0 extension of DC++.
+//
+// Nodes exchange ADC UDP commands (INF, SCH, RES, PUB, STA, GET, SND) that may be compressed with zlib and
+// are encrypted with RC4. Each node sends a UDP key derived from its secret and the IP address of the receiver,
+// and the receiver encrypts the following packets with this key. Only nodes that replied with the key are
+// considered verified and are added to the Kademlia routing table.
+//
+// A node joins the network by pinging bootstrap nodes and requesting node lists from them. Files are published
+// to K nodes closest to the TTH of the file, and are found by an iterative lookup. Nodes in the routing table
+// are pinged periodically to detect dead nodes and to keep NAT mappings open.
+package dht
+
+import (
+	"net"
+
+	"github.com/direct-connect/go-dc/adc"
+)
+
+// DefaultPort is a default UDP port for DHT nodes.
+const DefaultPort = 6250
+
+// NodeAddr is a DHT node ID and its UDP address.
+type NodeAddr struct {
+	ID   adc.CID
+	Addr *net.UDPAddr
+}
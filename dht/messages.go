@@ -0,0 +1,290 @@
+package dht
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/direct-connect/go-dc/adc"
+)
+
+// Messages of DHT protocol. They use the ADC encoding, but are not registered in adc package,
+// since the command names overlap with client-client commands, while the fields are different.
+var (
+	_ adc.Message = Info{}
+	_ adc.Message = Search{}
+	_ adc.Message = Result{}
+	_ adc.Message = Publish{}
+	_ adc.Message = Status{}
+	_ adc.Message = Get{}
+	_ adc.Message = Send{}
+)
+
+// InfoType is a set of flags in Info message.
+type InfoType int
+
+const (
+	// InfoPing requests the receiver to reply with its Info.
+	InfoPing = InfoType(1 << iota)
+	// InfoOnline signals that the sender joins the network and should be added to the routing table.
+	InfoOnline
+)
+
+// Info is the information about the node. It is used as a ping and to announce the node to other nodes.
+type Info struct {
+	Type        InfoType `adc:"TY"`
+	Application string   `adc:"AP"`
+	Version     string   `adc:"VE"`
+	Name        string   `adc:"NI"`
+	Slots       int      `adc:"SL"`
+	MaxUpload   int64    `adc:"US"` // bytes/s
+	Features    string   `adc:"SU"` // comma-separated
+}
+
+func (Info) Cmd() adc.MsgType {
+	return adc.MsgType{'I', 'N', 'F'}
+}
+
+// SearchType is the type of the search request.
+type SearchType int
+
+const (
+	// SearchFile looks for sources of a file with a given TTH. Nodes reply with known sources,
+	// or with the closest nodes if there are none.
+	SearchFile = SearchType(iota + 1)
+	// SearchNode looks for the nodes closest to a given CID.
+	SearchNode
+	// SearchStore looks for the nodes closest to a given TTH, to publish the file to them.
+	SearchStore
+)
+
+// Search is a search request. Nodes reply with Result with the same token.
+type Search struct {
+	Term  string     `adc:"TR"` // base32 CID or TTH
+	Type  SearchType `adc:"TY"`
+	Token string     `adc:"TO"`
+}
+
+func (Search) Cmd() adc.MsgType {
+	return adc.MsgType{'S', 'C', 'H'}
+}
+
+// Result is a response to Search. It contains a zlib-compressed XML list of nodes or file sources.
+type Result struct {
+	Token string     `adc:"TO"`
+	List  binaryData `adc:"NX"`
+}
+
+func (Result) Cmd() adc.MsgType {
+	return adc.MsgType{'R', 'E', 'S'}
+}
+
+// Publish requests the receiver to store the sender as a source of the file. The receiver replies with Status.
+type Publish struct {
+	TTH     adc.TTH `adc:"TR"`
+	Size    int64   `adc:"SI"`
+	Partial bool    `adc:"PF"`
+}
+
+func (Publish) Cmd() adc.MsgType {
+	return adc.MsgType{'P', 'U', 'B'}
+}
+
+// Status is a reply to a request. FC field contains the command name of the request.
+type Status struct {
+	Code    string  `adc:"#"` // severity and error code, "000" for success
+	Msg     string  `adc:"#"`
+	Command string  `adc:"FC"`
+	TTH     adc.TTH `adc:"TR"`
+}
+
+func (Status) Cmd() adc.MsgType {
+	return adc.MsgType{'S', 'T', 'A'}
+}
+
+const (
+	// getNodes and nodesFile are the type and the path of the node list requested with Get.
+	getNodes  = "nodes"
+	nodesFile = "dht.xml"
+)
+
+// Get requests some data from the node. Currently only the node list is supported (nodes dht.xml).
+// The node replies with Send.
+type Get struct {
+	Type string `adc:"#"`
+	Path string `adc:"#"`
+}
+
+func (Get) Cmd() adc.MsgType {
+	return adc.MsgType{'G', 'E', 'T'}
+}
+
+// Send is a response to Get. For the node list, the data is a zlib-compressed XML list of nodes.
+type Send struct {
+	Type string     `adc:"#"`
+	Path string     `adc:"#"`
+	Data binaryData `adc:"#"`
+}
+
+func (Send) Cmd() adc.MsgType {
+	return adc.MsgType{'S', 'N', 'D'}
+}
+
+// binaryData is an escaped binary field.
+type binaryData []byte
+
+func (b binaryData) MarshalADC(buf *bytes.Buffer) error {
+	for _, c := range b {
+		switch c {
+		case '\\':
+			buf.WriteString(`\\`)
+		case ' ':
+			buf.WriteString(`\s`)
+		case '\n':
+			buf.WriteString(`\n`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return nil
+}
+
+func (b *binaryData) UnmarshalADC(data []byte) error {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if c != '\\' {
+			out = append(out, c)
+			continue
+		}
+		if i+1 >= len(data) {
+			return errors.New("invalid escape sequence")
+		}
+		i++
+		switch data[i] {
+		case '\\':
+			out = append(out, '\\')
+		case 's':
+			out = append(out, ' ')
+		case 'n':
+			out = append(out, '\n')
+		default:
+			return fmt.Errorf("invalid escape sequence: %q", data[i-1:i+1])
+		}
+	}
+	*b = out
+	return nil
+}
+
+// unmarshal decodes the message, checking that it has at least a given number of positional parameters.
+func unmarshal(data []byte, m adc.Message, positional int) error {
+	if positional > 0 && bytes.Count(data, []byte(" "))+1 < positional {
+		return fmt.Errorf("dht: expected %d parameters in %s", positional, m.Cmd())
+	}
+	return adc.Unmarshal(data, m)
+}
+
+// keyParam is a UDP key of the sender, added to each message.
+type keyParam struct {
+	Key Key `adc:"UK"`
+}
+
+// withKey adds the UDP key of the sender to the message.
+type withKey struct {
+	adc.Message
+	key Key
+}
+
+func (m withKey) MarshalADC(buf *bytes.Buffer) error {
+	n := buf.Len()
+	if err := adc.Marshal(buf, m.Message); err != nil {
+		return err
+	}
+	if buf.Len() != n {
+		buf.WriteByte(' ')
+	}
+	buf.WriteString("UK")
+	return m.key.MarshalADC(buf)
+}
+
+// nodeList is a list of nodes and file sources, sent in Result and Send messages.
+type nodeList struct {
+	XMLName xml.Name     `xml:"Nodes"`
+	Nodes   []listNode   `xml:"Node"`
+	Sources []listSource `xml:"Source"`
+}
+
+// listNode is a node entry of the list.
+type listNode struct {
+	ID   string `xml:"CID,attr"`
+	IP   string `xml:"I4,attr"`
+	Port int    `xml:"U4,attr"`
+}
+
+// listSource is a file source entry of the list.
+type listSource struct {
+	listNode
+	Size    int64 `xml:"SI,attr"`
+	Partial int   `xml:"PF,attr"` // 0 or 1
+}
+
+func (n listNode) addr() (NodeAddr, error) {
+	var a NodeAddr
+	if err := a.ID.FromBase32(n.ID); err != nil {
+		return a, err
+	}
+	ip := net.ParseIP(n.IP)
+	if ip == nil || ip.To4() == nil {
+		return a, fmt.Errorf("dht: invalid node IP: %q", n.IP)
+	} else if n.Port <= 0 || n.Port > 0xffff {
+		return a, fmt.Errorf("dht: invalid node port: %d", n.Port)
+	}
+	a.Addr = &net.UDPAddr{IP: ip.To4(), Port: n.Port}
+	return a, nil
+}
+
+func newListNode(n NodeAddr) listNode {
+	return listNode{ID: n.ID.Base32(), IP: n.Addr.IP.String(), Port: n.Addr.Port}
+}
+
+// encodeList encodes the list as XML and compresses it.
+func encodeList(l *nodeList) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	zw, err := zlib.NewWriterLevel(buf, zlib.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = zw.Write([]byte(xml.Header)); err != nil {
+		return nil, err
+	}
+	if err = xml.NewEncoder(zw).Encode(l); err != nil {
+		return nil, err
+	}
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeList decompresses and decodes the list.
+func decodeList(data []byte) (*nodeList, error) {
+	data, err := decompress(data)
+	if err != nil {
+		return nil, err
+	}
+	var l nodeList
+	if err = xml.Unmarshal(data, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// Source is a node that shares a file.
+type Source struct {
+	NodeAddr
+	Size    int64
+	Partial bool
+}
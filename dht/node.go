@@ -0,0 +1,839 @@
+package dht
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/adc/types"
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+const (
+	defaultAlpha     = 3
+	defaultTimeout   = 5 * time.Second
+	defaultKeepAlive = 30 * time.Second
+	defaultSourceTTL = 24 * time.Hour
+	defaultMaxFailed = 2
+
+	// maxSources is the max number of sources stored for a single file.
+	maxSources = 100
+	// maxListNodes is the max number of nodes sent in a reply to Get.
+	maxListNodes = 20
+)
+
+var (
+	// ErrClosed is returned when the node is closed.
+	ErrClosed = errors.New("dht: node closed")
+	// ErrNoNodes is returned when there are no known nodes to send the request to.
+	ErrNoNodes = errors.New("dht: no nodes available")
+)
+
+// Config is a DHT node configuration.
+type Config struct {
+	// PID is a private ID of the node. CID of the node is derived from it.
+	// If not set, a random PID is generated.
+	PID adc.PID
+	// Secret is used to derive UDP keys sent to other nodes. If not set, a random one is generated.
+	// It should be persisted together with the PID.
+	Secret Key
+	// Info is sent to other nodes. The type is set by the node.
+	Info Info
+	// K is the size of Kademlia buckets, and the number of nodes a file is published to.
+	K int
+	// Alpha is the number of concurrent requests during lookups.
+	Alpha int
+	// Timeout is the timeout for a single request.
+	Timeout time.Duration
+	// KeepAlive is the interval of pings to nodes that were not seen recently.
+	// It should be less than the usual NAT mapping timeout to keep the UDP port open.
+	KeepAlive time.Duration
+	// SourceTTL is the time published sources are kept. Nodes should republish files more often.
+	SourceTTL time.Duration
+	// MaxFailed is the number of sequential failed requests the node may have before it is removed from the routing table.
+	MaxFailed int
+}
+
+func (c *Config) setDefaults() error {
+	if c.PID.IsZero() {
+		pid, err := types.NewPID()
+		if err != nil {
+			return err
+		}
+		c.PID = pid
+	}
+	if c.Secret.IsZero() {
+		if _, err := rand.Read(c.Secret[:]); err != nil {
+			return err
+		}
+	}
+	if c.K <= 0 {
+		c.K = DefaultK
+	}
+	if c.Alpha <= 0 {
+		c.Alpha = defaultAlpha
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.KeepAlive <= 0 {
+		c.KeepAlive = defaultKeepAlive
+	}
+	if c.SourceTTL <= 0 {
+		c.SourceTTL = defaultSourceTTL
+	}
+	if c.MaxFailed <= 0 {
+		c.MaxFailed = defaultMaxFailed
+	}
+	return nil
+}
+
+// Listen starts a DHT node on a given UDP address. Config is optional.
+func Listen(addr string, conf *Config) (*Node, error) {
+	c, err := net.ListenPacket("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	n, err := NewNode(c, conf)
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return n, nil
+}
+
+// NewNode starts a DHT node on a given packet connection. Config is optional.
+// The node takes the ownership of the connection.
+func NewNode(c net.PacketConn, conf *Config) (*Node, error) {
+	var cf Config
+	if conf != nil {
+		cf = *conf
+	}
+	if err := cf.setDefaults(); err != nil {
+		return nil, err
+	}
+	cid := cf.PID.Hash()
+	n := &Node{
+		conf:     cf,
+		cid:      cid,
+		c:        c,
+		table:    NewTable(cid, cf.K),
+		keys:     make(map[adc.CID]Key),
+		pinging:  make(map[adc.CID]time.Time),
+		searches: make(map[string]chan<- reply),
+		waiters:  make(map[*waiter]struct{}),
+		store:    make(map[adc.TTH]map[adc.CID]*storedSource),
+		closed:   make(chan struct{}),
+	}
+	n.wg.Add(2)
+	go n.serve()
+	go n.keepAlive()
+	return n, nil
+}
+
+// Node is a DHT node.
+type Node struct {
+	conf  Config
+	cid   adc.CID
+	c     net.PacketConn
+	table *Table
+
+	mu       sync.Mutex
+	keys     map[adc.CID]Key       // UDP keys received from other nodes
+	pinging  map[adc.CID]time.Time // pings sent to verify nodes or to keep them alive
+	searches map[string]chan<- reply
+	waiters  map[*waiter]struct{}
+
+	smu   sync.RWMutex
+	store map[adc.TTH]map[adc.CID]*storedSource
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	wg        sync.WaitGroup
+}
+
+// reply is a message received from a node.
+type reply struct {
+	from  NodeAddr
+	valid bool // encrypted with our UDP key
+	msg   *adc.RawMessage
+}
+
+// waiter waits for a reply that matches the filter.
+type waiter struct {
+	match func(r *reply) bool
+	ch    chan *reply
+}
+
+type storedSource struct {
+	Source
+	expires time.Time
+}
+
+// ID returns the CID of the node.
+func (n *Node) ID() adc.CID {
+	return n.cid
+}
+
+// LocalAddr returns the local UDP address of the node.
+func (n *Node) LocalAddr() net.Addr {
+	return n.c.LocalAddr()
+}
+
+// Table returns the routing table of the node.
+func (n *Node) Table() *Table {
+	return n.table
+}
+
+// Close stops the node.
+func (n *Node) Close() error {
+	var err error
+	n.closeOnce.Do(func() {
+		close(n.closed)
+		err = n.c.Close()
+		n.wg.Wait()
+	})
+	return err
+}
+
+func (n *Node) isClosed() bool {
+	select {
+	case <-n.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// udpKey returns the UDP key of this node for a given IP address.
+func (n *Node) udpKey(ip net.IP) Key {
+	b := make([]byte, 0, len(n.conf.Secret)+net.IPv6len)
+	b = append(b, n.conf.Secret[:]...)
+	b = append(b, ip.String()...)
+	return tiger.HashBytes(b)
+}
+
+func newToken() string {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return strconv.FormatUint(uint64(binary.BigEndian.Uint32(b[:])), 10)
+}
+
+// send encodes the message and sends it to the node. If the node ID is not known, the packet is not encrypted.
+func (n *Node) send(to NodeAddr, m adc.Message) error {
+	n.mu.Lock()
+	key := n.keys[to.ID]
+	n.mu.Unlock()
+	p := &adc.UDPPacket{ID: n.cid, Msg: withKey{Message: m, key: n.udpKey(to.Addr.IP)}}
+	data, err := encodePacket(p, to.ID, key)
+	if err != nil {
+		return err
+	}
+	_, err = n.c.WriteTo(data, to.Addr)
+	return err
+}
+
+func (n *Node) info(typ InfoType) Info {
+	m := n.conf.Info
+	m.Type = typ
+	return m
+}
+
+func (n *Node) serve() {
+	defer n.wg.Done()
+	buf := make([]byte, maxPacket)
+	for {
+		sz, addr, err := n.c.ReadFrom(buf)
+		if err != nil {
+			if n.isClosed() {
+				return
+			}
+			continue
+		}
+		uaddr, ok := addr.(*net.UDPAddr)
+		if !ok || uaddr.Port == 0 {
+			continue
+		}
+		data := make([]byte, sz)
+		copy(data, buf[:sz])
+		n.handle(data, uaddr)
+	}
+}
+
+func (n *Node) handle(data []byte, addr *net.UDPAddr) {
+	p, valid, err := decodePacket(data, n.cid, n.udpKey(addr.IP))
+	if err != nil || p.ID == n.cid || p.ID.IsZero() {
+		return
+	}
+	raw, ok := p.Msg.(*adc.RawMessage)
+	if !ok {
+		return
+	}
+	var kp keyParam
+	if adc.Unmarshal(raw.Data, &kp) == nil && !kp.Key.IsZero() {
+		// all the following packets to this node are encrypted with this key
+		n.mu.Lock()
+		n.keys[p.ID] = kp.Key
+		n.mu.Unlock()
+	}
+	from := NodeAddr{ID: p.ID, Addr: addr}
+	if valid {
+		// the node received our packet on this address, thus the address is not spoofed
+		n.table.Update(from.ID, addr, time.Now())
+	}
+	r := &reply{from: from, valid: valid, msg: raw}
+	switch raw.Type {
+	case (Info{}).Cmd():
+		var m Info
+		if unmarshal(raw.Data, &m, 0) != nil {
+			return
+		}
+		if m.Type&InfoPing != 0 {
+			typ := InfoType(0)
+			if !n.known(from, valid) {
+				// ask the node to reply with our key
+				typ = InfoPing
+				n.mu.Lock()
+				n.pinging[from.ID] = time.Now()
+				n.mu.Unlock()
+			}
+			_ = n.send(from, n.info(typ))
+		}
+		n.notify(r)
+		return
+	case (Search{}).Cmd():
+		var m Search
+		if unmarshal(raw.Data, &m, 0) == nil {
+			n.handleSearch(from, &m)
+		}
+	case (Result{}).Cmd():
+		var m Result
+		if unmarshal(raw.Data, &m, 0) == nil {
+			n.mu.Lock()
+			ch := n.searches[m.Token]
+			n.mu.Unlock()
+			if ch != nil {
+				select {
+				case ch <- *r:
+				default:
+				}
+			}
+		}
+	case (Publish{}).Cmd():
+		var m Publish
+		if !valid || unmarshal(raw.Data, &m, 0) != nil || m.TTH.IsZero() || m.Size < 0 {
+			break
+		}
+		n.storeSource(m.TTH, Source{NodeAddr: from, Size: m.Size, Partial: m.Partial})
+		_ = n.send(from, Status{Code: "000", Msg: "File published", Command: "PUB", TTH: m.TTH})
+	case (Get{}).Cmd():
+		var m Get
+		if !valid || unmarshal(raw.Data, &m, 2) != nil || m.Type != getNodes || m.Path != nodesFile {
+			break
+		}
+		n.sendNodes(from)
+	default:
+		n.notify(r)
+	}
+	if !n.known(from, valid) {
+		n.verify(from)
+	}
+}
+
+// known checks if the node is in the routing table, or if the packet from it was verified.
+func (n *Node) known(from NodeAddr, valid bool) bool {
+	if valid {
+		return true
+	}
+	_, ok := n.table.Get(from.ID)
+	return ok
+}
+
+// verify pings the node that sent an unverified packet. The node replies with our UDP key, and will be added
+// to the routing table.
+func (n *Node) verify(to NodeAddr) {
+	n.mu.Lock()
+	_, busy := n.pinging[to.ID]
+	if !busy {
+		n.pinging[to.ID] = time.Now()
+	}
+	n.mu.Unlock()
+	if !busy {
+		_ = n.send(to, n.info(InfoPing))
+	}
+}
+
+// notify passes the message to the waiters.
+func (n *Node) notify(r *reply) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for w := range n.waiters {
+		if w.match(r) {
+			select {
+			case w.ch <- r:
+			default:
+			}
+		}
+	}
+}
+
+// request sends the message to the node and waits for the reply that matches the filter.
+// Only replies encrypted with our UDP key are accepted.
+func (n *Node) request(ctx context.Context, to NodeAddr, m adc.Message, match func(r *reply) bool) (*reply, error) {
+	ctx, cancel := context.WithTimeout(ctx, n.conf.Timeout)
+	defer cancel()
+	w := &waiter{
+		match: func(r *reply) bool {
+			if !r.valid {
+				return false
+			} else if to.ID.IsZero() {
+				return r.from.Addr.IP.Equal(to.Addr.IP) && r.from.Addr.Port == to.Addr.Port && match(r)
+			}
+			return r.from.ID == to.ID && match(r)
+		},
+		ch: make(chan *reply, 1),
+	}
+	n.mu.Lock()
+	n.waiters[w] = struct{}{}
+	n.mu.Unlock()
+	defer func() {
+		n.mu.Lock()
+		delete(n.waiters, w)
+		n.mu.Unlock()
+	}()
+	if err := n.send(to, m); err != nil {
+		return nil, err
+	}
+	select {
+	case r := <-w.ch:
+		return r, nil
+	case <-ctx.Done():
+		if !to.ID.IsZero() {
+			n.table.Failed(to.ID, n.conf.MaxFailed)
+		}
+		return nil, ctx.Err()
+	case <-n.closed:
+		return nil, ErrClosed
+	}
+}
+
+// Ping sends the node info to a given node, and waits for the reply. The node is added to the routing table.
+// If the ID of the node is not known, the packet is not encrypted. It returns the ID of the node.
+func (n *Node) Ping(ctx context.Context, to NodeAddr) (adc.CID, error) {
+	r, err := n.request(ctx, to, n.info(InfoPing|InfoOnline), func(r *reply) bool {
+		return r.msg.Type == (Info{}).Cmd()
+	})
+	if err != nil {
+		return adc.CID{}, err
+	}
+	return r.from.ID, nil
+}
+
+// Bootstrap joins the DHT network. It pings the nodes from the list, requests more nodes from them,
+// and looks up the nodes closest to this node. The node IDs are optional.
+func (n *Node) Bootstrap(ctx context.Context, nodes []NodeAddr) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		live []NodeAddr
+		last error
+	)
+	for _, to := range nodes {
+		wg.Add(1)
+		go func(to NodeAddr) {
+			defer wg.Done()
+			id, err := n.Ping(ctx, to)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				last = err
+				return
+			}
+			to.ID = id
+			live = append(live, to)
+		}(to)
+	}
+	wg.Wait()
+	if len(live) == 0 {
+		if last == nil {
+			last = ErrNoNodes
+		}
+		return last
+	}
+	for _, to := range live {
+		wg.Add(1)
+		go func(to NodeAddr) {
+			defer wg.Done()
+			list, err := n.getNodes(ctx, to)
+			if err != nil {
+				return
+			}
+			n.pingAll(ctx, list)
+		}(to)
+	}
+	wg.Wait()
+	_, _, err := n.lookup(ctx, n.cid, SearchNode)
+	if err == ErrNoNodes {
+		err = nil
+	}
+	return err
+}
+
+// getNodes requests the node list from the node.
+func (n *Node) getNodes(ctx context.Context, to NodeAddr) ([]NodeAddr, error) {
+	r, err := n.request(ctx, to, Get{Type: getNodes, Path: nodesFile}, func(r *reply) bool {
+		return r.msg.Type == (Send{}).Cmd()
+	})
+	if err != nil {
+		return nil, err
+	}
+	var m Send
+	if err = unmarshal(r.msg.Data, &m, 3); err != nil {
+		return nil, err
+	} else if m.Type != getNodes || m.Path != nodesFile {
+		return nil, errors.New("dht: unexpected data: " + m.Type + " " + m.Path)
+	}
+	l, err := decodeList(m.Data)
+	if err != nil {
+		return nil, err
+	}
+	var out []NodeAddr
+	for _, ln := range l.Nodes {
+		if a, err := ln.addr(); err == nil && a.ID != n.cid {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+// pingAll pings the nodes that are not in the routing table.
+func (n *Node) pingAll(ctx context.Context, nodes []NodeAddr) {
+	var wg sync.WaitGroup
+	for _, a := range nodes {
+		if _, ok := n.table.Get(a.ID); ok {
+			continue
+		}
+		wg.Add(1)
+		go func(a NodeAddr) {
+			defer wg.Done()
+			_, _ = n.Ping(ctx, a)
+		}(a)
+	}
+	wg.Wait()
+}
+
+// sendNodes replies to Get with a list of random nodes from the routing table.
+func (n *Node) sendNodes(to NodeAddr) {
+	var target adc.CID
+	if _, err := rand.Read(target[:]); err != nil {
+		return
+	}
+	var l nodeList
+	for _, a := range n.table.Closest(target, maxListNodes+1) {
+		if a.ID != to.ID && len(l.Nodes) < maxListNodes {
+			l.Nodes = append(l.Nodes, newListNode(a))
+		}
+	}
+	data, err := encodeList(&l)
+	if err != nil {
+		return
+	}
+	_ = n.send(to, Send{Type: getNodes, Path: nodesFile, Data: data})
+}
+
+// handleSearch replies to the search request with file sources, or with the nodes closest to the target.
+func (n *Node) handleSearch(from NodeAddr, m *Search) {
+	var target adc.CID
+	if m.Token == "" || target.FromBase32(m.Term) != nil {
+		return
+	}
+	var l nodeList
+	switch m.Type {
+	case SearchFile:
+		for _, s := range n.Sources(adc.TTH(target)) {
+			ls := listSource{listNode: newListNode(s.NodeAddr), Size: s.Size}
+			if s.Partial {
+				ls.Partial = 1
+			}
+			l.Sources = append(l.Sources, ls)
+		}
+	case SearchNode, SearchStore:
+	default:
+		return
+	}
+	if len(l.Sources) == 0 {
+		for _, a := range n.table.Closest(target, n.conf.K+1) {
+			if a.ID != from.ID && len(l.Nodes) < n.conf.K {
+				l.Nodes = append(l.Nodes, newListNode(a))
+			}
+		}
+	}
+	data, err := encodeList(&l)
+	if err != nil {
+		return
+	}
+	_ = n.send(from, Result{Token: m.Token, List: data})
+}
+
+// lookup runs an iterative Kademlia lookup. It returns up to K nodes closest to the target that responded,
+// and the file sources, if any. A file lookup stops when sources are found.
+func (n *Node) lookup(ctx context.Context, target adc.CID, typ SearchType) ([]NodeAddr, []Source, error) {
+	cand := n.table.Closest(target, n.conf.K)
+	if len(cand) == 0 {
+		return nil, nil, ErrNoNodes
+	}
+	token := newToken()
+	ch := make(chan reply, n.conf.K*n.conf.Alpha)
+	n.mu.Lock()
+	n.searches[token] = ch
+	n.mu.Unlock()
+	defer func() {
+		n.mu.Lock()
+		delete(n.searches, token)
+		n.mu.Unlock()
+	}()
+
+	var (
+		seen      = map[adc.CID]bool{n.cid: true}
+		queried   = make(map[adc.CID]bool)
+		responded []NodeAddr
+		sources   []Source
+		srcSeen   = make(map[adc.CID]bool)
+	)
+	for _, a := range cand {
+		seen[a.ID] = true
+	}
+	req := Search{Term: target.Base32(), Type: typ, Token: token}
+	for {
+		// query alpha closest nodes that were not queried yet
+		sortByDistance(target, cand)
+		pending := make(map[adc.CID]NodeAddr)
+		for i := 0; i < len(cand) && i < n.conf.K && len(pending) < n.conf.Alpha; i++ {
+			a := cand[i]
+			if queried[a.ID] {
+				continue
+			}
+			queried[a.ID] = true
+			if n.send(a, req) == nil {
+				pending[a.ID] = a
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+		timer := time.NewTimer(n.conf.Timeout)
+	wait:
+		for len(pending) != 0 {
+			select {
+			case r := <-ch:
+				if !queried[r.from.ID] {
+					continue
+				}
+				delete(pending, r.from.ID)
+				responded = append(responded, r.from)
+				var m Result
+				if unmarshal(r.msg.Data, &m, 0) != nil {
+					continue
+				}
+				l, err := decodeList(m.List)
+				if err != nil {
+					continue
+				}
+				for _, ln := range l.Nodes {
+					if a, err := ln.addr(); err == nil && !seen[a.ID] {
+						seen[a.ID] = true
+						cand = append(cand, a)
+					}
+				}
+				for _, ls := range l.Sources {
+					if a, err := ls.addr(); err == nil && !srcSeen[a.ID] {
+						srcSeen[a.ID] = true
+						sources = append(sources, Source{NodeAddr: a, Size: ls.Size, Partial: ls.Partial != 0})
+					}
+				}
+			case <-timer.C:
+				break wait
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, nil, ctx.Err()
+			case <-n.closed:
+				timer.Stop()
+				return nil, nil, ErrClosed
+			}
+		}
+		timer.Stop()
+		for id := range pending {
+			n.table.Failed(id, n.conf.MaxFailed)
+		}
+		if typ == SearchFile && len(sources) != 0 {
+			break
+		}
+	}
+	sortByDistance(target, responded)
+	if len(responded) > n.conf.K {
+		responded = responded[:n.conf.K]
+	}
+	return responded, sources, nil
+}
+
+// FindNode looks up the nodes closest to a given ID.
+func (n *Node) FindNode(ctx context.Context, id adc.CID) ([]NodeAddr, error) {
+	nodes, _, err := n.lookup(ctx, id, SearchNode)
+	return nodes, err
+}
+
+// Search looks up the sources of a file with a given TTH.
+func (n *Node) Search(ctx context.Context, tth adc.TTH) ([]Source, error) {
+	_, sources, err := n.lookup(ctx, adc.CID(tth), SearchFile)
+	return sources, err
+}
+
+// Publish announces this node as a source of the file. The file is published to K nodes closest to the TTH.
+// It returns the number of nodes that stored the source. Files should be republished periodically,
+// since nodes drop sources after some time.
+func (n *Node) Publish(ctx context.Context, tth adc.TTH, size int64, partial bool) (int, error) {
+	nodes, _, err := n.lookup(ctx, adc.CID(tth), SearchStore)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		cnt  int
+		last error
+	)
+	m := Publish{TTH: tth, Size: size, Partial: partial}
+	for _, to := range nodes {
+		wg.Add(1)
+		go func(to NodeAddr) {
+			defer wg.Done()
+			_, err := n.request(ctx, to, m, func(r *reply) bool {
+				var st Status
+				return r.msg.Type == (Status{}).Cmd() && unmarshal(r.msg.Data, &st, 2) == nil &&
+					st.Command == "PUB" && st.TTH == tth
+			})
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				last = err
+			} else {
+				cnt++
+			}
+		}(to)
+	}
+	wg.Wait()
+	if cnt == 0 {
+		if last == nil {
+			last = ErrNoNodes
+		}
+		return 0, last
+	}
+	return cnt, nil
+}
+
+func (n *Node) storeSource(tth adc.TTH, s Source) {
+	n.smu.Lock()
+	defer n.smu.Unlock()
+	m := n.store[tth]
+	if m == nil {
+		m = make(map[adc.CID]*storedSource)
+		n.store[tth] = m
+	}
+	if _, ok := m[s.ID]; !ok && len(m) >= maxSources {
+		return
+	}
+	m[s.ID] = &storedSource{Source: s, expires: time.Now().Add(n.conf.SourceTTL)}
+}
+
+// Sources returns the sources of the file published to this node.
+func (n *Node) Sources(tth adc.TTH) []Source {
+	now := time.Now()
+	n.smu.RLock()
+	defer n.smu.RUnlock()
+	var out []Source
+	for _, s := range n.store[tth] {
+		if now.Before(s.expires) {
+			out = append(out, s.Source)
+		}
+	}
+	return out
+}
+
+func (n *Node) expireSources(now time.Time) {
+	n.smu.Lock()
+	defer n.smu.Unlock()
+	for tth, m := range n.store {
+		for id, s := range m {
+			if !now.Before(s.expires) {
+				delete(m, id)
+			}
+		}
+		if len(m) == 0 {
+			delete(n.store, tth)
+		}
+	}
+}
+
+// keepAlive pings the nodes that were not seen recently, to detect dead nodes and to keep NAT mappings open.
+func (n *Node) keepAlive() {
+	defer n.wg.Done()
+	interval := n.conf.KeepAlive / 2
+	if n.conf.Timeout < n.conf.KeepAlive {
+		interval = n.conf.Timeout / 2
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.closed:
+			return
+		case now := <-ticker.C:
+			n.expireSources(now)
+			n.checkNodes(now)
+		}
+	}
+}
+
+func (n *Node) checkNodes(now time.Time) {
+	var ping []NodeAddr
+	inTable := make(map[adc.CID]bool)
+	n.mu.Lock()
+	for _, node := range n.table.Nodes() {
+		inTable[node.ID] = true
+		sent, ok := n.pinging[node.ID]
+		switch {
+		case ok && node.LastSeen.After(sent):
+			delete(n.pinging, node.ID)
+		case ok && now.Sub(sent) > n.conf.Timeout:
+			delete(n.pinging, node.ID)
+			n.table.Failed(node.ID, n.conf.MaxFailed)
+		case !ok && now.Sub(node.LastSeen) >= n.conf.KeepAlive:
+			n.pinging[node.ID] = now
+			ping = append(ping, node.NodeAddr)
+		}
+	}
+	// unverified nodes that never replied
+	for id, sent := range n.pinging {
+		if !inTable[id] && now.Sub(sent) > n.conf.Timeout {
+			delete(n.pinging, id)
+		}
+	}
+	// keys of nodes that are not in the table anymore
+	for id := range n.keys {
+		if _, ok := n.pinging[id]; !ok && !inTable[id] {
+			delete(n.keys, id)
+		}
+	}
+	n.mu.Unlock()
+	for _, a := range ping {
+		_ = n.send(a, n.info(InfoPing))
+	}
+}
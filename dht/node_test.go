@@ -0,0 +1,148 @@
+package dht
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+func newTestNode(t *testing.T, conf *Config) *Node {
+	if conf == nil {
+		conf = &Config{}
+	}
+	if conf.Timeout == 0 {
+		conf.Timeout = time.Second
+	}
+	n, err := Listen("127.0.0.1:0", conf)
+	require.NoError(t, err)
+	return n
+}
+
+func testNodeAddr(n *Node) NodeAddr {
+	return NodeAddr{ID: n.ID(), Addr: n.LocalAddr().(*net.UDPAddr)}
+}
+
+func TestNodes(t *testing.T) {
+	const num = 8
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var nodes []*Node
+	defer func() {
+		for _, n := range nodes {
+			_ = n.Close()
+		}
+	}()
+	for i := 0; i < num; i++ {
+		n := newTestNode(t, &Config{Info: Info{Name: "node" + strconv.Itoa(i)}})
+		nodes = append(nodes, n)
+		if i == 0 {
+			continue
+		}
+		// the ID of the bootstrap node is not known
+		err := n.Bootstrap(ctx, []NodeAddr{{Addr: testNodeAddr(nodes[0]).Addr}})
+		require.NoError(t, err)
+		require.NotZero(t, n.Table().Len())
+		_, ok := nodes[0].Table().Get(n.ID())
+		require.True(t, ok, "node %d is not verified", i)
+	}
+	require.Equal(t, num-1, nodes[0].Table().Len())
+	// late nodes learn about the earlier ones from the node list and lookups
+	require.True(t, nodes[num-1].Table().Len() > 1)
+
+	id, err := nodes[1].Ping(ctx, testNodeAddr(nodes[2]))
+	require.NoError(t, err)
+	require.Equal(t, nodes[2].ID(), id)
+
+	closest, err := nodes[num-1].FindNode(ctx, nodes[3].ID())
+	require.NoError(t, err)
+	require.NotEmpty(t, closest)
+	require.Equal(t, nodes[3].ID(), closest[0].ID)
+
+	tth := adc.TTH(tiger.HashBytes([]byte("file")))
+	cnt, err := nodes[1].Publish(ctx, tth, 42, false)
+	require.NoError(t, err)
+	require.NotZero(t, cnt)
+
+	stored := 0
+	for _, n := range nodes {
+		for _, s := range n.Sources(tth) {
+			require.Equal(t, nodes[1].ID(), s.ID)
+			stored++
+		}
+	}
+	require.Equal(t, cnt, stored)
+
+	sources, err := nodes[num-1].Search(ctx, tth)
+	require.NoError(t, err)
+	require.Len(t, sources, 1)
+	require.Equal(t, nodes[1].ID(), sources[0].ID)
+	require.Equal(t, testNodeAddr(nodes[1]).Addr.String(), sources[0].Addr.String())
+	require.Equal(t, int64(42), sources[0].Size)
+	require.False(t, sources[0].Partial)
+
+	sources, err = nodes[num-1].Search(ctx, adc.TTH(tiger.HashBytes([]byte("other"))))
+	require.NoError(t, err)
+	require.Empty(t, sources)
+}
+
+func TestNodeKeepAlive(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conf := &Config{KeepAlive: 50 * time.Millisecond, Timeout: 100 * time.Millisecond, MaxFailed: 1}
+	a := newTestNode(t, conf)
+	defer a.Close()
+	b := newTestNode(t, nil)
+	defer b.Close()
+
+	_, err := a.Ping(ctx, testNodeAddr(b))
+	require.NoError(t, err)
+	info, ok := a.Table().Get(b.ID())
+	require.True(t, ok)
+
+	// node is pinged periodically
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		cur, ok := a.Table().Get(b.ID())
+		require.True(t, ok)
+		if cur.LastSeen.After(info.LastSeen) {
+			break
+		}
+		require.True(t, time.Now().Before(deadline), "no keep-alive")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// dead node is removed
+	require.NoError(t, b.Close())
+	for a.Table().Len() != 0 {
+		require.True(t, time.Now().Before(deadline), "node was not removed")
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNodePublishUnverified(t *testing.T) {
+	a := newTestNode(t, nil)
+	defer a.Close()
+	b := newTestNode(t, nil)
+	defer b.Close()
+
+	// spoofed publish is not encrypted with the UDP key of b
+	tth := adc.TTH(tiger.HashBytes([]byte("file")))
+	err := a.send(testNodeAddr(b), Publish{TTH: tth, Size: 1})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// b verifies a in the meantime, thus the ping from a is processed after the publish
+	_, err = a.Ping(ctx, testNodeAddr(b))
+	require.NoError(t, err)
+	require.Empty(t, b.Sources(tth))
+}
@@ -0,0 +1,177 @@
+package dht
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/rand"
+	"crypto/rc4"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+const (
+	// packetHeader is the first byte of each plain DHT packet (ADC UDP command).
+	packetHeader = 'U'
+	// packetFooter is the last byte of each plain DHT packet.
+	packetFooter = '\n'
+	// packedHeader is the first byte of zlib-compressed packets.
+	packedHeader = 0xc1
+	// magicByte is the first byte of the decrypted payload. It's used to check if the key is valid.
+	magicByte = 0x5b
+
+	// maxPacket is the max size of UDP packet, and the max size of decompressed data.
+	maxPacket = 64 * 1024
+)
+
+var (
+	errShortPacket   = errors.New("dht: short packet")
+	errDecrypt       = errors.New("dht: cannot decrypt the packet")
+	errInvalidPacket = errors.New("dht: invalid packet")
+	errTooLarge      = errors.New("dht: decompressed data is too large")
+)
+
+// Key is a UDP key of the node. Each node sends a key derived from its secret and the IP address
+// of the receiver in UK field of each packet. The receiver encrypts the following packets to this node
+// with this key, thus the sender can verify that the receiver owns the IP address it claims.
+type Key = tiger.Hash
+
+// encryptionKey returns RC4 key for packets sent to a given node.
+// The UDP key received from this node is used, if any.
+func encryptionKey(target adc.CID, key Key) []byte {
+	h := tiger.New()
+	if !key.IsZero() {
+		_, _ = h.Write(key[:])
+	}
+	_, _ = h.Write(target[:])
+	return h.Sum(nil)
+}
+
+// compressPacket compresses the packet. It returns the packet unchanged if it cannot be compressed.
+func compressPacket(data []byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte(packedHeader)
+	zw, err := zlib.NewWriterLevel(buf, zlib.BestCompression)
+	if err != nil {
+		return data
+	}
+	if _, err = zw.Write(data); err != nil {
+		return data
+	}
+	if err = zw.Close(); err != nil || buf.Len() > len(data) {
+		return data
+	}
+	return buf.Bytes()
+}
+
+// decompress reads zlib-compressed data, up to maxPacket bytes.
+func decompress(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	out, err := ioutil.ReadAll(io.LimitReader(zr, maxPacket+1))
+	if err != nil {
+		return nil, err
+	} else if len(out) > maxPacket {
+		return nil, errTooLarge
+	}
+	return out, nil
+}
+
+// encryptPacket encrypts the packet with RC4. The first byte is random and is never equal to the header
+// of plain packets, the second one is magicByte. Both the magic byte and the packet are encrypted.
+func encryptPacket(data []byte, target adc.CID, key Key) ([]byte, error) {
+	c, err := rc4.NewCipher(encryptionKey(target, key))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data)+2)
+	if _, err = rand.Read(out[:1]); err != nil {
+		return nil, err
+	}
+	if out[0] == packetHeader || out[0] == packedHeader {
+		out[0]++
+	}
+	out[1] = magicByte
+	copy(out[2:], data)
+	c.XORKeyStream(out[1:], out[1:])
+	return out, nil
+}
+
+// decryptPacket decrypts the packet sent to the node with a given ID. It first tries the UDP key
+// the node sent to the address of the sender, and then tries to decrypt the packet with the node ID only.
+// It reports if the packet was encrypted with the UDP key.
+func decryptPacket(data []byte, self adc.CID, key Key) ([]byte, bool, error) {
+	if len(data) < 2 {
+		return nil, false, errShortPacket
+	}
+	out := make([]byte, len(data)-1)
+	for _, k := range []Key{key, {}} {
+		c, err := rc4.NewCipher(encryptionKey(self, k))
+		if err != nil {
+			return nil, false, err
+		}
+		c.XORKeyStream(out, data[1:])
+		if out[0] == magicByte {
+			return out[1:], !k.IsZero(), nil
+		}
+	}
+	return nil, false, errDecrypt
+}
+
+// encodePacket encodes the packet sent to a given node, compresses and encrypts it. If the node ID is not known,
+// the packet is not encrypted.
+func encodePacket(p *adc.UDPPacket, target adc.CID, key Key) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := p.MarshalPacketADC(buf); err != nil {
+		return nil, err
+	}
+	data := compressPacket(buf.Bytes())
+	if target.IsZero() {
+		return data, nil
+	}
+	return encryptPacket(data, target, key)
+}
+
+// decodePacket decrypts and decompresses the packet received by the node. The key must be the UDP key
+// the node sends to the address of the sender. It reports if the packet was encrypted with this key.
+//
+// The message of the packet is not decoded.
+func decodePacket(data []byte, self adc.CID, key Key) (*adc.UDPPacket, bool, error) {
+	if len(data) == 0 {
+		return nil, false, errShortPacket
+	}
+	var (
+		valid bool
+		err   error
+	)
+	if data[0] != packetHeader && data[0] != packedHeader {
+		data, valid, err = decryptPacket(data, self, key)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if len(data) != 0 && data[0] == packedHeader {
+		data, err = decompress(data[1:])
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	// U + command name + separator
+	const minLen = 1 + len(adc.MsgType{}) + 1
+	if len(data) < minLen || data[0] != packetHeader || data[len(data)-1] != packetFooter || data[4] != ' ' {
+		return nil, false, errInvalidPacket
+	}
+	var name adc.MsgType
+	copy(name[:], data[1:4])
+	p := &adc.UDPPacket{}
+	if err = p.UnmarshalPacketADC(name, data[5:]); err != nil {
+		return nil, false, err
+	}
+	return p, valid, nil
+}
@@ -0,0 +1,132 @@
+package dht
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+func testPacket(m adc.Message) *adc.UDPPacket {
+	return &adc.UDPPacket{ID: adc.CID(tiger.HashBytes([]byte("node"))), Msg: m}
+}
+
+func TestPacketPlain(t *testing.T) {
+	p := testPacket(Info{Type: InfoPing, Name: "a b"})
+	data, err := encodePacket(p, adc.CID{}, Key{})
+	require.NoError(t, err)
+	require.Equal(t, "UINF "+p.ID.Base32()+" TY1 NIa\\sb\n", string(data))
+
+	got, valid, err := decodePacket(data, testID(0x02), Key{})
+	require.NoError(t, err)
+	require.False(t, valid)
+	require.Equal(t, p.ID, got.ID)
+	require.Equal(t, "TY1 NIa\\sb", string(got.Msg.(*adc.RawMessage).Data))
+}
+
+func TestPacketEncrypted(t *testing.T) {
+	self := testID(0x02)
+	key := tiger.HashBytes([]byte("key"))
+	// long enough to be compressed
+	p := testPacket(Info{Name: strings.Repeat("a", 200)})
+
+	data, err := encodePacket(p, self, key)
+	require.NoError(t, err)
+	require.NotEqual(t, byte(packetHeader), data[0])
+	require.NotEqual(t, byte(packedHeader), data[0])
+	require.False(t, bytes.Contains(data, []byte("INF")))
+
+	got, valid, err := decodePacket(data, self, key)
+	require.NoError(t, err)
+	require.True(t, valid)
+	require.Equal(t, p.ID, got.ID)
+
+	// the key is not the one we sent to the sender
+	_, _, err = decodePacket(data, self, tiger.HashBytes([]byte("other")))
+	require.Error(t, err)
+
+	// sender does not know our key yet
+	data, err = encodePacket(p, self, Key{})
+	require.NoError(t, err)
+	got, valid, err = decodePacket(data, self, key)
+	require.NoError(t, err)
+	require.False(t, valid)
+	require.Equal(t, p.ID, got.ID)
+
+	// encrypted for a different node
+	_, _, err = decodePacket(data, testID(0x03), key)
+	require.Error(t, err)
+}
+
+func TestPacketInvalid(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"U",
+		"UINF",
+		"UINF \n",
+		"UINF " + testID(0x01).Base32(),
+		"\xc1garbage",
+	} {
+		_, _, err := decodePacket([]byte(data), testID(0x02), Key{})
+		require.Error(t, err, "%q", data)
+	}
+}
+
+func TestMessageKey(t *testing.T) {
+	key := tiger.HashBytes([]byte("key"))
+	buf := bytes.NewBuffer(nil)
+	err := adc.Marshal(buf, withKey{Message: Search{Term: "T", Type: SearchNode, Token: "1"}, key: key})
+	require.NoError(t, err)
+	require.Equal(t, "TRT TY2 TO1 UK"+key.Base32(), buf.String())
+
+	var kp keyParam
+	require.NoError(t, adc.Unmarshal(buf.Bytes(), &kp))
+	require.Equal(t, key, kp.Key)
+
+	var s Search
+	require.NoError(t, unmarshal(buf.Bytes(), &s, 0))
+	require.Equal(t, Search{Term: "T", Type: SearchNode, Token: "1"}, s)
+}
+
+func TestMessageBinary(t *testing.T) {
+	data := []byte("a b\\c\nd\x00")
+	buf := bytes.NewBuffer(nil)
+	err := adc.Marshal(buf, Send{Type: getNodes, Path: nodesFile, Data: data})
+	require.NoError(t, err)
+	require.Equal(t, "nodes dht.xml a\\sb\\\\c\\nd\x00", buf.String())
+
+	var m Send
+	require.NoError(t, unmarshal(buf.Bytes(), &m, 3))
+	require.Equal(t, binaryData(data), m.Data)
+
+	require.Error(t, unmarshal([]byte("nodes"), &m, 3))
+}
+
+func TestNodeList(t *testing.T) {
+	a := NodeAddr{ID: testID(0x01), Addr: testAddr}
+	l := &nodeList{
+		Nodes:   []listNode{newListNode(a)},
+		Sources: []listSource{{listNode: newListNode(a), Size: 10, Partial: 1}},
+	}
+	data, err := encodeList(l)
+	require.NoError(t, err)
+
+	got, err := decodeList(data)
+	require.NoError(t, err)
+	require.Equal(t, l.Nodes, got.Nodes)
+	require.Equal(t, l.Sources, got.Sources)
+
+	n, err := got.Nodes[0].addr()
+	require.NoError(t, err)
+	require.Equal(t, a.ID, n.ID)
+	require.Equal(t, testAddr.String(), n.Addr.String())
+
+	_, err = listNode{ID: a.ID.Base32(), IP: "::1", Port: 1}.addr()
+	require.Error(t, err)
+	_, err = listNode{ID: a.ID.Base32(), IP: "127.0.0.1", Port: 0}.addr()
+	require.Error(t, err)
+}
@@ -0,0 +1,220 @@
+package dht
+
+import (
+	"math/bits"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dc/adc"
+)
+
+// DefaultK is a default size of Kademlia buckets, as used by DC++.
+const DefaultK = 10
+
+// idBits is a number of bits in the node ID.
+const idBits = len(adc.CID{}) * 8
+
+// Distance returns a XOR distance between two IDs.
+func Distance(a, b adc.CID) (d adc.CID) {
+	for i := range a {
+		d[i] = a[i] ^ b[i]
+	}
+	return d
+}
+
+// closer checks if a is closer to the target than b.
+func closer(target, a, b adc.CID) bool {
+	for i := range target {
+		da, db := a[i]^target[i], b[i]^target[i]
+		if da != db {
+			return da < db
+		}
+	}
+	return false
+}
+
+// commonPrefix returns a number of common leading bits of two IDs.
+func commonPrefix(a, b adc.CID) int {
+	for i := range a {
+		if x := a[i] ^ b[i]; x != 0 {
+			return i*8 + bits.LeadingZeros8(x)
+		}
+	}
+	return idBits
+}
+
+// NodeInfo is a node entry in the routing table.
+type NodeInfo struct {
+	NodeAddr
+	// LastSeen is the last time a verified packet was received from the node.
+	LastSeen time.Time
+	// Failed is the number of requests to the node that timed out since LastSeen.
+	Failed int
+}
+
+// NewTable creates a routing table for the node with a given ID.
+// If k is zero, DefaultK is used.
+func NewTable(self adc.CID, k int) *Table {
+	if k <= 0 {
+		k = DefaultK
+	}
+	return &Table{self: self, k: k}
+}
+
+// Table is a Kademlia routing table. Nodes are grouped into buckets by the length of the common
+// ID prefix with the local node. Each bucket holds up to K nodes, ordered from least to most recently seen.
+//
+// It's safe for a concurrent use.
+type Table struct {
+	self adc.CID
+	k    int
+
+	mu      sync.RWMutex
+	buckets [idBits][]*NodeInfo
+}
+
+// Self returns the ID of the local node.
+func (t *Table) Self() adc.CID {
+	return t.self
+}
+
+// K returns the bucket size.
+func (t *Table) K() int {
+	return t.k
+}
+
+// bucket returns the bucket for a given ID. It returns nil for the ID of the local node,
+// since it is never stored in the table.
+func (t *Table) bucket(id adc.CID) *[]*NodeInfo {
+	i := commonPrefix(t.self, id)
+	if i >= idBits {
+		return nil
+	}
+	return &t.buckets[i]
+}
+
+// Update records that a verified packet was received from the node. The node is added to the table
+// if the bucket is not full, or if the least recently seen node in the bucket failed to respond.
+// It returns false if the node was not added.
+func (t *Table) Update(id adc.CID, addr *net.UDPAddr, now time.Time) bool {
+	if id == t.self || id.IsZero() {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.bucket(id)
+	for i, n := range *b {
+		if n.ID == id {
+			n.Addr = addr
+			n.LastSeen = now
+			n.Failed = 0
+			// move to the tail
+			copy((*b)[i:], (*b)[i+1:])
+			(*b)[len(*b)-1] = n
+			return true
+		}
+	}
+	n := &NodeInfo{NodeAddr: NodeAddr{ID: id, Addr: addr}, LastSeen: now}
+	if len(*b) < t.k {
+		*b = append(*b, n)
+		return true
+	}
+	if (*b)[0].Failed == 0 {
+		// prefer old nodes that are still alive
+		return false
+	}
+	copy(*b, (*b)[1:])
+	(*b)[len(*b)-1] = n
+	return true
+}
+
+// Failed records that the request to the node timed out. The node is removed if it failed
+// more than a given number of times in a row.
+func (t *Table) Failed(id adc.CID, max int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.bucket(id)
+	if b == nil {
+		return
+	}
+	for i, n := range *b {
+		if n.ID != id {
+			continue
+		}
+		n.Failed++
+		if n.Failed > max {
+			*b = append((*b)[:i], (*b)[i+1:]...)
+		}
+		return
+	}
+}
+
+// Remove the node from the table.
+func (t *Table) Remove(id adc.CID) {
+	t.Failed(id, -1)
+}
+
+// Get returns the node with a given ID.
+func (t *Table) Get(id adc.CID) (NodeInfo, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	b := t.bucket(id)
+	if b == nil {
+		return NodeInfo{}, false
+	}
+	for _, n := range *b {
+		if n.ID == id {
+			return *n, true
+		}
+	}
+	return NodeInfo{}, false
+}
+
+// Len returns the number of nodes in the table.
+func (t *Table) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	cnt := 0
+	for _, b := range t.buckets {
+		cnt += len(b)
+	}
+	return cnt
+}
+
+// Nodes returns all nodes in the table.
+func (t *Table) Nodes() []NodeInfo {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var out []NodeInfo
+	for _, b := range t.buckets {
+		for _, n := range b {
+			out = append(out, *n)
+		}
+	}
+	return out
+}
+
+// Closest returns up to n nodes that are closest to the target, ordered by the distance.
+func (t *Table) Closest(target adc.CID, n int) []NodeAddr {
+	t.mu.RLock()
+	var out []NodeAddr
+	for _, b := range t.buckets {
+		for _, node := range b {
+			out = append(out, node.NodeAddr)
+		}
+	}
+	t.mu.RUnlock()
+	sortByDistance(target, out)
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+func sortByDistance(target adc.CID, nodes []NodeAddr) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return closer(target, nodes[i].ID, nodes[j].ID)
+	})
+}
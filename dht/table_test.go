@@ -0,0 +1,146 @@
+package dht
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dc/adc"
+)
+
+func testID(b ...byte) (id adc.CID) {
+	copy(id[:], b)
+	return id
+}
+
+var testAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}
+
+func TestDistance(t *testing.T) {
+	require.Equal(t, testID(0x81, 0x01), Distance(testID(0x80, 0x01), testID(0x01)))
+	require.True(t, Distance(testID(0x42), testID(0x42)).IsZero())
+}
+
+func TestTableClosest(t *testing.T) {
+	tb := NewTable(testID(0x00), 2)
+	now := time.Now()
+
+	require.True(t, tb.Update(testID(0x80), testAddr, now))
+	require.True(t, tb.Update(testID(0x81), testAddr, now))
+	// bucket is full, and old nodes are alive
+	require.False(t, tb.Update(testID(0x82), testAddr, now))
+	require.True(t, tb.Update(testID(0x40), testAddr, now))
+	require.True(t, tb.Update(testID(0x01), testAddr, now))
+	require.False(t, tb.Update(testID(0x00), testAddr, now), "self")
+	require.Equal(t, 4, tb.Len())
+
+	var ids []adc.CID
+	for _, n := range tb.Closest(testID(0x81), 3) {
+		ids = append(ids, n.ID)
+	}
+	require.Equal(t, []adc.CID{testID(0x81), testID(0x80), testID(0x01)}, ids)
+
+	// failed node is replaced by a new one
+	tb.Failed(testID(0x80), 2)
+	require.True(t, tb.Update(testID(0x82), testAddr, now))
+	_, ok := tb.Get(testID(0x80))
+	require.False(t, ok)
+
+	tb.Remove(testID(0x40))
+	require.Equal(t, 3, tb.Len())
+}
+
+func TestTableNew(t *testing.T) {
+	tb := NewTable(testID(0x01), 0)
+	require.Equal(t, testID(0x01), tb.Self())
+	require.Equal(t, DefaultK, tb.K())
+	require.Equal(t, 0, tb.Len())
+	require.Empty(t, tb.Nodes())
+	require.Empty(t, tb.Closest(testID(0x02), 10))
+
+	tb = NewTable(testID(0x01), 3)
+	require.Equal(t, 3, tb.K())
+}
+
+func TestTableSelf(t *testing.T) {
+	self := testID(0x01)
+	tb := NewTable(self, 2)
+	require.True(t, tb.Update(testID(0x80), testAddr, time.Now()))
+
+	// none of the methods should panic for the local node ID
+	require.False(t, tb.Update(self, testAddr, time.Now()))
+	_, ok := tb.Get(self)
+	require.False(t, ok)
+	tb.Failed(self, 0)
+	tb.Remove(self)
+	require.Equal(t, 1, tb.Len())
+	require.Len(t, tb.Closest(self, 10), 1)
+
+	// zero ID is rejected as well
+	require.False(t, tb.Update(adc.CID{}, testAddr, time.Now()))
+}
+
+func TestTableUpdate(t *testing.T) {
+	tb := NewTable(testID(0x00), 2)
+	t1 := time.Unix(100, 0)
+	t2 := time.Unix(200, 0)
+	addr2 := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2}
+
+	require.True(t, tb.Update(testID(0x80), testAddr, t1))
+	require.True(t, tb.Update(testID(0x81), testAddr, t1))
+	tb.Failed(testID(0x80), 5)
+
+	n, ok := tb.Get(testID(0x80))
+	require.True(t, ok)
+	require.Equal(t, 1, n.Failed)
+
+	// update resets the failure count and moves the node to the tail
+	require.True(t, tb.Update(testID(0x80), addr2, t2))
+	n, ok = tb.Get(testID(0x80))
+	require.True(t, ok)
+	require.Equal(t, NodeInfo{NodeAddr: NodeAddr{ID: testID(0x80), Addr: addr2}, LastSeen: t2}, n)
+
+	// the least recently seen node is now 0x81
+	tb.Failed(testID(0x81), 5)
+	require.True(t, tb.Update(testID(0x82), testAddr, t2))
+	_, ok = tb.Get(testID(0x81))
+	require.False(t, ok)
+	require.Equal(t, 2, tb.Len())
+}
+
+func TestTableFailed(t *testing.T) {
+	tb := NewTable(testID(0x00), 2)
+	require.True(t, tb.Update(testID(0x80), testAddr, time.Now()))
+
+	tb.Failed(testID(0x80), 1)
+	n, ok := tb.Get(testID(0x80))
+	require.True(t, ok)
+	require.Equal(t, 1, n.Failed)
+
+	// removed when it fails more than max times
+	tb.Failed(testID(0x80), 1)
+	_, ok = tb.Get(testID(0x80))
+	require.False(t, ok)
+	require.True(t, tb.Update(testID(0x80), testAddr, time.Now()))
+
+	// unknown nodes are ignored
+	tb.Failed(testID(0x40), 0)
+	tb.Remove(testID(0x40))
+	require.Equal(t, 1, tb.Len())
+}
+
+func TestTableNodes(t *testing.T) {
+	tb := NewTable(testID(0x00), 2)
+	now := time.Now()
+	for _, id := range []adc.CID{testID(0x80), testID(0x40), testID(0x01)} {
+		require.True(t, tb.Update(id, testAddr, now))
+	}
+	var ids []adc.CID
+	for _, n := range tb.Nodes() {
+		ids = append(ids, n.ID)
+		require.Equal(t, now, n.LastSeen)
+	}
+	require.ElementsMatch(t, []adc.CID{testID(0x80), testID(0x40), testID(0x01)}, ids)
+	require.Len(t, tb.Closest(testID(0x80), 2), 2)
+}
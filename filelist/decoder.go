@@ -0,0 +1,228 @@
+package filelist
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/htmlindex"
+
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+// Token is a single element returned by the Decoder: *DirStart, DirEnd or *File.
+type Token interface {
+	isToken()
+}
+
+// DirStart starts a directory. All tokens until the matching DirEnd belong to this directory.
+type DirStart struct {
+	Name       string
+	Incomplete bool
+	Time       time.Time
+}
+
+// DirEnd ends the directory.
+type DirEnd struct{}
+
+func (*DirStart) isToken() {}
+func (DirEnd) isToken()    {}
+func (*File) isToken()     {}
+
+var errNoListing = errors.New("filelist: no FileListing element")
+
+// bzip2Magic is the header of bzip2 streams.
+var bzip2Magic = []byte("BZh")
+
+// NewDecoder creates a streaming file list decoder. Compressed lists are detected automatically.
+//
+// The decoder tolerates common quirks of file lists produced by different clients:
+// non-UTF-8 encodings, control characters in names, invalid or missing sizes, TTHs and timestamps.
+func NewDecoder(r io.Reader) (*Decoder, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(bzip2Magic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	var rd io.Reader = br
+	if string(magic) == string(bzip2Magic) {
+		rd = bzip2.NewReader(br)
+	}
+	x := xml.NewDecoder(&controlFilter{r: rd})
+	x.Strict = false
+	x.CharsetReader = func(label string, r io.Reader) (io.Reader, error) {
+		enc, err := htmlindex.Get(label)
+		if err != nil {
+			return nil, err
+		}
+		return enc.NewDecoder().Reader(r), nil
+	}
+	return &Decoder{x: x}, nil
+}
+
+// Decoder reads file list elements one by one.
+type Decoder struct {
+	x     *xml.Decoder
+	hdr   *Header
+	depth int // directory depth
+	done  bool
+}
+
+// Header reads the FileListing element and returns its attributes.
+func (d *Decoder) Header() (*Header, error) {
+	if d.hdr != nil {
+		return d.hdr, nil
+	}
+	for {
+		tok, err := d.x.Token()
+		if err == io.EOF {
+			return nil, errNoListing
+		} else if err != nil {
+			return nil, err
+		}
+		st, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if st.Name.Local != "FileListing" {
+			return nil, fmt.Errorf("filelist: unexpected element: %q", st.Name.Local)
+		}
+		h := &Header{Base: "/"}
+		for _, a := range st.Attr {
+			switch a.Name.Local {
+			case "Version":
+				h.Version, _ = strconv.Atoi(strings.TrimSpace(a.Value))
+			case "CID":
+				// some clients send invalid CIDs, ignore them
+				_ = h.CID.FromBase32(strings.TrimSpace(a.Value))
+			case "Base":
+				if a.Value != "" {
+					h.Base = a.Value
+				}
+			case "Generator":
+				h.Generator = a.Value
+			}
+		}
+		d.hdr = h
+		return h, nil
+	}
+}
+
+// Next returns the next element of the file list. It returns io.EOF at the end of the list.
+func (d *Decoder) Next() (Token, error) {
+	if _, err := d.Header(); err != nil {
+		return nil, err
+	}
+	if d.done {
+		return nil, io.EOF
+	}
+	for {
+		tok, err := d.x.Token()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch tok.Name.Local {
+			case "Directory":
+				d.depth++
+				return decodeDir(tok.Attr), nil
+			case "File":
+				f := decodeFile(tok.Attr)
+				if err = d.x.Skip(); err != nil {
+					return nil, err
+				}
+				return f, nil
+			default:
+				// unknown element
+				if err = d.x.Skip(); err != nil {
+					return nil, err
+				}
+			}
+		case xml.EndElement:
+			switch tok.Name.Local {
+			case "Directory":
+				if d.depth == 0 {
+					// unmatched end element
+					continue
+				}
+				d.depth--
+				return DirEnd{}, nil
+			case "FileListing":
+				if d.depth != 0 {
+					return nil, errors.New("filelist: unclosed directory")
+				}
+				d.done = true
+				return nil, io.EOF
+			}
+		}
+	}
+}
+
+func decodeDir(attrs []xml.Attr) *DirStart {
+	dir := &DirStart{}
+	for _, a := range attrs {
+		switch a.Name.Local {
+		case "Name":
+			dir.Name = a.Value
+		case "Incomplete":
+			dir.Incomplete = a.Value == "1" || strings.EqualFold(a.Value, "true")
+		case "Date", "TS":
+			dir.Time = parseTime(a.Value)
+		}
+	}
+	return dir
+}
+
+func decodeFile(attrs []xml.Attr) *File {
+	f := &File{}
+	for _, a := range attrs {
+		switch a.Name.Local {
+		case "Name":
+			f.Name = a.Value
+		case "Size":
+			// negative or invalid sizes are reported as zero
+			f.Size, _ = strconv.ParseUint(strings.TrimSpace(a.Value), 10, 64)
+		case "TTH":
+			if err := f.TTH.FromBase32(strings.TrimSpace(a.Value)); err != nil {
+				f.TTH = tiger.Hash{}
+			}
+		case "Date", "TS":
+			f.Time = parseTime(a.Value)
+		}
+	}
+	return f
+}
+
+// parseTime parses a Unix timestamp. Zero or invalid values are returned as zero time.
+func parseTime(s string) time.Time {
+	v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || v <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(v, 0).UTC()
+}
+
+// controlFilter replaces control characters that are not allowed in XML with spaces.
+// Some clients write them as-is in file names.
+type controlFilter struct {
+	r io.Reader
+}
+
+func (f *controlFilter) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	for i, b := range p[:n] {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' {
+			p[i] = ' '
+		}
+	}
+	return n, err
+}
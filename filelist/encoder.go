@@ -0,0 +1,174 @@
+package filelist
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dsnet/compress/bzip2"
+)
+
+const xmlHeader = `<?xml version="1.0" encoding="utf-8" standalone="yes"?>` + "\r\n"
+
+var (
+	errNoHeader    = errors.New("filelist: header is not written")
+	errNoDirectory = errors.New("filelist: no open directory")
+	errInvalidName = errors.New("filelist: invalid file name")
+)
+
+// NewEncoder creates a streaming file list encoder. The writer must be closed to finish the list.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w)}
+}
+
+// Encoder writes file list elements one by one, in the format used by DC++.
+type Encoder struct {
+	w      *bufio.Writer
+	header bool
+	depth  int
+	err    error
+}
+
+func (e *Encoder) indent() {
+	for i := 0; i <= e.depth; i++ {
+		e.w.WriteByte('\t')
+	}
+}
+
+func (e *Encoder) attr(name, val string) {
+	e.w.WriteByte(' ')
+	e.w.WriteString(name)
+	e.w.WriteString(`="`)
+	if e.err == nil {
+		e.err = xml.EscapeText(e.w, []byte(val))
+	}
+	e.w.WriteByte('"')
+}
+
+// WriteHeader starts the list. It must be called before writing any other elements.
+// If the version is not set, the current format version is used.
+func (e *Encoder) WriteHeader(h *Header) error {
+	if e.header {
+		return errors.New("filelist: header is already written")
+	}
+	e.header = true
+	vers := h.Version
+	if vers == 0 {
+		vers = Version
+	}
+	base := h.Base
+	if base == "" {
+		base = "/"
+	}
+	e.w.WriteString(xmlHeader)
+	e.w.WriteString("<FileListing")
+	e.attr("Version", strconv.Itoa(vers))
+	if !h.CID.IsZero() {
+		e.attr("CID", h.CID.Base32())
+	}
+	e.attr("Base", base)
+	if h.Generator != "" {
+		e.attr("Generator", h.Generator)
+	}
+	e.w.WriteString(">\r\n")
+	return e.err
+}
+
+// StartDir starts a new directory. All following elements are written into it, until EndDir is called.
+func (e *Encoder) StartDir(d *DirStart) error {
+	if !e.header {
+		return errNoHeader
+	}
+	if !validName(d.Name) {
+		return errInvalidName
+	}
+	e.indent()
+	e.w.WriteString("<Directory")
+	e.attr("Name", d.Name)
+	if d.Incomplete {
+		e.attr("Incomplete", "1")
+	}
+	if !d.Time.IsZero() {
+		e.attr("Date", strconv.FormatInt(d.Time.Unix(), 10))
+	}
+	e.w.WriteString(">\r\n")
+	e.depth++
+	return e.err
+}
+
+// EndDir ends the current directory.
+func (e *Encoder) EndDir() error {
+	if e.depth == 0 {
+		return errNoDirectory
+	}
+	e.depth--
+	e.indent()
+	e.w.WriteString("</Directory>\r\n")
+	return e.err
+}
+
+// WriteFile writes a file into the current directory.
+func (e *Encoder) WriteFile(f *File) error {
+	if !e.header {
+		return errNoHeader
+	}
+	if !validName(f.Name) {
+		return errInvalidName
+	}
+	e.indent()
+	e.w.WriteString("<File")
+	e.attr("Name", f.Name)
+	e.attr("Size", strconv.FormatUint(f.Size, 10))
+	if !f.TTH.IsZero() {
+		e.attr("TTH", f.TTH.Base32())
+	}
+	if !f.Time.IsZero() {
+		e.attr("TS", strconv.FormatInt(f.Time.Unix(), 10))
+	}
+	e.w.WriteString("/>\r\n")
+	return e.err
+}
+
+// Close ends all open directories and the list, and flushes the data. It doesn't close the underlying writer.
+func (e *Encoder) Close() error {
+	if !e.header {
+		return errNoHeader
+	}
+	for e.depth > 0 {
+		if err := e.EndDir(); err != nil {
+			return err
+		}
+	}
+	e.w.WriteString("</FileListing>\r\n")
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+// NewBZip2Writer returns a writer that compresses the file list with bzip2.
+// The writer must be closed to flush the compressed data.
+func NewBZip2Writer(w io.Writer) (io.WriteCloser, error) {
+	return bzip2.NewWriter(w, &bzip2.WriterConfig{Level: bzip2.BestCompression})
+}
+
+// EncodeBZip2 writes the file list compressed with bzip2.
+func EncodeBZip2(w io.Writer, l *FileListing) error {
+	bw, err := NewBZip2Writer(w)
+	if err != nil {
+		return err
+	}
+	if err = Encode(bw, l); err != nil {
+		_ = bw.Close()
+		return err
+	}
+	return bw.Close()
+}
+
+// validName checks if the name can be written to the list.
+func validName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "/\\")
+}
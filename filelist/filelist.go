@@ -0,0 +1,142 @@
+// Package filelist implements a decoder and an encoder for DC file lists (files.xml and files.xml.bz2).
+//
+// The format is shared by ADC and NMDC clients:
+//
+//	<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+//	<FileListing Version="1" CID="..." Base="/" Generator="DC++ 0.868">
+//		<Directory Name="dir">
+//			<File Name="file.txt" Size="1024" TTH="..."/>
+//		</Directory>
+//	</FileListing>
+package filelist
+
+import (
+	"io"
+	"time"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+const (
+	// FileName is the name of the uncompressed file list.
+	FileName = "files.xml"
+	// FileNameBZIP is the name of the compressed file list.
+	FileNameBZIP = adc.FileListBZIP
+	// Version is the version of the file list format.
+	Version = 1
+)
+
+// Header contains attributes of the FileListing element.
+type Header struct {
+	Version int
+	// CID of the user that generated the list. Zero if not set or invalid.
+	CID adc.CID
+	// Base is the path of the root directory of the list. Partial lists have it set to a subdirectory.
+	Base      string
+	Generator string
+}
+
+// FileListing is a decoded file list.
+type FileListing struct {
+	Header
+	Dirs  []Directory
+	Files []File
+}
+
+// Directory is a directory in the file list.
+type Directory struct {
+	Name string
+	// Incomplete is set for directories that have no content in partial lists.
+	Incomplete bool
+	// Time is an optional modification time of the directory.
+	Time  time.Time
+	Dirs  []Directory
+	Files []File
+}
+
+// File is a file in the file list.
+type File struct {
+	Name string
+	Size uint64
+	TTH  tiger.Hash
+	// Time is an optional modification time of the file.
+	Time time.Time
+}
+
+// Decode reads the whole file list. The list may be compressed with bzip2.
+func Decode(r io.Reader) (*FileListing, error) {
+	d, err := NewDecoder(r)
+	if err != nil {
+		return nil, err
+	}
+	h, err := d.Header()
+	if err != nil {
+		return nil, err
+	}
+	l := &FileListing{Header: *h}
+	// stack of open directories
+	var stack []*Directory
+	for {
+		tok, err := d.Next()
+		if err == io.EOF {
+			return l, nil
+		} else if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case *DirStart:
+			dir := Directory{Name: tok.Name, Incomplete: tok.Incomplete, Time: tok.Time}
+			if len(stack) == 0 {
+				l.Dirs = append(l.Dirs, dir)
+				stack = append(stack, &l.Dirs[len(l.Dirs)-1])
+			} else {
+				p := stack[len(stack)-1]
+				p.Dirs = append(p.Dirs, dir)
+				stack = append(stack, &p.Dirs[len(p.Dirs)-1])
+			}
+		case DirEnd:
+			stack = stack[:len(stack)-1]
+		case *File:
+			if len(stack) == 0 {
+				l.Files = append(l.Files, *tok)
+			} else {
+				p := stack[len(stack)-1]
+				p.Files = append(p.Files, *tok)
+			}
+		}
+	}
+}
+
+// Encode writes the file list in uncompressed form. See NewBZip2Writer for compression.
+func Encode(w io.Writer, l *FileListing) error {
+	e := NewEncoder(w)
+	if err := e.WriteHeader(&l.Header); err != nil {
+		return err
+	}
+	if err := encodeContent(e, l.Dirs, l.Files); err != nil {
+		return err
+	}
+	return e.Close()
+}
+
+func encodeContent(e *Encoder, dirs []Directory, files []File) error {
+	for i := range dirs {
+		d := &dirs[i]
+		if err := e.StartDir(&DirStart{Name: d.Name, Incomplete: d.Incomplete, Time: d.Time}); err != nil {
+			return err
+		}
+		if err := encodeContent(e, d.Dirs, d.Files); err != nil {
+			return err
+		}
+		if err := e.EndDir(); err != nil {
+			return err
+		}
+	}
+	for i := range files {
+		if err := e.WriteFile(&files[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
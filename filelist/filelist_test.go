@@ -0,0 +1,130 @@
+package filelist
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/charmap"
+
+	"github.com/direct-connect/go-dc/adc/types"
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+const testTTH = "LWPNACQDBZRYXW3VHJVCJ64QBZNGHOHHHZWCLNQ"
+
+var testList = &FileListing{
+	Header: Header{
+		Version:   1,
+		CID:       types.MustParseCID("SHNTMFFRXU7ZPGTGTEUSJ7UGCH6P6ERXPBAEQUY"),
+		Base:      "/",
+		Generator: "go-dc",
+	},
+	Dirs: []Directory{
+		{
+			Name: "Music",
+			Time: time.Unix(1500000000, 0).UTC(),
+			Dirs: []Directory{
+				{Name: "Empty"},
+				{Name: "Partial", Incomplete: true},
+			},
+			Files: []File{
+				{Name: `a "b" & <c>.mp3`, Size: 1024, TTH: tiger.MustParseBase32(testTTH)},
+			},
+		},
+	},
+	Files: []File{
+		{Name: "file.txt", Size: 10, TTH: tiger.MustParseBase32(testTTH), Time: time.Unix(1600000000, 0).UTC()},
+	},
+}
+
+const testListXML = `<?xml version="1.0" encoding="utf-8" standalone="yes"?>` + "\r\n" +
+	`<FileListing Version="1" CID="SHNTMFFRXU7ZPGTGTEUSJ7UGCH6P6ERXPBAEQUY" Base="/" Generator="go-dc">` + "\r\n" +
+	"\t" + `<Directory Name="Music" Date="1500000000">` + "\r\n" +
+	"\t\t" + `<Directory Name="Empty">` + "\r\n" +
+	"\t\t" + `</Directory>` + "\r\n" +
+	"\t\t" + `<Directory Name="Partial" Incomplete="1">` + "\r\n" +
+	"\t\t" + `</Directory>` + "\r\n" +
+	"\t\t" + `<File Name="a &#34;b&#34; &amp; &lt;c&gt;.mp3" Size="1024" TTH="` + testTTH + `"/>` + "\r\n" +
+	"\t" + `</Directory>` + "\r\n" +
+	"\t" + `<File Name="file.txt" Size="10" TTH="` + testTTH + `" TS="1600000000"/>` + "\r\n" +
+	`</FileListing>` + "\r\n"
+
+func TestEncode(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	err := Encode(buf, testList)
+	require.NoError(t, err)
+	require.Equal(t, testListXML, buf.String())
+
+	l, err := Decode(buf)
+	require.NoError(t, err)
+	require.Equal(t, testList, l)
+}
+
+func TestEncodeBZip2(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	err := EncodeBZip2(buf, testList)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(buf.Bytes(), []byte("BZh")))
+
+	l, err := Decode(buf)
+	require.NoError(t, err)
+	require.Equal(t, testList, l)
+}
+
+func TestDecoderStream(t *testing.T) {
+	d, err := NewDecoder(bytes.NewBufferString(testListXML))
+	require.NoError(t, err)
+	h, err := d.Header()
+	require.NoError(t, err)
+	require.Equal(t, &testList.Header, h)
+
+	var got []Token
+	for {
+		tok, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		got = append(got, tok)
+	}
+	require.Len(t, got, 8)
+	require.Equal(t, &DirStart{Name: "Music", Time: time.Unix(1500000000, 0).UTC()}, got[0])
+	require.Equal(t, DirEnd{}, got[6])
+	require.Equal(t, &testList.Files[0], got[7])
+}
+
+func TestDecodeQuirks(t *testing.T) {
+	var data bytes.Buffer
+	data.WriteString(`<?xml version="1.0" encoding="windows-1251"?>` + "\n")
+	data.WriteString(`<FileListing Version="1" CID="invalid" Generator="old client">` + "\n")
+	name, err := charmap.Windows1251.NewEncoder().String("Музыка")
+	require.NoError(t, err)
+	data.WriteString(`<Directory Name="` + name + `">` + "\n")
+	data.WriteString(`<File Name="bad` + "\x01" + `name" Size="-1" TTH="invalid"/>` + "\n")
+	data.WriteString(`<Unknown><File Name="skipped"/></Unknown>` + "\n")
+	data.WriteString(`<File Name="ok" Size=" 5 " TTH="` + testTTH + `" TS="abc"/>` + "\n")
+	data.WriteString(`</Directory>` + "\n")
+	data.WriteString(`</FileListing>`)
+
+	l, err := Decode(&data)
+	require.NoError(t, err)
+	require.Equal(t, &FileListing{
+		Header: Header{Version: 1, Base: "/", Generator: "old client"},
+		Dirs: []Directory{{
+			Name: "Музыка",
+			Files: []File{
+				{Name: "bad name"},
+				{Name: "ok", Size: 5, TTH: tiger.MustParseBase32(testTTH)},
+			},
+		}},
+	}, l)
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	data := testListXML[:len(testListXML)/2]
+	_, err := Decode(bytes.NewBufferString(data))
+	require.Error(t, err)
+}
@@ -5,6 +5,7 @@ go 1.12
 require (
 	github.com/cxmcc/tiger v0.0.0-20170524142333-bde35e2713d7
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dsnet/compress v0.0.1
 	github.com/stretchr/testify v1.3.0
 	golang.org/x/text v0.3.2
 )
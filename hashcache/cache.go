@@ -0,0 +1,278 @@
+// Package hashcache implements a persistent cache of file hashes (TTH and leaves).
+//
+// The cache is an append-only log of records, with the following format:
+//
+//	file   = magic version *record
+//	magic  = "DCHC"
+//	record = uvarint(len(payload)) payload crc32(payload)
+//
+// The payload contains the operation (put or delete), the file path, size, modification time,
+// inode (if available), TTH and leaves. Records written partially (for example, on a crash)
+// are discarded when the cache is opened. The log is compacted automatically when the number
+// of stale records exceeds the number of live ones.
+package hashcache
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+const (
+	// DefaultBlockSize is the default minimal size of a block covered by a single stored leaf.
+	DefaultBlockSize = 64 * 1024
+
+	// minCompact is the minimal number of stale records that triggers the compaction.
+	minCompact = 1024
+)
+
+// ErrNotFound is returned if there is no entry for a given TTH.
+var ErrNotFound = errors.New("hashcache: not found")
+
+// Options for the cache.
+type Options struct {
+	// BlockSize is the minimal size of a block covered by a single leaf. The leaves are reduced to this
+	// granularity before being stored. DefaultBlockSize is used if not set.
+	BlockSize int64
+}
+
+// Entry is a cached hash of a file.
+type Entry struct {
+	Path    string
+	Size    uint64
+	ModTime time.Time
+	// Inode is the inode number of the file, or zero if it's not available.
+	Inode uint64
+	TTH   tiger.Hash
+}
+
+// entry is an in-memory record of the cache.
+type entry struct {
+	Entry
+	leavesOff int64 // offset of leaves in the file
+	leavesN   int
+}
+
+// Open opens or creates the cache file.
+func Open(path string, opt *Options) (*Cache, error) {
+	c := &Cache{
+		path:  path,
+		files: make(map[string]*entry),
+		byTTH: make(map[tiger.Hash][]*entry),
+	}
+	if opt != nil {
+		c.opt = *opt
+	}
+	if c.opt.BlockSize <= 0 {
+		c.opt.BlockSize = DefaultBlockSize
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	c.f = f
+	if err = c.load(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Cache is a persistent hash cache. Entries are keyed by the file path, size, modification time and inode.
+// It's safe for concurrent use.
+type Cache struct {
+	path string
+	opt  Options
+
+	mu    sync.RWMutex
+	f     *os.File
+	size  int64 // file size
+	files map[string]*entry
+	byTTH map[tiger.Hash][]*entry
+	stale int // number of stale records in the file
+}
+
+// Len returns the number of entries in the cache.
+func (c *Cache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.files)
+}
+
+// Lookup returns the cached entry for a given path.
+func (c *Cache) Lookup(path string) (Entry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e := c.files[path]
+	if e == nil {
+		return Entry{}, false
+	}
+	return e.Entry, true
+}
+
+// Get returns the TTH of the file if it wasn't changed since it was hashed. If the file was changed,
+// the entry is removed from the cache. Get implements share.HashCache.
+func (c *Cache) Get(path string, fi os.FileInfo) (tiger.Hash, bool) {
+	c.mu.RLock()
+	e := c.files[path]
+	c.mu.RUnlock()
+	if e == nil {
+		return tiger.Hash{}, false
+	}
+	if e.matches(fi) {
+		return e.TTH, true
+	}
+	// stale entry, unless it was replaced concurrently
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.files[path] == e {
+		_ = c.remove(path)
+	}
+	return tiger.Hash{}, false
+}
+
+func (e *entry) matches(fi os.FileInfo) bool {
+	if e.Size != uint64(fi.Size()) || !e.ModTime.Equal(fi.ModTime().Round(0)) {
+		return false
+	}
+	if ino := inode(fi); ino != 0 && e.Inode != 0 && ino != e.Inode {
+		return false
+	}
+	return true
+}
+
+// Put stores the TTH and the leaves of the file. The leaves are reduced to the configured block size.
+// Put implements share.HashCache.
+func (c *Cache) Put(path string, fi os.FileInfo, tth tiger.Hash, leaves tiger.Leaves) error {
+	size := uint64(fi.Size())
+	blocks := int((int64(size) + c.opt.BlockSize - 1) / c.opt.BlockSize)
+	e := &entry{Entry: Entry{
+		Path:    path,
+		Size:    size,
+		ModTime: fi.ModTime().Round(0),
+		Inode:   inode(fi),
+		TTH:     tth,
+	}}
+	leaves = leaves.Reduce(blocks)
+
+	payload, pos := encodePut(&e.Entry, leaves)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	off, err := c.appendRecord(payload)
+	if err != nil {
+		return err
+	}
+	e.leavesOff = off + int64(pos)
+	e.leavesN = len(leaves)
+	c.set(e)
+	return c.maybeCompact()
+}
+
+// Remove deletes the entry for a given path.
+func (c *Cache) Remove(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.remove(path)
+}
+
+func (c *Cache) remove(path string) error {
+	if _, ok := c.files[path]; !ok {
+		return nil
+	}
+	if _, err := c.appendRecord(encodeDelete(path)); err != nil {
+		return err
+	}
+	c.del(path)
+	c.stale++ // delete record itself is stale
+	return c.maybeCompact()
+}
+
+// Leaves returns the stored leaves for a given TTH. It can be used to serve tthl requests.
+func (c *Cache) Leaves(tth tiger.Hash) (tiger.Leaves, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	list := c.byTTH[tth]
+	if len(list) == 0 {
+		return nil, ErrNotFound
+	}
+	e := list[0]
+	buf := make([]byte, e.leavesN*tiger.Size)
+	if _, err := c.f.ReadAt(buf, e.leavesOff); err != nil {
+		return nil, err
+	}
+	leaves := make(tiger.Leaves, e.leavesN)
+	for i := range leaves {
+		copy(leaves[i][:], buf[i*tiger.Size:])
+	}
+	return leaves, nil
+}
+
+// Clean removes entries for files that no longer exist or were changed.
+func (c *Cache) Clean() error {
+	c.mu.RLock()
+	list := make([]*entry, 0, len(c.files))
+	for _, e := range c.files {
+		list = append(list, e)
+	}
+	c.mu.RUnlock()
+	var stale []*entry
+	for _, e := range list {
+		fi, err := os.Stat(e.Path)
+		if err != nil || !e.matches(fi) {
+			stale = append(stale, e)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range stale {
+		if c.files[e.Path] != e {
+			continue // replaced concurrently
+		}
+		if err := c.remove(e.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the cache file.
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.f.Close()
+}
+
+// set adds the entry to the index. It must be called with the write lock held.
+func (c *Cache) set(e *entry) {
+	if _, ok := c.files[e.Path]; ok {
+		c.del(e.Path)
+	}
+	c.files[e.Path] = e
+	c.byTTH[e.TTH] = append(c.byTTH[e.TTH], e)
+}
+
+// del removes the entry from the index. The record of the entry becomes stale.
+func (c *Cache) del(path string) {
+	e := c.files[path]
+	if e == nil {
+		return
+	}
+	delete(c.files, path)
+	list := c.byTTH[e.TTH]
+	for i, e2 := range list {
+		if e2 == e {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(c.byTTH, e.TTH)
+	} else {
+		c.byTTH[e.TTH] = list
+	}
+	c.stale++
+}
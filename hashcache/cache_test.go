@@ -0,0 +1,168 @@
+package hashcache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dc/share"
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+var _ share.HashCache = (*Cache)(nil)
+
+type testFile struct {
+	path   string
+	fi     os.FileInfo
+	tth    tiger.Hash
+	leaves tiger.Leaves
+}
+
+func newTestFile(t *testing.T, dir, name string, size int) *testFile {
+	path := filepath.Join(dir, name)
+	data := bytes.Repeat([]byte(name), size/len(name)+1)[:size]
+	err := ioutil.WriteFile(path, data, 0644)
+	require.NoError(t, err)
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	leaves, err := tiger.TreeLeaves(bytes.NewReader(data))
+	require.NoError(t, err)
+	return &testFile{path: path, fi: fi, tth: leaves.TreeHash(), leaves: leaves}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "hashcache_")
+	require.NoError(t, err)
+	return dir
+}
+
+func TestCache(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	cpath := filepath.Join(dir, "hashes.db")
+
+	c, err := Open(cpath, &Options{BlockSize: 4096})
+	require.NoError(t, err)
+
+	f1 := newTestFile(t, dir, "a.bin", 20*1024)
+	f2 := newTestFile(t, dir, "b.bin", 100)
+
+	_, ok := c.Get(f1.path, f1.fi)
+	require.False(t, ok)
+	require.NoError(t, c.Put(f1.path, f1.fi, f1.tth, f1.leaves))
+	require.NoError(t, c.Put(f2.path, f2.fi, f2.tth, f2.leaves))
+
+	h, ok := c.Get(f1.path, f1.fi)
+	require.True(t, ok)
+	require.Equal(t, f1.tth, h)
+
+	leaves, err := c.Leaves(f1.tth)
+	require.NoError(t, err)
+	require.True(t, len(leaves) <= 5)
+	require.Equal(t, f1.tth, leaves.TreeHash())
+	_, err = c.Leaves(tiger.Hash{})
+	require.Equal(t, ErrNotFound, err)
+	require.NoError(t, c.Close())
+
+	// reopen
+	c, err = Open(cpath, &Options{BlockSize: 4096})
+	require.NoError(t, err)
+	defer c.Close()
+	require.Equal(t, 2, c.Len())
+	h, ok = c.Get(f2.path, f2.fi)
+	require.True(t, ok)
+	require.Equal(t, f2.tth, h)
+	leaves, err = c.Leaves(f1.tth)
+	require.NoError(t, err)
+	require.Equal(t, f1.tth, leaves.TreeHash())
+
+	// modified file invalidates the entry
+	mod := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(f2.path, mod, mod))
+	fi, err := os.Stat(f2.path)
+	require.NoError(t, err)
+	_, ok = c.Get(f2.path, fi)
+	require.False(t, ok)
+	require.Equal(t, 1, c.Len())
+
+	// removed file is cleaned
+	require.NoError(t, os.Remove(f1.path))
+	require.NoError(t, c.Clean())
+	require.Equal(t, 0, c.Len())
+}
+
+func TestCacheCompact(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	cpath := filepath.Join(dir, "hashes.db")
+
+	c, err := Open(cpath, nil)
+	require.NoError(t, err)
+	f := newTestFile(t, dir, "a.bin", 3000)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, c.Put(f.path, f.fi, f.tth, f.leaves))
+	}
+	st1, err := os.Stat(cpath)
+	require.NoError(t, err)
+	require.NoError(t, c.Compact())
+	st2, err := os.Stat(cpath)
+	require.NoError(t, err)
+	require.True(t, st2.Size() < st1.Size())
+
+	leaves, err := c.Leaves(f.tth)
+	require.NoError(t, err)
+	require.Equal(t, f.tth, leaves.TreeHash())
+	require.NoError(t, c.Close())
+
+	c, err = Open(cpath, nil)
+	require.NoError(t, err)
+	defer c.Close()
+	require.Equal(t, 1, c.Len())
+	e, ok := c.Lookup(f.path)
+	require.True(t, ok)
+	require.Equal(t, f.tth, e.TTH)
+	require.Equal(t, uint64(3000), e.Size)
+}
+
+func TestCacheTornWrite(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	cpath := filepath.Join(dir, "hashes.db")
+
+	c, err := Open(cpath, nil)
+	require.NoError(t, err)
+	f1 := newTestFile(t, dir, "a.bin", 100)
+	f2 := newTestFile(t, dir, "b.bin", 200)
+	require.NoError(t, c.Put(f1.path, f1.fi, f1.tth, f1.leaves))
+	st, err := os.Stat(cpath)
+	require.NoError(t, err)
+	require.NoError(t, c.Put(f2.path, f2.fi, f2.tth, f2.leaves))
+	require.NoError(t, c.Close())
+
+	// simulate a partial write of the last record
+	st2, err := os.Stat(cpath)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(cpath, (st.Size()+st2.Size())/2))
+
+	c, err = Open(cpath, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, c.Len())
+	_, ok := c.Get(f1.path, f1.fi)
+	require.True(t, ok)
+
+	// new records are appended after the valid part
+	require.NoError(t, c.Put(f2.path, f2.fi, f2.tth, f2.leaves))
+	require.NoError(t, c.Close())
+	c, err = Open(cpath, nil)
+	require.NoError(t, err)
+	defer c.Close()
+	require.Equal(t, 2, c.Len())
+
+	_, err = Open(filepath.Join(dir, "a.bin"), nil)
+	require.Error(t, err)
+}
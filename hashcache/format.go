@@ -0,0 +1,275 @@
+package hashcache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+const (
+	magic   = "DCHC"
+	version = 1
+
+	opPut    = 1
+	opDelete = 2
+
+	// maxRecord limits the size of a single record to detect corrupted length prefixes.
+	maxRecord = 64 << 20
+)
+
+var (
+	errCorrupted = errors.New("hashcache: corrupted record")
+	errVersion   = errors.New("hashcache: unsupported version")
+)
+
+// encodePut encodes a put record and returns the position of the leaves in the payload.
+func encodePut(e *Entry, leaves tiger.Leaves) ([]byte, int) {
+	var b [binary.MaxVarintLen64]byte
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte(opPut)
+	buf.Write(b[:binary.PutUvarint(b[:], uint64(len(e.Path)))])
+	buf.WriteString(e.Path)
+	buf.Write(b[:binary.PutUvarint(b[:], e.Size)])
+	buf.Write(b[:binary.PutVarint(b[:], e.ModTime.UnixNano())])
+	buf.Write(b[:binary.PutUvarint(b[:], e.Inode)])
+	buf.Write(e.TTH[:])
+	buf.Write(b[:binary.PutUvarint(b[:], uint64(len(leaves)))])
+	pos := buf.Len()
+	for _, l := range leaves {
+		buf.Write(l[:])
+	}
+	return buf.Bytes(), pos
+}
+
+func encodeDelete(path string) []byte {
+	var b [binary.MaxVarintLen64]byte
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte(opDelete)
+	buf.Write(b[:binary.PutUvarint(b[:], uint64(len(path)))])
+	buf.WriteString(path)
+	return buf.Bytes()
+}
+
+// decodeRecord decodes the payload. For put records, the position of the leaves in the payload is returned.
+func decodeRecord(payload []byte) (op byte, e *entry, pos int, err error) {
+	r := bytes.NewReader(payload)
+	op, err = r.ReadByte()
+	if err != nil {
+		return 0, nil, 0, errCorrupted
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return 0, nil, 0, errCorrupted
+	}
+	path := make([]byte, n)
+	_, _ = r.Read(path)
+	e = &entry{Entry: Entry{Path: string(path)}}
+	switch op {
+	case opDelete:
+		return op, e, 0, nil
+	case opPut:
+	default:
+		return 0, nil, 0, errCorrupted
+	}
+	if e.Size, err = binary.ReadUvarint(r); err != nil {
+		return 0, nil, 0, errCorrupted
+	}
+	mod, err := binary.ReadVarint(r)
+	if err != nil {
+		return 0, nil, 0, errCorrupted
+	}
+	e.ModTime = time.Unix(0, mod)
+	if e.Inode, err = binary.ReadUvarint(r); err != nil {
+		return 0, nil, 0, errCorrupted
+	}
+	if _, err = io.ReadFull(r, e.TTH[:]); err != nil {
+		return 0, nil, 0, errCorrupted
+	}
+	cnt, err := binary.ReadUvarint(r)
+	if err != nil || cnt*tiger.Size != uint64(r.Len()) {
+		return 0, nil, 0, errCorrupted
+	}
+	e.leavesN = int(cnt)
+	pos = len(payload) - r.Len()
+	return op, e, pos, nil
+}
+
+// appendRecord writes the record to the end of the file and returns the offset of the payload.
+func (c *Cache) appendRecord(payload []byte) (int64, error) {
+	off, data := frameRecord(c.size, payload)
+	if _, err := c.f.WriteAt(data, c.size); err != nil {
+		return 0, err
+	}
+	c.size += int64(len(data))
+	return off, nil
+}
+
+// frameRecord adds the length prefix and the checksum to the payload. It returns the offset of the payload
+// in the file, given the offset of the record.
+func frameRecord(at int64, payload []byte) (int64, []byte) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], uint64(len(payload)))
+	data := make([]byte, 0, n+len(payload)+4)
+	data = append(data, b[:n]...)
+	data = append(data, payload...)
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.ChecksumIEEE(payload))
+	data = append(data, sum[:]...)
+	return at + int64(n), data
+}
+
+// load reads all records from the file. If the tail of the file is corrupted, it's truncated.
+func (c *Cache) load() error {
+	if _, err := c.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	br := bufio.NewReader(c.f)
+	hdr := make([]byte, len(magic)+1)
+	n, err := io.ReadFull(br, hdr)
+	if n == 0 && err == io.EOF {
+		// new file
+		hdr = append([]byte(magic), version)
+		if _, err = c.f.WriteAt(hdr, 0); err != nil {
+			return err
+		}
+		c.size = int64(len(hdr))
+		return nil
+	} else if err != nil || string(hdr[:len(magic)]) != magic {
+		return errors.New("hashcache: not a cache file")
+	} else if hdr[len(magic)] != version {
+		return errVersion
+	}
+	off := int64(len(hdr))
+	for {
+		payload, size, err := readRecord(br)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			// partially written or corrupted tail, discard it
+			if err = c.f.Truncate(off); err != nil {
+				return err
+			}
+			break
+		}
+		op, e, pos, err := decodeRecord(payload)
+		if err != nil {
+			if err = c.f.Truncate(off); err != nil {
+				return err
+			}
+			break
+		}
+		switch op {
+		case opPut:
+			e.leavesOff = off + int64(size-len(payload)-4) + int64(pos)
+			c.set(e)
+		case opDelete:
+			c.del(e.Path)
+			c.stale++
+		}
+		off += int64(size)
+	}
+	c.size = off
+	return c.maybeCompact()
+}
+
+// readRecord reads a single record and returns its payload and the total size.
+func readRecord(br *bufio.Reader) ([]byte, int, error) {
+	n, err := binary.ReadUvarint(br)
+	if err == io.EOF {
+		return nil, 0, io.EOF
+	} else if err != nil {
+		return nil, 0, errCorrupted
+	} else if n > maxRecord {
+		return nil, 0, errCorrupted
+	}
+	var b [binary.MaxVarintLen64]byte
+	hdr := binary.PutUvarint(b[:], n)
+	data := make([]byte, n+4)
+	if _, err = io.ReadFull(br, data); err != nil {
+		return nil, 0, errCorrupted
+	}
+	payload := data[:n]
+	if binary.LittleEndian.Uint32(data[n:]) != crc32.ChecksumIEEE(payload) {
+		return nil, 0, errCorrupted
+	}
+	return payload, hdr + len(data), nil
+}
+
+// maybeCompact compacts the file if there are too many stale records.
+func (c *Cache) maybeCompact() error {
+	if c.stale < minCompact || c.stale < len(c.files) {
+		return nil
+	}
+	return c.compact()
+}
+
+// Compact rewrites the cache file, removing stale records.
+func (c *Cache) Compact() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.compact()
+}
+
+func (c *Cache) compact() error {
+	tmp := c.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			_ = f.Close()
+			_ = os.Remove(tmp)
+		}
+	}()
+	hdr := append([]byte(magic), version)
+	bw := bufio.NewWriter(f)
+	if _, err = bw.Write(hdr); err != nil {
+		return err
+	}
+	size := int64(len(hdr))
+	offsets := make(map[*entry]int64, len(c.files))
+	for _, e := range c.files {
+		buf := make([]byte, e.leavesN*tiger.Size)
+		if _, err = c.f.ReadAt(buf, e.leavesOff); err != nil {
+			return err
+		}
+		leaves := make(tiger.Leaves, e.leavesN)
+		for i := range leaves {
+			copy(leaves[i][:], buf[i*tiger.Size:])
+		}
+		payload, pos := encodePut(&e.Entry, leaves)
+		off, data := frameRecord(size, payload)
+		if _, err = bw.Write(data); err != nil {
+			return err
+		}
+		offsets[e] = off + int64(pos)
+		size += int64(len(data))
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	ok = true
+	_ = c.f.Close()
+	c.f = f
+	c.size = size
+	c.stale = 0
+	for e, off := range offsets {
+		e.leavesOff = off
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package hashcache
+
+import "os"
+
+// inode returns the inode number of the file, or zero if it's not available.
+func inode(fi os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,211 @@
+package dc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/lineproto"
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+// DefaultSoftware is the client software reported to the hub if none is set in Options.
+var DefaultSoftware = Software{Name: "go-dc", Version: "1.0"}
+
+// Options for connecting to the hub.
+type Options struct {
+	// Name is the user name used on the hub. Required.
+	Name string
+	// Password is used if the hub requires the user to be registered.
+	Password string
+	// Desc is the user description.
+	Desc string
+	// Email is the user email.
+	Email string
+	// Software is the client name and version. DefaultSoftware is used if not set.
+	Software Software
+	// Share is the share size, in bytes.
+	Share uint64
+	// Slots is the number of upload slots.
+	Slots int
+	// Bot registers the client as a bot. ADC hubs receive the bot client type,
+	// while NMDC hubs receive BotINFO after the login.
+	Bot bool
+
+	// PID is the private ID of the client. It's only used for ADC hubs.
+	// A random PID is generated if not set.
+	PID *adc.PID
+	// TLS config for hubs with a secure scheme. See nmdc.DialHub and adc.DialHub
+	// for the certificate verification rules.
+	TLS *tls.Config
+	// Trace is called before the handshake with the protocol reader and writer of the connection.
+	// It can register hooks to log or capture the raw traffic, see lineproto.Reader.OnLine.
+	// Reader and writer hooks may be called concurrently.
+	Trace func(r *lineproto.Reader, w *lineproto.Writer)
+}
+
+// User is a user on the hub.
+type User struct {
+	Name     string
+	Desc     string
+	Email    string
+	Share    uint64
+	Software Software
+	Op       bool
+	// Reg is set for registered users. Operators are always registered.
+	Reg bool
+	Bot bool
+}
+
+// ChatMessage is a message received in the main chat or a private message.
+type ChatMessage struct {
+	From string
+	Text string
+	// PM is set for private messages.
+	PM bool
+}
+
+// SearchRequest is a file search request. Either a pattern or a TTH must be set.
+type SearchRequest struct {
+	Pattern string
+	TTH     *tiger.Hash
+}
+
+// SearchResult is a single result for a search request.
+type SearchResult struct {
+	From  string
+	Path  string // path with '/' separators
+	IsDir bool
+	Size  uint64
+	TTH   *tiger.Hash
+	Slots int // free slots
+}
+
+// Hub is a client connection to a hub. The implementation is chosen by the address scheme.
+//
+// Events are delivered from a single goroutine that reads messages from the hub.
+// Hooks should be registered right after Dial; events received before the registration are dropped.
+// All methods are safe for concurrent use.
+type Hub interface {
+	// Addr returns the normalized address of the hub, see Address.Normalize.
+	Addr() string
+	// Name returns the hub name, if it's known.
+	Name() string
+	// Users returns a list of users on the hub, sorted by name.
+	Users() []User
+	// User finds a user by name.
+	User(name string) (User, bool)
+	// SendChat sends a message to the main chat.
+	SendChat(text string) error
+	// SendPM sends a private message to a user.
+	SendPM(to, text string) error
+	// SendChatTo sends a message to the main chat that is only visible to a given user.
+	// NMDC hubs without MCTo support receive a private message instead.
+	SendChatTo(to, text string) error
+	// Search sends a search request to the hub. Results are delivered to OnSearchResult hooks.
+	Search(req SearchRequest) error
+
+	// OnChat registers a hook that is called for each chat message and private message.
+	OnChat(fnc func(m ChatMessage))
+	// OnUserJoin registers a hook that is called when a user joins the hub.
+	OnUserJoin(fnc func(u User))
+	// OnUserLeave registers a hook that is called when a user leaves the hub.
+	OnUserLeave(fnc func(u User))
+	// OnSearchResult registers a hook that is called for each search result.
+	OnSearchResult(fnc func(r SearchResult))
+
+	// Done returns a channel that is closed when the connection to the hub is lost or closed.
+	Done() <-chan struct{}
+	// Close the connection to the hub.
+	Close() error
+}
+
+var errNoName = errors.New("dc: user name is not set")
+
+// Dial connects to the hub at a given address and performs the handshake.
+// Both ADC (adc://, adcs://) and NMDC (dchub://, nmdcs://) hubs are supported.
+// The address is parsed with ParseAddress, thus addresses without the scheme are assumed to be NMDC,
+// and addresses without the port use the default port of the protocol.
+func Dial(ctx context.Context, addr string, opt *Options) (Hub, error) {
+	if opt == nil || opt.Name == "" {
+		return nil, errNoName
+	}
+	a, err := ParseAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	o := *opt
+	if o.Software == (Software{}) {
+		o.Software = DefaultSoftware
+	}
+	addr = a.Normalize().String()
+	if a.Proto == ProtoADC {
+		return dialADC(ctx, addr, &o)
+	}
+	return dialNMDC(ctx, addr, &o)
+}
+
+// hubHooks implements hook registration and dispatch for hub implementations.
+type hubHooks struct {
+	mu       sync.RWMutex
+	onChat   []func(m ChatMessage)
+	onJoin   []func(u User)
+	onLeave  []func(u User)
+	onResult []func(r SearchResult)
+}
+
+func (h *hubHooks) OnChat(fnc func(m ChatMessage)) {
+	h.mu.Lock()
+	h.onChat = append(h.onChat, fnc)
+	h.mu.Unlock()
+}
+
+func (h *hubHooks) OnUserJoin(fnc func(u User)) {
+	h.mu.Lock()
+	h.onJoin = append(h.onJoin, fnc)
+	h.mu.Unlock()
+}
+
+func (h *hubHooks) OnUserLeave(fnc func(u User)) {
+	h.mu.Lock()
+	h.onLeave = append(h.onLeave, fnc)
+	h.mu.Unlock()
+}
+
+func (h *hubHooks) OnSearchResult(fnc func(r SearchResult)) {
+	h.mu.Lock()
+	h.onResult = append(h.onResult, fnc)
+	h.mu.Unlock()
+}
+
+func (h *hubHooks) emitChat(m ChatMessage) {
+	h.mu.RLock()
+	hooks := h.onChat
+	h.mu.RUnlock()
+	for _, fnc := range hooks {
+		fnc(m)
+	}
+}
+
+func (h *hubHooks) emitUser(u User, join bool) {
+	h.mu.RLock()
+	hooks := h.onLeave
+	if join {
+		hooks = h.onJoin
+	}
+	h.mu.RUnlock()
+	for _, fnc := range hooks {
+		fnc(u)
+	}
+}
+
+func (h *hubHooks) emitResult(r SearchResult) {
+	h.mu.RLock()
+	hooks := h.onResult
+	h.mu.RUnlock()
+	for _, fnc := range hooks {
+		fnc(r)
+	}
+}
@@ -0,0 +1,403 @@
+package dc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/adc/types"
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+var _ Hub = (*adcHub)(nil)
+
+type adcHub struct {
+	hubHooks
+
+	addr string
+	self string
+	sid  adc.SID
+	conn net.Conn
+	r    *adc.Reader
+	name atomic.Value // string
+
+	wmu sync.Mutex
+	w   *adc.Writer
+
+	umu   sync.RWMutex
+	users map[adc.SID]*adc.UserInfo
+	names map[string]adc.SID
+
+	token uint32
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func dialADC(ctx context.Context, addr string, opt *Options) (*adcHub, error) {
+	conn, err := adc.DialHub(ctx, addr, opt.TLS)
+	if err != nil {
+		return nil, err
+	}
+	h := &adcHub{
+		addr:  addr,
+		self:  opt.Name,
+		conn:  conn,
+		r:     adc.NewReader(conn),
+		w:     adc.NewWriter(conn),
+		users: make(map[adc.SID]*adc.UserInfo),
+		names: make(map[string]adc.SID),
+		done:  make(chan struct{}),
+	}
+	h.name.Store("")
+	if opt.Trace != nil {
+		opt.Trace(h.r.Reader, h.w.Writer)
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+	if err = h.handshake(opt); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	go h.readLoop()
+	return h, nil
+}
+
+func (h *adcHub) writePacket(p adc.Packet) error {
+	h.wmu.Lock()
+	defer h.wmu.Unlock()
+	if err := h.w.WritePacket(p); err != nil {
+		return err
+	}
+	return h.w.Flush()
+}
+
+func (h *adcHub) handshake(opt *Options) error {
+	err := h.writePacket(&adc.HubPacket{Msg: adc.Supported{
+		Features: adc.ModFeatures{adc.FeaBASE: true, adc.FeaTIGR: true},
+	}})
+	if err != nil {
+		return err
+	}
+	pid := opt.PID
+	if pid == nil {
+		p, err := types.NewPID()
+		if err != nil {
+			return err
+		}
+		pid = &p
+	}
+	for {
+		p, err := h.r.ReadPacketRaw()
+		if err != nil {
+			return err
+		}
+		switch p := p.(type) {
+		case *adc.InfoPacket:
+			switch cmd := p.Msg.Cmd(); cmd {
+			case (adc.SIDAssign{}).Cmd():
+				var m adc.SIDAssign
+				if err = p.DecodeMessageTo(&m); err != nil {
+					return err
+				}
+				h.sid = m.SID
+				info := adc.UserInfo{
+					Id:          pid.Hash(),
+					Pid:         pid,
+					Name:        opt.Name,
+					Desc:        opt.Desc,
+					Email:       opt.Email,
+					Application: opt.Software.Name,
+					Version:     opt.Software.Version,
+					ShareSize:   int64(opt.Share),
+					Slots:       opt.Slots,
+					SlotsFree:   opt.Slots,
+					HubsNormal:  1,
+					Features:    adc.ExtFeatures{},
+				}
+				if opt.Bot {
+					info.Type = adc.UserTypeBot
+				}
+				err = h.writePacket(&adc.BroadcastPacket{ID: h.sid, Msg: info})
+			case (adc.HubInfo{}).Cmd():
+				var m adc.HubInfo
+				if err = p.DecodeMessageTo(&m); err != nil {
+					return err
+				}
+				h.name.Store(m.Name)
+			case (adc.GetPassword{}).Cmd():
+				var m adc.GetPassword
+				if err = p.DecodeMessageTo(&m); err != nil {
+					return err
+				}
+				if opt.Password == "" {
+					return errors.New("dc: password required")
+				}
+				data := append([]byte(opt.Password), m.Salt...)
+				err = h.writePacket(&adc.HubPacket{Msg: adc.Password{Hash: tiger.HashBytes(data)}})
+			case (adc.Status{}).Cmd():
+				var m adc.Status
+				if err = p.DecodeMessageTo(&m); err != nil {
+					return err
+				}
+				if !m.Ok() {
+					return m.Err()
+				}
+			case (adc.Disconnect{}).Cmd():
+				var m adc.Disconnect
+				if err = p.DecodeMessageTo(&m); err == nil && m.Message != "" {
+					err = errors.New("dc: disconnected: " + m.Message)
+				} else if err == nil {
+					err = errors.New("dc: disconnected")
+				}
+			}
+			if err != nil {
+				return err
+			}
+		case *adc.BroadcastPacket:
+			u, err := h.updateUser(p)
+			if err != nil {
+				return err
+			}
+			if p.ID == h.sid && u != nil {
+				// hub sends our own info at the end of the user list
+				return nil
+			}
+		}
+	}
+}
+
+// updateUser applies the user info update from INF packet. It returns nil if the packet is not INF.
+// Events are emitted only after the handshake.
+func (h *adcHub) updateUser(p *adc.BroadcastPacket) (*adc.UserInfo, error) {
+	if p.Msg.Cmd() != (adc.UserInfo{}).Cmd() {
+		return nil, nil
+	}
+	h.umu.Lock()
+	u, ok := h.users[p.ID]
+	var nu adc.UserInfo
+	if ok {
+		nu = *u
+	}
+	if err := p.DecodeMessageTo(&nu); err != nil {
+		h.umu.Unlock()
+		return nil, err
+	}
+	if ok && u.Name != nu.Name && h.names[u.Name] == p.ID {
+		delete(h.names, u.Name)
+	}
+	h.users[p.ID] = &nu
+	h.names[nu.Name] = p.ID
+	h.umu.Unlock()
+	return &nu, nil
+}
+
+func (h *adcHub) readLoop() {
+	defer h.Close()
+	for {
+		p, err := h.r.ReadPacketRaw()
+		if err != nil {
+			return
+		}
+		switch p := p.(type) {
+		case *adc.BroadcastPacket:
+			switch p.Msg.Cmd() {
+			case (adc.UserInfo{}).Cmd():
+				h.umu.RLock()
+				_, existed := h.users[p.ID]
+				h.umu.RUnlock()
+				u, err := h.updateUser(p)
+				if err == nil && !existed {
+					h.emitUser(adcUser(u), true)
+				}
+			case (adc.ChatMessage{}).Cmd():
+				var m adc.ChatMessage
+				if p.DecodeMessageTo(&m) == nil {
+					h.emitChat(ChatMessage{From: h.userName(p.ID), Text: m.Text})
+				}
+			}
+		case *adc.EchoPacket:
+			if p.ID != h.sid {
+				h.handleDirect((*adc.DirectPacket)(p))
+			}
+		case *adc.DirectPacket:
+			h.handleDirect(p)
+		case *adc.InfoPacket:
+			switch p.Msg.Cmd() {
+			case (adc.Disconnect{}).Cmd():
+				var m adc.Disconnect
+				if p.DecodeMessageTo(&m) != nil {
+					continue
+				}
+				if m.ID == h.sid {
+					return
+				}
+				h.umu.Lock()
+				u, ok := h.users[m.ID]
+				delete(h.users, m.ID)
+				if ok && h.names[u.Name] == m.ID {
+					delete(h.names, u.Name)
+				}
+				h.umu.Unlock()
+				if ok {
+					h.emitUser(adcUser(u), false)
+				}
+			case (adc.ChatMessage{}).Cmd():
+				var m adc.ChatMessage
+				if p.DecodeMessageTo(&m) == nil {
+					h.emitChat(ChatMessage{Text: m.Text})
+				}
+			}
+		}
+	}
+}
+
+func (h *adcHub) handleDirect(p *adc.DirectPacket) {
+	switch p.Msg.Cmd() {
+	case (adc.ChatMessage{}).Cmd():
+		var m adc.ChatMessage
+		if p.DecodeMessageTo(&m) == nil {
+			h.emitChat(ChatMessage{From: h.userName(p.ID), Text: m.Text, PM: m.PM != nil})
+		}
+	case (adc.SearchResult{}).Cmd():
+		var m adc.SearchResult
+		if p.DecodeMessageTo(&m) != nil {
+			return
+		}
+		r := SearchResult{
+			From:  h.userName(p.ID),
+			Path:  strings.TrimPrefix(m.Path, "/"),
+			IsDir: strings.HasSuffix(m.Path, "/"),
+			TTH:   m.TTH,
+			Slots: m.Slots,
+		}
+		r.Path = strings.TrimSuffix(r.Path, "/")
+		if m.Size > 0 {
+			r.Size = uint64(m.Size)
+		}
+		h.emitResult(r)
+	}
+}
+
+func (h *adcHub) userName(sid adc.SID) string {
+	h.umu.RLock()
+	defer h.umu.RUnlock()
+	if u, ok := h.users[sid]; ok {
+		return u.Name
+	}
+	return ""
+}
+
+func (h *adcHub) userSID(name string) (adc.SID, bool) {
+	h.umu.RLock()
+	defer h.umu.RUnlock()
+	sid, ok := h.names[name]
+	return sid, ok
+}
+
+func adcUser(u *adc.UserInfo) User {
+	out := User{
+		Name:     u.Name,
+		Desc:     u.Desc,
+		Email:    u.Email,
+		Software: Software{Name: u.Application, Version: u.Version},
+		Op:       u.Type.Is(adc.UserTypeOperator | adc.UserTypeSuperUser | adc.UserTypeHubOwner),
+		Bot:      u.Type.Is(adc.UserTypeBot),
+	}
+	out.Reg = out.Op || u.Type.Is(adc.UserTypeRegistered)
+	if u.Application == "" {
+		// older clients put the name and the version into VE
+		nu := *u
+		nu.Normalize()
+		out.Software = Software{Name: nu.Application, Version: nu.Version}
+	}
+	if u.ShareSize > 0 {
+		out.Share = uint64(u.ShareSize)
+	}
+	return out
+}
+
+func (h *adcHub) Addr() string {
+	return h.addr
+}
+
+func (h *adcHub) Name() string {
+	return h.name.Load().(string)
+}
+
+func (h *adcHub) Users() []User {
+	h.umu.RLock()
+	out := make([]User, 0, len(h.users))
+	for _, u := range h.users {
+		out = append(out, adcUser(u))
+	}
+	h.umu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+func (h *adcHub) User(name string) (User, bool) {
+	h.umu.RLock()
+	defer h.umu.RUnlock()
+	sid, ok := h.names[name]
+	if !ok {
+		return User{}, false
+	}
+	return adcUser(h.users[sid]), true
+}
+
+func (h *adcHub) SendChat(text string) error {
+	return h.writePacket(&adc.BroadcastPacket{ID: h.sid, Msg: adc.ChatMessage{Text: text}})
+}
+
+func (h *adcHub) SendPM(to, text string) error {
+	sid, ok := h.userSID(to)
+	if !ok {
+		return errors.New("dc: no such user: " + to)
+	}
+	return h.writePacket(&adc.EchoPacket{ID: h.sid, To: sid, Msg: adc.ChatMessage{Text: text, PM: &h.sid}})
+}
+
+func (h *adcHub) SendChatTo(to, text string) error {
+	sid, ok := h.userSID(to)
+	if !ok {
+		return errors.New("dc: no such user: " + to)
+	}
+	return h.writePacket(&adc.EchoPacket{ID: h.sid, To: sid, Msg: adc.ChatMessage{Text: text}})
+}
+
+func (h *adcHub) Search(req SearchRequest) error {
+	token := strconv.FormatUint(uint64(atomic.AddUint32(&h.token, 1)), 10)
+	s := adc.SearchRequest{Token: token, TTH: req.TTH}
+	if req.TTH == nil {
+		s.And = strings.Fields(req.Pattern)
+		if len(s.And) == 0 {
+			return errors.New("dc: empty search request")
+		}
+	}
+	return h.writePacket(&adc.BroadcastPacket{ID: h.sid, Msg: s})
+}
+
+func (h *adcHub) Done() <-chan struct{} {
+	return h.done
+}
+
+func (h *adcHub) Close() error {
+	var err error
+	h.closeOnce.Do(func() {
+		err = h.conn.Close()
+		close(h.done)
+	})
+	return err
+}
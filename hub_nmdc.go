@@ -0,0 +1,265 @@
+package dc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/direct-connect/go-dc/nmdc"
+)
+
+var _ Hub = (*nmdcHub)(nil)
+
+type nmdcHub struct {
+	hubHooks
+
+	addr  string
+	self  string
+	conn  net.Conn
+	r     *nmdc.Reader
+	users *nmdc.UserList
+	name  atomic.Value // string
+	mcto  bool         // hub supports MCTo; set during the handshake
+
+	wmu sync.Mutex
+	w   *nmdc.Writer
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func dialNMDC(ctx context.Context, addr string, opt *Options) (*nmdcHub, error) {
+	conn, err := nmdc.DialHub(ctx, addr, opt.TLS)
+	if err != nil {
+		return nil, err
+	}
+	h := &nmdcHub{
+		addr:  addr,
+		self:  opt.Name,
+		conn:  conn,
+		r:     nmdc.NewReader(conn),
+		w:     nmdc.NewWriter(conn),
+		users: nmdc.NewUserList(),
+		done:  make(chan struct{}),
+	}
+	h.name.Store("")
+	if opt.Trace != nil {
+		opt.Trace(h.r.Reader, h.w.Writer)
+	}
+	h.r.OnMessage(h.users.OnMessage)
+	h.users.OnGetINFO(func(name string) error {
+		return h.writeMsg(&nmdc.GetINFO{Target: name, From: h.self})
+	})
+	h.users.OnEvent(func(e nmdc.UserEvent) {
+		switch e.Type {
+		case nmdc.UserJoined:
+			h.emitUser(nmdcUser(e.User), true)
+		case nmdc.UserParted:
+			h.emitUser(nmdcUser(e.User), false)
+		}
+	})
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+	if err = h.handshake(opt); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	go h.readLoop()
+	return h, nil
+}
+
+func (h *nmdcHub) writeMsg(msg ...nmdc.Message) error {
+	h.wmu.Lock()
+	defer h.wmu.Unlock()
+	if err := h.w.WriteMsg(msg...); err != nil {
+		return err
+	}
+	return h.w.Flush()
+}
+
+func (h *nmdcHub) handshake(opt *Options) error {
+	var lock nmdc.Lock
+	if err := h.r.ReadMsgTo(&lock); err != nil {
+		return err
+	}
+	var msgs []nmdc.Message
+	if !lock.NoExt {
+		ext := []string{
+			nmdc.ExtNoHello, nmdc.ExtNoGetINFO, nmdc.ExtUserIP2, nmdc.ExtTTHSearch, nmdc.ExtMCTo,
+		}
+		if opt.Bot {
+			ext = append(ext, nmdc.ExtBotINFO)
+		}
+		sup := &nmdc.Supports{Ext: ext}
+		sup.AdvertiseExtJSON()
+		msgs = append(msgs, sup)
+	}
+	msgs = append(msgs, lock.Key(), &nmdc.ValidateNick{Name: nmdc.Name(opt.Name)})
+	if err := h.writeMsg(msgs...); err != nil {
+		return err
+	}
+	for {
+		m, err := h.r.ReadMsg()
+		if err != nil {
+			return err
+		}
+		switch m := m.(type) {
+		case *nmdc.Supports:
+			h.users.SetExtJSON(m.HasExtJSON())
+			for _, ext := range m.Ext {
+				switch ext {
+				case nmdc.ExtNoGetINFO:
+					h.users.SetNoGetINFO(true)
+				case nmdc.ExtMCTo:
+					h.mcto = true
+				}
+			}
+		case *nmdc.HubName:
+			h.name.Store(string(m.String))
+		case *nmdc.GetPass:
+			if opt.Password == "" {
+				return errors.New("dc: password required")
+			}
+			if err = h.writeMsg(&nmdc.MyPass{String: nmdc.String(opt.Password)}); err != nil {
+				return err
+			}
+		case *nmdc.BadPass:
+			return errors.New("dc: wrong password")
+		case *nmdc.ValidateDenide:
+			return errors.New("dc: name is taken or invalid")
+		case *nmdc.HubIsFull:
+			return errors.New("dc: hub is full")
+		case *nmdc.Hello:
+			if string(m.Name) != h.self {
+				continue
+			}
+			msgs := []nmdc.Message{
+				&nmdc.Version{Vers: "1,0091"},
+				&nmdc.GetNickList{},
+				&nmdc.MyINFO{
+					Name:       opt.Name,
+					Desc:       opt.Desc,
+					Email:      opt.Email,
+					Client:     opt.Software,
+					Mode:       nmdc.UserModePassive,
+					HubsNormal: 1,
+					Slots:      opt.Slots,
+					Conn:       nmdc.ConnSpeedServer,
+					Flag:       nmdc.FlagStatusNormal,
+					ShareSize:  opt.Share,
+				},
+			}
+			if opt.Bot {
+				msgs = append(msgs, &nmdc.BotINFO{String: nmdc.String(opt.Desc)})
+			}
+			return h.writeMsg(msgs...)
+		}
+	}
+}
+
+func (h *nmdcHub) readLoop() {
+	defer h.Close()
+	for {
+		m, err := h.r.ReadMsg()
+		if err != nil {
+			return
+		}
+		switch m := m.(type) {
+		case *nmdc.ChatMessage:
+			h.emitChat(ChatMessage{From: m.Name, Text: m.Text})
+		case *nmdc.PrivateMessage:
+			h.emitChat(ChatMessage{From: m.From, Text: m.Text, PM: true})
+		case *nmdc.SR:
+			h.emitResult(SearchResult{
+				From:  m.From,
+				Path:  strings.Join(m.Path, "/"),
+				IsDir: m.IsDir,
+				Size:  m.Size,
+				TTH:   m.TTH,
+				Slots: m.FreeSlots,
+			})
+		case *nmdc.HubName:
+			h.name.Store(string(m.String))
+		}
+	}
+}
+
+func nmdcUser(u nmdc.User) User {
+	out := User{Name: u.Name, Op: u.Op, Reg: u.Op, Bot: u.Bot}
+	if u.Info != nil {
+		out.Desc = u.Info.Desc
+		out.Email = u.Info.Email
+		out.Share = u.Info.ShareSize
+		out.Software = u.Info.Client
+	}
+	return out
+}
+
+func (h *nmdcHub) Addr() string {
+	return h.addr
+}
+
+func (h *nmdcHub) Name() string {
+	return h.name.Load().(string)
+}
+
+func (h *nmdcHub) Users() []User {
+	list := h.users.Users()
+	out := make([]User, 0, len(list))
+	for _, u := range list {
+		out = append(out, nmdcUser(u))
+	}
+	return out
+}
+
+func (h *nmdcHub) User(name string) (User, bool) {
+	u, ok := h.users.User(name)
+	if !ok {
+		return User{}, false
+	}
+	return nmdcUser(u), true
+}
+
+func (h *nmdcHub) SendChat(text string) error {
+	return h.writeMsg(&nmdc.ChatMessage{Name: h.self, Text: text})
+}
+
+func (h *nmdcHub) SendPM(to, text string) error {
+	return h.writeMsg(&nmdc.PrivateMessage{To: to, From: h.self, Name: h.self, Text: text})
+}
+
+func (h *nmdcHub) SendChatTo(to, text string) error {
+	if !h.mcto {
+		return h.SendPM(to, text)
+	}
+	return h.writeMsg(&nmdc.MCTo{To: to, From: h.self, Text: text})
+}
+
+func (h *nmdcHub) Search(req SearchRequest) error {
+	s := &nmdc.Search{User: h.self, DataType: nmdc.DataTypeAny, Pattern: req.Pattern}
+	if req.TTH != nil {
+		s.DataType, s.TTH, s.Pattern = nmdc.DataTypeTTH, req.TTH, ""
+	} else if req.Pattern == "" {
+		return errors.New("dc: empty search request")
+	}
+	return h.writeMsg(s)
+}
+
+func (h *nmdcHub) Done() <-chan struct{} {
+	return h.done
+}
+
+func (h *nmdcHub) Close() error {
+	var err error
+	h.closeOnce.Do(func() {
+		err = h.conn.Close()
+		close(h.done)
+	})
+	return err
+}
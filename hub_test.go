@@ -0,0 +1,313 @@
+package dc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/lineproto"
+	"github.com/direct-connect/go-dc/nmdc"
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+type dialResult struct {
+	hub Hub
+	err error
+}
+
+// dialTest starts a test listener and dials it with Dial. It returns the server side of the connection.
+func dialTest(t *testing.T, scheme string, opt *Options) (net.Conn, <-chan dialResult) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	done := make(chan dialResult, 1)
+	go func() {
+		defer cancel()
+		h, err := Dial(ctx, scheme+"://"+l.Addr().String(), opt)
+		done <- dialResult{hub: h, err: err}
+	}()
+	c, err := l.Accept()
+	require.NoError(t, err)
+	return c, done
+}
+
+// hubEvents collects hub events into channels.
+type hubEvents struct {
+	chat   chan ChatMessage
+	join   chan User
+	leave  chan User
+	result chan SearchResult
+}
+
+func watchHub(h Hub) *hubEvents {
+	e := &hubEvents{
+		chat:   make(chan ChatMessage, 10),
+		join:   make(chan User, 10),
+		leave:  make(chan User, 10),
+		result: make(chan SearchResult, 10),
+	}
+	h.OnChat(func(m ChatMessage) { e.chat <- m })
+	h.OnUserJoin(func(u User) { e.join <- u })
+	h.OnUserLeave(func(u User) { e.leave <- u })
+	h.OnSearchResult(func(r SearchResult) { e.result <- r })
+	return e
+}
+
+// waitJoin waits for a join event for a given user. Users from the initial
+// user list may also be reported, since hooks are registered after Dial.
+func waitJoin(t *testing.T, e *hubEvents, name string) User {
+	for {
+		select {
+		case u := <-e.join:
+			if u.Name == name {
+				return u
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+}
+
+func testMyINFO(name string) *nmdc.MyINFO {
+	return &nmdc.MyINFO{
+		Name:       name,
+		Desc:       "desc",
+		Client:     Software{Name: "++", Version: "0.868"},
+		Mode:       nmdc.UserModePassive,
+		HubsNormal: 1,
+		Slots:      1,
+		Conn:       "100",
+		Flag:       nmdc.FlagStatusNormal,
+		ShareSize:  1024,
+	}
+}
+
+func TestDialNMDC(t *testing.T) {
+	var traced []string
+	c, done := dialTest(t, nmdc.SchemeNMDC, &Options{
+		Name: "alice", Password: "pass",
+		Trace: func(r *lineproto.Reader, w *lineproto.Writer) {
+			w.OnLine(func(line []byte) (bool, error) {
+				traced = append(traced, string(line))
+				return true, nil
+			})
+		},
+	})
+	defer c.Close()
+	r, w := nmdc.NewReader(c), nmdc.NewWriter(c)
+	send := func(m ...nmdc.Message) {
+		require.NoError(t, w.WriteMsg(m...))
+		require.NoError(t, w.Flush())
+	}
+
+	lock := &nmdc.Lock{Lock: "_test", PK: "test"}
+	send(lock)
+	var sup nmdc.Supports
+	require.NoError(t, r.ReadMsgTo(&sup))
+	require.Contains(t, sup.Ext, nmdc.ExtNoGetINFO)
+	require.True(t, sup.HasExtJSON())
+	var key nmdc.Key
+	require.NoError(t, r.ReadMsgTo(&key))
+	require.Equal(t, lock.Key(), &key)
+	var nick nmdc.ValidateNick
+	require.NoError(t, r.ReadMsgTo(&nick))
+	require.Equal(t, "alice", string(nick.Name))
+
+	send(
+		&nmdc.Supports{Ext: []string{nmdc.ExtNoGetINFO, nmdc.ExtNoHello}},
+		&nmdc.HubName{String: "Test hub"},
+		&nmdc.GetPass{},
+	)
+	var pass nmdc.MyPass
+	require.NoError(t, r.ReadMsgTo(&pass))
+	require.Equal(t, "pass", string(pass.String))
+
+	send(&nmdc.Hello{Name: "alice"})
+	require.NoError(t, r.ReadMsgTo(&nmdc.Version{}))
+	require.NoError(t, r.ReadMsgTo(&nmdc.GetNickList{}))
+	var info nmdc.MyINFO
+	require.NoError(t, r.ReadMsgTo(&info))
+	require.Equal(t, "alice", info.Name)
+	require.Equal(t, DefaultSoftware, info.Client)
+
+	send(testMyINFO("bob"), testMyINFO("alice"), &nmdc.OpList{Names: []string{"bob"}})
+	res := <-done
+	require.NoError(t, res.err)
+	h := res.hub
+	defer h.Close()
+	require.Equal(t, "Test hub", h.Name())
+	require.Equal(t, "$MyPass pass|", traced[3])
+	e := watchHub(h)
+
+	send(testMyINFO("carol"))
+	u := waitJoin(t, e, "carol")
+	require.Equal(t, "carol", u.Name)
+	require.Equal(t, uint64(1024), u.Share)
+
+	send(&nmdc.ChatMessage{Name: "bob", Text: "hi"})
+	require.Equal(t, ChatMessage{From: "bob", Text: "hi"}, <-e.chat)
+	send(&nmdc.PrivateMessage{To: "alice", From: "bob", Name: "bob", Text: "psst"})
+	require.Equal(t, ChatMessage{From: "bob", Text: "psst", PM: true}, <-e.chat)
+
+	users := h.Users()
+	require.Len(t, users, 3)
+	require.Equal(t, "bob", users[1].Name)
+	require.True(t, users[1].Op)
+	u, ok := h.User("bob")
+	require.True(t, ok)
+	require.True(t, u.Op)
+
+	require.NoError(t, h.SendChat("hello"))
+	var chat nmdc.ChatMessage
+	require.NoError(t, r.ReadMsgTo(&chat))
+	require.Equal(t, nmdc.ChatMessage{Name: "alice", Text: "hello"}, chat)
+
+	// no MCTo support, falls back to PM
+	require.NoError(t, h.SendChatTo("bob", "only you"))
+	var pm nmdc.PrivateMessage
+	require.NoError(t, r.ReadMsgTo(&pm))
+	require.Equal(t, "bob", pm.To)
+	require.Equal(t, "only you", pm.Text)
+
+	require.NoError(t, h.Search(SearchRequest{Pattern: "some file"}))
+	var search nmdc.Search
+	require.NoError(t, r.ReadMsgTo(&search))
+	require.Equal(t, "alice", search.User)
+	require.Equal(t, "some file", search.Pattern)
+
+	send(&nmdc.SR{
+		From: "bob", Path: []string{"dir", "some file.txt"}, Size: 10,
+		FreeSlots: 1, TotalSlots: 2, HubName: "Test hub", HubAddress: "127.0.0.1:411",
+	})
+	require.Equal(t, SearchResult{From: "bob", Path: "dir/some file.txt", Size: 10, Slots: 1}, <-e.result)
+
+	send(&nmdc.Quit{Name: "carol"})
+	require.Equal(t, "carol", (<-e.leave).Name)
+
+	_ = c.Close()
+	select {
+	case <-h.Done():
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestDialADC(t *testing.T) {
+	c, done := dialTest(t, adc.SchemaADC, &Options{Name: "alice", Password: "pass"})
+	defer c.Close()
+	r, w := adc.NewReader(c), adc.NewWriter(c)
+	send := func(p ...adc.Packet) {
+		for _, p := range p {
+			require.NoError(t, w.WritePacket(p))
+		}
+		require.NoError(t, w.Flush())
+	}
+	read := func() adc.Packet {
+		p, err := r.ReadPacket()
+		require.NoError(t, err)
+		return p
+	}
+	alice, bob, carol := adc.SID{'A', 'A', 'A', 'B'}, adc.SID{'A', 'A', 'A', 'C'}, adc.SID{'A', 'A', 'A', 'D'}
+	userInfo := func(name string) adc.UserInfo {
+		return adc.UserInfo{Id: adc.PID{byte(len(name))}.Hash(), Name: name, Application: "DC++", Version: "0.868", ShareSize: 1024}
+	}
+
+	p := read()
+	require.IsType(t, &adc.HubPacket{}, p)
+	require.IsType(t, adc.Supported{}, p.Message())
+
+	salt := []byte("salt")
+	send(
+		&adc.InfoPacket{Msg: adc.Supported{Features: adc.ModFeatures{adc.FeaBASE: true, adc.FeaTIGR: true}}},
+		&adc.InfoPacket{Msg: adc.SIDAssign{SID: alice}},
+		&adc.InfoPacket{Msg: adc.HubInfo{Name: "ADC hub", Version: "1.0"}},
+	)
+	p = read()
+	require.Equal(t, alice, p.(*adc.BroadcastPacket).ID)
+	require.Equal(t, "alice", p.Message().(adc.UserInfo).Name)
+
+	send(&adc.InfoPacket{Msg: adc.GetPassword{Salt: salt}})
+	p = read()
+	require.Equal(t, adc.Password{Hash: tiger.HashBytes([]byte("passsalt"))}, p.Message())
+
+	send(
+		&adc.BroadcastPacket{ID: bob, Msg: userInfo("bob")},
+		&adc.BroadcastPacket{ID: alice, Msg: userInfo("alice")},
+	)
+	res := <-done
+	require.NoError(t, res.err)
+	h := res.hub
+	defer h.Close()
+	require.Equal(t, "ADC hub", h.Name())
+	e := watchHub(h)
+
+	send(&adc.BroadcastPacket{ID: carol, Msg: userInfo("carol")})
+	u := waitJoin(t, e, "carol")
+	require.Equal(t, "carol", u.Name)
+	require.Equal(t, Software{Name: "DC++", Version: "0.868"}, u.Software)
+
+	send(&adc.BroadcastPacket{ID: bob, Msg: adc.ChatMessage{Text: "hi"}})
+	require.Equal(t, ChatMessage{From: "bob", Text: "hi"}, <-e.chat)
+	send(&adc.EchoPacket{ID: bob, To: alice, Msg: adc.ChatMessage{Text: "psst", PM: &bob}})
+	require.Equal(t, ChatMessage{From: "bob", Text: "psst", PM: true}, <-e.chat)
+
+	require.Len(t, h.Users(), 3)
+	u, ok := h.User("bob")
+	require.True(t, ok)
+	require.Equal(t, "bob", u.Name)
+	_, ok = h.User("dave")
+	require.False(t, ok)
+
+	require.NoError(t, h.SendPM("bob", "hello"))
+	p = read()
+	require.Equal(t, &adc.EchoPacket{ID: alice, To: bob, Msg: adc.ChatMessage{Text: "hello", PM: &alice}}, p)
+
+	require.NoError(t, h.SendChatTo("bob", "only you"))
+	p = read()
+	require.Equal(t, &adc.EchoPacket{ID: alice, To: bob, Msg: adc.ChatMessage{Text: "only you"}}, p)
+
+	require.NoError(t, h.Search(SearchRequest{Pattern: "some file"}))
+	p = read()
+	require.Equal(t, []string{"some", "file"}, p.Message().(adc.SearchRequest).And)
+
+	send(&adc.DirectPacket{ID: bob, To: alice, Msg: adc.SearchResult{Path: "/dir/some file.txt", Size: 10, Slots: 1}})
+	require.Equal(t, SearchResult{From: "bob", Path: "dir/some file.txt", Size: 10, Slots: 1}, <-e.result)
+
+	send(&adc.InfoPacket{Msg: adc.Disconnect{ID: carol}})
+	require.Equal(t, "carol", (<-e.leave).Name)
+	_, ok = h.User("carol")
+	require.False(t, ok)
+
+	send(&adc.InfoPacket{Msg: adc.Disconnect{ID: alice}})
+	select {
+	case <-h.Done():
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestDialNoName(t *testing.T) {
+	_, err := Dial(context.Background(), "adc://127.0.0.1:1", &Options{})
+	require.Equal(t, errNoName, err)
+}
+
+func TestDialSchemeCase(t *testing.T) {
+	c, done := dialTest(t, "ADC", &Options{Name: "alice"})
+	defer c.Close()
+	p, err := adc.NewReader(c).ReadPacket()
+	require.NoError(t, err)
+	require.IsType(t, adc.Supported{}, p.Message())
+	_ = c.Close()
+	require.Error(t, (<-done).err)
+}
+
+func TestDialInvalidAddress(t *testing.T) {
+	_, err := Dial(context.Background(), "http://127.0.0.1:1", &Options{Name: "alice"})
+	require.Error(t, err)
+}
@@ -0,0 +1,167 @@
+// Package hublist implements hub lists in the DC++ Hublist XML format (optionally compressed with bzip2)
+// and in JSON.
+//
+// The XML format is the one produced by hublist pingers: the list contains a set of columns
+// and a hub element for each hub, with one attribute per column.
+package hublist
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/nmdc"
+)
+
+const (
+	// FileName is the conventional name of the uncompressed hub list.
+	FileName = "hublist.xml"
+	// FileNameBZIP is the conventional name of the hub list compressed with bzip2.
+	FileNameBZIP = FileName + ".bz2"
+)
+
+// Hublist is a list of hubs.
+type Hublist struct {
+	// Name and Address of the list itself. Both are optional.
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address,omitempty"`
+	Hubs    []Hub  `json:"hubs"`
+}
+
+// Hub is a single entry of the hub list.
+type Hub struct {
+	Name        string `json:"name"`
+	Address     string `json:"address"`
+	Description string `json:"description,omitempty"`
+	Country     string `json:"country,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+	Users       int    `json:"users"`
+	Shared      uint64 `json:"shared,omitempty"`
+	MinShare    uint64 `json:"minshare,omitempty"`
+	MinSlots    int    `json:"minslots,omitempty"`
+	MaxHubs     int    `json:"maxhubs,omitempty"`
+	MaxUsers    int    `json:"maxusers,omitempty"`
+	// Reliability is the percentage of successful pings.
+	Reliability float64 `json:"reliability,omitempty"`
+	Rating      string  `json:"rating,omitempty"`
+
+	// Extended columns used by the pingers.
+
+	Status   string `json:"status,omitempty"`
+	Software string `json:"software,omitempty"`
+	Website  string `json:"website,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Network  string `json:"network,omitempty"`
+	Owner    string `json:"owner,omitempty"`
+
+	// Extra contains columns not known to this package.
+	Extra map[string]string `json:"extra,omitempty"`
+}
+
+// FromADC converts hub information received from an ADC hub to a hub list entry.
+func FromADC(info *adc.HubInfo) Hub {
+	h := Hub{
+		Name:        info.Name,
+		Address:     info.Address,
+		Description: info.Desc,
+		Encoding:    "UTF-8",
+		Users:       info.Users,
+		MinSlots:    info.MinSlots,
+		MaxHubs:     info.MaxHubsUser,
+		MaxUsers:    info.UsersLimit,
+		Website:     info.Website,
+		Network:     info.Network,
+		Owner:       info.Owner,
+	}
+	if info.Share > 0 {
+		h.Shared = uint64(info.Share)
+	}
+	if info.MinShare > 0 {
+		h.MinShare = uint64(info.MinShare)
+	}
+	h.Software = info.Application
+	if h.Software == "" {
+		h.Software = info.Version
+	} else if info.Version != "" {
+		h.Software += " " + info.Version
+	}
+	return h
+}
+
+// FromNMDC converts hub information received from an NMDC hub to a hub list entry.
+// The number of users is not included in HubINFO and should be set by the caller.
+func FromNMDC(info *nmdc.HubINFO) Hub {
+	h := Hub{
+		Name:        info.Name,
+		Address:     info.Host,
+		Description: info.Desc,
+		Encoding:    info.Encoding,
+		MaxUsers:    info.MaxUsers,
+		MinShare:    info.MinShare,
+		MinSlots:    info.MinSlots,
+		MaxHubs:     info.MaxHubs,
+		Owner:       info.Owner,
+	}
+	if info.Category != "" {
+		h.Extra = map[string]string{"Category": info.Category}
+	}
+	h.Software = info.Soft.Name
+	if info.Soft.Version != "" {
+		h.Software += " " + info.Soft.Version
+	}
+	if h.Address != "" && !strings.Contains(h.Address, "://") {
+		h.Address = nmdc.SchemeNMDC + "://" + h.Address
+	}
+	return h
+}
+
+// parseInt parses an integer value, ignoring spaces, fractions and anything after the number.
+// Invalid values are returned as zero.
+func parseInt(s string) int64 {
+	s = strings.Replace(strings.TrimSpace(s), " ", "", -1)
+	end := 0
+	for end < len(s) && (s[end] == '-' || s[end] >= '0' && s[end] <= '9') {
+		end++
+	}
+	v, _ := strconv.ParseInt(s[:end], 10, 64)
+	return v
+}
+
+// parseBytes parses a size in bytes. Most lists write plain numbers, but some use
+// fractional values with units, like "1.5 TB".
+func parseBytes(s string) uint64 {
+	s = strings.TrimSpace(s)
+	if v, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return v
+	}
+	num := strings.TrimRightFunc(s, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	unit := strings.ToUpper(strings.TrimSpace(s[len(num):]))
+	num = strings.Replace(strings.TrimSpace(num), ",", ".", 1)
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f < 0 {
+		return 0
+	}
+	unit = strings.TrimSuffix(strings.Replace(unit, "I", "", 1), "B")
+	if unit != "" {
+		i := strings.IndexByte("KMGTPE", unit[0])
+		if i < 0 || len(unit) != 1 {
+			return 0
+		}
+		for ; i >= 0; i-- {
+			f *= 1024
+		}
+	}
+	return uint64(f)
+}
+
+// parsePercent parses a percentage, with or without the percent sign.
+func parsePercent(s string) float64 {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "%"))
+	v, err := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,155 @@
+package hublist
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/nmdc"
+	"github.com/direct-connect/go-dc/types"
+)
+
+const testList = `<?xml version="1.0" encoding="utf-8" standalone="yes"?>` + "\r\n" +
+	`<Hublist Name="Test list">` + "\r\n" +
+	"\t<Hubs>\r\n" +
+	"\t\t<Columns>\r\n" +
+	"\t\t\t<Column Name=\"Name\" Type=\"string\"/>\r\n" +
+	"\t\t\t<Column Name=\"Address\" Type=\"string\"/>\r\n" +
+	"\t\t\t<Column Name=\"Description\" Type=\"string\"/>\r\n" +
+	"\t\t\t<Column Name=\"Users\" Type=\"int\"/>\r\n" +
+	"\t\t\t<Column Name=\"Country\" Type=\"string\"/>\r\n" +
+	"\t\t\t<Column Name=\"Shared\" Type=\"bytes\"/>\r\n" +
+	"\t\t\t<Column Name=\"Minshare\" Type=\"bytes\"/>\r\n" +
+	"\t\t\t<Column Name=\"Minslots\" Type=\"int\"/>\r\n" +
+	"\t\t\t<Column Name=\"Maxhubs\" Type=\"int\"/>\r\n" +
+	"\t\t\t<Column Name=\"Maxusers\" Type=\"int\"/>\r\n" +
+	"\t\t\t<Column Name=\"Reliability\" Type=\"percent\"/>\r\n" +
+	"\t\t\t<Column Name=\"Rating\" Type=\"string\"/>\r\n" +
+	"\t\t\t<Column Name=\"Software\" Type=\"string\"/>\r\n" +
+	"\t\t\t<Column Name=\"ASN\" Type=\"string\"/>\r\n" +
+	"\t\t</Columns>\r\n" +
+	"\t\t<Hub Name=\"Hub &amp; Co\" Address=\"adcs://hub.example.com:412\" Description=\"desc\" Users=\"120\" Country=\"NL\" Shared=\"1099511627776\" Minshare=\"0\" Minslots=\"1\" Maxhubs=\"0\" Maxusers=\"1000\" Reliability=\"99.5\" Rating=\"\" Software=\"\" ASN=\"AS123\"/>\r\n" +
+	"\t\t<Hub Name=\"Other\" Address=\"dchub://other.example.com\" Description=\"\" Users=\"5\" Country=\"\" Shared=\"0\" Minshare=\"0\" Minslots=\"0\" Maxhubs=\"0\" Maxusers=\"0\" Reliability=\"0\" Rating=\"\" Software=\"Verlihub 1.1\" ASN=\"\"/>\r\n" +
+	"\t</Hubs>\r\n" +
+	"</Hublist>\r\n"
+
+var testHubs = &Hublist{
+	Name: "Test list",
+	Hubs: []Hub{
+		{
+			Name: "Hub & Co", Address: "adcs://hub.example.com:412", Description: "desc",
+			Users: 120, Country: "NL", Shared: 1 << 40, MinSlots: 1, MaxUsers: 1000,
+			Reliability: 99.5, Extra: map[string]string{"ASN": "AS123"},
+		},
+		{
+			Name: "Other", Address: "dchub://other.example.com", Users: 5,
+			Software: "Verlihub 1.1", Extra: map[string]string{"ASN": ""},
+		},
+	},
+}
+
+func TestEncodeDecode(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	err := Encode(buf, testHubs)
+	require.NoError(t, err)
+	require.Equal(t, testList, buf.String())
+
+	l, err := Decode(buf)
+	require.NoError(t, err)
+	require.Equal(t, testHubs, l)
+}
+
+func TestEncodeDecodeBZip2(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	err := EncodeBZip2(buf, testHubs)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(buf.Bytes(), bzip2Magic))
+
+	l, err := Decode(buf)
+	require.NoError(t, err)
+	require.Equal(t, testHubs, l)
+}
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(testHubs)
+	require.NoError(t, err)
+	var l Hublist
+	err = json.Unmarshal(data, &l)
+	require.NoError(t, err)
+	require.Equal(t, testHubs, &l)
+}
+
+var dirtyCases = []struct {
+	name string
+	data string
+	exp  []Hub
+}{
+	{
+		name: "no columns",
+		data: `<Hublist><Hubs><Hub Name="A" Address="a.example.com" Users="10"/></Hubs></Hublist>`,
+		exp:  []Hub{{Name: "A", Address: "a.example.com", Users: 10}},
+	},
+	{
+		name: "case and aliases",
+		data: `<hublist><hubs><hub name="A" host="a.example.com" USERS=" 10 " MinShare="10 GiB" reliability="95.5%" desc="d"/></hubs></hublist>`,
+		exp: []Hub{{
+			Name: "A", Address: "a.example.com", Users: 10, MinShare: 10 << 30,
+			Reliability: 95.5, Description: "d",
+		}},
+	},
+	{
+		name: "windows-1251",
+		data: "<?xml version=\"1.0\" encoding=\"windows-1251\"?>\n" +
+			"<Hublist><Hubs><Hub Name=\"\xc0\xe1\xe2\" Address=\"a.example.com\"/></Hubs></Hublist>",
+		exp: []Hub{{Name: "Абв", Address: "a.example.com"}},
+	},
+	{
+		name: "invalid utf-8",
+		data: "<Hublist><Hubs><Hub Name=\"A\xc0\x01B\" Address=\"a.example.com\" Users=\"x\"/></Hubs></Hublist>",
+		exp:  []Hub{{Name: "A� B", Address: "a.example.com"}},
+	},
+	{
+		name: "unescaped and no address",
+		data: `<Hublist><Hubs><Hub Name="A & B" Address="a.example.com"/><Hub Name="C"/></Hubs></Hublist>`,
+		exp:  []Hub{{Name: "A & B", Address: "a.example.com"}},
+	},
+}
+
+func TestDecodeDirty(t *testing.T) {
+	for _, c := range dirtyCases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			l, err := Decode(bytes.NewReader([]byte(c.data)))
+			require.NoError(t, err)
+			require.Equal(t, c.exp, l.Hubs)
+		})
+	}
+}
+
+func TestFromADC(t *testing.T) {
+	h := FromADC(&adc.HubInfo{
+		Name: "Hub", Version: "1.0", Application: "Soft", Desc: "desc",
+		Address: "adc://hub.example.com:412", Users: 10, Share: 100, MinSlots: 2, UsersLimit: 50,
+	})
+	require.Equal(t, Hub{
+		Name: "Hub", Address: "adc://hub.example.com:412", Description: "desc", Encoding: "UTF-8",
+		Users: 10, Shared: 100, MinSlots: 2, MaxUsers: 50, Software: "Soft 1.0",
+	}, h)
+}
+
+func TestFromNMDC(t *testing.T) {
+	h := FromNMDC(&nmdc.HubINFO{
+		Name: "hub name", Host: "dc.example.com:8000", Desc: "hub desc",
+		MaxUsers: 3000, MinShare: 32212254720, MinSlots: 3, MaxHubs: 40,
+		Soft:  types.Software{Name: "YnHub", Version: "1.0364"},
+		Owner: "owner", Category: "Public HUB", Encoding: "CP1251",
+	})
+	require.Equal(t, Hub{
+		Name: "hub name", Address: "dchub://dc.example.com:8000", Description: "hub desc",
+		Encoding: "CP1251", MaxUsers: 3000, MinShare: 32212254720, MinSlots: 3, MaxHubs: 40,
+		Software: "YnHub 1.0364", Owner: "owner", Extra: map[string]string{"Category": "Public HUB"},
+	}, h)
+}
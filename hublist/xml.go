@@ -0,0 +1,338 @@
+package hublist
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	bzip2w "github.com/dsnet/compress/bzip2"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+const xmlHeader = `<?xml version="1.0" encoding="utf-8" standalone="yes"?>` + "\r\n"
+
+// bzip2Magic is the header of bzip2 streams.
+var bzip2Magic = []byte("BZh")
+
+// Column types used in the list.
+const (
+	typeString  = "string"
+	typeInt     = "int"
+	typeBytes   = "bytes"
+	typePercent = "percent"
+)
+
+// column describes how a hub attribute is mapped to a field of Hub.
+type column struct {
+	name string // as written by DC++ and pingers
+	typ  string
+	// ext columns are only written if at least one hub has a value
+	ext bool
+	get func(h *Hub) string
+	set func(h *Hub, v string)
+}
+
+func strColumn(name string, ext bool, f func(h *Hub) *string) column {
+	return column{
+		name: name, typ: typeString, ext: ext,
+		get: func(h *Hub) string { return *f(h) },
+		set: func(h *Hub, v string) { *f(h) = v },
+	}
+}
+
+func intColumn(name string, f func(h *Hub) *int) column {
+	return column{
+		name: name, typ: typeInt,
+		get: func(h *Hub) string { return strconv.Itoa(*f(h)) },
+		set: func(h *Hub, v string) { *f(h) = int(parseInt(v)) },
+	}
+}
+
+func bytesColumn(name string, f func(h *Hub) *uint64) column {
+	return column{
+		name: name, typ: typeBytes,
+		get: func(h *Hub) string { return strconv.FormatUint(*f(h), 10) },
+		set: func(h *Hub, v string) { *f(h) = parseBytes(v) },
+	}
+}
+
+// columns in the order they are written.
+var columns = []column{
+	strColumn("Name", false, func(h *Hub) *string { return &h.Name }),
+	strColumn("Address", false, func(h *Hub) *string { return &h.Address }),
+	strColumn("Description", false, func(h *Hub) *string { return &h.Description }),
+	intColumn("Users", func(h *Hub) *int { return &h.Users }),
+	strColumn("Country", false, func(h *Hub) *string { return &h.Country }),
+	bytesColumn("Shared", func(h *Hub) *uint64 { return &h.Shared }),
+	bytesColumn("Minshare", func(h *Hub) *uint64 { return &h.MinShare }),
+	intColumn("Minslots", func(h *Hub) *int { return &h.MinSlots }),
+	intColumn("Maxhubs", func(h *Hub) *int { return &h.MaxHubs }),
+	intColumn("Maxusers", func(h *Hub) *int { return &h.MaxUsers }),
+	{
+		name: "Reliability", typ: typePercent,
+		get: func(h *Hub) string { return strconv.FormatFloat(h.Reliability, 'f', -1, 64) },
+		set: func(h *Hub, v string) { h.Reliability = parsePercent(v) },
+	},
+	strColumn("Rating", false, func(h *Hub) *string { return &h.Rating }),
+	strColumn("Encoding", true, func(h *Hub) *string { return &h.Encoding }),
+	strColumn("Status", true, func(h *Hub) *string { return &h.Status }),
+	strColumn("Software", true, func(h *Hub) *string { return &h.Software }),
+	strColumn("Website", true, func(h *Hub) *string { return &h.Website }),
+	strColumn("Email", true, func(h *Hub) *string { return &h.Email }),
+	strColumn("Network", true, func(h *Hub) *string { return &h.Network }),
+	strColumn("Owner", true, func(h *Hub) *string { return &h.Owner }),
+}
+
+// columnsByName maps lower-case column names and their known aliases to columns.
+var columnsByName = make(map[string]*column)
+
+func init() {
+	for i := range columns {
+		c := &columns[i]
+		columnsByName[strings.ToLower(c.name)] = c
+	}
+	for alias, name := range map[string]string{
+		"desc":      "description",
+		"host":      "address",
+		"usercount": "users",
+		"share":     "shared",
+		"min_share": "minshare",
+		"min_slots": "minslots",
+		"max_hubs":  "maxhubs",
+		"max_users": "maxusers",
+		"charset":   "encoding",
+		"url":       "website",
+	} {
+		columnsByName[alias] = columnsByName[name]
+	}
+}
+
+// Decode reads a hub list in XML format. Compressed lists are detected automatically.
+//
+// The decoder accepts lists produced by different pingers: columns may be missing or listed in any
+// order, attribute names are case-insensitive, numbers may contain units, and the list may use
+// any encoding. Lists without an encoding declaration that are not valid UTF-8 are decoded with
+// invalid sequences replaced. Unknown columns are stored in Hub.Extra.
+func Decode(r io.Reader) (*Hublist, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(bzip2Magic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	var rd io.Reader = br
+	if string(magic) == string(bzip2Magic) {
+		rd = bzip2.NewReader(br)
+	}
+	data, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	data = cleanXML(data)
+
+	x := xml.NewDecoder(bytes.NewReader(data))
+	x.Strict = false
+	x.CharsetReader = func(label string, r io.Reader) (io.Reader, error) {
+		enc, err := htmlindex.Get(label)
+		if err != nil {
+			// unknown encoding, assume UTF-8 and let cleanXML deal with it
+			return r, nil
+		}
+		return enc.NewDecoder().Reader(r), nil
+	}
+	l := &Hublist{}
+	for {
+		tok, err := x.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		st, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(st.Name.Local) {
+		case "hublist":
+			for _, a := range st.Attr {
+				switch strings.ToLower(a.Name.Local) {
+				case "name":
+					l.Name = a.Value
+				case "address":
+					l.Address = a.Value
+				}
+			}
+		case "hub":
+			h := decodeHub(st.Attr)
+			if h.Address == "" {
+				continue
+			}
+			l.Hubs = append(l.Hubs, h)
+		}
+	}
+	return l, nil
+}
+
+func decodeHub(attrs []xml.Attr) Hub {
+	var h Hub
+	for _, a := range attrs {
+		name := a.Name.Local
+		if c := columnsByName[strings.ToLower(name)]; c != nil {
+			c.set(&h, strings.TrimSpace(a.Value))
+			continue
+		}
+		if h.Extra == nil {
+			h.Extra = make(map[string]string)
+		}
+		h.Extra[name] = a.Value
+	}
+	return h
+}
+
+var reEncoding = regexp.MustCompile(`^\s*<\?xml[^>]*encoding=`)
+
+// cleanXML fixes common issues of the hub lists: UTF-8 lists with invalid sequences and
+// control characters that are not allowed in XML.
+func cleanXML(data []byte) []byte {
+	// lists in other encodings are converted by the XML decoder
+	if !utf8.Valid(data) && !declaresEncoding(data) {
+		buf := make([]byte, 0, len(data))
+		for len(data) > 0 {
+			r, n := utf8.DecodeRune(data)
+			if r == utf8.RuneError && n == 1 {
+				buf = append(buf, "�"...)
+			} else {
+				buf = append(buf, data[:n]...)
+			}
+			data = data[n:]
+		}
+		data = buf
+	}
+	for i, b := range data {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' {
+			data[i] = ' '
+		}
+	}
+	return data
+}
+
+// declaresEncoding checks if the XML declaration specifies an encoding other than UTF-8.
+func declaresEncoding(data []byte) bool {
+	i := bytes.Index(data, []byte("?>"))
+	if i < 0 {
+		return false
+	}
+	decl := data[:i]
+	if !reEncoding.Match(decl) {
+		return false
+	}
+	decl = bytes.ToLower(decl)
+	return !bytes.Contains(decl, []byte("utf-8")) && !bytes.Contains(decl, []byte("utf8"))
+}
+
+// Encode writes the hub list in the XML format used by DC++.
+//
+// Extended columns are only written if at least one of the hubs has a value for them.
+// Columns from Hub.Extra are written after the known ones, sorted by name.
+func Encode(w io.Writer, l *Hublist) error {
+	used := make([]*column, 0, len(columns))
+	for i := range columns {
+		c := &columns[i]
+		if c.ext && !hasValue(l.Hubs, c) {
+			continue
+		}
+		used = append(used, c)
+	}
+	extra := make(map[string]struct{})
+	for _, h := range l.Hubs {
+		for k := range h.Extra {
+			if columnsByName[strings.ToLower(k)] == nil {
+				extra[k] = struct{}{}
+			}
+		}
+	}
+	extraNames := make([]string, 0, len(extra))
+	for k := range extra {
+		extraNames = append(extraNames, k)
+	}
+	sort.Strings(extraNames)
+
+	bw := bufio.NewWriter(w)
+	var err error
+	attr := func(name, val string) {
+		bw.WriteByte(' ')
+		bw.WriteString(name)
+		bw.WriteString(`="`)
+		if err == nil {
+			err = xml.EscapeText(bw, []byte(val))
+		}
+		bw.WriteByte('"')
+	}
+	bw.WriteString(xmlHeader)
+	bw.WriteString("<Hublist")
+	if l.Name != "" {
+		attr("Name", l.Name)
+	}
+	if l.Address != "" {
+		attr("Address", l.Address)
+	}
+	bw.WriteString(">\r\n\t<Hubs>\r\n\t\t<Columns>\r\n")
+	for _, c := range used {
+		bw.WriteString("\t\t\t<Column")
+		attr("Name", c.name)
+		attr("Type", c.typ)
+		bw.WriteString("/>\r\n")
+	}
+	for _, name := range extraNames {
+		bw.WriteString("\t\t\t<Column")
+		attr("Name", name)
+		attr("Type", typeString)
+		bw.WriteString("/>\r\n")
+	}
+	bw.WriteString("\t\t</Columns>\r\n")
+	for i := range l.Hubs {
+		h := &l.Hubs[i]
+		bw.WriteString("\t\t<Hub")
+		for _, c := range used {
+			attr(c.name, c.get(h))
+		}
+		for _, name := range extraNames {
+			attr(name, h.Extra[name])
+		}
+		bw.WriteString("/>\r\n")
+	}
+	bw.WriteString("\t</Hubs>\r\n</Hublist>\r\n")
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func hasValue(hubs []Hub, c *column) bool {
+	for i := range hubs {
+		if c.get(&hubs[i]) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// EncodeBZip2 writes the hub list compressed with bzip2.
+func EncodeBZip2(w io.Writer, l *Hublist) error {
+	bw, err := bzip2w.NewWriter(w, &bzip2w.WriterConfig{Level: bzip2w.BestCompression})
+	if err != nil {
+		return err
+	}
+	if err = Encode(bw, l); err != nil {
+		_ = bw.Close()
+		return err
+	}
+	return bw.Close()
+}
@@ -1,7 +1,10 @@
 package tlskp
 
 import (
+	"context"
 	"crypto/tls"
+	"net"
+	"time"
 
 	"github.com/direct-connect/go-dc/keyprint"
 )
@@ -38,3 +41,49 @@ func VerifyKeyPrint(c *tls.Conn, kp string) ([]string, error) {
 	}
 	return kps, &ErrInvalidKeyPrint{Expected: kp, Actual: kps}
 }
+
+// Client wraps a connection to the hub into TLS and performs the handshake, respecting the context deadline.
+// The connection is closed if the handshake fails.
+//
+// If the keyprint is set, the hub certificate is verified against it instead of the certificate chain,
+// since most hubs use self-signed certificates. Otherwise, the certificate chain is verified as usual,
+// unless the verification is disabled explicitly with InsecureSkipVerify. If the config has no ServerName,
+// it is set to a given host.
+func Client(ctx context.Context, c net.Conn, host, kp string, conf *tls.Config) (*tls.Conn, error) {
+	if conf == nil {
+		conf = &tls.Config{}
+	} else {
+		conf = conf.Clone()
+	}
+	if conf.ServerName == "" {
+		conf.ServerName = host
+	}
+	if kp != "" {
+		// keyprint replaces the chain verification
+		conf.InsecureSkipVerify = true
+	}
+	tc := tls.Client(c, conf)
+	if err := Handshake(ctx, tc); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	if kp != "" {
+		if _, err := VerifyKeyPrint(tc, kp); err != nil {
+			_ = tc.Close()
+			return nil, err
+		}
+	}
+	return tc, nil
+}
+
+// Handshake runs a TLS handshake on the client or server connection, respecting the context deadline.
+// The connection is not closed if the handshake fails.
+func Handshake(ctx context.Context, c *tls.Conn) error {
+	if dl, ok := ctx.Deadline(); ok {
+		if err := c.SetDeadline(dl); err != nil {
+			return err
+		}
+		defer c.SetDeadline(time.Time{})
+	}
+	return c.Handshake()
+}
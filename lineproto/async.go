@@ -0,0 +1,413 @@
+package lineproto
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultQueueSize is the number of lines an AsyncWriter can hold if no size is set in the config.
+	DefaultQueueSize = 1024
+
+	// maxBatch is the max number of lines written before the flush.
+	maxBatch = 256
+)
+
+var (
+	// ErrQueueFull is returned by TryWriteLine if the queue is full.
+	ErrQueueFull = errors.New("lineproto: send queue is full")
+	// ErrSlowConsumer is returned if the peer doesn't read the data fast enough. See AsyncConfig.MaxLag.
+	ErrSlowConsumer = errors.New("lineproto: slow consumer")
+
+	errAsyncClosed = errors.New("lineproto: async writer is closed")
+)
+
+// Priority of the line in the send queue. Lines with higher priority are written first.
+type Priority int
+
+const (
+	// PriorityLow is for messages that can be dropped, for example search requests.
+	PriorityLow = Priority(iota)
+	// PriorityNormal is used by WriteLine.
+	PriorityNormal
+	// PriorityHigh is for chat and control messages.
+	PriorityHigh
+
+	numPriorities = int(PriorityHigh) + 1
+)
+
+// AsyncConfig is an optional configuration for AsyncWriter.
+type AsyncConfig struct {
+	// QueueSize is the max number of queued lines, for all priorities. DefaultQueueSize is used if not set.
+	QueueSize int
+	// DropLow allows dropping the oldest low-priority lines when the queue is full.
+	// Otherwise, writes block until there is space in the queue.
+	DropLow bool
+	// MaxLag is the max time a line can wait in the queue. If it is exceeded, the writer fails with
+	// ErrSlowConsumer. Zero means no limit.
+	MaxLag time.Duration
+	// OnError is called once when the writer fails, either with an error from the underlying writer
+	// or with ErrSlowConsumer. It's usually used to close the connection. It may be called from any goroutine.
+	OnError func(err error)
+}
+
+// queuedLine is a line in the send queue.
+type queuedLine struct {
+	data []byte
+	time time.Time
+}
+
+var _ LineWriter = (*AsyncWriter)(nil)
+
+// NewAsyncWriter creates an asynchronous writer on top of w. The config is optional.
+// The writer takes ownership of w: it must not be used directly until the AsyncWriter is closed.
+func NewAsyncWriter(w LineWriter, conf *AsyncConfig) *AsyncWriter {
+	aw := &AsyncWriter{
+		w:    w,
+		done: make(chan struct{}),
+	}
+	if conf != nil {
+		aw.conf = *conf
+	}
+	if aw.conf.QueueSize <= 0 {
+		aw.conf.QueueSize = DefaultQueueSize
+	}
+	aw.cond = sync.NewCond(&aw.mu)
+	go aw.writeLoop()
+	if aw.conf.MaxLag > 0 {
+		aw.stop = make(chan struct{})
+		go aw.watchLag()
+	}
+	return aw
+}
+
+// AsyncWriter is a line writer that is safe for concurrent use. Lines are copied to a bounded queue
+// and are written in batches by a separate goroutine, thus a slow peer doesn't block the callers,
+// unless the queue is full.
+//
+// Lines with higher priority are written before lines with lower priority, thus the order is only
+// preserved for lines with the same priority. The priority is strict: lower-priority lines are only
+// written when there are no higher-priority lines in the queue. Thus, a steady stream of high-priority
+// lines may starve PriorityLow, and if MaxLag is set, a healthy peer may be disconnected with
+// ErrSlowConsumer because of the lag of starved lines. Consider enabling DropLow in this case,
+// or using a MaxLag large enough for the expected bursts.
+//
+// Changes of the connection state, such as enabling zlib compression, must be done with Barrier,
+// since the underlying writer is used by a separate goroutine.
+//
+// See nmdc.AsyncWriter and adc.AsyncWriter for writers that choose the priority by the message type.
+type AsyncWriter struct {
+	w    LineWriter
+	conf AsyncConfig
+
+	mu      sync.Mutex
+	cond    *sync.Cond // signaled on each state change
+	queue   [numPriorities][]queuedLine
+	n       int       // number of queued lines
+	writing time.Time // time of the oldest line that is being written
+	dropped uint64
+	barrier bool // new lines are not accepted during the barrier
+	closed  bool
+	err     error
+
+	stop chan struct{} // stops the lag watcher
+	done chan struct{} // closed when the write loop exits
+}
+
+// WriteLine queues the line with normal priority. It blocks if the queue is full.
+func (w *AsyncWriter) WriteLine(line []byte) error {
+	return w.WriteLinePriority(PriorityNormal, line)
+}
+
+// WriteLinePriority queues the line with a given priority. If the queue is full, the oldest low-priority
+// line is dropped (see AsyncConfig.DropLow), or the call blocks until there is space in the queue.
+func (w *AsyncWriter) WriteLinePriority(p Priority, line []byte) error {
+	return w.queueLine(p, line, true)
+}
+
+// TryWriteLine is like WriteLinePriority, but returns ErrQueueFull instead of blocking.
+func (w *AsyncWriter) TryWriteLine(p Priority, line []byte) error {
+	return w.queueLine(p, line, false)
+}
+
+func (w *AsyncWriter) queueLine(p Priority, line []byte, block bool) error {
+	if p < PriorityLow {
+		p = PriorityLow
+	} else if p > PriorityHigh {
+		p = PriorityHigh
+	}
+	now := time.Now()
+	w.mu.Lock()
+	for {
+		if w.err != nil {
+			err := w.err
+			w.mu.Unlock()
+			return err
+		} else if w.closed {
+			w.mu.Unlock()
+			return errAsyncClosed
+		}
+		if w.barrier {
+			if !block {
+				w.mu.Unlock()
+				return ErrQueueFull
+			}
+			w.cond.Wait()
+			continue
+		}
+		if w.n < w.conf.QueueSize {
+			break
+		}
+		if w.conf.DropLow {
+			if q := w.queue[PriorityLow]; len(q) != 0 {
+				// drop the oldest one
+				q[0] = queuedLine{}
+				w.queue[PriorityLow] = q[1:]
+				w.n--
+				w.dropped++
+				break
+			} else if p == PriorityLow {
+				// no space for a new one either
+				w.dropped++
+				w.mu.Unlock()
+				return nil
+			}
+		}
+		if !block {
+			w.mu.Unlock()
+			return ErrQueueFull
+		}
+		w.cond.Wait()
+	}
+	data := make([]byte, len(line))
+	copy(data, line)
+	w.queue[p] = append(w.queue[p], queuedLine{data: data, time: now})
+	w.n++
+	w.cond.Broadcast()
+	w.mu.Unlock()
+	return nil
+}
+
+// Flush waits until all queued lines are written and flushed.
+func (w *AsyncWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.err == nil && (w.n != 0 || !w.writing.IsZero()) {
+		w.cond.Wait()
+	}
+	return w.err
+}
+
+// Barrier waits until all queued lines are written and flushed, and calls fnc while the write loop is idle.
+// New lines are not accepted until fnc returns: writes block and TryWriteLine returns ErrQueueFull.
+//
+// It allows to safely change the state of the underlying writer, for example to enable zlib compression.
+// Lines written by fnc directly to the underlying writer are sent before any other queued lines.
+// An error returned by fnc fails the writer.
+func (w *AsyncWriter) Barrier(fnc func() error) error {
+	w.mu.Lock()
+	// wait for other barriers
+	for w.barrier && w.err == nil && !w.closed {
+		w.cond.Wait()
+	}
+	if w.err != nil {
+		err := w.err
+		w.mu.Unlock()
+		return err
+	} else if w.closed {
+		w.mu.Unlock()
+		return errAsyncClosed
+	}
+	w.barrier = true
+	for w.err == nil && (w.n != 0 || !w.writing.IsZero()) {
+		w.cond.Wait()
+	}
+	err := w.err
+	w.mu.Unlock()
+
+	if err == nil {
+		err = fnc()
+	}
+
+	w.mu.Lock()
+	w.barrier = false
+	failed := err != nil && w.fail(err)
+	w.cond.Broadcast()
+	w.mu.Unlock()
+	if failed {
+		w.onError(err)
+	}
+	return err
+}
+
+// Len returns the number of queued lines.
+func (w *AsyncWriter) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.n
+}
+
+// Dropped returns the number of low-priority lines dropped because the queue was full.
+func (w *AsyncWriter) Dropped() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dropped
+}
+
+// Err returns the error that caused the writer to fail.
+func (w *AsyncWriter) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Close writes all queued lines and stops the writer. It won't close the underlying writer.
+//
+// If the underlying writer is blocked, Close blocks as well. In this case the connection
+// should be closed first.
+func (w *AsyncWriter) Close() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		if w.stop != nil {
+			close(w.stop)
+		}
+		w.cond.Broadcast()
+	}
+	w.mu.Unlock()
+	<-w.done
+	return w.Err()
+}
+
+// fail stops the writer with a given error. It must be called with the lock held.
+// It returns false if the writer has already failed.
+func (w *AsyncWriter) fail(err error) bool {
+	if w.err != nil {
+		return false
+	}
+	w.err = err
+	for i := range w.queue {
+		w.queue[i] = nil
+	}
+	w.n = 0
+	w.cond.Broadcast()
+	return true
+}
+
+func (w *AsyncWriter) onError(err error) {
+	if w.conf.OnError != nil {
+		w.conf.OnError(err)
+	}
+}
+
+// nextBatch moves up to max lines from the queue to the batch, highest priority first.
+// It must be called with the lock held.
+func (w *AsyncWriter) nextBatch(batch []queuedLine, max int) []queuedLine {
+	for p := numPriorities - 1; p >= 0 && len(batch) < max; p-- {
+		q := w.queue[p]
+		k := max - len(batch)
+		if k > len(q) {
+			k = len(q)
+		}
+		batch = append(batch, q[:k]...)
+		for i := range q[:k] {
+			q[i] = queuedLine{}
+		}
+		if k == len(q) {
+			// reuse the buffer
+			w.queue[p] = q[:0]
+		} else {
+			w.queue[p] = q[k:]
+		}
+		w.n -= k
+	}
+	return batch
+}
+
+func (w *AsyncWriter) writeLoop() {
+	defer close(w.done)
+	var batch []queuedLine
+	for {
+		w.mu.Lock()
+		for w.n == 0 && !w.closed && w.err == nil {
+			w.cond.Wait()
+		}
+		if w.err != nil || w.n == 0 {
+			// failed or closed
+			w.mu.Unlock()
+			return
+		}
+		batch = w.nextBatch(batch[:0], maxBatch)
+		w.writing = batch[0].time
+		for _, l := range batch[1:] {
+			if l.time.Before(w.writing) {
+				w.writing = l.time
+			}
+		}
+		w.cond.Broadcast()
+		w.mu.Unlock()
+
+		err := w.writeBatch(batch)
+		for i := range batch {
+			batch[i] = queuedLine{}
+		}
+
+		w.mu.Lock()
+		w.writing = time.Time{}
+		failed := err != nil && w.fail(err)
+		w.cond.Broadcast()
+		w.mu.Unlock()
+		if failed {
+			w.onError(err)
+			return
+		}
+	}
+}
+
+func (w *AsyncWriter) writeBatch(batch []queuedLine) error {
+	for _, l := range batch {
+		if err := w.w.WriteLine(l.data); err != nil {
+			return err
+		}
+	}
+	return w.w.Flush()
+}
+
+// oldest returns the time of the oldest queued line. It must be called with the lock held.
+func (w *AsyncWriter) oldest() time.Time {
+	t := w.writing
+	for _, q := range w.queue {
+		if len(q) != 0 && (t.IsZero() || q[0].time.Before(t)) {
+			t = q[0].time
+		}
+	}
+	return t
+}
+
+// watchLag periodically checks the lag of the queue. It stops when the writer is closed or fails.
+func (w *AsyncWriter) watchLag() {
+	interval := w.conf.MaxLag / 4
+	if interval <= 0 {
+		interval = w.conf.MaxLag
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-w.done:
+			return
+		case now := <-ticker.C:
+			w.mu.Lock()
+			t := w.oldest()
+			failed := !t.IsZero() && now.Sub(t) > w.conf.MaxLag && w.fail(ErrSlowConsumer)
+			w.mu.Unlock()
+			if failed {
+				w.onError(ErrSlowConsumer)
+				return
+			}
+		}
+	}
+}
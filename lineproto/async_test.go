@@ -0,0 +1,207 @@
+package lineproto
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// blockingWriter is a line writer that blocks until the gate is closed.
+type blockingWriter struct {
+	gate    chan struct{}
+	started chan struct{}
+
+	mu    sync.Mutex
+	lines []string
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{gate: make(chan struct{}), started: make(chan struct{}, 1)}
+}
+
+func (w *blockingWriter) WriteLine(line []byte) error {
+	select {
+	case w.started <- struct{}{}:
+	default:
+	}
+	<-w.gate
+	w.mu.Lock()
+	w.lines = append(w.lines, string(line))
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *blockingWriter) Flush() error {
+	return nil
+}
+
+func (w *blockingWriter) Lines() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.lines...)
+}
+
+// waitStarted waits until the write loop is blocked on the first line.
+func (w *blockingWriter) waitStarted(t *testing.T) {
+	select {
+	case <-w.started:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestAsyncWriter(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := NewAsyncWriter(NewWriter(buf), nil)
+
+	const (
+		writers = 10
+		lines   = 100
+	)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			line := []byte("$Line|")
+			for j := 0; j < lines; j++ {
+				require.NoError(t, w.WriteLine(line))
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, w.Flush())
+	require.Equal(t, 0, w.Len())
+	require.NoError(t, w.Close())
+	require.Equal(t, writers*lines, bytes.Count(buf.Bytes(), []byte("$Line|")))
+	require.Equal(t, errAsyncClosed, w.WriteLine([]byte("$Late|")))
+}
+
+func TestAsyncWriterPriority(t *testing.T) {
+	bw := newBlockingWriter()
+	w := NewAsyncWriter(bw, nil)
+
+	require.NoError(t, w.WriteLine([]byte("first")))
+	bw.waitStarted(t)
+	require.NoError(t, w.WriteLinePriority(PriorityLow, []byte("low 1")))
+	require.NoError(t, w.WriteLinePriority(PriorityNormal, []byte("normal")))
+	require.NoError(t, w.WriteLinePriority(PriorityLow, []byte("low 2")))
+	require.NoError(t, w.WriteLinePriority(PriorityHigh, []byte("high")))
+	require.Equal(t, 4, w.Len())
+
+	close(bw.gate)
+	require.NoError(t, w.Close())
+	require.Equal(t, []string{"first", "high", "normal", "low 1", "low 2"}, bw.Lines())
+}
+
+func TestAsyncWriterDropLow(t *testing.T) {
+	bw := newBlockingWriter()
+	w := NewAsyncWriter(bw, &AsyncConfig{QueueSize: 2, DropLow: true})
+
+	require.NoError(t, w.WriteLine([]byte("first")))
+	bw.waitStarted(t)
+	require.NoError(t, w.WriteLinePriority(PriorityLow, []byte("low 1")))
+	require.NoError(t, w.WriteLinePriority(PriorityLow, []byte("low 2")))
+	// drops the oldest low-priority line
+	require.NoError(t, w.WriteLinePriority(PriorityNormal, []byte("normal 1")))
+	require.NoError(t, w.WriteLinePriority(PriorityNormal, []byte("normal 2")))
+	require.Equal(t, uint64(2), w.Dropped())
+	// no space for low-priority lines
+	require.NoError(t, w.WriteLinePriority(PriorityLow, []byte("low 3")))
+	require.Equal(t, uint64(3), w.Dropped())
+	require.Equal(t, ErrQueueFull, w.TryWriteLine(PriorityHigh, []byte("high")))
+
+	close(bw.gate)
+	require.NoError(t, w.Close())
+	require.Equal(t, []string{"first", "normal 1", "normal 2"}, bw.Lines())
+}
+
+func TestAsyncWriterBlock(t *testing.T) {
+	bw := newBlockingWriter()
+	w := NewAsyncWriter(bw, &AsyncConfig{QueueSize: 1})
+
+	require.NoError(t, w.WriteLine([]byte("first")))
+	bw.waitStarted(t)
+	require.NoError(t, w.WriteLine([]byte("second")))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- w.WriteLine([]byte("third"))
+	}()
+	select {
+	case <-done:
+		t.Fatal("write should block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(bw.gate)
+	require.NoError(t, <-done)
+	require.NoError(t, w.Close())
+	require.Equal(t, []string{"first", "second", "third"}, bw.Lines())
+}
+
+func TestAsyncWriterSlowConsumer(t *testing.T) {
+	bw := newBlockingWriter()
+	errc := make(chan error, 1)
+	w := NewAsyncWriter(bw, &AsyncConfig{
+		MaxLag: 50 * time.Millisecond,
+		OnError: func(err error) {
+			errc <- err
+			// closing the connection unblocks the writer
+			close(bw.gate)
+		},
+	})
+	for i := 0; i < 10; i++ {
+		require.NoError(t, w.WriteLine([]byte(strconv.Itoa(i))))
+	}
+	select {
+	case err := <-errc:
+		require.Equal(t, ErrSlowConsumer, err)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	require.Equal(t, ErrSlowConsumer, w.WriteLine([]byte("late")))
+	require.Equal(t, ErrSlowConsumer, w.Flush())
+	require.Equal(t, ErrSlowConsumer, w.Close())
+	// only the line that was being written is delivered
+	require.Equal(t, []string{"0"}, bw.Lines()[:1])
+	require.Equal(t, 0, w.Len())
+}
+
+func TestAsyncWriterBarrier(t *testing.T) {
+	bw := newBlockingWriter()
+	w := NewAsyncWriter(bw, nil)
+	require.NoError(t, w.WriteLine([]byte("first")))
+	bw.waitStarted(t)
+	require.NoError(t, w.WriteLine([]byte("second")))
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- w.Barrier(func() error {
+			// all queued lines must be written at this point
+			require.Equal(t, []string{"first", "second"}, bw.Lines())
+			close(entered)
+			<-release
+			return bw.WriteLine([]byte("barrier"))
+		})
+	}()
+	close(bw.gate)
+	select {
+	case <-entered:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	// no new lines are accepted during the barrier
+	require.Equal(t, ErrQueueFull, w.TryWriteLine(PriorityHigh, []byte("early")))
+	close(release)
+	require.NoError(t, <-errc)
+
+	require.NoError(t, w.WriteLine([]byte("third")))
+	require.NoError(t, w.Close())
+	require.Equal(t, []string{"first", "second", "barrier", "third"}, bw.Lines())
+}
@@ -137,6 +137,13 @@ type Reader struct {
 	// The buffer will contain a delimiter and is in the connection encoding.
 	// The function may return (false, nil) to ignore the message.
 	onLine []func(line []byte) (bool, error)
+	// onZlib is called each time the compression is enabled or disabled.
+	onZlib []func(on bool)
+	// onBinary is called with the data read from binary readers.
+	onBinary []func(data []byte)
+	// onBinaryBegin and onBinaryEnd are called when a binary reader is created and closed.
+	onBinaryBegin []func(compressed bool)
+	onBinaryEnd   []func()
 }
 
 // NewReader allocates a Reader.
@@ -164,6 +171,10 @@ func (r *Reader) Close() error {
 	}
 
 	r.onLine = nil
+	r.onZlib = nil
+	r.onBinary = nil
+	r.onBinaryBegin = nil
+	r.onBinaryEnd = nil
 	r.line = nil
 	return nil
 }
@@ -182,6 +193,58 @@ func (r *Reader) OnLine(fnc func(line []byte) (bool, error)) {
 	r.onLine = append(r.onLine, fnc)
 }
 
+// OnZlib registers a hook that is called each time the zlib compression is enabled or disabled.
+//
+// This method is not concurrent-safe.
+func (r *Reader) OnZlib(fnc func(on bool)) {
+	r.onZlib = append(r.onZlib, fnc)
+}
+
+// OnBinary registers a hook that is called with the data read from readers returned by Binary
+// and BinaryZlib. The data is already decompressed. The buffer is only valid until the hook returns.
+//
+// This method is not concurrent-safe.
+func (r *Reader) OnBinary(fnc func(data []byte)) {
+	r.onBinary = append(r.onBinary, fnc)
+}
+
+// OnBinaryBegin registers a hook that is called when a binary section starts, i.e. when Binary
+// or BinaryZlib is called. The compressed flag is set for BinaryZlib.
+//
+// This method is not concurrent-safe.
+func (r *Reader) OnBinaryBegin(fnc func(compressed bool)) {
+	r.onBinaryBegin = append(r.onBinaryBegin, fnc)
+}
+
+// OnBinaryEnd registers a hook that is called when a binary section ends, i.e. when the reader
+// returned by Binary or BinaryZlib is closed.
+//
+// This method is not concurrent-safe.
+func (r *Reader) OnBinaryEnd(fnc func()) {
+	r.onBinaryEnd = append(r.onBinaryEnd, fnc)
+}
+
+// binaryHooks returns the hooks for a new binary section and calls the begin hooks.
+func (r *Reader) binaryHooks(compressed bool) binaryHooks {
+	for _, fnc := range r.onBinaryBegin {
+		fnc(compressed)
+	}
+	return binaryHooks{data: r.onBinary, end: r.onBinaryEnd}
+}
+
+func (r *Reader) setZlib(on bool) {
+	r.zlibOn = on
+	for _, fnc := range r.onZlib {
+		fnc(on)
+	}
+}
+
+// disableZlib switches back to the original reader after the end of the compressed stream.
+func (r *Reader) disableZlib() {
+	r.cur = r.original
+	r.setZlib(false)
+}
+
 // ReadLine reads a single raw message until the delimiter. The returned buffer contains
 // a delimiter and is in the connection encoding. The buffer is only valid until the next
 // call to Read or ReadLine.
@@ -199,8 +262,7 @@ read:
 		pref, more, err := r.cur.Scan(r.delim)
 		if err == io.EOF && r.zlibOn {
 			// if compression was enabled, we need to switch back to original reader
-			r.cur = r.original
-			r.zlibOn = false
+			r.disableZlib()
 			continue
 		}
 		r.line = append(r.line, pref...)
@@ -234,8 +296,7 @@ func (r *Reader) Read(buf []byte) (int, error) {
 	n, err := r.cur.Read(buf)
 	if err == io.EOF && r.zlibOn {
 		// if compression was enabled, we need to switch back to original reader
-		r.cur = r.original
-		r.zlibOn = false
+		r.disableZlib()
 
 		// if some data was read, return it without errors.
 		if n > 0 {
@@ -248,6 +309,21 @@ func (r *Reader) Read(buf []byte) (int, error) {
 	return n, err
 }
 
+// ReadByte reads a single byte, inflating it if zlib is active.
+// It allows to use the Reader as a flate.Reader without reading past the compressed stream.
+func (r *Reader) ReadByte() (byte, error) {
+	if r.original == nil {
+		return 0, errReaderClosed
+	}
+	b, err := r.cur.ReadByte()
+	if err == io.EOF && r.zlibOn {
+		// if compression was enabled, we need to switch back to original reader
+		r.disableZlib()
+		return r.cur.ReadByte()
+	}
+	return b, err
+}
+
 // EnableZlib activates zlib inflating.
 func (r *Reader) EnableZlib() error {
 	if r.original == nil {
@@ -255,8 +331,6 @@ func (r *Reader) EnableZlib() error {
 	} else if r.zlibOn {
 		return errZlibAlreadyActive
 	}
-	r.zlibOn = true
-
 	if r.zlib != nil {
 		err := r.zlib.(zlib.Resetter).Reset(r.original, nil)
 		if err != nil {
@@ -276,6 +350,7 @@ func (r *Reader) EnableZlib() error {
 		r.compressed = newBufReader(r.zlib)
 	}
 	r.cur = r.compressed
+	r.setZlib(true)
 	return nil
 }
 
@@ -285,18 +360,90 @@ func (r *Reader) Binary(sz uint64) (io.ReadCloser, error) {
 	if r.original == nil {
 		return nil, errReaderClosed
 	}
-	return &binaryReader{r: io.LimitReader(r, int64(sz))}, nil
+	return &binaryReader{r: io.LimitReader(r, int64(sz)), hooks: r.binaryHooks(false)}, nil
+}
+
+// BinaryZlib returns a binary reader for a zlib-compressed stream that inflates to the given amount of bytes.
+// Caller must close the reader. Reader will automatically drain any unread bytes of the compressed stream.
+func (r *Reader) BinaryZlib(sz uint64) (io.ReadCloser, error) {
+	if r.original == nil {
+		return nil, errReaderClosed
+	}
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &binaryZlibReader{z: zr, r: io.LimitReader(zr, int64(sz)), hooks: r.binaryHooks(true)}, nil
+}
+
+type binaryZlibReader struct {
+	z     io.ReadCloser
+	r     io.Reader
+	hooks binaryHooks
+}
+
+func (r *binaryZlibReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.hooks.call(p[:n])
+	return n, err
+}
+
+func (r *binaryZlibReader) Close() error {
+	if r.hooks.closed {
+		return nil
+	}
+	defer r.hooks.close()
+	_, err := io.Copy(ioutil.Discard, r)
+	// read until the end of the compressed stream, including the checksum
+	if _, err2 := io.Copy(ioutil.Discard, r.z); err == nil {
+		err = err2
+	}
+	if err2 := r.z.Close(); err == nil {
+		err = err2
+	}
+	return err
 }
 
 type binaryReader struct {
-	r io.Reader
+	r     io.Reader
+	hooks binaryHooks
 }
 
 func (r *binaryReader) Read(p []byte) (int, error) {
-	return r.r.Read(p)
+	n, err := r.r.Read(p)
+	r.hooks.call(p[:n])
+	return n, err
 }
 
 func (r *binaryReader) Close() error {
-	_, err := io.Copy(ioutil.Discard, r.r)
+	if r.hooks.closed {
+		return nil
+	}
+	defer r.hooks.close()
+	// drain through the hooks, so they observe the whole binary section
+	_, err := io.Copy(ioutil.Discard, r)
 	return err
 }
+
+// binaryHooks calls data hooks for a single binary section and end hooks when the section is closed.
+type binaryHooks struct {
+	data   []func(data []byte)
+	end    []func()
+	closed bool
+}
+
+func (h *binaryHooks) call(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	for _, fnc := range h.data {
+		fnc(data)
+	}
+}
+
+func (h *binaryHooks) close() {
+	h.closed = true
+	for _, fnc := range h.end {
+		fnc()
+	}
+}
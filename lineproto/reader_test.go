@@ -74,3 +74,53 @@ func TestReader(t *testing.T) {
 
 	expect("$command4|")
 }
+
+func TestReaderBinaryZlib(t *testing.T) {
+	var byts []byte
+	byts = append(byts, []byte("$Sending 18|")...)
+	// zlib stream for "$OtherCommand test"
+	byts = append(byts, []byte{120, 156, 83, 241, 47, 201, 72, 45, 114,
+		206, 207, 205, 77, 204, 75, 81, 40, 73, 45,
+		46, 1, 0, 61, 220, 6, 198}...)
+	byts = append(byts, []byte("$command|")...)
+
+	r := NewReader(bytes.NewReader(byts), '|')
+	var (
+		bin    []byte
+		events []string
+	)
+	r.OnBinary(func(data []byte) {
+		bin = append(bin, data...)
+	})
+	r.OnBinaryBegin(func(compressed bool) {
+		require.True(t, compressed)
+		events = append(events, "begin")
+	})
+	r.OnBinaryEnd(func() {
+		events = append(events, "end")
+	})
+
+	line, err := r.ReadLine()
+	require.NoError(t, err)
+	require.Equal(t, "$Sending 18|", string(line))
+
+	rc, err := r.BinaryZlib(18)
+	require.NoError(t, err)
+
+	// partial read
+	data, err := ioutil.ReadAll(io.LimitReader(rc, 6))
+	require.NoError(t, err)
+	require.Equal(t, "$Other", string(data))
+
+	err = rc.Close()
+	require.NoError(t, err)
+	// unread data is reported as well
+	require.Equal(t, "$OtherCommand test", string(bin))
+	// end is only reported once
+	require.NoError(t, rc.Close())
+	require.Equal(t, []string{"begin", "end"}, events)
+
+	line, err = r.ReadLine()
+	require.NoError(t, err)
+	require.Equal(t, "$command|", string(line))
+}
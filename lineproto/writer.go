@@ -36,6 +36,13 @@ type Writer struct {
 	// onLine is called each time a raw protocol message is written.
 	// The function may return (false, nil) to skip writing the message.
 	onLine []func(line []byte) (bool, error)
+	// onZlib is called each time the compression is enabled or disabled.
+	onZlib []func(on bool)
+	// onBinary is called with the data written by Write and binary writers.
+	onBinary []func(data []byte)
+	// onBinaryBegin and onBinaryEnd are called when a binary writer is created and closed.
+	onBinaryBegin []func(compressed bool)
+	onBinaryEnd   []func()
 
 	w       io.Writer
 	cur     io.Writer     // active writer underlying the bw
@@ -54,6 +61,43 @@ func (w *Writer) OnLine(fnc func(line []byte) (bool, error)) {
 	w.onLine = append(w.onLine, fnc)
 }
 
+// OnZlib registers a hook that is called each time the zlib compression is enabled or disabled.
+//
+// This method is not concurrent-safe.
+func (w *Writer) OnZlib(fnc func(on bool)) {
+	w.onZlib = append(w.onZlib, fnc)
+}
+
+// OnBinary registers a hook that is called with the data written by Write or by the writer returned
+// from Binary, before the compression. The buffer is only valid until the hook returns.
+//
+// This method is not concurrent-safe.
+func (w *Writer) OnBinary(fnc func(data []byte)) {
+	w.onBinary = append(w.onBinary, fnc)
+}
+
+// OnBinaryBegin registers a hook that is called when a binary section starts, i.e. when Binary is called.
+//
+// This method is not concurrent-safe.
+func (w *Writer) OnBinaryBegin(fnc func(compressed bool)) {
+	w.onBinaryBegin = append(w.onBinaryBegin, fnc)
+}
+
+// OnBinaryEnd registers a hook that is called when a binary section ends, i.e. when the writer
+// returned by Binary is closed.
+//
+// This method is not concurrent-safe.
+func (w *Writer) OnBinaryEnd(fnc func()) {
+	w.onBinaryEnd = append(w.onBinaryEnd, fnc)
+}
+
+func (w *Writer) setZlib(on bool) {
+	w.zlibOn = on
+	for _, fnc := range w.onZlib {
+		fnc(on)
+	}
+}
+
 func (w *Writer) setError(err error) {
 	w.err = err
 }
@@ -80,6 +124,10 @@ func (w *Writer) Close() error {
 	w.cur = nil
 	w.w = nil
 	w.onLine = nil
+	w.onZlib = nil
+	w.onBinary = nil
+	w.onBinaryBegin = nil
+	w.onBinaryEnd = nil
 	return last
 }
 
@@ -98,7 +146,6 @@ func (w *Writer) EnableZlibLevel(lvl int) error {
 	if err := w.Flush(); err != nil {
 		return err
 	}
-	w.zlibOn = true
 	if w.zlibW == nil || w.zlibLvl != lvl {
 		z, err := zlib.NewWriterLevel(w.w, lvl)
 		if err != nil {
@@ -111,6 +158,7 @@ func (w *Writer) EnableZlibLevel(lvl int) error {
 	}
 	w.cur = w.zlibW
 	w.bw.Reset(w.cur)
+	w.setZlib(true)
 	return nil
 }
 
@@ -131,9 +179,9 @@ func (w *Writer) DisableZlib() error {
 		w.setError(err)
 		return err
 	}
-	w.zlibOn = false
 	w.cur = w.w
 	w.bw.Reset(w.cur)
+	w.setZlib(false)
 	return nil
 }
 
@@ -176,9 +224,73 @@ func (w *Writer) Write(p []byte) (int, error) {
 			return 0, err
 		}
 	}
+	for _, fnc := range w.onBinary {
+		fnc(p)
+	}
 	return w.cur.Write(p)
 }
 
+// Binary starts a binary section, for example a file transfer. Buffered messages are flushed first.
+// If compressed is set, the data is compressed with a separate zlib stream, as required by GetZBlock.
+//
+// The caller must close the returned writer to end the section. Closing it finishes the zlib stream
+// and flushes the writer, but won't close the underlying writer.
+func (w *Writer) Binary(compressed bool) (io.WriteCloser, error) {
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	for _, fnc := range w.onBinaryBegin {
+		fnc(compressed)
+	}
+	bw := &binaryWriter{w: w, out: w.cur}
+	if compressed {
+		bw.z = zlib.NewWriter(w.cur)
+		bw.out = bw.z
+	}
+	return bw, nil
+}
+
+// binaryWriter is a writer for a single binary section.
+type binaryWriter struct {
+	w      *Writer
+	out    io.Writer
+	z      *zlib.Writer
+	closed bool
+}
+
+func (b *binaryWriter) Write(p []byte) (int, error) {
+	if b.closed {
+		return 0, errWriterClosed
+	} else if b.w.err != nil {
+		return 0, b.w.err
+	}
+	for _, fnc := range b.w.onBinary {
+		fnc(p)
+	}
+	n, err := b.out.Write(p)
+	if err != nil {
+		b.w.setError(err)
+	}
+	return n, err
+}
+
+func (b *binaryWriter) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	for _, fnc := range b.w.onBinaryEnd {
+		fnc()
+	}
+	if b.z != nil {
+		if err := b.z.Close(); err != nil {
+			b.w.setError(err)
+			return err
+		}
+	}
+	return b.w.Flush()
+}
+
 // WriteLine writes a single protocol message.
 func (w *Writer) WriteLine(data []byte) error {
 	if w.err != nil {
@@ -177,3 +177,52 @@ func BenchmarkWriteLine(b *testing.B) {
 		}
 	}
 }
+
+func TestWriterBinary(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := NewWriter(buf)
+
+	var events []string
+	w.OnBinaryBegin(func(compressed bool) {
+		if compressed {
+			events = append(events, "begin zlib")
+		} else {
+			events = append(events, "begin")
+		}
+	})
+	w.OnBinary(func(data []byte) {
+		events = append(events, string(data))
+	})
+	w.OnBinaryEnd(func() {
+		events = append(events, "end")
+	})
+
+	require.NoError(t, w.WriteLine([]byte("$Sending 5|")))
+	bw, err := w.Binary(true)
+	require.NoError(t, err)
+	_, err = bw.Write([]byte("world"))
+	require.NoError(t, err)
+	require.NoError(t, bw.Close())
+	require.NoError(t, bw.Close())
+	_, err = bw.Write([]byte("x"))
+	require.Error(t, err)
+	require.NoError(t, w.WriteLine([]byte("$Sending|")))
+	require.NoError(t, w.Flush())
+
+	// the same stream as in TestReaderBinaryZlib
+	require.Equal(t, []string{"begin zlib", "world", "end"}, events)
+	r := NewReader(bytes.NewReader(buf.Bytes()), '|')
+	line, err := r.ReadLine()
+	require.NoError(t, err)
+	require.Equal(t, "$Sending 5|", string(line))
+	rc, err := r.BinaryZlib(5)
+	require.NoError(t, err)
+	var data bytes.Buffer
+	_, err = io.Copy(&data, rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, "world", data.String())
+	line, err = r.ReadLine()
+	require.NoError(t, err)
+	require.Equal(t, "$Sending|", string(line))
+}
@@ -0,0 +1,279 @@
+package dc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/nmdc"
+)
+
+const (
+	// DefaultDetectTimeout is the time the Listener waits for the ADC handshake
+	// before assuming that the client speaks NMDC.
+	DefaultDetectTimeout = time.Second
+	// DefaultHandshakeTimeout is the time the Listener waits for the TLS handshake to complete.
+	DefaultHandshakeTimeout = 10 * time.Second
+)
+
+// tlsRecordHandshake is the first byte of the TLS ClientHello record.
+const tlsRecordHandshake = 0x16
+
+const (
+	// minAcceptDelay and maxAcceptDelay limit the backoff after accept timeouts.
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+)
+
+var (
+	errListenerClosed = errors.New("dc: listener closed")
+	errTLSNotEnabled  = errors.New("dc: TLS connection on the listener without TLS config")
+)
+
+// NewListener wraps a TCP listener and detects the protocol of incoming connections.
+// If the TLS config is nil, TLS connections are rejected.
+//
+// The detection runs in a separate goroutine for each connection, thus slow clients
+// don't block the Accept.
+func NewListener(l net.Listener, conf *tls.Config) *Listener {
+	return &Listener{
+		l:       l,
+		conf:    conf,
+		conns:   make(chan *Conn),
+		closed:  make(chan struct{}),
+		Timeout: DefaultDetectTimeout,
+	}
+}
+
+// Listener accepts ADC, ADCS, NMDC and NMDCS connections on a single port.
+//
+// The first bytes of the connection are used to detect a TLS ClientHello. After that
+// (inside or outside of TLS), the listener waits for ADC HSUP message for a short time,
+// and otherwise assumes an NMDC client that waits for $Lock from the hub.
+//
+// Since NMDC clients send nothing until the hub sends $Lock, each NMDC connection (plain or TLS) is only
+// returned after the full Timeout has expired.
+type Listener struct {
+	l    net.Listener
+	conf *tls.Config
+
+	// Timeout is the time to wait for the ADC handshake. DefaultDetectTimeout is used if not set.
+	// NMDC clients always wait for this time before the hub can send $Lock.
+	// It must be set before the first call to Accept.
+	Timeout time.Duration
+	// HandshakeTimeout is the time to wait for the TLS handshake. DefaultHandshakeTimeout is used if not set.
+	// It must be set before the first call to Accept.
+	HandshakeTimeout time.Duration
+
+	start sync.Once
+	conns chan *Conn
+
+	mu     sync.Mutex
+	err    error
+	closed chan struct{}
+}
+
+// Addr returns the listener address.
+func (l *Listener) Addr() net.Addr {
+	return l.l.Addr()
+}
+
+// Close stops the listener. Connections that are still being detected are closed.
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-l.closed:
+		return nil
+	default:
+	}
+	if l.err == nil {
+		l.err = errListenerClosed
+	}
+	close(l.closed)
+	return l.l.Close()
+}
+
+// Accept waits for the next connection with a detected protocol. It implements net.Listener.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.AcceptConn()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// AcceptConn is the same as Accept, but returns a concrete connection type.
+func (l *Listener) AcceptConn() (*Conn, error) {
+	l.start.Do(func() {
+		go l.serve()
+	})
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		l.mu.Lock()
+		err := l.err
+		l.mu.Unlock()
+		return nil, err
+	}
+}
+
+func (l *Listener) serve() {
+	var delay time.Duration
+	for {
+		c, err := l.l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				// retry with an exponential backoff
+				if delay == 0 {
+					delay = minAcceptDelay
+				} else if delay *= 2; delay > maxAcceptDelay {
+					delay = maxAcceptDelay
+				}
+				select {
+				case <-time.After(delay):
+					continue
+				case <-l.closed:
+					return
+				}
+			}
+			l.mu.Lock()
+			if l.err == nil {
+				l.err = err
+			}
+			l.mu.Unlock()
+			_ = l.Close()
+			return
+		}
+		delay = 0
+		go l.detect(c)
+	}
+}
+
+func (l *Listener) detect(c net.Conn) {
+	dc, err := l.detectConn(c)
+	if err != nil {
+		_ = c.Close()
+		return
+	}
+	select {
+	case l.conns <- dc:
+	case <-l.closed:
+		_ = dc.Close()
+	}
+}
+
+func (l *Listener) detectConn(c net.Conn) (*Conn, error) {
+	timeout := l.Timeout
+	if timeout <= 0 {
+		timeout = DefaultDetectTimeout
+	}
+	conn := &Conn{Conn: c, r: bufio.NewReader(c)}
+
+	// TLS clients start the handshake right away, while ADC clients send HSUP,
+	// thus the first byte is enough to distinguish them
+	b, err := conn.peek(1, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 0 && b[0] == tlsRecordHandshake {
+		if l.conf == nil {
+			return nil, errTLSNotEnabled
+		}
+		hto := l.HandshakeTimeout
+		if hto <= 0 {
+			hto = DefaultHandshakeTimeout
+		}
+		tc := tls.Server(conn, l.conf)
+		if err = tc.SetDeadline(time.Now().Add(hto)); err != nil {
+			return nil, err
+		}
+		if err = tc.Handshake(); err != nil {
+			return nil, err
+		}
+		if err = tc.SetDeadline(time.Time{}); err != nil {
+			return nil, err
+		}
+		conn = &Conn{Conn: tc, r: bufio.NewReader(tc), secure: true}
+		b, err = conn.peek(1, timeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(b) != 0 {
+		b, err = conn.peek(len(adcHandshake), timeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	conn.adc = bytes.HasPrefix(b, adcHandshake)
+	return conn, nil
+}
+
+// adcHandshake is the first message sent by ADC clients.
+var adcHandshake = []byte("HSUP")
+
+// Conn is a connection with a detected protocol, returned by the Listener.
+//
+// Bytes that were read during the detection are buffered and returned by Read, thus the connection
+// can be passed to protocol readers (lineproto, adc or nmdc) without losing any data.
+type Conn struct {
+	net.Conn
+	r      *bufio.Reader
+	secure bool
+	adc    bool
+}
+
+// peek waits for at least n bytes with a given timeout. If the client sends no data
+// before the timeout, the bytes received so far are returned without an error.
+func (c *Conn) peek(n int, timeout time.Duration) ([]byte, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	b, err := c.r.Peek(n)
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = c.Conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Read implements io.Reader. It returns the buffered data first.
+func (c *Conn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// IsADC returns true if the client sent ADC handshake.
+func (c *Conn) IsADC() bool {
+	return c.adc
+}
+
+// IsTLS returns true if the connection uses TLS.
+func (c *Conn) IsTLS() bool {
+	return c.secure
+}
+
+// Scheme returns the URL scheme of the detected protocol.
+func (c *Conn) Scheme() string {
+	switch {
+	case c.adc && c.secure:
+		return adc.SchemaADCS
+	case c.adc:
+		return adc.SchemaADC
+	case c.secure:
+		return nmdc.SchemeNMDCS
+	default:
+		return nmdc.SchemeNMDC
+	}
+}
@@ -0,0 +1,177 @@
+package dc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/lineproto"
+	"github.com/direct-connect/go-dc/nmdc"
+)
+
+func testCert(t testing.TB) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"go-dc"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func testListener(t *testing.T) *Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ln := NewListener(l, &tls.Config{Certificates: []tls.Certificate{testCert(t)}})
+	ln.Timeout = 100 * time.Millisecond
+	return ln
+}
+
+func TestListener(t *testing.T) {
+	const hsup = "HSUP ADBASE ADTIGR\n"
+	var cases = []struct {
+		scheme string
+		secure bool
+		send   string
+	}{
+		{scheme: adc.SchemaADC, send: hsup},
+		{scheme: adc.SchemaADCS, secure: true, send: hsup},
+		{scheme: nmdc.SchemeNMDC},
+		{scheme: nmdc.SchemeNMDCS, secure: true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.scheme, func(t *testing.T) {
+			l := testListener(t)
+			defer l.Close()
+
+			errc := make(chan error, 1)
+			go func() {
+				conn, err := net.Dial("tcp", l.Addr().String())
+				if err != nil {
+					errc <- err
+					return
+				}
+				defer conn.Close()
+				if c.secure {
+					tc := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+					if err = tc.Handshake(); err != nil {
+						errc <- err
+						return
+					}
+					conn = tc
+				}
+				if c.send != "" {
+					_, err = conn.Write([]byte(c.send))
+				} else {
+					// NMDC client waits for the hub
+					var b [1]byte
+					_, err = conn.Read(b[:])
+				}
+				errc <- err
+			}()
+
+			conn, err := l.AcceptConn()
+			require.NoError(t, err)
+			defer conn.Close()
+			require.Equal(t, c.scheme, conn.Scheme())
+			require.Equal(t, c.secure, conn.IsTLS())
+			if c.send != "" {
+				require.True(t, conn.IsADC())
+				// peeked bytes must be preserved
+				line, err := lineproto.NewReader(conn, '\n').ReadLine()
+				require.NoError(t, err)
+				require.Equal(t, c.send, string(line))
+			} else {
+				require.False(t, conn.IsADC())
+				_, err = conn.Write([]byte("$"))
+				require.NoError(t, err)
+			}
+			require.NoError(t, <-errc)
+		})
+	}
+}
+
+func TestListenerNoTLS(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ln := NewListener(l, nil)
+	defer ln.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	go func() {
+		_ = tls.Client(conn, &tls.Config{InsecureSkipVerify: true}).Handshake()
+	}()
+
+	// TLS connection must be closed, the listener should still accept other connections
+	conn2, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn2.Close()
+	_, err = conn2.Write([]byte("HSUP ADBASE\n"))
+	require.NoError(t, err)
+
+	c, err := ln.AcceptConn()
+	require.NoError(t, err)
+	defer c.Close()
+	require.Equal(t, adc.SchemaADC, c.Scheme())
+
+	require.NoError(t, ln.Close())
+	_, err = ln.Accept()
+	require.Error(t, err)
+}
+
+// timeoutErr is a net.Error with a timeout.
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+// flakyListener returns timeouts from Accept a few times before accepting connections.
+type flakyListener struct {
+	net.Listener
+	fails int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.fails > 0 {
+		l.fails--
+		return nil, timeoutErr{}
+	}
+	return l.Listener.Accept()
+}
+
+func TestListenerAcceptTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ln := NewListener(&flakyListener{Listener: l, fails: 3}, nil)
+	defer ln.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("HSUP ADBASE\n"))
+	require.NoError(t, err)
+
+	c, err := ln.AcceptConn()
+	require.NoError(t, err)
+	defer c.Close()
+	require.True(t, c.IsADC())
+}
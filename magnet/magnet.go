@@ -0,0 +1,226 @@
+// Package magnet implements parsing and formatting of magnet links used in DC networks.
+//
+// DC clients identify files by TTH, thus only urn:tree:tiger (and urn:bitprint) topics are
+// recognized, other topics are preserved as-is.
+package magnet
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+// Scheme is the URL scheme of magnet links.
+const Scheme = "magnet"
+
+const (
+	urnTTH      = "urn:tree:tiger"
+	urnBitprint = "urn:bitprint:" // SHA1.TTH
+)
+
+var (
+	errNotMagnet = errors.New("magnet: not a magnet link")
+	errNoTopic   = errors.New("magnet: no exact topic")
+)
+
+// Magnet is a parsed magnet link.
+//
+// http://magnet-uri.sourceforge.net/magnet-draft-overview.txt
+type Magnet struct {
+	// TTH is the tree hash of the file, from urn:tree:tiger or urn:bitprint topic.
+	TTH *tiger.Hash
+	// Topics is a list of other exact topics (xt), for example hashes for other P2P networks.
+	Topics []string
+	// Size is the file size in bytes (xl). Zero means that the size is unknown.
+	Size uint64
+	// Name is the display name of the file (dn).
+	Name string
+	// Keywords is a list of search keywords (kt).
+	Keywords []string
+	// Sources is a list of acceptable sources (as), usually HTTP URLs.
+	Sources []string
+	// ExactSources is a list of exact sources (xs), except DC hubs.
+	ExactSources []string
+	// Hubs is a list of DC hub addresses (dchub, nmdcs, adc and adcs URLs) that have the file.
+	// DC clients send them as exact or acceptable sources.
+	Hubs []string
+	// Extra contains parameters that are not recognized.
+	Extra url.Values
+}
+
+// Parse parses the magnet link.
+//
+// Numbered parameters (xt.1, xt.2, ...) are supported for all keys.
+func Parse(s string) (*Magnet, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexByte(s, ':')
+	if i < 0 || !strings.EqualFold(s[:i], Scheme) {
+		return nil, errNotMagnet
+	}
+	s = strings.TrimPrefix(s[i+1:], "?")
+	vals, err := url.ParseQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(vals))
+	for key := range vals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	m := &Magnet{}
+	for _, key := range keys {
+		k := key
+		if i := strings.IndexByte(k, '.'); i >= 0 {
+			if _, err := strconv.Atoi(k[i+1:]); err == nil {
+				k = k[:i]
+			}
+		}
+		for _, v := range vals[key] {
+			if err := m.setParam(k, key, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if m.TTH == nil && len(m.Topics) == 0 && m.Name == "" && len(m.Keywords) == 0 {
+		return nil, errNoTopic
+	}
+	return m, nil
+}
+
+func (m *Magnet) setParam(k, key, v string) error {
+	switch k {
+	case "xt":
+		h, ok, err := parseTopic(v)
+		if err != nil {
+			return err
+		}
+		if ok && m.TTH == nil {
+			m.TTH = &h
+		} else if !ok {
+			m.Topics = append(m.Topics, v)
+		}
+	case "xl":
+		size, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return errors.New("magnet: invalid size")
+		}
+		m.Size = size
+	case "dn":
+		m.Name = v
+	case "kt":
+		m.Keywords = append(m.Keywords, strings.Fields(v)...)
+	case "as", "xs":
+		if isHub(v) {
+			m.Hubs = append(m.Hubs, v)
+		} else if k == "as" {
+			m.Sources = append(m.Sources, v)
+		} else {
+			m.ExactSources = append(m.ExactSources, v)
+		}
+	default:
+		if m.Extra == nil {
+			m.Extra = make(url.Values)
+		}
+		m.Extra.Add(key, v)
+	}
+	return nil
+}
+
+// parseTopic extracts the TTH from the exact topic. It returns false if the topic has a different type.
+func parseTopic(v string) (tiger.Hash, bool, error) {
+	var h tiger.Hash
+	lv := strings.ToLower(v)
+	switch {
+	case strings.HasPrefix(lv, urnTTH):
+		// some clients add a tree depth: urn:tree:tiger/1024:<hash>
+		i := strings.LastIndexByte(v, ':')
+		if i < len(urnTTH) {
+			return h, false, nil
+		}
+		v = v[i+1:]
+	case strings.HasPrefix(lv, urnBitprint):
+		v = v[len(urnBitprint):]
+		i := strings.IndexByte(v, '.')
+		if i < 0 {
+			return h, false, errors.New("magnet: invalid bitprint")
+		}
+		v = v[i+1:]
+	default:
+		return h, false, nil
+	}
+	if err := h.FromBase32(strings.ToUpper(v)); err != nil {
+		return h, false, err
+	}
+	return h, true, nil
+}
+
+// isHub checks if the source is a DC hub address.
+func isHub(v string) bool {
+	i := strings.Index(v, "://")
+	if i < 0 {
+		return false
+	}
+	switch strings.ToLower(v[:i]) {
+	case "dchub", "nmdc", "nmdcs", "adc", "adcs":
+		return true
+	}
+	return false
+}
+
+// String formats the magnet link.
+func (m *Magnet) String() string {
+	var buf strings.Builder
+	buf.WriteString(Scheme + ":?")
+	first := true
+	add := func(k, v string) {
+		if !first {
+			buf.WriteByte('&')
+		}
+		first = false
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		buf.WriteString(escape(v))
+	}
+	if m.TTH != nil {
+		add("xt", urnTTH+":"+m.TTH.Base32())
+	}
+	for _, t := range m.Topics {
+		add("xt", t)
+	}
+	if m.Size != 0 {
+		add("xl", strconv.FormatUint(m.Size, 10))
+	}
+	if m.Name != "" {
+		add("dn", m.Name)
+	}
+	if len(m.Keywords) != 0 {
+		add("kt", strings.Join(m.Keywords, " "))
+	}
+	for _, s := range m.Sources {
+		add("as", s)
+	}
+	for _, s := range m.ExactSources {
+		add("xs", s)
+	}
+	for _, s := range m.Hubs {
+		add("xs", s)
+	}
+	if len(m.Extra) != 0 {
+		if !first {
+			buf.WriteByte('&')
+		}
+		buf.WriteString(m.Extra.Encode())
+	}
+	return buf.String()
+}
+
+// escape is the same as url.QueryEscape, but keeps characters that are commonly used
+// unescaped in URNs and source URLs.
+func escape(s string) string {
+	s = url.QueryEscape(s)
+	return strings.NewReplacer("%3A", ":", "%2F", "/").Replace(s)
+}
@@ -0,0 +1,86 @@
+package magnet
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+const testTTH = "LWPNACQDBZRYXW3VHJVCJ64QBZNGHOHHHZWCLNQ"
+
+var magnetCases = []struct {
+	name  string
+	data  string
+	exp   Magnet
+	fixed string
+}{
+	{
+		name: "dc",
+		data: "magnet:?xt=urn:tree:tiger:" + testTTH + "&xl=1024&dn=some+file.txt&xs=dchub://example.com:411",
+		exp: Magnet{
+			Size: 1024,
+			Name: "some file.txt",
+			Hubs: []string{"dchub://example.com:411"},
+		},
+	},
+	{
+		name: "sources",
+		data: "magnet:?xt=urn:tree:tiger:" + testTTH + "&xt=urn:sha1:ABC&kt=some+file&as=http://example.com/file&xs=adcs://example.com:412&tr=udp://tracker",
+		exp: Magnet{
+			Topics:   []string{"urn:sha1:ABC"},
+			Keywords: []string{"some", "file"},
+			Sources:  []string{"http://example.com/file"},
+			Hubs:     []string{"adcs://example.com:412"},
+			Extra:    url.Values{"tr": {"udp://tracker"}},
+		},
+		fixed: "magnet:?xt=urn:tree:tiger:" + testTTH + "&xt=urn:sha1:ABC&kt=some+file&as=http://example.com/file&xs=adcs://example.com:412&tr=udp%3A%2F%2Ftracker",
+	},
+	{
+		name: "numbered",
+		data: "magnet:?xt.1=urn:sha1:ABC&xt.2=urn:bitprint:ABC." + testTTH + "&dn=file",
+		exp: Magnet{
+			Topics: []string{"urn:sha1:ABC"},
+			Name:   "file",
+		},
+		fixed: "magnet:?xt=urn:tree:tiger:" + testTTH + "&xt=urn:sha1:ABC&dn=file",
+	},
+	{
+		name:  "depth",
+		data:  "magnet:?xt=urn:tree:tiger/1024:" + testTTH,
+		exp:   Magnet{},
+		fixed: "magnet:?xt=urn:tree:tiger:" + testTTH,
+	},
+}
+
+func TestMagnet(t *testing.T) {
+	for _, c := range magnetCases {
+		t.Run(c.name, func(t *testing.T) {
+			m, err := Parse(c.data)
+			require.NoError(t, err)
+			exp := c.exp
+			h := tiger.MustParseBase32(testTTH)
+			exp.TTH = &h
+			require.Equal(t, &exp, m)
+			fixed := c.fixed
+			if fixed == "" {
+				fixed = c.data
+			}
+			require.Equal(t, fixed, m.String())
+		})
+	}
+}
+
+func TestMagnetInvalid(t *testing.T) {
+	for _, s := range []string{
+		"http://example.com",
+		"magnet:?xl=10",
+		"magnet:?xt=urn:tree:tiger:ABC",
+		"magnet:?xt=urn:tree:tiger:" + testTTH + "&xl=abc",
+	} {
+		_, err := Parse(s)
+		require.Error(t, err, s)
+	}
+}
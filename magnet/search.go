@@ -0,0 +1,67 @@
+package magnet
+
+import (
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/nmdc"
+)
+
+// ErrNoTTH is returned when converting a magnet link without TTH to a search request.
+var ErrNoTTH = errors.New("magnet: no TTH in the link")
+
+// ADCSearch returns ADC search request for the file. The token should be set by the caller.
+func (m *Magnet) ADCSearch() (*adc.SearchRequest, error) {
+	if m.TTH == nil {
+		return nil, ErrNoTTH
+	}
+	h := *m.TTH
+	return &adc.SearchRequest{TTH: &h}, nil
+}
+
+// NMDCSearch returns NMDC search request for the file. The address of the searcher should be set by the caller.
+func (m *Magnet) NMDCSearch() (*nmdc.Search, error) {
+	if m.TTH == nil {
+		return nil, ErrNoTTH
+	}
+	h := *m.TTH
+	return &nmdc.Search{DataType: nmdc.DataTypeTTH, TTH: &h}, nil
+}
+
+// FromADC creates a magnet link from ADC search result. Directories have no TTH,
+// thus the result will only contain the name.
+func FromADC(r *adc.SearchResult) *Magnet {
+	m := &Magnet{Name: path.Base(strings.TrimSuffix(r.Path, "/"))}
+	if r.TTH != nil {
+		h := *r.TTH
+		m.TTH = &h
+	}
+	if r.Size > 0 && !strings.HasSuffix(r.Path, "/") {
+		m.Size = uint64(r.Size)
+	}
+	return m
+}
+
+// FromNMDC creates a magnet link from NMDC search result. If the result contains a hub address,
+// it's added to the list of hubs. Directories have no TTH, thus the result will only contain the name.
+func FromNMDC(r *nmdc.SR) *Magnet {
+	m := &Magnet{}
+	if len(r.Path) != 0 {
+		m.Name = r.Path[len(r.Path)-1]
+	}
+	if r.TTH != nil {
+		h := *r.TTH
+		m.TTH = &h
+	}
+	if !r.IsDir {
+		m.Size = r.Size
+	}
+	if r.HubAddress != "" {
+		if addr, err := nmdc.NormalizeAddr(r.HubAddress); err == nil {
+			m.Hubs = append(m.Hubs, addr)
+		}
+	}
+	return m
+}
@@ -0,0 +1,51 @@
+package magnet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/nmdc"
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+func TestSearch(t *testing.T) {
+	h := tiger.MustParseBase32(testTTH)
+	m := &Magnet{TTH: &h, Name: "file"}
+
+	s, err := m.ADCSearch()
+	require.NoError(t, err)
+	require.Equal(t, &adc.SearchRequest{TTH: &h}, s)
+
+	s2, err := m.NMDCSearch()
+	require.NoError(t, err)
+	require.Equal(t, &nmdc.Search{DataType: nmdc.DataTypeTTH, TTH: &h}, s2)
+
+	m = &Magnet{Name: "file"}
+	_, err = m.ADCSearch()
+	require.Equal(t, ErrNoTTH, err)
+	_, err = m.NMDCSearch()
+	require.Equal(t, ErrNoTTH, err)
+}
+
+func TestFromResult(t *testing.T) {
+	h := tiger.MustParseBase32(testTTH)
+
+	m := FromADC(&adc.SearchResult{Path: "/dir/file.txt", Size: 10, TTH: &h})
+	require.Equal(t, &Magnet{TTH: &h, Name: "file.txt", Size: 10}, m)
+
+	m = FromNMDC(&nmdc.SR{
+		Path:       []string{"dir", "file.txt"},
+		Size:       10,
+		TTH:        &h,
+		HubAddress: "example.com:411",
+	})
+	require.Equal(t, &Magnet{
+		TTH:  &h,
+		Name: "file.txt",
+		Size: 10,
+		Hubs: []string{"dchub://example.com:411"},
+	}, m)
+	require.Equal(t, "magnet:?xt=urn:tree:tiger:"+testTTH+"&xl=10&dn=file.txt&xs=dchub://example.com:411", m.String())
+}
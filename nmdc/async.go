@@ -0,0 +1,98 @@
+package nmdc
+
+import (
+	"bytes"
+	"compress/zlib"
+	"sync"
+
+	"github.com/direct-connect/go-dc/lineproto"
+)
+
+// MessagePriority returns the send queue priority for the message.
+//
+// Chat messages have the highest priority, search requests and results have the lowest one.
+// All other messages, including the user list and control messages, have the normal priority,
+// thus their relative order is preserved.
+func MessagePriority(m Message) lineproto.Priority {
+	switch m.(type) {
+	case *ChatMessage, *PrivateMessage, *MCTo:
+		return lineproto.PriorityHigh
+	case *Search, *SR, *TTHSearchActive, *TTHSearchPassive:
+		return lineproto.PriorityLow
+	}
+	return lineproto.PriorityNormal
+}
+
+// NewAsyncWriter creates an asynchronous message writer on top of w. The config is optional.
+//
+// The writer takes ownership of w: it must not be used directly until the AsyncWriter is closed.
+// Messages are encoded with the encoder of w. Message hooks of w are not called, while line hooks
+// are called from a separate goroutine.
+func NewAsyncWriter(w *Writer, conf *lineproto.AsyncConfig) *AsyncWriter {
+	return &AsyncWriter{
+		AsyncWriter: lineproto.NewAsyncWriter(w.Writer, conf),
+		w:           w,
+	}
+}
+
+// AsyncWriter is a NMDC message writer that is safe for concurrent use. Messages are queued with
+// a priority chosen by MessagePriority and are written by a separate goroutine.
+// See lineproto.AsyncWriter for details.
+type AsyncWriter struct {
+	*lineproto.AsyncWriter
+	w *Writer
+}
+
+// asyncBufs is a pool of encoding buffers. Each caller uses a separate buffer,
+// thus a write that waits for the space in the queue doesn't block other writes.
+var asyncBufs = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// WriteMsg encodes and queues NMDC protocol messages. It blocks if the queue is full.
+func (w *AsyncWriter) WriteMsg(msg ...Message) error {
+	for _, m := range msg {
+		if err := w.WriteMsgPriority(MessagePriority(m), m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteMsgPriority encodes and queues NMDC protocol messages with a given priority.
+func (w *AsyncWriter) WriteMsgPriority(p lineproto.Priority, msg ...Message) error {
+	enc := w.w.Encoder()
+	buf := asyncBufs.Get().(*bytes.Buffer)
+	defer asyncBufs.Put(buf)
+	for _, m := range msg {
+		buf.Reset()
+		if err := MarshalTo(enc, buf, m); err != nil {
+			return err
+		}
+		// the line is copied by the queue
+		if err := w.WriteLinePriority(p, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ZOn writes all queued messages, and enables the compression.
+// Messages queued after this call are compressed.
+func (w *AsyncWriter) ZOn() error {
+	return w.ZOnLevel(zlib.DefaultCompression)
+}
+
+// ZOnLevel is like ZOn, but allows to set the compression level.
+func (w *AsyncWriter) ZOnLevel(lvl int) error {
+	return w.Barrier(func() error {
+		return w.w.ZOnLevel(lvl)
+	})
+}
+
+// DisableZlib writes all queued messages, and disables the compression.
+func (w *AsyncWriter) DisableZlib() error {
+	return w.Barrier(w.w.DisableZlib)
+}
@@ -0,0 +1,113 @@
+package nmdc
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// gateWriter blocks the first write until the gate is closed.
+type gateWriter struct {
+	gate    chan struct{}
+	started chan struct{}
+	once    sync.Once
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func newGateWriter() *gateWriter {
+	return &gateWriter{gate: make(chan struct{}), started: make(chan struct{})}
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() {
+		close(w.started)
+		<-w.gate
+	})
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *gateWriter) Bytes() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]byte(nil), w.buf.Bytes()...)
+}
+
+func readAllMsgs(t *testing.T, data []byte) []Message {
+	r := NewReader(bytes.NewReader(data))
+	var out []Message
+	for {
+		m, err := r.ReadMsg()
+		if err == io.EOF {
+			return out
+		}
+		require.NoError(t, err)
+		if _, ok := m.(*ZOn); ok {
+			require.NoError(t, r.EnableZlib())
+		}
+		out = append(out, m)
+	}
+}
+
+func TestMessagePriority(t *testing.T) {
+	for _, c := range []struct {
+		msg Message
+		exp int
+	}{
+		{&ChatMessage{Name: "bob", Text: "hi"}, 2},
+		{&PrivateMessage{To: "bob", From: "alice", Text: "hi"}, 2},
+		{&Hello{Name: "bob"}, 1},
+		{&MyINFO{Name: "bob"}, 1},
+		{&Search{Pattern: "a"}, 0},
+		{&SR{From: "bob"}, 0},
+	} {
+		require.Equal(t, c.exp, int(MessagePriority(c.msg)), "%T", c.msg)
+	}
+}
+
+func TestAsyncWriterPriority(t *testing.T) {
+	gw := newGateWriter()
+	w := NewAsyncWriter(NewWriter(gw), nil)
+	require.NoError(t, w.WriteMsg(&Hello{Name: "alice"}))
+	<-gw.started
+
+	require.NoError(t, w.WriteMsg(
+		&Search{Address: "127.0.0.1:412", IsMaxSize: true, DataType: DataTypeAny, Pattern: "a"},
+		&Hello{Name: "bob"},
+		&ChatMessage{Name: "bob", Text: "hi"},
+	))
+	close(gw.gate)
+	require.NoError(t, w.Close())
+
+	require.Equal(t, []Message{
+		&Hello{Name: "alice"},
+		&ChatMessage{Name: "bob", Text: "hi"},
+		&Hello{Name: "bob"},
+		&Search{Address: "127.0.0.1:412", IsMaxSize: true, DataType: DataTypeAny, Pattern: "a"},
+	}, readAllMsgs(t, gw.Bytes()))
+}
+
+func TestAsyncWriterZOn(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := NewAsyncWriter(NewWriter(buf), nil)
+	require.NoError(t, w.WriteMsg(&Hello{Name: "alice"}))
+	require.NoError(t, w.ZOn())
+	require.NoError(t, w.WriteMsg(&Hello{Name: "bob"}))
+	require.NoError(t, w.Flush())
+	require.NoError(t, w.DisableZlib())
+	require.NoError(t, w.WriteMsg(&Hello{Name: "carol"}))
+	require.NoError(t, w.Close())
+
+	require.Equal(t, []Message{
+		&Hello{Name: "alice"},
+		&ZOn{},
+		&Hello{Name: "bob"},
+		&Hello{Name: "carol"},
+	}, readAllMsgs(t, buf.Bytes()))
+}
@@ -0,0 +1,175 @@
+package nmdc
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/direct-connect/go-dc/types"
+)
+
+// ClientRule describes how a specific client software presents itself in the MyINFO tag.
+type ClientRule struct {
+	// Name is a canonical name of the client.
+	Name string
+	// Tags is a list of names used by the client in the MyINFO tag.
+	Tags []string
+	// Version is a pattern that all versions of the client match.
+	Version *regexp.Regexp
+	// Keys is a list of additional tag keys the client may send, in addition to V, M, H and S.
+	// If it's empty, any keys are allowed.
+	Keys []string
+}
+
+var (
+	reVersDotted   = regexp.MustCompile(`^\d+\.\d+(\.\d+)*[a-z]?$`)
+	reVersFlylink  = regexp.MustCompile(`^r\d{3,}(-[a-zA-Z0-9._-]+)?$`)
+	reVersEiskalt  = regexp.MustCompile(`^\d+\.\d+\.\d+(-[a-zA-Z0-9._-]+)?$`)
+	reVersAirDCxxx = regexp.MustCompile(`^\d+\.\d+(\.\d+)*(b\d+)?(-[a-zA-Z0-9._-]+)?$`)
+)
+
+// DefaultClients is a list of rules for well-known NMDC clients.
+var DefaultClients = []ClientRule{
+	{Name: "DC++", Tags: []string{"++", "DC++"}, Version: reVersDotted, Keys: []string{TagAutoOpen}},
+	{Name: "ApexDC++", Tags: []string{"ApexDC++"}, Version: reVersDotted, Keys: []string{TagAutoOpen, TagBandwidth, TagUpload}},
+	{Name: "FlylinkDC++", Tags: []string{"FlylinkDC++", "FlylinkDC++ x64"}, Version: reVersFlylink},
+	{Name: "EiskaltDC++", Tags: []string{"EiskaltDC++"}, Version: reVersEiskalt},
+	{Name: "AirDC++", Tags: []string{"AirDC++", "AirDC++w"}, Version: reVersAirDCxxx},
+	{Name: "StrgDC++", Tags: []string{"StrgDC++"}, Version: reVersDotted},
+}
+
+// ClientInfo is a result of the client detection.
+type ClientInfo struct {
+	// Software is a normalized client name and version.
+	// If the client is unknown, it contains a name and version from the tag.
+	Software types.Software
+	// Known is set if the client matches one of the rules.
+	Known bool
+	// Fake is set if the tag claims to be a known client, but it doesn't match the client rules.
+	Fake bool
+	// Problems lists issues found in the tag.
+	Problems []string
+}
+
+// NewClientDB creates a client fingerprint database from the list of rules.
+func NewClientDB(rules []ClientRule) *ClientDB {
+	db := &ClientDB{byTag: make(map[string]*ClientRule)}
+	for i := range rules {
+		r := &rules[i]
+		for _, t := range r.Tags {
+			db.byTag[strings.ToLower(t)] = r
+		}
+	}
+	return db
+}
+
+// ClientDB detects client software from MyINFO tags.
+type ClientDB struct {
+	byTag map[string]*ClientRule
+}
+
+var defaultClientDB = NewClientDB(DefaultClients)
+
+// DetectClient detects the client from the MyINFO tag using DefaultClients rules.
+func DetectClient(m *MyINFO) ClientInfo {
+	return defaultClientDB.Detect(m)
+}
+
+// Detect detects the client from the MyINFO tag and checks if the tag is malformed or fake.
+func (db *ClientDB) Detect(m *MyINFO) ClientInfo {
+	ci := ClientInfo{Software: m.Client}
+	if !m.HasTag() {
+		ci.Problems = append(ci.Problems, "no tag")
+		return ci
+	}
+	if m.Client.Name == "" {
+		ci.Problems = append(ci.Problems, "no client name")
+	}
+	if m.Client.Version == "" {
+		ci.Problems = append(ci.Problems, "no client version")
+	}
+	switch m.Mode {
+	case UserModeActive, UserModePassive, UserModeSOCKS5:
+	default:
+		ci.Problems = append(ci.Problems, "invalid mode")
+	}
+	if m.HubsNormal < 0 || m.HubsRegistered < 0 || m.HubsOperator < 0 {
+		ci.Problems = append(ci.Problems, "negative hub count")
+	} else if m.HubsNormal+m.HubsRegistered+m.HubsOperator == 0 {
+		ci.Problems = append(ci.Problems, "zero hub count")
+	}
+	if m.Slots < 0 {
+		ci.Problems = append(ci.Problems, "negative slot count")
+	}
+	r := db.byTag[strings.ToLower(m.Client.Name)]
+	if r == nil {
+		return ci
+	}
+	ci.Known = true
+	ci.Software = types.Software{Name: r.Name, Version: m.Client.Version}
+	if r.Version != nil && !r.Version.MatchString(m.Client.Version) {
+		ci.Fake = true
+		ci.Problems = append(ci.Problems, "unexpected version format")
+	}
+	if len(r.Keys) != 0 {
+		for k := range m.Extra {
+			if !containsString(r.Keys, k) {
+				ci.Fake = true
+				ci.Problems = append(ci.Problems, "unexpected tag field: "+k)
+			}
+		}
+	}
+	return ci
+}
+
+func containsString(arr []string, s string) bool {
+	for _, v := range arr {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// CompareVersions compares two client versions. Numeric parts are compared as numbers,
+// and other parts are compared as strings. Prefixes like "r" in "r504" are ignored.
+// The result is 0 if a == b, -1 if a < b, and +1 if a > b.
+func CompareVersions(a, b string) int {
+	pa, pb := splitVersion(a), splitVersion(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var va, vb string
+		if i < len(pa) {
+			va = pa[i]
+		}
+		if i < len(pb) {
+			vb = pb[i]
+		}
+		na, erra := strconv.ParseUint(va, 10, 64)
+		nb, errb := strconv.ParseUint(vb, 10, 64)
+		switch {
+		case va == vb:
+			continue
+		case va == "" && errb == nil && nb == 0, vb == "" && erra == nil && na == 0:
+			// 1.0 == 1.0.0
+			continue
+		case erra == nil && errb == nil:
+			if na < nb {
+				return -1
+			} else if na > nb {
+				return +1
+			}
+		case va < vb:
+			return -1
+		default:
+			return +1
+		}
+	}
+	return 0
+}
+
+func splitVersion(v string) []string {
+	v = strings.TrimLeft(v, "rRvV")
+	return strings.FieldsFunc(v, func(r rune) bool {
+		return r == '.' || r == '-' || r == ' '
+	})
+}
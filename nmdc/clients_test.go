@@ -0,0 +1,110 @@
+package nmdc
+
+import (
+	"testing"
+
+	"github.com/direct-connect/go-dc/types"
+	"github.com/stretchr/testify/require"
+)
+
+var detectClientCases = []struct {
+	name string
+	info string
+	exp  ClientInfo
+}{
+	{
+		name: "dc++",
+		info: `$ALL user <++ V:0.868,M:A,H:1/0/0,S:3>$ $100$$0$`,
+		exp: ClientInfo{
+			Software: types.Software{Name: "DC++", Version: "0.868"},
+			Known:    true,
+		},
+	},
+	{
+		name: "flylink",
+		info: `$ALL user <FlylinkDC++ V:r504-x64,M:P,H:0/1/0,S:15>$ $100$$0$`,
+		exp: ClientInfo{
+			Software: types.Software{Name: "FlylinkDC++", Version: "r504-x64"},
+			Known:    true,
+		},
+	},
+	{
+		name: "eiskalt",
+		info: `$ALL user <EiskaltDC++ V:2.2.9,M:A,H:1/0/0,S:3>$ $100$$0$`,
+		exp: ClientInfo{
+			Software: types.Software{Name: "EiskaltDC++", Version: "2.2.9"},
+			Known:    true,
+		},
+	},
+	{
+		name: "airdc",
+		info: `$ALL user <AirDC++ V:3.60b1,M:A,H:1/0/0,S:3>$ $100$$0$`,
+		exp: ClientInfo{
+			Software: types.Software{Name: "AirDC++", Version: "3.60b1"},
+			Known:    true,
+		},
+	},
+	{
+		name: "fake version",
+		info: `$ALL user <FlylinkDC++ V:9.99,M:A,H:1/0/0,S:3>$ $100$$0$`,
+		exp: ClientInfo{
+			Software: types.Software{Name: "FlylinkDC++", Version: "9.99"},
+			Known:    true,
+			Fake:     true,
+			Problems: []string{"unexpected version format"},
+		},
+	},
+	{
+		name: "fake field",
+		info: `$ALL user <++ V:0.868,M:A,H:1/0/0,S:3,L:100>$ $100$$0$`,
+		exp: ClientInfo{
+			Software: types.Software{Name: "DC++", Version: "0.868"},
+			Known:    true,
+			Fake:     true,
+			Problems: []string{"unexpected tag field: L"},
+		},
+	},
+	{
+		name: "malformed",
+		info: `$ALL user <SomeDC ,M:X,H:0/0/0,S:3>$ $100$$0$`,
+		exp: ClientInfo{
+			Software: types.Software{Name: "SomeDC "},
+			Problems: []string{"no client version", "invalid mode", "zero hub count"},
+		},
+	},
+	{
+		name: "no tag",
+		info: `$ALL user desc$ $100$$0$`,
+		exp: ClientInfo{
+			Problems: []string{"no tag"},
+		},
+	},
+}
+
+func TestDetectClient(t *testing.T) {
+	for _, c := range detectClientCases {
+		t.Run(c.name, func(t *testing.T) {
+			var m MyINFO
+			err := m.UnmarshalNMDC(nil, []byte(c.info))
+			require.NoError(t, err)
+			require.Equal(t, c.exp, DetectClient(&m))
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	var cases = []struct {
+		a, b string
+		exp  int
+	}{
+		{"0.868", "0.868", 0},
+		{"0.868", "0.870", -1},
+		{"1.0", "1.0.0", 0},
+		{"2.2.10", "2.2.9", +1},
+		{"r504", "r600", -1},
+		{"r600-x64", "r600", +1},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.exp, CompareVersions(c.a, c.b), "%s vs %s", c.a, c.b)
+	}
+}
@@ -42,6 +42,23 @@ func (m *Supports) Intersect(m2 *Supports) Supports {
 	return r
 }
 
+// Has checks if the extension is in the list.
+func (m *Supports) Has(ext string) bool {
+	for _, e := range m.Ext {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Add appends the extension to the list, if it's not listed yet.
+func (m *Supports) Add(ext string) {
+	if !m.Has(ext) {
+		m.Ext = append(m.Ext, ext)
+	}
+}
+
 func (m *Supports) MarshalNMDC(_ *TextEncoder, buf *bytes.Buffer) error {
 	n := len(m.Ext) - 1
 	for _, ext := range m.Ext {
@@ -0,0 +1,171 @@
+package nmdc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+)
+
+func init() {
+	RegisterMessage(&ExtJSON{})
+}
+
+// ExtJSON carries additional user information in JSON format. Requires 'ExtJSON2' extension.
+//
+// The hub should only forward this message to users that support ExtJSON2 extension.
+// Clients advertise it with AdvertiseExtJSON and check the hub reply with HasExtJSON.
+// The payload is sent in the connection encoding and is escaped in the same way as other strings.
+type ExtJSON struct {
+	Name string
+	Info ExtJSONInfo
+}
+
+func (*ExtJSON) Type() string {
+	return "ExtJSON"
+}
+
+func (m *ExtJSON) MarshalNMDC(enc *TextEncoder, buf *bytes.Buffer) error {
+	if err := Name(m.Name).MarshalNMDC(enc, buf); err != nil {
+		return err
+	}
+	buf.WriteByte(' ')
+	data, err := json.Marshal(&m.Info)
+	if err != nil {
+		return err
+	}
+	return String(data).MarshalNMDC(enc, buf)
+}
+
+func (m *ExtJSON) UnmarshalNMDC(dec *TextDecoder, data []byte) error {
+	i := bytes.IndexByte(data, ' ')
+	if i < 0 {
+		return errors.New("invalid ExtJSON command")
+	}
+	var name Name
+	if err := name.UnmarshalNMDC(dec, data[:i]); err != nil {
+		return err
+	}
+	m.Name = string(name)
+	var s String
+	if err := s.UnmarshalNMDC(dec, data[i+1:]); err != nil {
+		return err
+	}
+	m.Info = ExtJSONInfo{}
+	return json.Unmarshal([]byte(s), &m.Info)
+}
+
+// AdvertiseExtJSON adds ExtJSON2 extension to the list of supported extensions.
+func (m *Supports) AdvertiseExtJSON() {
+	m.Add(ExtExtJSON2)
+}
+
+// HasExtJSON checks if ExtJSON2 extension is in the list of supported extensions.
+func (m *Supports) HasExtJSON() bool {
+	return m.Has(ExtExtJSON2)
+}
+
+// ExtJSONInfo is a payload of ExtJSON message.
+//
+// Fields that are not recognized are preserved in Extra.
+type ExtJSONInfo struct {
+	Gender  int    `json:"Gender,omitempty"`
+	Country string `json:"Country,omitempty"`
+	City    string `json:"City,omitempty"`
+	ISP     string `json:"ISP,omitempty"`
+
+	// share groups and statistics
+
+	ShareGroups []string `json:"ShareGroups,omitempty"`
+	Files       int      `json:"Files,omitempty"`
+
+	// download queue
+
+	QueueFiles   int   `json:"QueueFiles,omitempty"`
+	QueueSources int   `json:"QueueSrc,omitempty"`
+	QueueSize    int64 `json:"QueueSize,omitempty"`
+
+	// client statistics
+
+	StartCore int   `json:"StartCore,omitempty"`
+	StartGUI  int   `json:"StartGUI,omitempty"`
+	RAMWork   int64 `json:"RAMWork,omitempty"`
+	RAMPeak   int64 `json:"RAMPeak,omitempty"`
+	RAMFree   int64 `json:"RAMFree,omitempty"`
+	SQLSize   int64 `json:"SQLSize,omitempty"`
+	SQLFree   int64 `json:"SQLFree,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// extJSONInfo is used to avoid recursion in ExtJSONInfo marshal methods.
+type extJSONInfo ExtJSONInfo
+
+// MarshalJSON implements json.Marshaler.
+func (m *ExtJSONInfo) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal((*extJSONInfo)(m))
+	if err != nil || len(m.Extra) == 0 {
+		return data, err
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range m.Extra {
+		if _, ok := fields[k]; !ok {
+			fields[k] = v
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (m *ExtJSONInfo) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*extJSONInfo)(m)); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	m.Extra = nil
+	for k, v := range fields {
+		if knownExtJSONFields[k] {
+			continue
+		}
+		if m.Extra == nil {
+			m.Extra = make(map[string]json.RawMessage)
+		}
+		m.Extra[k] = v
+	}
+	return nil
+}
+
+// knownExtJSONFields is a set of JSON field names that have a corresponding field in ExtJSONInfo.
+var knownExtJSONFields = make(map[string]bool)
+
+func init() {
+	rt := reflect.TypeOf(extJSONInfo{})
+	for i := 0; i < rt.NumField(); i++ {
+		tag := strings.SplitN(rt.Field(i).Tag.Get("json"), ",", 2)[0]
+		if tag != "" && tag != "-" {
+			knownExtJSONFields[tag] = true
+		}
+	}
+}
+
+// clone makes a deep copy of the ExtJSONInfo.
+func (m *ExtJSONInfo) clone() *ExtJSONInfo {
+	m2 := *m
+	if m.ShareGroups != nil {
+		m2.ShareGroups = append([]string{}, m.ShareGroups...)
+	}
+	if m.Extra != nil {
+		m2.Extra = make(map[string]json.RawMessage, len(m.Extra))
+		for k, v := range m.Extra {
+			m2.Extra[k] = v
+		}
+	}
+	return &m2
+}
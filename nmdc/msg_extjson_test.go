@@ -0,0 +1,105 @@
+package nmdc
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/charmap"
+)
+
+var extJSONCases = []casesMessageEntry{
+	{
+		typ:  "ExtJSON",
+		data: `user {"Gender":2,"Country":"RU","ShareGroups":["Music","Video"],"Files":100,"QueueFiles":3,"QueueSrc":5}`,
+		msg: &ExtJSON{
+			Name: "user",
+			Info: ExtJSONInfo{
+				Gender:       2,
+				Country:      "RU",
+				ShareGroups:  []string{"Music", "Video"},
+				Files:        100,
+				QueueFiles:   3,
+				QueueSources: 5,
+			},
+		},
+	},
+	{
+		typ:  "ExtJSON",
+		name: "unknown fields",
+		data: `user {"Gender":1,"LDBHistSize":10,"Note":"a&#36;b"}`,
+		msg: &ExtJSON{
+			Name: "user",
+			Info: ExtJSONInfo{
+				Gender: 1,
+				Extra: map[string]json.RawMessage{
+					"LDBHistSize": json.RawMessage(`10`),
+					"Note":        json.RawMessage(`"a$b"`),
+				},
+			},
+		},
+	},
+}
+
+func TestExtJSONUnmarshal(t *testing.T) {
+	doMessageTestUnmarshal(t, extJSONCases)
+}
+
+func TestExtJSONMarshal(t *testing.T) {
+	doMessageTestMarshal(t, extJSONCases)
+}
+
+func TestExtJSONEncoding(t *testing.T) {
+	m := &ExtJSON{Name: "юзер", Info: ExtJSONInfo{City: "Москва"}}
+	buf := bytes.NewBuffer(nil)
+	err := m.MarshalNMDC(charmap.Windows1251.NewEncoder(), buf)
+	require.NoError(t, err)
+	require.Equal(t, "\xfe\xe7\xe5\xf0 {\"City\":\"\xcc\xee\xf1\xea\xe2\xe0\"}", buf.String())
+
+	var got ExtJSON
+	err = got.UnmarshalNMDC(charmap.Windows1251.NewDecoder(), buf.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, m, &got)
+}
+
+func TestUserListExtJSON(t *testing.T) {
+	l := NewUserList()
+	l.SetNoGetINFO(true)
+	l.SetExtJSON(true)
+	readUserList(t, l, ""+
+		"$MyINFO $ALL alice desc<++ V:0.868,M:A,H:1/0/0,S:3>$ $LAN(T1)\x01$$100$|"+
+		`$ExtJSON alice {"Gender":2,"QueueFiles":3}|`+
+		"$MyINFO $ALL alice desc<++ V:0.868,M:A,H:1/0/0,S:3>$ $LAN(T1)\x01$$200$|",
+	)
+	u, ok := l.User("alice")
+	require.True(t, ok)
+	require.Equal(t, uint64(200), u.Info.ShareSize)
+	require.Equal(t, &ExtJSONInfo{Gender: 2, QueueFiles: 3}, u.ExtJSON)
+}
+
+func TestUserListExtJSONNotNegotiated(t *testing.T) {
+	l := NewUserList()
+	l.SetNoGetINFO(true)
+	readUserList(t, l, ""+
+		"$MyINFO $ALL alice desc<++ V:0.868,M:A,H:1/0/0,S:3>$ $LAN(T1)\x01$$100$|"+
+		`$ExtJSON alice {"Gender":2}|`,
+	)
+	u, ok := l.User("alice")
+	require.True(t, ok)
+	require.Nil(t, u.ExtJSON)
+}
+
+func TestSupportsExtJSON(t *testing.T) {
+	var s Supports
+	require.False(t, s.HasExtJSON())
+	s.AdvertiseExtJSON()
+	s.AdvertiseExtJSON()
+	require.True(t, s.HasExtJSON())
+	require.Equal(t, []string{ExtExtJSON2}, s.Ext)
+
+	var got Supports
+	err := got.UnmarshalNMDC(nil, []byte("NoHello ExtJSON2 "))
+	require.NoError(t, err)
+	require.True(t, got.HasExtJSON())
+}
@@ -42,17 +42,20 @@ func (*SetLogo) Type() string {
 }
 
 // HubINFO is a detailed hub information exposed only after receiving BotINFO.
+//
+// Hubs do not agree on the fields after the owner: Verlihub sends the hub category and the encoding,
+// while YnHub sends a second description and an email, which are stored in Category and ignored.
 type HubINFO struct {
 	Name     string
 	Host     string
 	Desc     string
-	I1       int // TODO
-	I2       int // TODO
-	I3       int // TODO
-	I4       int // TODO
+	MaxUsers int    // maximal number of users allowed on the hub
+	MinShare uint64 // minimal share size, as reported by the hub (usually in bytes)
+	MinSlots int    // minimal number of open slots
+	MaxHubs  int    // maximal number of hubs the user can be connected to
 	Soft     types.Software
-	Owner    string
-	State    string // TODO
+	Owner    string // owner name or email
+	Category string // hub category, for example "Public HUB"
 	Encoding string
 }
 
@@ -75,13 +78,13 @@ func (m *HubINFO) MarshalNMDC(enc *TextEncoder, buf *bytes.Buffer) error {
 	}
 
 	buf.WriteByte(sep)
-	buf.WriteString(strconv.Itoa(m.I1))
+	buf.WriteString(strconv.Itoa(m.MaxUsers))
 	buf.WriteByte(sep)
-	buf.WriteString(strconv.Itoa(m.I2))
+	buf.WriteString(strconv.FormatUint(m.MinShare, 10))
 	buf.WriteByte(sep)
-	buf.WriteString(strconv.Itoa(m.I3))
+	buf.WriteString(strconv.Itoa(m.MinSlots))
 	buf.WriteByte(sep)
-	buf.WriteString(strconv.Itoa(m.I4))
+	buf.WriteString(strconv.Itoa(m.MaxHubs))
 
 	buf.WriteByte(sep)
 	if m.Soft.Version == "" {
@@ -98,7 +101,7 @@ func (m *HubINFO) MarshalNMDC(enc *TextEncoder, buf *bytes.Buffer) error {
 	}
 
 	buf.WriteByte(sep)
-	if err := String(m.State).MarshalNMDC(enc, buf); err != nil {
+	if err := String(m.Category).MarshalNMDC(enc, buf); err != nil {
 		return err
 	}
 
@@ -126,29 +129,29 @@ func (m *HubINFO) UnmarshalNMDC(dec *TextDecoder, data []byte) error {
 			}
 			m.Desc = string(s)
 		case 3:
-			i1, err := atoiTrim(field)
+			n, err := atoiTrim(field)
 			if err != nil {
-				return errors.New("invalid i1")
+				return errors.New("invalid max users")
 			}
-			m.I1 = i1
+			m.MaxUsers = n
 		case 4:
-			i2, err := atoiTrim(field)
+			n, err := strconv.ParseUint(string(trimSpace(field)), 10, 64)
 			if err != nil {
-				return errors.New("invalid i2")
+				return errors.New("invalid min share")
 			}
-			m.I2 = i2
+			m.MinShare = n
 		case 5:
-			i3, err := atoiTrim(field)
+			n, err := atoiTrim(field)
 			if err != nil {
-				return errors.New("invalid i3")
+				return errors.New("invalid min slots")
 			}
-			m.I3 = i3
+			m.MinSlots = n
 		case 6:
-			i4, err := atoiTrim(field)
+			n, err := atoiTrim(field)
 			if err != nil {
-				return errors.New("invalid i4")
+				return errors.New("invalid max hubs")
 			}
-			m.I4 = i4
+			m.MaxHubs = n
 		case 7:
 			soft := string(field)
 			m.Soft.Name = soft
@@ -167,7 +170,7 @@ func (m *HubINFO) UnmarshalNMDC(dec *TextDecoder, data []byte) error {
 			if err := s.UnmarshalNMDC(dec, field); err != nil {
 				return err
 			}
-			m.State = string(s)
+			m.Category = string(s)
 		case 10:
 			if len(fields) < 12 {
 				m.Encoding = string(field)
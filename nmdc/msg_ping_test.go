@@ -13,13 +13,13 @@ var pingCases = []casesMessageEntry{
 		data:    `OZERKI$dc.ozerki.pro$Main Russian D�++ Hub$5000$0$1$2721$PtokaX$`,
 		expData: `OZERKI$dc.ozerki.pro$Main Russian D�++ Hub$5000$0$1$2721$PtokaX$$$`,
 		msg: &HubINFO{
-			Name: "OZERKI",
-			Host: "dc.ozerki.pro",
-			Desc: "Main Russian D�++ Hub",
-			I1:   5000,
-			I2:   0,
-			I3:   1,
-			I4:   2721,
+			Name:     "OZERKI",
+			Host:     "dc.ozerki.pro",
+			Desc:     "Main Russian D�++ Hub",
+			MaxUsers: 5000,
+			MinShare: 0,
+			MinSlots: 1,
+			MaxHubs:  2721,
 			Soft: types.Software{
 				Name: "PtokaX",
 			},
@@ -31,19 +31,19 @@ var pingCases = []casesMessageEntry{
 		data:    `Angels vs Demons$dc.milenahub.ru$Cogitationis poenam nemo patitur.$20480$0$0$0$Verlihub 1.1.0.12$=FAUST= & KCAHDEP$Public HUB$CP1251`,
 		expData: `Angels vs Demons$dc.milenahub.ru$Cogitationis poenam nemo patitur.$20480$0$0$0$Verlihub 1.1.0.12$=FAUST= &amp; KCAHDEP$Public HUB$CP1251`,
 		msg: &HubINFO{
-			Name: "Angels vs Demons",
-			Host: "dc.milenahub.ru",
-			Desc: "Cogitationis poenam nemo patitur.",
-			I1:   20480,
-			I2:   0,
-			I3:   0,
-			I4:   0,
+			Name:     "Angels vs Demons",
+			Host:     "dc.milenahub.ru",
+			Desc:     "Cogitationis poenam nemo patitur.",
+			MaxUsers: 20480,
+			MinShare: 0,
+			MinSlots: 0,
+			MaxHubs:  0,
 			Soft: types.Software{
 				Name:    "Verlihub",
 				Version: "1.1.0.12",
 			},
 			Owner:    "=FAUST= & KCAHDEP",
-			State:    "Public HUB",
+			Category: "Public HUB",
 			Encoding: "CP1251",
 		},
 	},
@@ -53,19 +53,19 @@ var pingCases = []casesMessageEntry{
 		data:    `hub name$dc.example.com:8000$hub desc$3000$32212254720$3$40$YnHub 1.0364$owner$desc 2$admin@example.com$`,
 		expData: `hub name$dc.example.com:8000$hub desc$3000$32212254720$3$40$YnHub 1.0364$owner$desc 2$`,
 		msg: &HubINFO{
-			Name: "hub name",
-			Host: "dc.example.com:8000",
-			Desc: "hub desc",
-			I1:   3000,
-			I2:   32212254720,
-			I3:   3,
-			I4:   40,
+			Name:     "hub name",
+			Host:     "dc.example.com:8000",
+			Desc:     "hub desc",
+			MaxUsers: 3000,
+			MinShare: 32212254720,
+			MinSlots: 3,
+			MaxHubs:  40,
 			Soft: types.Software{
 				Name:    "YnHub",
 				Version: "1.0364",
 			},
-			Owner: "owner",
-			State: "desc 2",
+			Owner:    "owner",
+			Category: "desc 2",
 		},
 	},
 }
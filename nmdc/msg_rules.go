@@ -0,0 +1,197 @@
+package nmdc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+func init() {
+	RegisterMessage(&NickRule{})
+	RegisterMessage(&SearchRule{})
+}
+
+// ruleSep separates fields in NickRule and SearchRule messages.
+var ruleSep = []byte("$$")
+
+// splitRule splits the rule message into key-value pairs and calls fnc for each of them.
+// Empty fields are skipped.
+func splitRule(data []byte, fnc func(key string, val []byte) error) error {
+	for _, field := range bytes.Split(data, ruleSep) {
+		if len(field) == 0 {
+			continue
+		}
+		key, val := field, []byte(nil)
+		if i := bytes.IndexByte(field, ' '); i >= 0 {
+			key, val = field[:i], field[i+1:]
+		}
+		if err := fnc(string(key), val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeRuleField(buf *bytes.Buffer, key string) {
+	if buf.Len() != 0 {
+		buf.Write(ruleSep)
+	}
+	buf.WriteString(key)
+	buf.WriteByte(' ')
+}
+
+// NickRule is sent by the hub to describe the nick restrictions. Requires 'NickRule' extension.
+// Zero values mean that the restriction is not set.
+type NickRule struct {
+	Min    int      // minimal nick length
+	Max    int      // maximal nick length
+	Chars  []rune   // forbidden characters
+	Prefix []string // required prefixes; one of them must be present
+}
+
+func (*NickRule) Type() string {
+	return "NickRule"
+}
+
+func (m *NickRule) MarshalNMDC(enc *TextEncoder, buf *bytes.Buffer) error {
+	var b bytes.Buffer
+	if m.Min > 0 {
+		writeRuleField(&b, "Min")
+		b.WriteString(strconv.Itoa(m.Min))
+	}
+	if m.Max > 0 {
+		writeRuleField(&b, "Max")
+		b.WriteString(strconv.Itoa(m.Max))
+	}
+	if len(m.Chars) != 0 {
+		writeRuleField(&b, "Char")
+		for i, c := range m.Chars {
+			if i != 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(strconv.Itoa(int(c)))
+		}
+	}
+	if len(m.Prefix) != 0 {
+		writeRuleField(&b, "Pref")
+		for i, p := range m.Prefix {
+			if i != 0 {
+				b.WriteByte(' ')
+			}
+			if err := Name(p).MarshalNMDC(enc, &b); err != nil {
+				return err
+			}
+		}
+	}
+	buf.Write(b.Bytes())
+	return nil
+}
+
+func (m *NickRule) UnmarshalNMDC(dec *TextDecoder, data []byte) error {
+	*m = NickRule{}
+	return splitRule(data, func(key string, val []byte) error {
+		var err error
+		switch key {
+		case "Min":
+			m.Min, err = atoiTrim(val)
+		case "Max":
+			m.Max, err = atoiTrim(val)
+		case "Char":
+			for _, v := range bytes.Fields(val) {
+				c, err := strconv.Atoi(string(v))
+				if err != nil || c < 0 {
+					return fmt.Errorf("invalid NickRule character: %q", string(v))
+				}
+				m.Chars = append(m.Chars, rune(c))
+			}
+		case "Pref":
+			for _, v := range bytes.Fields(val) {
+				var p Name
+				if err := p.UnmarshalNMDC(dec, v); err != nil {
+					return err
+				}
+				m.Prefix = append(m.Prefix, string(p))
+			}
+		default:
+			// ignore unknown fields
+		}
+		if err != nil {
+			return fmt.Errorf("invalid NickRule %s value: %q", key, string(val))
+		}
+		return nil
+	})
+}
+
+// SearchRule is sent by the hub to describe the search restrictions. Requires 'SearchRule' extension.
+// Zero values mean that the restriction is not set. Intervals have a precision of one second.
+type SearchRule struct {
+	Min int // minimal length of the search pattern
+	Max int // maximal length of the search pattern
+
+	Interval        time.Duration // minimal interval between searches
+	IntervalActive  time.Duration // minimal interval between searches for active users
+	IntervalPassive time.Duration // minimal interval between searches for passive users
+}
+
+func (*SearchRule) Type() string {
+	return "SearchRule"
+}
+
+func (m *SearchRule) MarshalNMDC(_ *TextEncoder, buf *bytes.Buffer) error {
+	var b bytes.Buffer
+	for _, f := range []struct {
+		key string
+		val int
+	}{
+		{"Min", m.Min},
+		{"Max", m.Max},
+		{"Int", int(m.Interval / time.Second)},
+		{"IntAct", int(m.IntervalActive / time.Second)},
+		{"IntPas", int(m.IntervalPassive / time.Second)},
+	} {
+		if f.val <= 0 {
+			continue
+		}
+		writeRuleField(&b, f.key)
+		b.WriteString(strconv.Itoa(f.val))
+	}
+	buf.Write(b.Bytes())
+	return nil
+}
+
+func (m *SearchRule) UnmarshalNMDC(_ *TextDecoder, data []byte) error {
+	*m = SearchRule{}
+	return splitRule(data, func(key string, val []byte) error {
+		var dst *time.Duration
+		switch key {
+		case "Min", "Max":
+			v, err := atoiTrim(val)
+			if err != nil {
+				return fmt.Errorf("invalid SearchRule %s value: %q", key, string(val))
+			}
+			if key == "Min" {
+				m.Min = v
+			} else {
+				m.Max = v
+			}
+			return nil
+		case "Int":
+			dst = &m.Interval
+		case "IntAct":
+			dst = &m.IntervalActive
+		case "IntPas":
+			dst = &m.IntervalPassive
+		default:
+			// ignore unknown fields
+			return nil
+		}
+		v, err := atoiTrim(val)
+		if err != nil || v < 0 {
+			return errors.New("invalid SearchRule " + key + " interval")
+		}
+		*dst = time.Duration(v) * time.Second
+		return nil
+	})
+}
@@ -0,0 +1,99 @@
+package nmdc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var rulesCases = []casesMessageEntry{
+	{
+		typ:  "NickRule",
+		data: `Min 3$$Max 64$$Char 32 36 124$$Pref [ISP] [BOT]`,
+		msg: &NickRule{
+			Min:    3,
+			Max:    64,
+			Chars:  []rune{' ', '$', '|'},
+			Prefix: []string{"[ISP]", "[BOT]"},
+		},
+	},
+	{
+		typ:  "NickRule",
+		name: "max only",
+		data: `Max 32`,
+		msg:  &NickRule{Max: 32},
+	},
+	{
+		typ:  "SearchRule",
+		data: `Min 3$$Max 256$$Int 10$$IntAct 5$$IntPas 30`,
+		msg: &SearchRule{
+			Min:             3,
+			Max:             256,
+			Interval:        10 * time.Second,
+			IntervalActive:  5 * time.Second,
+			IntervalPassive: 30 * time.Second,
+		},
+	},
+}
+
+func TestRulesUnmarshal(t *testing.T) {
+	doMessageTestUnmarshal(t, rulesCases)
+}
+
+func TestRulesMarshal(t *testing.T) {
+	doMessageTestMarshal(t, rulesCases)
+}
+
+func TestNickRuleValidate(t *testing.T) {
+	r := &NickRule{Min: 3, Max: 8, Chars: []rune{' ', '$'}, Prefix: []string{"[A]", "[B]"}}
+	for _, c := range []struct {
+		nick string
+		err  bool
+	}{
+		{nick: "[A]user"},
+		{nick: "[B]юзер"},
+		{nick: "[A]"},
+		{nick: "[A", err: true},
+		{nick: "[A]user12", err: true},
+		{nick: "[A]u r", err: true},
+		{nick: "[A]u$r", err: true},
+		{nick: "user", err: true},
+	} {
+		err := r.Validate(c.nick)
+		if c.err {
+			require.Error(t, err, c.nick)
+		} else {
+			require.NoError(t, err, c.nick)
+		}
+	}
+}
+
+func TestSearchRuleCheck(t *testing.T) {
+	r := &SearchRule{Min: 3, Max: 10, Interval: 10 * time.Second, IntervalPassive: 30 * time.Second}
+	active := &Search{Address: "127.0.0.1:412", Pattern: "abc"}
+	passive := &Search{User: "user", Pattern: "abc"}
+
+	require.Equal(t, ErrSearchTooShort, r.Validate(&Search{User: "user", Pattern: "ab"}))
+	require.Equal(t, ErrSearchTooLong, r.Validate(&Search{User: "user", Pattern: "abcdefghijk"}))
+	require.NoError(t, r.Validate(&Search{User: "user", TTH: &TTH{}}))
+
+	now := time.Now()
+	require.NoError(t, r.Check(active, time.Time{}, now))
+	require.Equal(t, ErrSearchTooFrequent, r.Check(active, now.Add(-5*time.Second), now))
+	require.NoError(t, r.Check(active, now.Add(-10*time.Second), now))
+	require.Equal(t, ErrSearchTooFrequent, r.Check(passive, now.Add(-20*time.Second), now))
+	require.NoError(t, r.Check(passive, now.Add(-30*time.Second), now))
+}
+
+func TestRuleMessages(t *testing.T) {
+	nick := &NickRule{Max: 32}
+	search := &SearchRule{Min: 3}
+	ext := Extensions{}
+	require.Empty(t, RuleMessages(ext, nick, search))
+	ext.Set(ExtSearchRule)
+	require.Equal(t, []Message{search}, RuleMessages(ext, nick, search))
+	ext.Set(ExtNickRule)
+	require.Equal(t, []Message{nick, search}, RuleMessages(ext, nick, search))
+	require.Equal(t, []Message{nick}, RuleMessages(ext, nick, nil))
+}
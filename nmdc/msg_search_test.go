@@ -129,6 +129,21 @@ var searchCases = []casesMessageEntry{
 			To:         "User2",
 		},
 	},
+	{
+		typ:  "SR",
+		name: "escaped path",
+		data: "User1 dir\\a&#36;b&#124;c.txt\x05100 1/3\x05TTH:HRFQOVMYIGSSGXN4FDTOGWO4USC24BBVQLOKIQI (1.2.3.4:411)\x05User2",
+		msg: &SR{
+			From:       "User1",
+			Path:       []string{"dir", "a$b|c.txt"},
+			Size:       100,
+			FreeSlots:  1,
+			TotalSlots: 3,
+			TTH:        getTHPointer("HRFQOVMYIGSSGXN4FDTOGWO4USC24BBVQLOKIQI"),
+			HubAddress: "1.2.3.4:411",
+			To:         "User2",
+		},
+	},
 	{
 		typ:  "SA",
 		name: "Short TTH search (active)",
@@ -0,0 +1,239 @@
+package nmdc
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+func init() {
+	RegisterMessage(&Get{})
+	RegisterMessage(&FileLength{})
+	RegisterMessage(&Send{})
+	RegisterMessage(&GetBlock{})
+	RegisterMessage(&UGetBlock{})
+	RegisterMessage(&GetZBlock{})
+	RegisterMessage(&UGetZBlock{})
+	RegisterMessage(&Sending{})
+}
+
+// Get is a legacy file request. The uploader responds with FileLength and waits for Send.
+//
+// http://nmdc.sourceforge.net/NMDC.html#_get
+type Get struct {
+	Path  string
+	Start uint64 // 1-based offset
+}
+
+func (*Get) Type() string {
+	return "Get"
+}
+
+func (m *Get) MarshalNMDC(enc *TextEncoder, buf *bytes.Buffer) error {
+	if err := String(m.Path).MarshalNMDC(enc, buf); err != nil {
+		return err
+	}
+	buf.WriteByte('$')
+	start := m.Start
+	if start == 0 {
+		start = 1
+	}
+	buf.WriteString(strconv.FormatUint(start, 10))
+	return nil
+}
+
+func (m *Get) UnmarshalNMDC(dec *TextDecoder, data []byte) error {
+	i := bytes.LastIndexByte(data, '$')
+	if i < 0 {
+		return errors.New("Get: missing offset")
+	}
+	var s String
+	if err := s.UnmarshalNMDC(dec, data[:i]); err != nil {
+		return err
+	}
+	m.Path = string(s)
+	start, err := parseUin64Trim(data[i+1:])
+	if err != nil || start == 0 {
+		return errors.New("Get: invalid offset")
+	}
+	m.Start = start
+	return nil
+}
+
+// FileLength is sent by the uploader in response to Get.
+//
+// http://nmdc.sourceforge.net/NMDC.html#_filelength
+type FileLength struct {
+	Size uint64
+}
+
+func (*FileLength) Type() string {
+	return "FileLength"
+}
+
+func (m *FileLength) MarshalNMDC(_ *TextEncoder, buf *bytes.Buffer) error {
+	buf.WriteString(strconv.FormatUint(m.Size, 10))
+	return nil
+}
+
+func (m *FileLength) UnmarshalNMDC(_ *TextDecoder, data []byte) error {
+	size, err := parseUin64Trim(data)
+	if err != nil {
+		return errors.New("FileLength: invalid size")
+	}
+	m.Size = size
+	return nil
+}
+
+// Send is sent by the downloader to start the transfer requested by Get.
+//
+// http://nmdc.sourceforge.net/NMDC.html#_send
+type Send struct {
+	NoArgs
+}
+
+func (*Send) Type() string {
+	return "Send"
+}
+
+// BlockRequest is a common payload for GetBlock, UGetBlock, GetZBlock and UGetZBlock.
+type BlockRequest struct {
+	Start uint64
+	Bytes int64 // -1 means until the end of file
+	Path  string
+}
+
+func (m *BlockRequest) marshal(enc *TextEncoder, buf *bytes.Buffer) error {
+	buf.WriteString(strconv.FormatUint(m.Start, 10))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(m.Bytes, 10))
+	buf.WriteByte(' ')
+	return String(m.Path).MarshalNMDC(enc, buf)
+}
+
+func (m *BlockRequest) unmarshal(dec *TextDecoder, data []byte) error {
+	fields := bytes.SplitN(data, []byte(" "), 3)
+	if len(fields) != 3 {
+		return errors.New("invalid block request")
+	}
+	var err error
+	m.Start, err = parseUin64Trim(fields[0])
+	if err != nil {
+		return errors.New("invalid block start")
+	}
+	if bytes.Equal(fields[1], []byte("-1")) {
+		m.Bytes = -1
+	} else {
+		n, err := parseUin64Trim(fields[1])
+		if err != nil {
+			return errors.New("invalid block size")
+		}
+		m.Bytes = int64(n)
+	}
+	var s String
+	if err := s.UnmarshalNMDC(dec, fields[2]); err != nil {
+		return err
+	}
+	m.Path = string(s)
+	return nil
+}
+
+// GetBlock requests a part of the file. Path is in the connection encoding.
+// The uploader responds with Sending followed by the data.
+type GetBlock struct {
+	BlockRequest
+}
+
+func (*GetBlock) Type() string {
+	return "GetBlock"
+}
+
+func (m *GetBlock) MarshalNMDC(enc *TextEncoder, buf *bytes.Buffer) error {
+	return m.marshal(enc, buf)
+}
+
+func (m *GetBlock) UnmarshalNMDC(dec *TextDecoder, data []byte) error {
+	return m.unmarshal(dec, data)
+}
+
+// UGetBlock is the same as GetBlock, but the path is always in UTF-8.
+type UGetBlock struct {
+	BlockRequest
+}
+
+func (*UGetBlock) Type() string {
+	return "UGetBlock"
+}
+
+func (m *UGetBlock) MarshalNMDC(_ *TextEncoder, buf *bytes.Buffer) error {
+	return m.marshal(nil, buf)
+}
+
+func (m *UGetBlock) UnmarshalNMDC(_ *TextDecoder, data []byte) error {
+	return m.unmarshal(nil, data)
+}
+
+// GetZBlock is the same as GetBlock, but the data is compressed with zlib. Requires 'GetZBlock' extension.
+type GetZBlock struct {
+	BlockRequest
+}
+
+func (*GetZBlock) Type() string {
+	return "GetZBlock"
+}
+
+func (m *GetZBlock) MarshalNMDC(enc *TextEncoder, buf *bytes.Buffer) error {
+	return m.marshal(enc, buf)
+}
+
+func (m *GetZBlock) UnmarshalNMDC(dec *TextDecoder, data []byte) error {
+	return m.unmarshal(dec, data)
+}
+
+// UGetZBlock is the same as GetZBlock, but the path is always in UTF-8. Requires 'GetZBlock' extension.
+type UGetZBlock struct {
+	BlockRequest
+}
+
+func (*UGetZBlock) Type() string {
+	return "UGetZBlock"
+}
+
+func (m *UGetZBlock) MarshalNMDC(_ *TextEncoder, buf *bytes.Buffer) error {
+	return m.marshal(nil, buf)
+}
+
+func (m *UGetZBlock) UnmarshalNMDC(_ *TextDecoder, data []byte) error {
+	return m.unmarshal(nil, data)
+}
+
+// Sending is sent by the uploader in response to block requests, right before the data.
+// Bytes is the uncompressed size of the data, or -1 if it's unknown.
+type Sending struct {
+	Bytes int64
+}
+
+func (*Sending) Type() string {
+	return "Sending"
+}
+
+func (m *Sending) MarshalNMDC(_ *TextEncoder, buf *bytes.Buffer) error {
+	if m.Bytes < 0 {
+		return nil
+	}
+	buf.WriteString(strconv.FormatInt(m.Bytes, 10))
+	return nil
+}
+
+func (m *Sending) UnmarshalNMDC(_ *TextDecoder, data []byte) error {
+	if len(data) == 0 {
+		m.Bytes = -1
+		return nil
+	}
+	n, err := parseUin64Trim(data)
+	if err != nil {
+		return errors.New("Sending: invalid size")
+	}
+	m.Bytes = int64(n)
+	return nil
+}
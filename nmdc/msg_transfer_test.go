@@ -0,0 +1,177 @@
+package nmdc
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var transferCases = []casesMessageEntry{
+	{
+		typ:  "Get",
+		data: `dir\file 1.txt$1`,
+		msg:  &Get{Path: `dir\file 1.txt`, Start: 1},
+	},
+	{
+		typ:  "FileLength",
+		data: `1024`,
+		msg:  &FileLength{Size: 1024},
+	},
+	{
+		typ:  "GetBlock",
+		data: `0 -1 dir\file.txt`,
+		msg:  &GetBlock{BlockRequest{Start: 0, Bytes: -1, Path: `dir\file.txt`}},
+	},
+	{
+		typ:  "UGetZBlock",
+		data: `100 50 dir\some file.txt`,
+		msg:  &UGetZBlock{BlockRequest{Start: 100, Bytes: 50, Path: `dir\some file.txt`}},
+	},
+	{
+		typ:  "Sending",
+		data: `50`,
+		msg:  &Sending{Bytes: 50},
+	},
+	{
+		typ:  "Sending",
+		name: "no size",
+		data: ``,
+		msg:  &Sending{Bytes: -1},
+	},
+}
+
+func TestTransferUnmarshal(t *testing.T) {
+	doMessageTestUnmarshal(t, transferCases)
+}
+
+func TestTransferMarshal(t *testing.T) {
+	doMessageTestMarshal(t, transferCases)
+}
+
+func testOpenFunc(path string) (io.ReadSeeker, uint64, error) {
+	if path != `dir\file.txt` {
+		return nil, 0, os.ErrNotExist
+	}
+	const data = "hello world"
+	return strings.NewReader(data), uint64(len(data)), nil
+}
+
+var legacyUploadCases = []struct {
+	name string
+	in   string // recorded downloader messages
+	out  string // recorded uploader messages
+}{
+	{
+		name: "get",
+		in:   `$Get dir\file.txt$1|$Send|`,
+		out:  `$FileLength 11|hello world`,
+	},
+	{
+		name: "get offset",
+		in:   `$Get dir\file.txt$7|$Send|`,
+		out:  `$FileLength 11|world`,
+	},
+	{
+		name: "get not found",
+		in:   `$Get dir\other.txt$1|`,
+		out:  `$Error File Not Available|`,
+	},
+	{
+		name: "get block",
+		in:   `$UGetBlock 6 -1 dir\file.txt|`,
+		out:  `$Sending 5|world`,
+	},
+	{
+		name: "get block size",
+		in:   `$GetBlock 0 5 dir\file.txt|`,
+		out:  `$Sending 5|hello`,
+	},
+	{
+		name: "get block out of range",
+		in:   `$GetBlock 6 10 dir\file.txt|`,
+		out:  `$Failed invalid block size|`,
+	},
+}
+
+func TestServeLegacyUpload(t *testing.T) {
+	for _, c := range legacyUploadCases {
+		t.Run(c.name, func(t *testing.T) {
+			r := NewReader(strings.NewReader(c.in))
+			buf := bytes.NewBuffer(nil)
+			w := NewWriter(buf)
+			req, err := r.ReadMsg()
+			require.NoError(t, err)
+			err = ServeLegacyUpload(r, w, req, testOpenFunc)
+			require.NoError(t, err)
+			require.Equal(t, c.out, buf.String())
+		})
+	}
+}
+
+func TestServeLegacyUploadZlib(t *testing.T) {
+	r := NewReader(strings.NewReader(`$UGetZBlock 6 5 dir\file.txt|`))
+	buf := bytes.NewBuffer(nil)
+	w := NewWriter(buf)
+	req, err := r.ReadMsg()
+	require.NoError(t, err)
+	err = ServeLegacyUpload(r, w, req, testOpenFunc)
+	require.NoError(t, err)
+
+	// decode the uploader side the same way as the downloader would
+	buf.WriteString("$Sending 5|hello")
+	r = NewReader(buf)
+	for _, exp := range []struct {
+		data       string
+		compressed bool
+	}{
+		{"world", true},
+		{"hello", false},
+	} {
+		var m Sending
+		err = r.ReadMsgTo(&m)
+		require.NoError(t, err)
+		require.Equal(t, int64(5), m.Bytes)
+		rc, err := r.ReadBlock(uint64(m.Bytes), exp.compressed)
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		require.Equal(t, exp.data, string(data))
+	}
+}
+
+func TestWriteBlockShort(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		w := NewWriter(ioutil.Discard)
+		err := w.WriteBlock(strings.NewReader("hello"), 10, compressed)
+		require.Equal(t, io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestReadBlockTranscript(t *testing.T) {
+	// recorded from a GetZBlock transfer
+	var in []byte
+	in = append(in, "$Sending 5|"...)
+	in = append(in, 120, 156, 43, 207, 47, 202, 73, 1, 0, 6, 166, 2, 41)
+	in = append(in, "$Sending|"...)
+
+	r := NewReader(bytes.NewReader(in))
+	var m Sending
+	err := r.ReadMsgTo(&m)
+	require.NoError(t, err)
+	rc, err := r.ReadBlock(uint64(m.Bytes), true)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, "world", string(data))
+
+	err = r.ReadMsgTo(&m)
+	require.NoError(t, err)
+	require.Equal(t, int64(-1), m.Bytes)
+}
@@ -1,9 +1,14 @@
 package nmdc
 
-import "bytes"
+import (
+	"bytes"
+	"errors"
+)
 
 func init() {
 	RegisterMessage(&GetNickList{})
+	RegisterMessage(&NickList{})
+	RegisterMessage(&GetINFO{})
 	RegisterMessage(&OpList{})
 	RegisterMessage(&BotList{})
 	RegisterMessage(&UserIP{})
@@ -20,6 +25,58 @@ func (*GetNickList) Type() string {
 	return "GetNickList"
 }
 
+// NickList is a list of online users sent by the hub in response to GetNickList.
+//
+// http://nmdc.sourceforge.net/NMDC.html#_nicklist
+type NickList struct {
+	Names
+}
+
+func (*NickList) Type() string {
+	return "NickList"
+}
+
+// GetINFO is sent by the client to request MyINFO of a specific user.
+// Clients that negotiated NoGetINFO extension won't send it.
+//
+// http://nmdc.sourceforge.net/NMDC.html#_getinfo
+type GetINFO struct {
+	Target string
+	From   string
+}
+
+func (*GetINFO) Type() string {
+	return "GetINFO"
+}
+
+func (m *GetINFO) MarshalNMDC(enc *TextEncoder, buf *bytes.Buffer) error {
+	if err := Name(m.Target).MarshalNMDC(enc, buf); err != nil {
+		return err
+	}
+	buf.WriteByte(' ')
+	if err := Name(m.From).MarshalNMDC(enc, buf); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *GetINFO) UnmarshalNMDC(dec *TextDecoder, data []byte) error {
+	i := bytes.LastIndexByte(data, ' ')
+	if i < 0 {
+		return errors.New("invalid GetINFO command")
+	}
+	var name Name
+	if err := name.UnmarshalNMDC(dec, data[:i]); err != nil {
+		return err
+	}
+	m.Target = string(name)
+	if err := name.UnmarshalNMDC(dec, data[i+1:]); err != nil {
+		return err
+	}
+	m.From = string(name)
+	return nil
+}
+
 // OpList is a list of hub operators.
 //
 // http://nmdc.sourceforge.net/NMDC.html#_oplist
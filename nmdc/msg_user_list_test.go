@@ -26,6 +26,21 @@ var userListCases = []casesMessageEntry{
 			Names: []string{"Op 1", "Op 2"},
 		},
 	},
+	{
+		typ:  "NickList",
+		data: "alice$$bob$$",
+		msg: &NickList{
+			Names: []string{"alice", "bob"},
+		},
+	},
+	{
+		typ:  "GetINFO",
+		data: "alice bob",
+		msg: &GetINFO{
+			Target: "alice",
+			From:   "bob",
+		},
+	},
 	{
 		typ:  "UserIP",
 		data: `john doe 192.168.1.2$$user 2 192.168.1.3$$`,
@@ -0,0 +1,259 @@
+package nmdc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+
+	"golang.org/x/text/encoding"
+
+	"github.com/direct-connect/go-dc/types"
+)
+
+const (
+	// DefaultPingName is the name used by Ping if no name is set in the config.
+	DefaultPingName = "pinger"
+	// DefaultPingIdle is the time Ping waits for new messages after the login, before leaving the hub.
+	DefaultPingIdle = 3 * time.Second
+)
+
+var (
+	errPingPassword = errors.New("nmdc: ping: password required")
+	errPingBadPass  = errors.New("nmdc: ping: wrong password")
+	errPingNick     = errors.New("nmdc: ping: name is taken or invalid")
+	errPingFull     = errors.New("nmdc: ping: hub is full")
+)
+
+// PingConfig is an optional configuration for Ping.
+type PingConfig struct {
+	// Name of the pinger. DefaultPingName is used if not set.
+	Name     string
+	Password string
+	// Share size reported in MyINFO. Some hubs require a minimal share even for pingers.
+	Share uint64
+	Slots int
+	// Encoding is the text encoding of the hub. If not set, UTF-8 is assumed and messages
+	// in other encodings are decoded with invalid characters replaced.
+	Encoding encoding.Encoding
+	// TLS config for nmdcs:// addresses. See DialHub.
+	TLS *tls.Config
+	// Idle is the time to wait for new messages after the login. DefaultPingIdle is used if not set.
+	Idle time.Duration
+}
+
+// PingInfo is the information about the hub collected by Ping.
+type PingInfo struct {
+	Name  string
+	Topic string
+	// Lock is the challenge sent by the hub. Lock.PK usually contains the hub software.
+	Lock Lock
+	// Ext is the list of extensions supported by the hub.
+	Ext []string
+	// HubINFO is the detailed hub information, or nil if the hub doesn't support BotINFO.
+	HubINFO *HubINFO
+	// Users is the list of users, sorted by name. Operators and bots are marked in it.
+	Users []User
+	// Redirect is set if the hub redirected the pinger with ForceMove.
+	Redirect string
+	// FailOver is the list of alternative hub addresses.
+	FailOver []string
+}
+
+// ShareSize returns the total share size of all users.
+func (p *PingInfo) ShareSize() uint64 {
+	var size uint64
+	for _, u := range p.Users {
+		if u.Info != nil {
+			size += u.Info.ShareSize
+		}
+	}
+	return size
+}
+
+// Ping connects to the hub as a pinger bot and collects information about it.
+//
+// The pinger logs in, sends BotINFO, collects HubINFO, the hub name and topic, the user list
+// and the list of operators, and leaves after no messages are received for the idle time
+// (see PingConfig). The context controls the whole process, including the connection.
+//
+// If the hub redirects the pinger before it logs in, the info is returned with the Redirect set.
+func Ping(ctx context.Context, addr string, conf *PingConfig) (*PingInfo, error) {
+	var c PingConfig
+	if conf != nil {
+		c = *conf
+	}
+	if c.Name == "" {
+		c.Name = DefaultPingName
+	}
+	if c.Idle <= 0 {
+		c.Idle = DefaultPingIdle
+	}
+	conn, err := DialHub(ctx, addr, c.TLS)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// unblock reads if the context is canceled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+
+	p := &pinger{
+		conf:  &c,
+		r:     NewReader(conn),
+		w:     NewWriter(conn),
+		users: NewUserList(),
+	}
+	if c.Encoding != nil {
+		p.r.SetDecoder(c.Encoding.NewDecoder())
+		p.w.SetEncoder(c.Encoding.NewEncoder())
+	}
+	p.r.OnUnknownEncoding = func(text []byte) (*TextDecoder, error) {
+		return nil, nil // replace invalid characters
+	}
+	p.r.OnUnmarshalError = func(text []byte, err error) (bool, error) {
+		return false, nil // skip broken messages
+	}
+	p.r.OnMessage(p.users.OnMessage)
+	p.users.OnGetINFO(func(name string) error {
+		return p.w.WriteMsg(&GetINFO{Target: name, From: c.Name})
+	})
+
+	if err = p.login(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if p.info.Redirect != "" {
+		return &p.info, nil
+	}
+	for {
+		if err = p.w.Flush(); err != nil {
+			return nil, err
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(c.Idle))
+		m, err := p.r.ReadMsg()
+		if e, ok := err.(net.Error); ok && e.Timeout() {
+			break
+		} else if err != nil {
+			if ctx.Err() != nil {
+				break // return what was collected
+			}
+			return nil, err
+		}
+		p.handle(m)
+	}
+	p.info.Users = p.users.Users()
+	return &p.info, nil
+}
+
+type pinger struct {
+	conf  *PingConfig
+	r     *Reader
+	w     *Writer
+	users *UserList
+	info  PingInfo
+}
+
+func (p *pinger) writeMsg(msg ...Message) error {
+	if err := p.w.WriteMsg(msg...); err != nil {
+		return err
+	}
+	return p.w.Flush()
+}
+
+// login runs the handshake until the hub accepts the pinger. It returns early if the hub redirects it.
+func (p *pinger) login() error {
+	if err := p.r.ReadMsgTo(&p.info.Lock); err != nil {
+		return err
+	}
+	lock := &p.info.Lock
+	var msgs []Message
+	if !lock.NoExt {
+		msgs = append(msgs, &Supports{Ext: []string{
+			ExtNoHello, ExtNoGetINFO, ExtBotINFO, ExtHubINFO, ExtHubTopic, ExtBotList,
+		}})
+	}
+	msgs = append(msgs, lock.Key(), &ValidateNick{Name: Name(p.conf.Name)})
+	if err := p.writeMsg(msgs...); err != nil {
+		return err
+	}
+	for {
+		m, err := p.r.ReadMsg()
+		if err != nil {
+			return err
+		}
+		switch m := m.(type) {
+		case *Supports:
+			p.info.Ext = m.Ext
+			for _, ext := range m.Ext {
+				if ext == ExtNoGetINFO {
+					p.users.SetNoGetINFO(true)
+				}
+			}
+		case *GetPass:
+			if p.conf.Password == "" {
+				return errPingPassword
+			}
+			if err = p.writeMsg(&MyPass{String: String(p.conf.Password)}); err != nil {
+				return err
+			}
+		case *BadPass:
+			return errPingBadPass
+		case *ValidateDenide:
+			return errPingNick
+		case *HubIsFull:
+			return errPingFull
+		case *Hello:
+			if string(m.Name) != p.conf.Name {
+				continue
+			}
+			return p.writeMsg(
+				&Version{Vers: "1,0091"},
+				&GetNickList{},
+				&MyINFO{
+					Name:       p.conf.Name,
+					Client:     types.Software{Name: "go-dc", Version: "pinger"},
+					Mode:       UserModePassive,
+					HubsNormal: 1,
+					Slots:      p.conf.Slots,
+					Conn:       ConnSpeedServer,
+					Flag:       FlagStatusNormal,
+					ShareSize:  p.conf.Share,
+				},
+				&BotINFO{String: "go-dc pinger"},
+			)
+		default:
+			p.handle(m)
+			if p.info.Redirect != "" {
+				return nil
+			}
+		}
+	}
+}
+
+// handle collects the hub information from a message. The user list is updated by a Reader hook.
+func (p *pinger) handle(m Message) {
+	switch m := m.(type) {
+	case *HubName:
+		p.info.Name = string(m.String)
+	case *HubTopic:
+		p.info.Topic = m.Text
+	case *HubINFO:
+		p.info.HubINFO = m
+	case *FailOver:
+		p.info.FailOver = m.Host
+	case *ForceMove:
+		p.info.Redirect = m.Address
+	}
+}
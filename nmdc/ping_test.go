@@ -0,0 +1,131 @@
+package nmdc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dc/types"
+)
+
+// testPingHub serves a single pinger connection and returns the messages received from it.
+func testPingHub(t *testing.T, l net.Listener, pass bool) <-chan []Message {
+	out := make(chan []Message, 1)
+	go func() {
+		defer close(out)
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r, w := NewReader(conn), NewWriter(conn)
+		var got []Message
+		send := func(msg ...Message) {
+			_ = w.WriteMsg(msg...)
+			_ = w.Flush()
+		}
+		read := func() Message {
+			m, err := r.ReadMsg()
+			if err != nil {
+				return nil
+			}
+			got = append(got, m)
+			return m
+		}
+		send(&Lock{Lock: "_verlihub", PK: "version1.1"})
+		for i := 0; i < 3; i++ { // Supports, Key, ValidateNick
+			read()
+		}
+		send(&Supports{Ext: []string{ExtNoHello, ExtNoGetINFO, ExtBotINFO, ExtHubINFO}}, &HubName{String: "Test hub"})
+		if pass {
+			send(&GetPass{})
+			read()
+		}
+		send(&Hello{Name: "pinger"})
+		for i := 0; i < 4; i++ { // Version, GetNickList, MyINFO, BotINFO
+			read()
+		}
+		send(
+			&MyINFO{Name: "alice", Client: types.Software{Name: "DC++", Version: "0.868"}, ShareSize: 100, Mode: UserModeActive, HubsNormal: 1, Slots: 1, Conn: ConnSpeedServer, Flag: FlagStatusNormal},
+			&MyINFO{Name: "bob", Client: types.Software{Name: "DC++", Version: "0.868"}, ShareSize: 50, Mode: UserModeActive, HubsNormal: 1, Slots: 1, Conn: ConnSpeedServer, Flag: FlagStatusNormal},
+			&OpList{Names: Names{"bob"}},
+			&HubTopic{Text: "topic"},
+			&HubINFO{
+				Name: "Test hub", Host: "dc.example.com", Desc: "desc",
+				MaxUsers: 1000, MinShare: 1 << 30, MinSlots: 2, MaxHubs: 10,
+				Soft: types.Software{Name: "Verlihub", Version: "1.1"}, Owner: "owner",
+				Category: "Public HUB", Encoding: "UTF-8",
+			},
+		)
+		// wait for the pinger to leave
+		for read() != nil {
+		}
+		out <- got
+	}()
+	return out
+}
+
+func TestPing(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	msgs := testPingHub(t, l, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	info, err := Ping(ctx, l.Addr().String(), &PingConfig{
+		Password: "secret",
+		Idle:     200 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Test hub", info.Name)
+	require.Equal(t, "topic", info.Topic)
+	require.Equal(t, "version1.1", info.Lock.PK)
+	require.Equal(t, []string{ExtNoHello, ExtNoGetINFO, ExtBotINFO, ExtHubINFO}, info.Ext)
+	require.NotNil(t, info.HubINFO)
+	require.Equal(t, 1000, info.HubINFO.MaxUsers)
+	require.Equal(t, uint64(1<<30), info.HubINFO.MinShare)
+	require.Equal(t, "Public HUB", info.HubINFO.Category)
+	require.Len(t, info.Users, 2)
+	require.Equal(t, "alice", info.Users[0].Name)
+	require.False(t, info.Users[0].Op)
+	require.Equal(t, "bob", info.Users[1].Name)
+	require.True(t, info.Users[1].Op)
+	require.Equal(t, uint64(150), info.ShareSize())
+
+	got := <-msgs
+	require.Len(t, got, 8)
+	require.Equal(t, &ValidateNick{Name: "pinger"}, got[2])
+	require.Equal(t, &MyPass{String: "secret"}, got[3])
+	require.IsType(t, &BotINFO{}, got[7])
+}
+
+func TestPingPassword(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	testPingHub(t, l, true)
+
+	_, err = Ping(context.Background(), l.Addr().String(), nil)
+	require.Equal(t, errPingPassword, err)
+}
+
+func TestPingCancel(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = Ping(ctx, l.Addr().String(), nil)
+	require.Equal(t, context.DeadlineExceeded, err)
+}
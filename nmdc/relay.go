@@ -0,0 +1,106 @@
+package nmdc
+
+import (
+	"errors"
+	"sync"
+)
+
+// ToSearch converts the TTHS search to a regular TTH search.
+func (m *TTHSearchActive) ToSearch() *Search {
+	h := m.TTH
+	return &Search{Address: m.Address, IsMaxSize: true, DataType: DataTypeTTH, TTH: &h}
+}
+
+// ToSearch converts the TTHS search to a regular TTH search.
+func (m *TTHSearchPassive) ToSearch() *Search {
+	h := m.TTH
+	return &Search{User: m.User, IsMaxSize: true, DataType: DataTypeTTH, TTH: &h}
+}
+
+// ToTTHS converts a TTH search to a short form defined by TTHS extension.
+// It returns nil if the search cannot be represented in the short form.
+func (m *Search) ToTTHS() Message {
+	if m.DataType != DataTypeTTH || m.TTH == nil {
+		return nil
+	}
+	if m.Address != "" {
+		return &TTHSearchActive{TTH: *m.TTH, Address: m.Address}
+	}
+	return &TTHSearchPassive{TTH: *m.TTH, User: m.User}
+}
+
+// NewSearchRelay prepares a search for broadcasting. The message must be either Search,
+// TTHSearchActive or TTHSearchPassive.
+func NewSearchRelay(m Message) (*SearchRelay, error) {
+	r := &SearchRelay{}
+	switch m := m.(type) {
+	case *Search:
+		r.long, r.short = m, m.ToTTHS()
+	case *TTHSearchActive:
+		r.long, r.short = m.ToSearch(), m
+	case *TTHSearchPassive:
+		r.long, r.short = m.ToSearch(), m
+	default:
+		return nil, errors.New("nmdc: not a search message: " + m.Type())
+	}
+	return r, nil
+}
+
+// SearchRelay selects a search form for each recipient of the broadcast. Recipients with TTHS
+// extension receive SA/SP form for TTH searches, while others receive a regular Search.
+//
+// Each form is encoded only once per text encoding. It's safe for a concurrent use.
+type SearchRelay struct {
+	long  *Search
+	short Message // SA or SP; nil if not a TTH search
+
+	mu    sync.Mutex
+	cache map[relayKey][]byte
+}
+
+type relayKey struct {
+	short bool
+	enc   *TextEncoder
+}
+
+// Search returns the search in a regular form.
+func (r *SearchRelay) Search() *Search {
+	return r.long
+}
+
+// Message returns a search message in a form supported by the recipient.
+func (r *SearchRelay) Message(ext Extensions) Message {
+	if r.short != nil && ext.Has(ExtTTHS) {
+		return r.short
+	}
+	return r.long
+}
+
+// Encode returns an encoded search message, including the delimiter, in a form supported by the recipient.
+// The result is cached and must not be modified. It can be written with Writer.WriteLine.
+func (r *SearchRelay) Encode(ext Extensions, enc *TextEncoder) ([]byte, error) {
+	m := r.Message(ext)
+	key := relayKey{short: m != r.long, enc: enc}
+	if key.short {
+		// SA and SP forms contain no text that depends on the encoding, except the nick
+		if _, ok := m.(*TTHSearchActive); ok {
+			key.enc = nil
+		}
+	} else if r.long.DataType == DataTypeTTH && r.long.Address != "" {
+		key.enc = nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if data, ok := r.cache[key]; ok {
+		return data, nil
+	}
+	data, err := Marshal(enc, m)
+	if err != nil {
+		return nil, err
+	}
+	if r.cache == nil {
+		r.cache = make(map[relayKey][]byte)
+	}
+	r.cache[key] = data
+	return data, nil
+}
@@ -0,0 +1,76 @@
+package nmdc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchRelay(t *testing.T) {
+	const tth = "TO32WPD6AQE7VA7654HEAM5GKFQGIL7F2BEKFNA"
+	var h TTH
+	err := h.FromBase32(tth)
+	require.NoError(t, err)
+
+	tths := Extensions{}
+	tths.Set(ExtTTHS)
+	legacy := Extensions{}
+
+	var cases = []struct {
+		name  string
+		msg   Message
+		short string
+		long  string
+	}{
+		{
+			name:  "search active",
+			msg:   &Search{Address: "127.0.0.1:412", IsMaxSize: true, DataType: DataTypeTTH, TTH: &h},
+			short: "$SA " + tth + " 127.0.0.1:412|",
+			long:  "$Search 127.0.0.1:412 F?T?0?9?TTH:" + tth + "|",
+		},
+		{
+			name:  "search passive",
+			msg:   &Search{User: "user", IsMaxSize: true, DataType: DataTypeTTH, TTH: &h},
+			short: "$SP " + tth + " user|",
+			long:  "$Search Hub:user F?T?0?9?TTH:" + tth + "|",
+		},
+		{
+			name:  "SA",
+			msg:   &TTHSearchActive{TTH: h, Address: "127.0.0.1:412"},
+			short: "$SA " + tth + " 127.0.0.1:412|",
+			long:  "$Search 127.0.0.1:412 F?T?0?9?TTH:" + tth + "|",
+		},
+		{
+			name:  "SP",
+			msg:   &TTHSearchPassive{TTH: h, User: "user"},
+			short: "$SP " + tth + " user|",
+			long:  "$Search Hub:user F?T?0?9?TTH:" + tth + "|",
+		},
+		{
+			name:  "text search",
+			msg:   &Search{User: "user", DataType: DataTypeAny, Pattern: "some file"},
+			short: "$Search Hub:user F?T?0?1?some$file|",
+			long:  "$Search Hub:user F?T?0?1?some$file|",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := NewSearchRelay(c.msg)
+			require.NoError(t, err)
+			for i := 0; i < 2; i++ {
+				data, err := r.Encode(tths, nil)
+				require.NoError(t, err)
+				require.Equal(t, c.short, string(data))
+
+				data, err = r.Encode(legacy, nil)
+				require.NoError(t, err)
+				require.Equal(t, c.long, string(data))
+			}
+		})
+	}
+}
+
+func TestSearchRelayInvalid(t *testing.T) {
+	_, err := NewSearchRelay(&Hello{Name: "user"})
+	require.Error(t, err)
+}
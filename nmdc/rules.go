@@ -0,0 +1,104 @@
+package nmdc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrNickTooShort      = errors.New("nick is too short")
+	ErrNickTooLong       = errors.New("nick is too long")
+	ErrNickPrefix        = errors.New("nick has no required prefix")
+	ErrSearchTooShort    = errors.New("search is too short")
+	ErrSearchTooLong     = errors.New("search is too long")
+	ErrSearchTooFrequent = errors.New("search is too frequent")
+)
+
+// Validate checks if the nick satisfies the rule. Clients should call it before sending ValidateNick.
+func (r *NickRule) Validate(name string) error {
+	n := utf8.RuneCountInString(name)
+	if r.Min > 0 && n < r.Min {
+		return ErrNickTooShort
+	}
+	if r.Max > 0 && n > r.Max {
+		return ErrNickTooLong
+	}
+	for _, c := range name {
+		for _, c2 := range r.Chars {
+			if c == c2 {
+				return fmt.Errorf("forbidden character in nick: %q", c)
+			}
+		}
+	}
+	if len(r.Prefix) == 0 {
+		return nil
+	}
+	for _, p := range r.Prefix {
+		if strings.HasPrefix(name, p) {
+			return nil
+		}
+	}
+	return ErrNickPrefix
+}
+
+// Validate checks if the search request satisfies the length limits of the rule.
+// TTH searches are not affected by the length limits.
+//
+// Clients should call it before sending the search request.
+func (r *SearchRule) Validate(s *Search) error {
+	if s.TTH != nil {
+		return nil
+	}
+	n := utf8.RuneCountInString(s.Pattern)
+	if r.Min > 0 && n < r.Min {
+		return ErrSearchTooShort
+	}
+	if r.Max > 0 && n > r.Max {
+		return ErrSearchTooLong
+	}
+	return nil
+}
+
+// IntervalFor returns a minimal interval between searches for active or passive users.
+// It falls back to the common interval if the mode-specific one is not set.
+func (r *SearchRule) IntervalFor(active bool) time.Duration {
+	if active && r.IntervalActive > 0 {
+		return r.IntervalActive
+	} else if !active && r.IntervalPassive > 0 {
+		return r.IntervalPassive
+	}
+	return r.Interval
+}
+
+// Check validates the search request and checks that the interval between searches is respected.
+// The last argument is the time of the previous search of the user, or zero time if there was none.
+//
+// Hubs should call it for each search before broadcasting it.
+func (r *SearchRule) Check(s *Search, last, now time.Time) error {
+	if err := r.Validate(s); err != nil {
+		return err
+	}
+	if last.IsZero() {
+		return nil
+	}
+	if dt := r.IntervalFor(s.IsActive()); dt > 0 && now.Sub(last) < dt {
+		return ErrSearchTooFrequent
+	}
+	return nil
+}
+
+// RuleMessages returns the rule messages that should be sent to the client after the handshake.
+// Only rules for extensions supported by the client are returned. Nil rules are skipped.
+func RuleMessages(ext Extensions, nick *NickRule, search *SearchRule) []Message {
+	var out []Message
+	if nick != nil && ext.Has(ExtNickRule) {
+		out = append(out, nick)
+	}
+	if search != nil && ext.Has(ExtSearchRule) {
+		out = append(out, search)
+	}
+	return out
+}
@@ -0,0 +1,206 @@
+package nmdc
+
+import (
+	"strings"
+
+	"github.com/direct-connect/go-dc/adc"
+)
+
+const (
+	// MaxResultsActive is the max number of results sent to an active user.
+	MaxResultsActive = 10
+	// MaxResultsPassive is the max number of results sent to a passive user.
+	MaxResultsPassive = 5
+)
+
+// extensions that have no corresponding ADC extension group
+var dataTypeExt = map[DataType][]string{
+	DataTypeDiskImage: {
+		"bin", "ccd", "cdi", "cue", "dmg", "img", "iso", "isz",
+		"mdf", "mds", "nrg", "udf", "vcd", "vhd", "vmdk",
+	},
+	DataTypeComics: {
+		"cb7", "cba", "cbr", "cbt", "cbz",
+	},
+	DataTypeBook: {
+		"azw", "azw3", "djv", "djvu", "epub", "fb2",
+		"lit", "lrf", "mobi", "prc",
+	},
+}
+
+var dataTypeExtI = make(map[string]DataType)
+
+func init() {
+	for typ, list := range dataTypeExt {
+		for _, ext := range list {
+			dataTypeExtI[ext] = typ
+		}
+	}
+}
+
+// ExtGroup returns an ADC extension group (SEGA) that corresponds to this data type.
+// It returns false if there is no such group.
+func (t DataType) ExtGroup() (adc.ExtGroup, bool) {
+	switch t {
+	case DataTypeAudio:
+		return adc.ExtAudio, true
+	case DataTypeCompressed:
+		return adc.ExtArch, true
+	case DataTypeDocument:
+		return adc.ExtDoc, true
+	case DataTypeExecutable:
+		return adc.ExtExe, true
+	case DataTypePicture:
+		return adc.ExtImage, true
+	case DataTypeVideo:
+		return adc.ExtVideo, true
+	}
+	return adc.ExtNone, false
+}
+
+// Extensions returns a list of file extensions for data types that have no corresponding
+// ADC extension group (see ExtGroup). It returns nil for other types.
+func (t DataType) Extensions() []string {
+	return append([]string(nil), dataTypeExt[t]...)
+}
+
+// MatchesName checks if a file name has an extension that belongs to this data type.
+// Types that are not related to file extensions, like DataTypeAny, match any name.
+// DataTypeFolders and DataTypeTTH never match.
+func (t DataType) MatchesName(name string) bool {
+	switch t {
+	case 0, DataTypeAny, DataTypeMagnet:
+		return true
+	case DataTypeFolders, DataTypeTTH:
+		return false
+	}
+	if g, ok := t.ExtGroup(); ok {
+		return g.Matches(name)
+	}
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 {
+		return false
+	}
+	typ, ok := dataTypeExtI[strings.ToLower(name[i+1:])]
+	return ok && typ == t
+}
+
+// SearchEntry is a single file or directory that can be matched by the Search.
+type SearchEntry struct {
+	Path  []string
+	IsDir bool
+	Size  uint64 // only set for files
+	TTH   *TTH   // only set for files
+}
+
+// SearchIndex is an index of shared files that can be queried by the Search.
+type SearchIndex interface {
+	// SearchTTH returns all files with a given TTH.
+	SearchTTH(h TTH) []SearchEntry
+	// WalkSearch calls fnc for each file and directory in the index, until it returns false.
+	WalkSearch(fnc func(e SearchEntry) bool)
+}
+
+// Terms returns the search pattern split into lowercase terms.
+func (m *Search) Terms() []string {
+	return strings.Fields(strings.ToLower(m.Pattern))
+}
+
+// Match checks if an entry matches the search request. It doesn't check the TTH
+// for DataTypeTTH searches, use SearchIndex.SearchTTH instead.
+func (m *Search) Match(e SearchEntry) bool {
+	return m.match(m.Terms(), e)
+}
+
+func (m *Search) match(terms []string, e SearchEntry) bool {
+	if len(e.Path) == 0 {
+		return false
+	}
+	switch m.DataType {
+	case DataTypeTTH:
+		return !e.IsDir && m.TTH != nil && e.TTH != nil && *e.TTH == *m.TTH
+	case DataTypeFolders:
+		if !e.IsDir {
+			return false
+		}
+	case 0, DataTypeAny, DataTypeMagnet:
+		// files and folders
+	default:
+		if e.IsDir || !m.DataType.MatchesName(e.Path[len(e.Path)-1]) {
+			return false
+		}
+	}
+	if m.SizeRestricted && !e.IsDir {
+		if m.IsMaxSize && e.Size > m.Size {
+			return false
+		} else if !m.IsMaxSize && e.Size < m.Size {
+			return false
+		}
+	}
+	if len(terms) == 0 {
+		return false
+	}
+	path := strings.ToLower(strings.Join(e.Path, "\\"))
+	for _, t := range terms {
+		if !strings.Contains(path, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchResults evaluates the search against the index and returns results that are ready to be sent.
+//
+// Fields of tmpl like From, FreeSlots, TotalSlots, HubName and HubAddress are copied to each result.
+// For passive searches the To field is set to the searching user.
+// If max is zero, MaxResultsActive or MaxResultsPassive will be used, depending on the search mode.
+func SearchResults(idx SearchIndex, m *Search, tmpl SR, max int) []SR {
+	if max <= 0 {
+		max = MaxResultsPassive
+		if m.IsActive() {
+			max = MaxResultsActive
+		}
+	}
+	tmpl.Path, tmpl.IsDir, tmpl.Size, tmpl.TTH = nil, false, 0, nil
+	tmpl.To = ""
+	if !m.IsActive() {
+		tmpl.To = m.User
+	}
+	var out []SR
+	add := func(e SearchEntry) bool {
+		r := tmpl
+		r.Path = e.Path
+		r.IsDir = e.IsDir
+		if !e.IsDir {
+			r.Size = e.Size
+			r.TTH = e.TTH
+		}
+		out = append(out, r)
+		return len(out) < max
+	}
+	if m.DataType == DataTypeTTH {
+		if m.TTH == nil {
+			return nil
+		}
+		for _, e := range idx.SearchTTH(*m.TTH) {
+			if !m.match(nil, e) {
+				continue
+			}
+			if !add(e) {
+				break
+			}
+		}
+		return out
+	}
+	terms := m.Terms()
+	if len(terms) == 0 {
+		return nil
+	}
+	idx.WalkSearch(func(e SearchEntry) bool {
+		if !m.match(terms, e) {
+			return true
+		}
+		return add(e)
+	})
+	return out
+}
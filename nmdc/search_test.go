@@ -0,0 +1,120 @@
+package nmdc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type searchList []SearchEntry
+
+func (l searchList) SearchTTH(h TTH) []SearchEntry {
+	var out []SearchEntry
+	for _, e := range l {
+		if e.TTH != nil && *e.TTH == h {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func (l searchList) WalkSearch(fnc func(e SearchEntry) bool) {
+	for _, e := range l {
+		if !fnc(e) {
+			return
+		}
+	}
+}
+
+var testSearchIndex = searchList{
+	{Path: []string{"Music"}, IsDir: true},
+	{Path: []string{"Music", "Some Band - Song.mp3"}, Size: 5000, TTH: getTHPointer("TO32WPD6AQE7VA7654HEAM5GKFQGIL7F2BEKFNA")},
+	{Path: []string{"Music", "Some Band - Song.txt"}, Size: 10},
+	{Path: []string{"Images", "linux.iso"}, Size: 700 << 20, TTH: getTHPointer("BNQGWMXKUIAFAU3TV32I5U6SKNYMQBBNH4FELNQ")},
+	{Path: []string{"Books", "Go.epub"}, Size: 100},
+}
+
+var searchMatchCases = []struct {
+	name   string
+	search Search
+	exp    []string
+}{
+	{
+		name:   "any",
+		search: Search{Pattern: "music song"},
+		exp:    []string{`Music\Some Band - Song.mp3`, `Music\Some Band - Song.txt`},
+	},
+	{
+		name:   "folder",
+		search: Search{Pattern: "music", DataType: DataTypeFolders},
+		exp:    []string{`Music`},
+	},
+	{
+		name:   "audio",
+		search: Search{Pattern: "song", DataType: DataTypeAudio},
+		exp:    []string{`Music\Some Band - Song.mp3`},
+	},
+	{
+		name:   "min size",
+		search: Search{Pattern: "song", SizeRestricted: true, Size: 100},
+		exp:    []string{`Music\Some Band - Song.mp3`},
+	},
+	{
+		name:   "max size",
+		search: Search{Pattern: "song", SizeRestricted: true, IsMaxSize: true, Size: 100},
+		exp:    []string{`Music\Some Band - Song.txt`},
+	},
+	{
+		name:   "disk image",
+		search: Search{Pattern: "linux", DataType: DataTypeDiskImage},
+		exp:    []string{`Images\linux.iso`},
+	},
+	{
+		name:   "book",
+		search: Search{Pattern: "go", DataType: DataTypeBook},
+		exp:    []string{`Books\Go.epub`},
+	},
+	{
+		name:   "tth",
+		search: Search{DataType: DataTypeTTH, TTH: getTHPointer("BNQGWMXKUIAFAU3TV32I5U6SKNYMQBBNH4FELNQ")},
+		exp:    []string{`Images\linux.iso`},
+	},
+	{
+		name:   "empty",
+		search: Search{},
+	},
+}
+
+func TestSearchResults(t *testing.T) {
+	tmpl := SR{
+		From: "bob", FreeSlots: 1, TotalSlots: 2,
+		HubName: "hub", HubAddress: "127.0.0.1:411",
+	}
+	for _, c := range searchMatchCases {
+		t.Run(c.name, func(t *testing.T) {
+			c.search.User = "alice"
+			res := SearchResults(testSearchIndex, &c.search, tmpl, 0)
+			var got []string
+			for _, r := range res {
+				require.Equal(t, "bob", r.From)
+				require.Equal(t, "alice", r.To)
+				require.Equal(t, 1, r.FreeSlots)
+				require.Equal(t, 2, r.TotalSlots)
+				require.Equal(t, "127.0.0.1:411", r.HubAddress)
+				p := r.Path[0]
+				for _, s := range r.Path[1:] {
+					p += `\` + s
+				}
+				got = append(got, p)
+			}
+			require.Equal(t, c.exp, got)
+		})
+	}
+}
+
+func TestSearchResultsLimit(t *testing.T) {
+	s := &Search{Address: "127.0.0.1:412", Pattern: "o"}
+	res := SearchResults(testSearchIndex, s, SR{From: "bob"}, 2)
+	require.Len(t, res, 2)
+	require.Equal(t, "", res[0].To)
+}
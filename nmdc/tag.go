@@ -0,0 +1,139 @@
+package nmdc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// known keys of the MyINFO tag, in addition to V, M, H and S
+const (
+	TagAutoOpen  = "O" // open an extra slot if the upload speed is below the value (KiB/s)
+	TagBandwidth = "B" // bandwidth limit (KiB/s)
+	TagUpload    = "L" // upload limit (KiB/s)
+	TagFriends   = "F" // slots reserved for friends and favourite users
+)
+
+// TagValue returns a raw value of the additional tag field.
+// One-letter keys are case-insensitive and stored in upper case.
+func (m *MyINFO) TagValue(key string) (string, bool) {
+	if len(key) == 1 {
+		key = strings.ToUpper(key)
+	}
+	v, ok := m.Extra[key]
+	return v, ok
+}
+
+// TagInt returns an integer value of the additional tag field.
+// It returns false if the field is not set and an error if it cannot be parsed.
+func (m *MyINFO) TagInt(key string) (int, bool, error) {
+	v, ok := m.TagValue(key)
+	if !ok {
+		return 0, false, nil
+	}
+	n, err := atoiTrim([]byte(v))
+	if err != nil {
+		return 0, true, fmt.Errorf("invalid tag field %s: %q", key, v)
+	}
+	return n, true, nil
+}
+
+// AutoOpenSlots returns the speed limit (in KiB/s) below which the client automatically
+// opens an extra slot (O: field). It returns false if the field is not set or invalid.
+func (m *MyINFO) AutoOpenSlots() (int, bool) {
+	v, ok, err := m.TagInt(TagAutoOpen)
+	return v, ok && err == nil
+}
+
+// BandwidthLimit returns the bandwidth limit in KiB/s (B: field).
+// It returns false if the field is not set or invalid.
+func (m *MyINFO) BandwidthLimit() (int, bool) {
+	v, ok, err := m.TagInt(TagBandwidth)
+	return v, ok && err == nil
+}
+
+// UploadLimit returns the upload limit in KiB/s (L: field).
+// It returns false if the field is not set or invalid.
+func (m *MyINFO) UploadLimit() (int, bool) {
+	v, ok, err := m.TagInt(TagUpload)
+	return v, ok && err == nil
+}
+
+// FriendSlots returns the number of slots reserved for friends (F: field).
+// It returns false if the field is not set or invalid.
+func (m *MyINFO) FriendSlots() (int, bool) {
+	v, ok, err := m.TagInt(TagFriends)
+	return v, ok && err == nil
+}
+
+// HasTag checks if MyINFO contained a client tag.
+func (m *MyINFO) HasTag() bool {
+	return m.Client.Name != "" || m.Client.Version != ""
+}
+
+// legacy connection speed names, in bits/second
+var connSpeeds = map[string]uint64{
+	"28.8kbps":  28800,
+	"33.6kbps":  33600,
+	"56kbps":    56000,
+	"modem":     56000,
+	"isdn":      128000,
+	"satellite": 1500000,
+	"dsl":       2000000,
+	"cable":     4000000,
+	"lan(t1)":   1544000,
+	"lan(t3)":   44736000,
+	"wireless":  11000000,
+}
+
+var errUnknownConnSpeed = errors.New("nmdc: unknown connection speed")
+
+// ParseConnSpeed parses a connection speed string from MyINFO and returns a speed in bytes per second.
+//
+// Supported forms are legacy names ("DSL", "LAN(T3)", "56Kbps"), numbers in Mbit/s
+// sent by modern clients ("100", "0.005") and values with units ("512 KiB/s", "10 Mbit/s").
+func ParseConnSpeed(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errUnknownConnSpeed
+	}
+	ls := strings.ToLower(s)
+	if v, ok := connSpeeds[ls]; ok {
+		return v / 8, nil
+	}
+	num, unit := ls, ""
+	if i := strings.IndexFunc(ls, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	}); i >= 0 {
+		num, unit = ls[:i], strings.TrimSpace(ls[i:])
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 {
+		return 0, errUnknownConnSpeed
+	}
+	// bits or bytes per second in the unit
+	var mult float64
+	switch strings.TrimSuffix(strings.TrimSuffix(unit, "/s"), "ps") {
+	case "", "m", "mbit", "mb":
+		mult = 1e6 / 8
+	case "k", "kbit", "kb":
+		mult = 1e3 / 8
+	case "g", "gbit", "gb":
+		mult = 1e9 / 8
+	case "kib", "kbyte":
+		mult = 1 << 10
+	case "mib", "mbyte":
+		mult = 1 << 20
+	case "gib", "gbyte":
+		mult = 1 << 30
+	default:
+		return 0, errUnknownConnSpeed
+	}
+	return uint64(v * mult), nil
+}
+
+// ConnSpeed is a shorthand for ParseConnSpeed(m.Conn).
+func (m *MyINFO) ConnSpeed() (uint64, error) {
+	return ParseConnSpeed(m.Conn)
+}
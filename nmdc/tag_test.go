@@ -0,0 +1,67 @@
+package nmdc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMyINFOTag(t *testing.T) {
+	var m MyINFO
+	err := m.UnmarshalNMDC(nil, []byte(`$ALL johndoe RU<ApexDC++ V:1.6.5,M:A,H:2/1/0,S:5,O:10,b:512,L:256,F:x>$ $LAN(T3)K$$1234$`))
+	require.NoError(t, err)
+
+	v, ok := m.AutoOpenSlots()
+	require.True(t, ok)
+	require.Equal(t, 10, v)
+
+	v, ok = m.BandwidthLimit()
+	require.True(t, ok)
+	require.Equal(t, 512, v)
+
+	v, ok = m.UploadLimit()
+	require.True(t, ok)
+	require.Equal(t, 256, v)
+
+	_, ok = m.FriendSlots()
+	require.False(t, ok)
+	_, ok, err = m.TagInt("f")
+	require.True(t, ok)
+	require.Error(t, err)
+
+	s, ok := m.TagValue("l")
+	require.True(t, ok)
+	require.Equal(t, "256", s)
+}
+
+func TestParseConnSpeed(t *testing.T) {
+	var cases = []struct {
+		conn string
+		exp  uint64
+		err  bool
+	}{
+		{conn: "LAN(T3)", exp: 44736000 / 8},
+		{conn: "DSL", exp: 2000000 / 8},
+		{conn: "56Kbps", exp: 56000 / 8},
+		{conn: "100", exp: 100 * 1e6 / 8},
+		{conn: "0.005", exp: 625},
+		{conn: "512 KiB/s", exp: 512 * 1024},
+		{conn: "10 Mbit/s", exp: 10 * 1e6 / 8},
+		{conn: "8kbps", exp: 1000},
+		{conn: "", err: true},
+		{conn: "fast", err: true},
+		{conn: "NetLimiter", err: true},
+		{conn: "10 parsecs", err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.conn, func(t *testing.T) {
+			v, err := ParseConnSpeed(c.conn)
+			if c.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.exp, v)
+		})
+	}
+}
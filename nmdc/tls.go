@@ -0,0 +1,97 @@
+package nmdc
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strconv"
+
+	"github.com/direct-connect/go-dc/keyprint"
+	"github.com/direct-connect/go-dc/keyprint/tlskp"
+)
+
+// DialHub connects to the NMDC hub at a given address. If the address has nmdcs:// scheme,
+// the connection is wrapped in TLS.
+//
+// If the address contains a keyprint (kp= query parameter), the hub certificate is verified
+// against it instead of the certificate chain, since most hubs use self-signed certificates.
+// Otherwise, the certificate chain is verified as usual. To connect to a hub with a self-signed
+// certificate and no keyprint, the verification must be disabled explicitly with InsecureSkipVerify.
+// See tlskp.Client.
+func DialHub(ctx context.Context, addr string, conf *tls.Config) (net.Conn, error) {
+	u, err := ParseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(u.Hostname(), strconv.Itoa(DefaultPort))
+	}
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != SchemeNMDCS {
+		return c, nil
+	}
+	tc, err := tlskp.Client(ctx, c, u.Hostname(), keyprint.FromURL(u), conf)
+	if err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// SupportsTLS checks if the user advertises TLS support for C-C connections in MyINFO.
+func (m *MyINFO) SupportsTLS() bool {
+	return m.Flag.IsSet(FlagTLS)
+}
+
+// UseTLS checks if C-C connection between two users should use TLS.
+// It returns true only if both sides advertise TLS support.
+func UseTLS(self, peer *MyINFO) bool {
+	return self.SupportsTLS() && peer.SupportsTLS()
+}
+
+// DialPeer connects to the peer address specified in ConnectToMe. If the request is
+// marked as secure (with "S" suffix), the connection is wrapped in TLS.
+//
+// C-C certificates are usually self-signed, thus if the config is nil, the certificate is not verified.
+// If the config has no ServerName, it is set to the host of the peer address.
+func DialPeer(ctx context.Context, m *ConnectToMe, conf *tls.Config) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(m.Address)
+	if err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", m.Address)
+	if err != nil {
+		return nil, err
+	}
+	if !m.Secure {
+		return c, nil
+	}
+	if conf == nil {
+		conf = &tls.Config{InsecureSkipVerify: true}
+	}
+	tc, err := tlskp.Client(ctx, c, host, "", conf)
+	if err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// AcceptPeer prepares an incoming C-C connection that was requested by a ConnectToMe
+// sent by this client. If the request was secure, the server side of a TLS handshake is performed.
+// The connection is closed if the handshake fails.
+func AcceptPeer(ctx context.Context, c net.Conn, secure bool, conf *tls.Config) (net.Conn, error) {
+	if !secure {
+		return c, nil
+	}
+	tc := tls.Server(c, conf)
+	if err := tlskp.Handshake(ctx, tc); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return tc, nil
+}
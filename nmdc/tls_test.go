@@ -0,0 +1,187 @@
+package nmdc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dc/keyprint"
+	"github.com/direct-connect/go-dc/keyprint/tlskp"
+)
+
+func testCert(t testing.TB) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"go-dc"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func testTLSServer(t *testing.T, cert tls.Certificate) net.Listener {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	require.NoError(t, err)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				_, _ = c.Write([]byte("$Lock EXTENDEDPROTOCOL_test Pk=test|"))
+				_ = c.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	return l
+}
+
+func TestDialHubTLS(t *testing.T) {
+	cert := testCert(t)
+	l := testTLSServer(t, cert)
+	defer l.Close()
+
+	kp := keyprint.FromCertificate(cert)[0]
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := DialHub(ctx, SchemeNMDCS+"://"+l.Addr().String()+"?kp="+kp, nil)
+	require.NoError(t, err)
+	var lock Lock
+	err = NewReader(c).ReadMsgTo(&lock)
+	require.NoError(t, err)
+	require.Equal(t, "_test", lock.Lock)
+	_ = c.Close()
+
+	_, err = DialHub(ctx, SchemeNMDCS+"://"+l.Addr().String()+"?kp=SHA256/AAAA", nil)
+	require.IsType(t, &tlskp.ErrInvalidKeyPrint{}, err)
+
+	// self-signed certificate is rejected without a keyprint
+	_, err = DialHub(ctx, SchemeNMDCS+"://"+l.Addr().String(), nil)
+	require.Error(t, err)
+
+	// unless the verification is disabled explicitly
+	c, err = DialHub(ctx, SchemeNMDCS+"://"+l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	_ = c.Close()
+}
+
+func TestDialPeerTLS(t *testing.T) {
+	cert := testCert(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer c.Close()
+		c, err = AcceptPeer(ctx, c, true, &tls.Config{Certificates: []tls.Certificate{cert}})
+		if err != nil {
+			errc <- err
+			return
+		}
+		_, err = c.Write([]byte("$MyNick bob|"))
+		errc <- err
+	}()
+
+	self := &MyINFO{Flag: FlagStatusNormal | FlagTLS}
+	peer := &MyINFO{Flag: FlagStatusNormal | FlagTLSDownload}
+	require.True(t, UseTLS(self, peer))
+	require.False(t, UseTLS(self, &MyINFO{Flag: FlagStatusNormal}))
+
+	ctm := &ConnectToMe{Targ: "alice", Address: l.Addr().String(), Secure: UseTLS(self, peer)}
+	c, err := DialPeer(ctx, ctm, nil)
+	require.NoError(t, err)
+	defer c.Close()
+	_, ok := c.(*tls.Conn)
+	require.True(t, ok)
+
+	var nick MyNick
+	err = NewReader(c).ReadMsgTo(&nick)
+	require.NoError(t, err)
+	require.Equal(t, Name("bob"), nick.Name)
+	require.NoError(t, <-errc)
+}
+
+func TestDialPeerServerName(t *testing.T) {
+	cert := testCert(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		_, _ = AcceptPeer(ctx, c, true, &tls.Config{Certificates: []tls.Certificate{cert}})
+	}()
+
+	x, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(x)
+
+	// the certificate is verified against the peer address
+	ctm := &ConnectToMe{Targ: "alice", Address: l.Addr().String(), Secure: true}
+	c, err := DialPeer(ctx, ctm, &tls.Config{RootCAs: roots})
+	require.NoError(t, err)
+	_ = c.Close()
+}
+
+func TestAcceptPeerClose(t *testing.T) {
+	cert := testCert(t)
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := AcceptPeer(ctx, c1, true, &tls.Config{Certificates: []tls.Certificate{cert}})
+		errc <- err
+	}()
+	// not a TLS handshake
+	_, _ = c2.Write([]byte("$MyNick bob|"))
+	require.Error(t, <-errc)
+
+	// the connection must be closed by AcceptPeer
+	_ = c2.SetReadDeadline(time.Now().Add(time.Second))
+	var err error
+	buf := make([]byte, 1024)
+	for err == nil {
+		_, err = c2.Read(buf)
+	}
+	require.Equal(t, io.EOF, err)
+}
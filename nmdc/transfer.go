@@ -0,0 +1,149 @@
+package nmdc
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrFileNotAvailable is the error sent to the downloader when the requested file is not shared.
+var ErrFileNotAvailable = errors.New("File Not Available")
+
+// OpenFunc opens a shared file for legacy transfer commands. The path uses '\' as a separator.
+// It should return os.ErrNotExist if the file is not shared. If the returned reader implements
+// io.Closer, it will be closed after the transfer.
+type OpenFunc func(path string) (r io.ReadSeeker, size uint64, err error)
+
+// ReadBlock returns a reader for the binary data that follows Sending or FileLength messages.
+// If the data is compressed (GetZBlock), it will be inflated. The caller must close the reader.
+func (r *Reader) ReadBlock(size uint64, compressed bool) (io.ReadCloser, error) {
+	if compressed {
+		return r.BinaryZlib(size)
+	}
+	return r.Binary(size)
+}
+
+// WriteBlock writes n bytes of the binary data that follows Sending or FileLength messages.
+// If compressed is set, the data is compressed with zlib. The writer is flushed after the write.
+//
+// If the reader has less than n bytes, io.ErrUnexpectedEOF is returned.
+func (w *Writer) WriteBlock(r io.Reader, n uint64, compressed bool) error {
+	bw, err := w.Binary(compressed)
+	if err != nil {
+		return err
+	}
+	if err = copyBlock(bw, io.LimitReader(r, int64(n)), n); err != nil {
+		_ = bw.Close()
+		return err
+	}
+	return bw.Close()
+}
+
+// copyBlock copies exactly n bytes from r to w.
+func copyBlock(w io.Writer, r io.Reader, n uint64) error {
+	m, err := io.Copy(w, r)
+	if err != nil {
+		return err
+	} else if uint64(m) != n {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// ServeLegacyUpload serves a single legacy download request: Get, GetBlock, UGetBlock, GetZBlock or UGetZBlock.
+// For Get, it will respond with FileLength and will wait for Send from the downloader.
+//
+// If the file cannot be opened, an error is sent to the peer and the function returns nil.
+func ServeLegacyUpload(r *Reader, w *Writer, req Message, open OpenFunc) error {
+	switch req := req.(type) {
+	case *Get:
+		return serveGet(r, w, req, open)
+	case *GetBlock:
+		return serveBlock(w, &req.BlockRequest, false, open)
+	case *UGetBlock:
+		return serveBlock(w, &req.BlockRequest, false, open)
+	case *GetZBlock:
+		return serveBlock(w, &req.BlockRequest, true, open)
+	case *UGetZBlock:
+		return serveBlock(w, &req.BlockRequest, true, open)
+	}
+	return errors.New("nmdc: unsupported transfer request: " + req.Type())
+}
+
+func openLegacy(path string, start uint64, open OpenFunc) (io.ReadSeeker, uint64, error) {
+	f, size, err := open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if start > size {
+		closeFile(f)
+		return nil, 0, errors.New("invalid offset")
+	}
+	if _, err = f.Seek(int64(start), io.SeekStart); err != nil {
+		closeFile(f)
+		return nil, 0, err
+	}
+	return f, size, nil
+}
+
+func closeFile(f io.ReadSeeker) {
+	if c, ok := f.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
+
+func legacyError(err error) error {
+	if os.IsNotExist(err) {
+		return ErrFileNotAvailable
+	}
+	return err
+}
+
+func serveGet(r *Reader, w *Writer, req *Get, open OpenFunc) error {
+	start := req.Start
+	if start > 0 {
+		start-- // 1-based
+	}
+	f, size, err := openLegacy(req.Path, start, open)
+	if err != nil {
+		if err = w.WriteMsg(&Error{Err: legacyError(err)}); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+	defer closeFile(f)
+	if err = w.WriteMsg(&FileLength{Size: size}); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = r.ReadMsgTo(&Send{}); err != nil {
+		return err
+	}
+	return w.WriteBlock(f, size-start, false)
+}
+
+func serveBlock(w *Writer, req *BlockRequest, compressed bool, open OpenFunc) error {
+	f, size, err := openLegacy(req.Path, req.Start, open)
+	if err == nil {
+		defer closeFile(f)
+		if req.Bytes >= 0 && req.Start+uint64(req.Bytes) > size {
+			err = errors.New("invalid block size")
+		}
+	}
+	if err != nil {
+		if err = w.WriteMsg(&Failed{Err: legacyError(err)}); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+	n := size - req.Start
+	if req.Bytes >= 0 {
+		n = uint64(req.Bytes)
+	}
+	if err = w.WriteMsg(&Sending{Bytes: int64(n)}); err != nil {
+		return err
+	}
+	return w.WriteBlock(f, n, compressed)
+}
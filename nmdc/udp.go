@@ -0,0 +1,146 @@
+package nmdc
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync/atomic"
+)
+
+// maxUDPPacket is the max size of the UDP datagram that will be accepted.
+const maxUDPPacket = 64 * 1024
+
+var errUDPTarget = errors.New("nmdc: SR sent over UDP should not have a target")
+
+// ListenUDP starts listening for NMDC messages on a given UDP address.
+// It is used by active clients to receive search results ($SR).
+func ListenUDP(addr string) (*UDPConn, error) {
+	c, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewUDPConn(c), nil
+}
+
+// NewUDPConn wraps a packet connection to read and write NMDC messages.
+func NewUDPConn(c net.PacketConn) *UDPConn {
+	return &UDPConn{c: c}
+}
+
+// UDPConn is a connection used by active NMDC clients to send and receive
+// search results and other messages over UDP. Each datagram contains a single message.
+//
+// Reads are not safe for concurrent use, while writes are.
+type UDPConn struct {
+	c net.PacketConn
+
+	enc atomic.Value // *TextEncoder
+	dec atomic.Value // *TextDecoder
+
+	rbuf []byte
+}
+
+// LocalAddr returns a local address of the connection.
+func (c *UDPConn) LocalAddr() net.Addr {
+	return c.c.LocalAddr()
+}
+
+// Close the connection.
+func (c *UDPConn) Close() error {
+	return c.c.Close()
+}
+
+// Encoder returns current text encoder.
+func (c *UDPConn) Encoder() *TextEncoder {
+	enc, _ := c.enc.Load().(*TextEncoder)
+	return enc
+}
+
+// SetEncoder sets a text encoding used to write messages.
+func (c *UDPConn) SetEncoder(enc *TextEncoder) {
+	c.enc.Store(enc)
+}
+
+// Decoder returns current text decoder.
+func (c *UDPConn) Decoder() *TextDecoder {
+	dec, _ := c.dec.Load().(*TextDecoder)
+	return dec
+}
+
+// SetDecoder sets a text decoder used to read messages.
+func (c *UDPConn) SetDecoder(dec *TextDecoder) {
+	c.dec.Store(dec)
+}
+
+// ReadMsg reads and decodes a single datagram. It returns the message and the address of the sender.
+//
+// If the datagram cannot be decoded, ErrProtocolViolation is returned. Datagrams may come from any host,
+// thus the caller may continue reading after this error.
+func (c *UDPConn) ReadMsg() (Message, net.Addr, error) {
+	if c.rbuf == nil {
+		c.rbuf = make([]byte, maxUDPPacket)
+	}
+	for {
+		n, addr, err := c.c.ReadFrom(c.rbuf)
+		if err != nil {
+			return nil, addr, err
+		}
+		data := bytes.TrimRight(c.rbuf[:n], "\r\n")
+		if len(data) == 0 {
+			continue
+		}
+		if data[len(data)-1] != Delimiter {
+			// some clients omit the delimiter
+			data = append(data, Delimiter)
+		}
+		m, err := Unmarshal(c.Decoder(), data)
+		if err != nil {
+			return nil, addr, &ErrProtocolViolation{Err: err}
+		}
+		return m, addr, nil
+	}
+}
+
+// ReadSR reads a single search result. Datagrams with other message types and malformed datagrams are skipped.
+func (c *UDPConn) ReadSR() (*SR, net.Addr, error) {
+	for {
+		m, addr, err := c.ReadMsg()
+		if _, ok := err.(*ErrProtocolViolation); ok {
+			continue
+		} else if err != nil {
+			return nil, addr, err
+		}
+		if sr, ok := m.(*SR); ok {
+			return sr, addr, nil
+		}
+	}
+}
+
+// WriteMsg encodes and sends the message as a single datagram to a given address.
+func (c *UDPConn) WriteMsg(addr net.Addr, m Message) error {
+	if sr, ok := m.(*SR); ok && sr.To != "" {
+		return errUDPTarget
+	}
+	data, err := Marshal(c.Encoder(), m)
+	if err != nil {
+		return err
+	}
+	_, err = c.c.WriteTo(data, addr)
+	return err
+}
+
+// WriteSR sends a search result to an active searcher. The address should be
+// in the ip:port form, as specified in Search.Address.
+func (c *UDPConn) WriteSR(addr string, sr *SR) error {
+	uaddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	return c.WriteMsg(uaddr, sr)
+}
+
+// IsActive checks if the search was sent by an active user. Results for active
+// searches should be sent over UDP to the Address.
+func (m *Search) IsActive() bool {
+	return m.Address != ""
+}
@@ -0,0 +1,86 @@
+package nmdc
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/charmap"
+)
+
+func TestUDPSR(t *testing.T) {
+	srv, err := ListenUDP("127.0.0.1:0")
+	require.NoError(t, err)
+	defer srv.Close()
+	srv.SetDecoder(charmap.Windows1251.NewDecoder())
+
+	cli, err := ListenUDP("127.0.0.1:0")
+	require.NoError(t, err)
+	defer cli.Close()
+	cli.SetEncoder(charmap.Windows1251.NewEncoder())
+
+	sr := &SR{
+		From:       "bob",
+		Path:       []string{"Музыка", "song.mp3"},
+		Size:       1024,
+		FreeSlots:  1,
+		TotalSlots: 3,
+		TTH:        getTHPointer("TO32WPD6AQE7VA7654HEAM5GKFQGIL7F2BEKFNA"),
+		HubAddress: "127.0.0.1:411",
+	}
+	err = cli.WriteSR(srv.LocalAddr().String(), sr)
+	require.NoError(t, err)
+
+	got, addr, err := srv.ReadSR()
+	require.NoError(t, err)
+	require.Equal(t, sr, got)
+	require.Equal(t, cli.LocalAddr().String(), addr.String())
+
+	err = cli.WriteMsg(srv.LocalAddr(), &SR{From: "bob", Path: []string{"a"}, To: "alice"})
+	require.Equal(t, errUDPTarget, err)
+}
+
+func TestUDPNoDelimiter(t *testing.T) {
+	srv, err := ListenUDP("127.0.0.1:0")
+	require.NoError(t, err)
+	defer srv.Close()
+
+	c, err := net.Dial("udp", srv.LocalAddr().String())
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.Write([]byte("$SR bob dir\\file\x05100 1/2\x05TTH:TO32WPD6AQE7VA7654HEAM5GKFQGIL7F2BEKFNA (127.0.0.1:411)"))
+	require.NoError(t, err)
+
+	sr, _, err := srv.ReadSR()
+	require.NoError(t, err)
+	require.Equal(t, []string{"dir", "file"}, sr.Path)
+	require.Equal(t, uint64(100), sr.Size)
+}
+
+func TestUDPMalformed(t *testing.T) {
+	srv, err := ListenUDP("127.0.0.1:0")
+	require.NoError(t, err)
+	defer srv.Close()
+
+	c, err := net.Dial("udp", srv.LocalAddr().String())
+	require.NoError(t, err)
+	defer c.Close()
+	send := func(s string) {
+		_, err := c.Write([]byte(s))
+		require.NoError(t, err)
+	}
+
+	send("$SR garbage|")
+	send("$SR bob file\x05100 1/2\x05TTH:TO32WPD6AQE7VA7654HEAM5GKFQGIL7F2BEKFNA (127.0.0.1:411)|")
+	_, _, err = srv.ReadMsg()
+	require.IsType(t, &ErrProtocolViolation{}, err)
+	m, _, err := srv.ReadMsg()
+	require.NoError(t, err)
+	require.Equal(t, []string{"file"}, m.(*SR).Path)
+
+	send("$SR garbage|")
+	send("$SR bob file\x05100 1/2\x05TTH:TO32WPD6AQE7VA7654HEAM5GKFQGIL7F2BEKFNA (127.0.0.1:411)|")
+	sr, _, err := srv.ReadSR()
+	require.NoError(t, err)
+	require.Equal(t, []string{"file"}, sr.Path)
+}
@@ -0,0 +1,300 @@
+package nmdc
+
+import (
+	"sort"
+	"sync"
+)
+
+// User is a snapshot of the user state tracked by the UserList.
+type User struct {
+	Name string
+	// Info is the last MyINFO received for the user. It is nil if the info was not received yet.
+	// The value is shared between snapshots and must not be modified.
+	Info *MyINFO
+	// IP is the address of the user, as reported by UserIP.
+	IP string
+	// Op is set if the user is listed in the last OpList.
+	Op bool
+	// Bot is set if the user is listed in the last BotList.
+	Bot bool
+	// ExtJSON is the last additional info received with ExtJSON message.
+	// The value is shared between snapshots and must not be modified.
+	ExtJSON *ExtJSONInfo
+}
+
+// UserEventType is a type of an event emitted by the UserList.
+type UserEventType int
+
+const (
+	UserJoined  = UserEventType(1)
+	UserUpdated = UserEventType(2)
+	UserParted  = UserEventType(3)
+)
+
+func (t UserEventType) String() string {
+	switch t {
+	case UserJoined:
+		return "join"
+	case UserUpdated:
+		return "update"
+	case UserParted:
+		return "part"
+	}
+	return "unknown"
+}
+
+// UserEvent is emitted by the UserList each time a user joins, leaves or changes its state.
+type UserEvent struct {
+	Type UserEventType
+	User User
+}
+
+// NewUserList creates an empty list of users.
+//
+// The list is usually attached to the Reader with OnMessage:
+//
+//	list := nmdc.NewUserList()
+//	r.OnMessage(list.OnMessage)
+func NewUserList() *UserList {
+	return &UserList{
+		users: make(map[string]*User),
+	}
+}
+
+// UserList maintains a list of users of a single hub by consuming NMDC messages
+// such as MyINFO, Quit, OpList, BotList, NickList, Hello, UserIP and ExtJSON.
+//
+// Hub may either send MyINFO of all users (NoGetINFO extension), or it may only
+// send the names and expect the client to request MyINFO with GetINFO. In the second
+// case the list will call a hook registered by OnGetINFO for each new user.
+// Note that UserJoined event may be emitted before MyINFO of the user is received;
+// an UserUpdated event will follow when it arrives.
+//
+// All methods are safe for concurrent use, except the hook registration methods.
+type UserList struct {
+	mu        sync.RWMutex
+	users     map[string]*User
+	noGetINFO bool
+	extJSON   bool
+
+	onGetINFO []func(name string) error
+	onEvent   []func(e UserEvent)
+}
+
+// SetNoGetINFO should be called to indicate that NoGetINFO extension was negotiated with the hub.
+// In this case the hub will send MyINFO for all users without any GetINFO requests.
+func (l *UserList) SetNoGetINFO(v bool) {
+	l.mu.Lock()
+	l.noGetINFO = v
+	l.mu.Unlock()
+}
+
+// SetExtJSON should be called to indicate that ExtJSON2 extension was negotiated with the hub.
+// ExtJSON messages are ignored until it is set.
+func (l *UserList) SetExtJSON(v bool) {
+	l.mu.Lock()
+	l.extJSON = v
+	l.mu.Unlock()
+}
+
+// OnGetINFO registers a hook that is called when MyINFO for a user must be requested
+// from the hub. The hook will only be called if NoGetINFO was not set.
+// Usually the hook sends GetINFO message to the hub.
+//
+// This method is not concurrent-safe.
+func (l *UserList) OnGetINFO(fnc func(name string) error) {
+	l.onGetINFO = append(l.onGetINFO, fnc)
+}
+
+// OnEvent registers a hook that is called each time a user joins, leaves or is updated.
+// The hook is called from the goroutine that passes messages to the list.
+//
+// This method is not concurrent-safe.
+func (l *UserList) OnEvent(fnc func(e UserEvent)) {
+	l.onEvent = append(l.onEvent, fnc)
+}
+
+// Len returns the number of users in the list.
+func (l *UserList) Len() int {
+	l.mu.RLock()
+	n := len(l.users)
+	l.mu.RUnlock()
+	return n
+}
+
+// User returns a snapshot of a user with a given name.
+func (l *UserList) User(name string) (User, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	u, ok := l.users[name]
+	if !ok {
+		return User{}, false
+	}
+	return *u, true
+}
+
+// Users returns a snapshot of all users, sorted by name.
+func (l *UserList) Users() []User {
+	l.mu.RLock()
+	list := make([]User, 0, len(l.users))
+	for _, u := range l.users {
+		list = append(list, *u)
+	}
+	l.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Reset removes all users from the list without emitting any events.
+func (l *UserList) Reset() {
+	l.mu.Lock()
+	l.users = make(map[string]*User)
+	l.mu.Unlock()
+}
+
+// OnMessage updates the list according to the message. Messages that are not related
+// to the user list are ignored.
+//
+// OpList and BotList are treated as full lists: the flag is set for all listed users
+// and is cleared for all other users.
+//
+// The method has the same signature as a Reader.OnMessage hook. It returns true
+// to allow other hooks to process the message, or an error returned by the OnGetINFO hook.
+func (l *UserList) OnMessage(m Message) (bool, error) {
+	var (
+		events  []UserEvent
+		getInfo []string
+	)
+	l.mu.Lock()
+	switch m := m.(type) {
+	case *MyINFO:
+		info := m.clone()
+		u, ok := l.users[m.Name]
+		if !ok {
+			u = &User{Name: m.Name, Info: info}
+			l.users[m.Name] = u
+			events = append(events, UserEvent{Type: UserJoined, User: *u})
+		} else {
+			u.Info = info
+			events = append(events, UserEvent{Type: UserUpdated, User: *u})
+		}
+	case *Quit:
+		if u, ok := l.users[string(m.Name)]; ok {
+			delete(l.users, u.Name)
+			events = append(events, UserEvent{Type: UserParted, User: *u})
+		}
+	case *Hello:
+		// with NoGetINFO, the hub will send MyINFO right after Hello
+		if !l.noGetINFO {
+			events, getInfo = l.addNames(events, getInfo, []string{string(m.Name)}, nil)
+		}
+	case *NickList:
+		events, getInfo = l.addNames(events, getInfo, m.Names, nil)
+	case *OpList:
+		events, getInfo = l.setFlag(events, getInfo, m.Names, func(u *User) *bool { return &u.Op })
+	case *BotList:
+		events, getInfo = l.setFlag(events, getInfo, m.Names, func(u *User) *bool { return &u.Bot })
+	case *ExtJSON:
+		if !l.extJSON {
+			break
+		}
+		if u, ok := l.users[m.Name]; ok {
+			u.ExtJSON = m.Info.clone()
+			events = append(events, UserEvent{Type: UserUpdated, User: *u})
+		}
+	case *UserIP:
+		for _, a := range m.List {
+			u, ok := l.users[a.Name]
+			if !ok || u.IP == a.IP {
+				continue
+			}
+			u.IP = a.IP
+			events = append(events, UserEvent{Type: UserUpdated, User: *u})
+		}
+	}
+	l.mu.Unlock()
+
+	for _, name := range getInfo {
+		for _, fnc := range l.onGetINFO {
+			if err := fnc(name); err != nil {
+				return false, err
+			}
+		}
+	}
+	for _, e := range events {
+		for _, fnc := range l.onEvent {
+			fnc(e)
+		}
+	}
+	return true, nil
+}
+
+// addNames adds users by name and applies an optional update function for each user.
+// It returns a list of events and a list of users that need a GetINFO request.
+func (l *UserList) addNames(events []UserEvent, getInfo []string, names []string, update func(u *User) bool) ([]UserEvent, []string) {
+	for _, name := range names {
+		u, ok := l.users[name]
+		if !ok {
+			u = &User{Name: name}
+			if update != nil {
+				update(u)
+			}
+			l.users[name] = u
+			events = append(events, UserEvent{Type: UserJoined, User: *u})
+			if !l.noGetINFO {
+				getInfo = append(getInfo, name)
+			}
+			continue
+		}
+		if update != nil && update(u) {
+			events = append(events, UserEvent{Type: UserUpdated, User: *u})
+		}
+	}
+	return events, getInfo
+}
+
+// setFlag sets the flag for all listed users and clears it for users that are not in the list.
+// Users that are not known yet are added to the list.
+func (l *UserList) setFlag(events []UserEvent, getInfo []string, names []string, flag func(u *User) *bool) ([]UserEvent, []string) {
+	listed := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		listed[name] = struct{}{}
+	}
+	var cleared []*User
+	for name, u := range l.users {
+		if _, ok := listed[name]; ok {
+			continue
+		}
+		if f := flag(u); *f {
+			*f = false
+			cleared = append(cleared, u)
+		}
+	}
+	sort.Slice(cleared, func(i, j int) bool {
+		return cleared[i].Name < cleared[j].Name
+	})
+	for _, u := range cleared {
+		events = append(events, UserEvent{Type: UserUpdated, User: *u})
+	}
+	return l.addNames(events, getInfo, names, func(u *User) bool {
+		if f := flag(u); !*f {
+			*f = true
+			return true
+		}
+		return false
+	})
+}
+
+// clone makes a deep copy of the MyINFO.
+func (m *MyINFO) clone() *MyINFO {
+	m2 := *m
+	if m.Extra != nil {
+		m2.Extra = make(map[string]string, len(m.Extra))
+		for k, v := range m.Extra {
+			m2.Extra[k] = v
+		}
+	}
+	return &m2
+}
@@ -0,0 +1,122 @@
+package nmdc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readUserList(t *testing.T, l *UserList, input string) {
+	r := NewReader(strings.NewReader(input))
+	r.OnMessage(l.OnMessage)
+	for {
+		_, err := r.ReadMsg()
+		if err != nil {
+			require.Equal(t, "EOF", err.Error())
+			return
+		}
+	}
+}
+
+func TestUserListNoGetINFO(t *testing.T) {
+	l := NewUserList()
+	l.SetNoGetINFO(true)
+	l.OnGetINFO(func(name string) error {
+		t.Fatal("unexpected GetINFO for", name)
+		return nil
+	})
+	var events []string
+	l.OnEvent(func(e UserEvent) {
+		events = append(events, e.Type.String()+" "+e.User.Name)
+	})
+	readUserList(t, l, ""+
+		"$Hello alice|"+
+		"$MyINFO $ALL alice desc<++ V:0.868,M:A,H:1/0/0,S:3>$ $LAN(T1)\x01$$100$|"+
+		"$MyINFO $ALL bob <++ V:0.868,M:P,H:1/0/0,S:3>$ $LAN(T1)\x01$$200$|"+
+		"$OpList bob$$|"+
+		"$BotList bot$$|"+
+		"$UserIP alice 10.0.0.1$$|"+
+		"$Quit bob|",
+	)
+	require.Equal(t, []string{
+		"join alice",
+		"join bob",
+		"update bob",
+		"join bot",
+		"update alice",
+		"part bob",
+	}, events)
+
+	users := l.Users()
+	require.Len(t, users, 2)
+	require.Equal(t, "alice", users[0].Name)
+	require.Equal(t, "10.0.0.1", users[0].IP)
+	require.NotNil(t, users[0].Info)
+	require.Equal(t, uint64(100), users[0].Info.ShareSize)
+	require.Equal(t, "bot", users[1].Name)
+	require.True(t, users[1].Bot)
+	require.Nil(t, users[1].Info)
+
+	_, ok := l.User("bob")
+	require.False(t, ok)
+}
+
+func TestUserListGetINFO(t *testing.T) {
+	l := NewUserList()
+	var req []string
+	l.OnGetINFO(func(name string) error {
+		req = append(req, name)
+		return nil
+	})
+	readUserList(t, l, ""+
+		"$NickList alice$$bob$$|"+
+		"$OpList bob$$|"+
+		"$MyINFO $ALL alice desc<++ V:0.868,M:A,H:1/0/0,S:3>$ $LAN(T1)\x01$$100$|"+
+		"$Hello carol|",
+	)
+	require.Equal(t, []string{"alice", "bob", "carol"}, req)
+	require.Equal(t, 3, l.Len())
+
+	u, ok := l.User("bob")
+	require.True(t, ok)
+	require.True(t, u.Op)
+	require.Nil(t, u.Info)
+
+	u, ok = l.User("alice")
+	require.True(t, ok)
+	require.NotNil(t, u.Info)
+}
+
+func TestUserListOpListFull(t *testing.T) {
+	l := NewUserList()
+	l.SetNoGetINFO(true)
+	var events []string
+	l.OnEvent(func(e UserEvent) {
+		events = append(events, e.Type.String()+" "+e.User.Name)
+	})
+	readUserList(t, l, ""+
+		"$NickList alice$$bob$$carol$$|"+
+		"$OpList alice$$bob$$|"+
+		"$BotList carol$$|"+
+		"$OpList bob$$|"+
+		"$BotList $$|",
+	)
+	require.Equal(t, []string{
+		"join alice",
+		"join bob",
+		"join carol",
+		"update alice",
+		"update bob",
+		"update carol",
+		"update alice",
+		"update carol",
+	}, events)
+
+	u, _ := l.User("alice")
+	require.False(t, u.Op)
+	u, _ = l.User("bob")
+	require.True(t, u.Op)
+	u, _ = l.User("carol")
+	require.False(t, u.Bot)
+}
@@ -0,0 +1,280 @@
+package share
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+// RefreshError is returned by Refresh if some of the shared directories cannot be scanned.
+type RefreshError struct {
+	// Roots maps the virtual names of failed roots to the scan errors.
+	Roots map[string]error
+}
+
+func (e *RefreshError) Error() string {
+	names := make([]string, 0, len(e.Roots))
+	for name := range e.Roots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf strings.Builder
+	buf.WriteString("share: cannot scan ")
+	for i, name := range names {
+		if i != 0 {
+			buf.WriteString("; ")
+		}
+		fmt.Fprintf(&buf, "%q: %v", name, e.Roots[name])
+	}
+	return buf.String()
+}
+
+// Refresh scans all shared directories and hashes new or modified files.
+//
+// Files that cannot be read are skipped. If one of the roots cannot be read, it keeps its
+// previous state in the index, other roots are updated as usual, and RefreshError is returned.
+// If the context is canceled, the index is not changed.
+func (s *Share) Refresh(ctx context.Context) error {
+	s.refresh.Lock()
+	defer s.refresh.Unlock()
+
+	roots := s.Roots()
+	old := s.index()
+	idx := newIndex()
+	var rerr *RefreshError
+	for name, path := range roots {
+		prev := old.root(name)
+		if prev != nil && prev.real != path {
+			prev = nil
+		}
+		d, err := s.scanDir(ctx, name, path, prev)
+		if err != nil {
+			if e := ctx.Err(); e != nil {
+				return e
+			}
+			if rerr == nil {
+				rerr = &RefreshError{Roots: make(map[string]error)}
+			}
+			rerr.Roots[name] = err
+			if prev == nil {
+				continue
+			}
+			// the index is immutable, thus a copy is required to rebuild it
+			d = prev.clone()
+		}
+		idx.roots = append(idx.roots, d)
+	}
+	idx.build()
+	s.setIndex(idx)
+	if rerr != nil {
+		return rerr
+	}
+	return nil
+}
+
+// Watch polls shared directories and refreshes the share periodically, until the context is canceled.
+// File system notifications are not used, thus changes are only visible after the next refresh.
+//
+// Refresh errors don't stop the watch. If onErr is set, it is called for each failed refresh.
+func (s *Share) Watch(ctx context.Context, interval time.Duration, onErr func(err error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := s.Refresh(ctx); err != nil && ctx.Err() == nil && onErr != nil {
+			onErr(err)
+		}
+	}
+}
+
+// scanDir scans the directory recursively. The previous state of the directory is used to avoid rehashing.
+func (s *Share) scanDir(ctx context.Context, name, path string, prev *dirNode) (*dirNode, error) {
+	list, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	d := &dirNode{name: name, real: path}
+	for _, fi := range list {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		fname := fi.Name()
+		if s.conf.SkipHidden && strings.HasPrefix(fname, ".") {
+			continue
+		}
+		fpath := filepath.Join(path, fname)
+		switch {
+		case fi.IsDir():
+			sub, err := s.scanDir(ctx, fname, fpath, prev.dir(fname))
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				continue
+			}
+			d.dirs = append(d.dirs, sub)
+		case fi.Mode().IsRegular():
+			f, err := s.hashFile(ctx, fpath, fi, prev.file(fname))
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				continue
+			}
+			d.files = append(d.files, f)
+		}
+	}
+	return d, nil
+}
+
+// clone makes a copy of the directory tree without the computed sizes. File nodes are shared.
+func (d *dirNode) clone() *dirNode {
+	d2 := &dirNode{name: d.name, real: d.real}
+	if len(d.dirs) != 0 {
+		d2.dirs = make([]*dirNode, 0, len(d.dirs))
+		for _, sub := range d.dirs {
+			d2.dirs = append(d2.dirs, sub.clone())
+		}
+	}
+	d2.files = append([]*fileNode{}, d.files...)
+	return d2
+}
+
+func (s *Share) hashFile(ctx context.Context, path string, fi os.FileInfo, prev *fileNode) (*fileNode, error) {
+	f := &fileNode{name: fi.Name(), size: uint64(fi.Size()), mod: fi.ModTime()}
+	if prev != nil && prev.size == f.size && prev.mod.Equal(f.mod) {
+		f.tth = prev.tth
+		return f, nil
+	}
+	if s.conf.Cache != nil {
+		if h, ok := s.conf.Cache.Get(path, fi); ok {
+			f.tth = h
+			return f, nil
+		}
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	leaves, err := tiger.TreeLeaves(&ctxReader{ctx: ctx, r: file})
+	if err != nil {
+		return nil, err
+	}
+	f.tth = leaves.TreeHash()
+	if s.conf.Cache != nil {
+		// cache errors only affect the next refresh
+		_ = s.conf.Cache.Put(path, fi, f.tth, leaves)
+	}
+	return f, nil
+}
+
+// ctxReader stops reading when the context is canceled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// savedDir is a persisted form of dirNode.
+type savedDir struct {
+	Name  string      `json:"name"`
+	Path  string      `json:"path,omitempty"` // only for roots
+	Dirs  []savedDir  `json:"dirs,omitempty"`
+	Files []savedFile `json:"files,omitempty"`
+}
+
+// savedFile is a persisted form of fileNode.
+type savedFile struct {
+	Name string     `json:"name"`
+	Size uint64     `json:"size"`
+	Mod  time.Time  `json:"mod"`
+	TTH  tiger.Hash `json:"tth"`
+}
+
+func saveDir(d *dirNode) savedDir {
+	sd := savedDir{Name: d.name}
+	for _, sub := range d.dirs {
+		sd.Dirs = append(sd.Dirs, saveDir(sub))
+	}
+	for _, f := range d.files {
+		sd.Files = append(sd.Files, savedFile{Name: f.name, Size: f.size, Mod: f.mod, TTH: f.tth})
+	}
+	return sd
+}
+
+func loadDir(sd *savedDir, path string) *dirNode {
+	d := &dirNode{name: sd.Name, real: path}
+	for i := range sd.Dirs {
+		sub := &sd.Dirs[i]
+		d.dirs = append(d.dirs, loadDir(sub, filepath.Join(path, sub.Name)))
+	}
+	for _, f := range sd.Files {
+		d.files = append(d.files, &fileNode{name: f.Name, size: f.Size, mod: f.Mod, tth: f.TTH})
+	}
+	sort.Slice(d.dirs, func(i, j int) bool { return d.dirs[i].name < d.dirs[j].name })
+	sort.Slice(d.files, func(i, j int) bool { return d.files[i].name < d.files[j].name })
+	return d
+}
+
+// Save writes the index and the list of roots in JSON format. It can be restored with Load
+// to avoid rescanning and rehashing the share on startup.
+func (s *Share) Save(w io.Writer) error {
+	idx := s.index()
+	roots := make([]savedDir, 0, len(idx.roots))
+	for _, d := range idx.roots {
+		sd := saveDir(d)
+		sd.Path = d.real
+		roots = append(roots, sd)
+	}
+	return json.NewEncoder(w).Encode(roots)
+}
+
+// Load restores the index saved by Save and replaces the current roots. The next Refresh will only
+// hash files that were changed since the index was saved.
+func (s *Share) Load(r io.Reader) error {
+	var roots []savedDir
+	if err := json.NewDecoder(r).Decode(&roots); err != nil {
+		return err
+	}
+	s.refresh.Lock()
+	defer s.refresh.Unlock()
+	idx := newIndex()
+	names := make(map[string]string, len(roots))
+	for i := range roots {
+		sd := &roots[i]
+		if sd.Name == "" || strings.ContainsAny(sd.Name, `/\`) {
+			return errInvalidName
+		}
+		if _, ok := names[sd.Name]; ok {
+			return errRootExists
+		}
+		names[sd.Name] = sd.Path
+		idx.roots = append(idx.roots, loadDir(sd, sd.Path))
+	}
+	idx.build()
+	s.mu.Lock()
+	s.roots = names
+	s.mu.Unlock()
+	s.setIndex(idx)
+	return nil
+}
@@ -0,0 +1,238 @@
+package share
+
+import (
+	"strings"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/filelist"
+	"github.com/direct-connect/go-dc/nmdc"
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+var _ nmdc.SearchIndex = (*Share)(nil)
+
+// SearchTTH returns all files with a given TTH. It implements nmdc.SearchIndex.
+func (s *Share) SearchTTH(h nmdc.TTH) []nmdc.SearchEntry {
+	refs := s.index().byTTH[h]
+	out := make([]nmdc.SearchEntry, 0, len(refs))
+	for _, r := range refs {
+		tth := r.file.tth
+		out = append(out, nmdc.SearchEntry{Path: r.path, Size: r.file.size, TTH: &tth})
+	}
+	return out
+}
+
+// WalkSearch calls fnc for each file and directory in the share. It implements nmdc.SearchIndex.
+func (s *Share) WalkSearch(fnc func(e nmdc.SearchEntry) bool) {
+	s.index().walk(func(path []string, d *dirNode, f *fileNode) bool {
+		path = append([]string(nil), path...)
+		if f == nil {
+			return fnc(nmdc.SearchEntry{Path: path, IsDir: true})
+		}
+		tth := f.tth
+		return fnc(nmdc.SearchEntry{Path: path, Size: f.size, TTH: &tth})
+	})
+}
+
+// walk calls fnc for each directory and file in the index, until it returns false.
+// The path slice is only valid until fnc returns.
+func (idx *index) walk(fnc func(path []string, d *dirNode, f *fileNode) bool) {
+	var walkDir func(path []string, d *dirNode) bool
+	walkDir = func(path []string, d *dirNode) bool {
+		path = append(path, d.name)
+		if !fnc(path, d, nil) {
+			return false
+		}
+		for _, sub := range d.dirs {
+			if !walkDir(path, sub) {
+				return false
+			}
+		}
+		for _, f := range d.files {
+			if !fnc(append(path, f.name), d, f) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, d := range idx.roots {
+		if !walkDir(nil, d) {
+			return
+		}
+	}
+}
+
+// SearchNMDC evaluates NMDC search request against the share. See nmdc.SearchResults for details.
+func (s *Share) SearchNMDC(m *nmdc.Search, tmpl nmdc.SR, max int) []nmdc.SR {
+	return nmdc.SearchResults(s, m, tmpl, max)
+}
+
+// SearchADC evaluates ADC search request against the share. The token is copied to the results,
+// and the number of free slots should be set by the caller.
+//
+// Requests without a TTH must contain at least one search term.
+func (s *Share) SearchADC(req *adc.SearchRequest, max int) []adc.SearchResult {
+	if max <= 0 {
+		max = nmdc.MaxResultsActive
+	}
+	idx := s.index()
+	var out []adc.SearchResult
+	if req.TTH != nil {
+		for _, r := range idx.byTTH[*req.TTH] {
+			if !matchADCFile(req, r.file) {
+				continue
+			}
+			out = append(out, adc.SearchResult{
+				Token: req.Token, Path: "/" + strings.Join(r.path, "/"),
+				Size: int64(r.file.size), TTH: tthPtr(r.file.tth),
+			})
+			if len(out) >= max {
+				break
+			}
+		}
+		return out
+	}
+	terms := lowerTerms(req.And)
+	if len(terms) == 0 {
+		return nil
+	}
+	not := lowerTerms(req.Not)
+	idx.walk(func(path []string, d *dirNode, f *fileNode) bool {
+		if f == nil {
+			if !matchADCDir(req) {
+				return true
+			}
+		} else if !matchADCFile(req, f) {
+			return true
+		}
+		if !matchTerms(path, terms, not) {
+			return true
+		}
+		r := adc.SearchResult{Token: req.Token, Path: "/" + strings.Join(path, "/")}
+		if f == nil {
+			r.Path += "/"
+			r.Size = int64(d.size)
+		} else {
+			r.Size = int64(f.size)
+			r.TTH = tthPtr(f.tth)
+		}
+		out = append(out, r)
+		return len(out) < max
+	})
+	return out
+}
+
+func tthPtr(h tiger.Hash) *tiger.Hash {
+	return &h
+}
+
+func lowerTerms(arr []string) []string {
+	out := make([]string, 0, len(arr))
+	for _, s := range arr {
+		if s = strings.ToLower(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// matchADCDir checks if directories can match the request. Size and extension filters only apply to files.
+func matchADCDir(req *adc.SearchRequest) bool {
+	if req.Type == adc.FileTypeFile {
+		return false
+	}
+	return len(req.Ext) == 0 && req.Group == adc.ExtNone &&
+		req.Le == 0 && req.Ge == 0 && req.Eq == 0
+}
+
+// matchADCFile checks the file type, size and extension filters of the request.
+func matchADCFile(req *adc.SearchRequest, f *fileNode) bool {
+	if req.Type == adc.FileTypeDir {
+		return false
+	}
+	size := int64(f.size)
+	if req.Eq != 0 && size != req.Eq {
+		return false
+	}
+	if req.Le != 0 && size > req.Le {
+		return false
+	}
+	if req.Ge != 0 && size < req.Ge {
+		return false
+	}
+	ext := ""
+	if i := strings.LastIndexByte(f.name, '.'); i >= 0 {
+		ext = strings.ToLower(f.name[i+1:])
+	}
+	if len(req.Ext) != 0 || req.Group != adc.ExtNone {
+		ok := req.Group != adc.ExtNone && req.Group.Matches(f.name)
+		for _, e := range req.Ext {
+			if strings.EqualFold(e, ext) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	for _, e := range req.NoExt {
+		if strings.EqualFold(e, ext) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTerms checks that the path contains all terms and doesn't contain any of excluded terms.
+func matchTerms(path []string, terms, not []string) bool {
+	p := strings.ToLower(strings.Join(path, "/"))
+	for _, t := range terms {
+		if !strings.Contains(p, t) {
+			return false
+		}
+	}
+	for _, t := range not {
+		if strings.Contains(p, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// FileList generates the file list of the share. If the base path in the header is set,
+// only the content of a given directory is listed.
+func (s *Share) FileList(h filelist.Header) (*filelist.FileListing, error) {
+	idx := s.index()
+	l := &filelist.FileListing{Header: h}
+	if l.Version == 0 {
+		l.Version = filelist.Version
+	}
+	path := splitPath(h.Base)
+	if len(path) == 0 {
+		l.Base = "/"
+		for _, d := range idx.roots {
+			l.Dirs = append(l.Dirs, listDir(d))
+		}
+		return l, nil
+	}
+	d, f := idx.lookup(path)
+	if d == nil || f != nil {
+		return nil, ErrNotFound
+	}
+	l.Base = "/" + strings.Join(path, "/") + "/"
+	ld := listDir(d)
+	l.Dirs, l.Files = ld.Dirs, ld.Files
+	return l, nil
+}
+
+func listDir(d *dirNode) filelist.Directory {
+	ld := filelist.Directory{Name: d.name}
+	for _, sub := range d.dirs {
+		ld.Dirs = append(ld.Dirs, listDir(sub))
+	}
+	for _, f := range d.files {
+		ld.Files = append(ld.Files, filelist.File{Name: f.name, Size: f.size, TTH: f.tth})
+	}
+	return ld
+}
@@ -0,0 +1,362 @@
+// Package share implements an index of shared files.
+//
+// The index scans local directories, computes TTHs of the files and answers
+// search and file requests for both ADC and NMDC.
+//
+// Each shared directory (root) is visible under a virtual name, thus virtual paths
+// have the form /<root>/<dir>/<file>. NMDC uses '\' as a separator instead.
+package share
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/nmdc"
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+var (
+	// ErrNotFound is returned if the file is not in the share.
+	ErrNotFound = errors.New("share: file not found")
+
+	errInvalidName = errors.New("share: invalid root name")
+	errRootExists  = errors.New("share: root already exists")
+)
+
+// HashCache stores file hashes between refreshes and restarts.
+type HashCache interface {
+	// Get returns the TTH of the file, if the file wasn't changed since it was hashed.
+	Get(path string, fi os.FileInfo) (tiger.Hash, bool)
+	// Put stores the TTH and the leaves of the file.
+	Put(path string, fi os.FileInfo, tth tiger.Hash, leaves tiger.Leaves) error
+}
+
+// Config is an optional configuration for the share.
+type Config struct {
+	// Cache is used to avoid rehashing files. Files that are already in the index are not rehashed even
+	// without the cache, see Save and Load.
+	Cache HashCache
+	// SkipHidden skips files and directories that start with a dot.
+	SkipHidden bool
+}
+
+// New creates an empty share.
+func New(conf *Config) *Share {
+	s := &Share{
+		roots: make(map[string]string),
+		idx:   newIndex(),
+	}
+	if conf != nil {
+		s.conf = *conf
+	}
+	return s
+}
+
+// Share is an index of shared files. It's safe for concurrent use.
+type Share struct {
+	conf Config
+
+	// refresh serializes index updates
+	refresh sync.Mutex
+
+	mu       sync.RWMutex
+	roots    map[string]string // virtual name -> real path
+	idx      *index
+	onUpdate []func()
+}
+
+// AddRoot adds a shared directory with a given virtual name. The directory is scanned on the next Refresh.
+func (s *Share) AddRoot(name, path string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return errInvalidName
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.roots[name]; ok {
+		return errRootExists
+	}
+	s.roots[name] = path
+	return nil
+}
+
+// RemoveRoot removes a shared directory. Files are removed from the index on the next Refresh.
+func (s *Share) RemoveRoot(name string) {
+	s.mu.Lock()
+	delete(s.roots, name)
+	s.mu.Unlock()
+}
+
+// Roots returns a map of virtual root names to real paths.
+func (s *Share) Roots() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m := make(map[string]string, len(s.roots))
+	for k, v := range s.roots {
+		m[k] = v
+	}
+	return m
+}
+
+// OnUpdate registers a function that is called each time the index changes.
+// It can be used to update the share size reported to the hubs.
+func (s *Share) OnUpdate(fnc func()) {
+	s.mu.Lock()
+	s.onUpdate = append(s.onUpdate, fnc)
+	s.mu.Unlock()
+}
+
+func (s *Share) setIndex(idx *index) {
+	s.mu.Lock()
+	s.idx = idx
+	hooks := s.onUpdate
+	s.mu.Unlock()
+	for _, fnc := range hooks {
+		fnc()
+	}
+}
+
+func (s *Share) index() *index {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.idx
+}
+
+// Stats returns the total size and the number of files in the share.
+func (s *Share) Stats() (size uint64, files int) {
+	idx := s.index()
+	return idx.size, idx.files
+}
+
+// FillUserInfo sets share size and the number of files in ADC user info.
+func (s *Share) FillUserInfo(u *adc.UserInfo) {
+	size, files := s.Stats()
+	u.ShareSize = int64(size)
+	u.ShareFiles = files
+}
+
+// FillMyINFO sets share size in NMDC user info.
+func (s *Share) FillMyINFO(m *nmdc.MyINFO) {
+	m.ShareSize, _ = s.Stats()
+}
+
+// splitPath splits the virtual path into elements. Both '/' and '\' are accepted as separators.
+func splitPath(vpath string) []string {
+	return strings.FieldsFunc(vpath, func(r rune) bool {
+		return r == '/' || r == '\\'
+	})
+}
+
+// Resolve returns the real path of a shared file or directory.
+func (s *Share) Resolve(vpath string) (string, error) {
+	d, f := s.index().lookup(splitPath(vpath))
+	if d == nil {
+		return "", ErrNotFound
+	}
+	if f == nil {
+		return d.real, nil
+	}
+	return filepath.Join(d.real, f.name), nil
+}
+
+// VirtualPath returns the virtual path of a local file or directory, if it's shared.
+func (s *Share) VirtualPath(path string) (string, bool) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	idx := s.index()
+	for _, d := range idx.roots {
+		rel, err := filepath.Rel(d.real, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		elems := []string{d.name}
+		if rel != "." {
+			elems = append(elems, strings.Split(filepath.ToSlash(rel), "/")...)
+		}
+		if pd, _ := idx.lookup(elems); pd == nil {
+			return "", false
+		}
+		return "/" + strings.Join(elems, "/"), true
+	}
+	return "", false
+}
+
+// Open opens a shared file by the virtual path. The caller must close the file.
+func (s *Share) Open(vpath string) (*os.File, uint64, error) {
+	d, f := s.index().lookup(splitPath(vpath))
+	if f == nil {
+		return nil, 0, ErrNotFound
+	}
+	return openFile(filepath.Join(d.real, f.name))
+}
+
+// OpenTTH opens a shared file by its TTH. The caller must close the file.
+func (s *Share) OpenTTH(h tiger.Hash) (*os.File, uint64, error) {
+	refs := s.index().byTTH[h]
+	for _, r := range refs {
+		f, size, err := openFile(filepath.Join(r.dir.real, r.file.name))
+		if err == nil {
+			return f, size, nil
+		}
+	}
+	return nil, 0, ErrNotFound
+}
+
+// OpenLegacy opens a shared file for legacy NMDC transfer commands. It implements nmdc.OpenFunc.
+func (s *Share) OpenLegacy(path string) (io.ReadSeeker, uint64, error) {
+	f, size, err := s.Open(path)
+	if err == ErrNotFound {
+		return nil, 0, os.ErrNotExist
+	} else if err != nil {
+		return nil, 0, err
+	}
+	return f, size, nil
+}
+
+func openFile(path string) (*os.File, uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, 0, err
+	}
+	return f, uint64(fi.Size()), nil
+}
+
+// dirNode is a directory in the index.
+type dirNode struct {
+	name  string
+	real  string
+	size  uint64 // total size of all files
+	dirs  []*dirNode
+	files []*fileNode
+}
+
+// fileNode is a file in the index.
+type fileNode struct {
+	name string
+	size uint64
+	mod  time.Time
+	tth  tiger.Hash
+}
+
+// dir finds a subdirectory by name. Directories are sorted by name.
+func (d *dirNode) dir(name string) *dirNode {
+	if d == nil {
+		return nil
+	}
+	i := sort.Search(len(d.dirs), func(i int) bool {
+		return d.dirs[i].name >= name
+	})
+	if i < len(d.dirs) && d.dirs[i].name == name {
+		return d.dirs[i]
+	}
+	return nil
+}
+
+// file finds a file by name. Files are sorted by name.
+func (d *dirNode) file(name string) *fileNode {
+	if d == nil {
+		return nil
+	}
+	i := sort.Search(len(d.files), func(i int) bool {
+		return d.files[i].name >= name
+	})
+	if i < len(d.files) && d.files[i].name == name {
+		return d.files[i]
+	}
+	return nil
+}
+
+// fileRef is a reference to a file in the index.
+type fileRef struct {
+	path []string
+	dir  *dirNode
+	file *fileNode
+}
+
+// index is an immutable snapshot of the share.
+type index struct {
+	roots []*dirNode // sorted by name
+	byTTH map[tiger.Hash][]fileRef
+	size  uint64
+	files int
+}
+
+func newIndex() *index {
+	return &index{byTTH: make(map[tiger.Hash][]fileRef)}
+}
+
+func (idx *index) root(name string) *dirNode {
+	for _, d := range idx.roots {
+		if d.name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// build computes directory sizes and fills the TTH map.
+func (idx *index) build() {
+	sort.Slice(idx.roots, func(i, j int) bool {
+		return idx.roots[i].name < idx.roots[j].name
+	})
+	var walk func(path []string, d *dirNode)
+	walk = func(path []string, d *dirNode) {
+		path = append(path, d.name)
+		for _, sub := range d.dirs {
+			walk(path, sub)
+			d.size += sub.size
+		}
+		for _, f := range d.files {
+			d.size += f.size
+			idx.files++
+			fpath := make([]string, len(path)+1)
+			copy(fpath, path)
+			fpath[len(path)] = f.name
+			idx.byTTH[f.tth] = append(idx.byTTH[f.tth], fileRef{path: fpath, dir: d, file: f})
+		}
+	}
+	for _, d := range idx.roots {
+		walk(nil, d)
+		idx.size += d.size
+	}
+}
+
+// lookup finds a file or directory by the virtual path. If the path points to a file,
+// both the parent directory and the file are returned.
+func (idx *index) lookup(path []string) (*dirNode, *fileNode) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+	d := idx.root(path[0])
+	for i := 1; d != nil && i < len(path); i++ {
+		name := path[i]
+		if sub := d.dir(name); sub != nil {
+			d = sub
+			continue
+		}
+		if i == len(path)-1 {
+			if f := d.file(name); f != nil {
+				return d, f
+			}
+		}
+		return nil, nil
+	}
+	return d, nil
+}
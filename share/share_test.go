@@ -0,0 +1,288 @@
+package share
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/filelist"
+	"github.com/direct-connect/go-dc/nmdc"
+	"github.com/direct-connect/go-dc/tiger"
+)
+
+func writeFile(t testing.TB, path, data string) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(path, []byte(data), 0644)
+	require.NoError(t, err)
+}
+
+func tth(data string) tiger.Hash {
+	h, err := tiger.TreeHash(bytes.NewReader([]byte(data)))
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// testShare creates a share with the following structure:
+//
+//	/Music/Artist/song.mp3
+//	/Music/readme.txt
+//	/Video/movie.mkv
+func testShare(t *testing.T, conf *Config) (*Share, string) {
+	dir, err := ioutil.TempDir("", "share_")
+	require.NoError(t, err)
+
+	writeFile(t, filepath.Join(dir, "music", "Artist", "song.mp3"), "song data")
+	writeFile(t, filepath.Join(dir, "music", "readme.txt"), "readme")
+	writeFile(t, filepath.Join(dir, "music", ".hidden"), "hidden")
+	writeFile(t, filepath.Join(dir, "video", "movie.mkv"), "movie data!")
+
+	s := New(conf)
+	require.NoError(t, s.AddRoot("Music", filepath.Join(dir, "music")))
+	require.NoError(t, s.AddRoot("Video", filepath.Join(dir, "video")))
+	require.Error(t, s.AddRoot("Video", dir))
+	require.Error(t, s.AddRoot("a/b", dir))
+	err = s.Refresh(context.Background())
+	require.NoError(t, err)
+	return s, dir
+}
+
+func TestShare(t *testing.T) {
+	s, dir := testShare(t, &Config{SkipHidden: true})
+	defer os.RemoveAll(dir)
+
+	size, files := s.Stats()
+	require.Equal(t, uint64(9+6+11), size)
+	require.Equal(t, 3, files)
+
+	var u adc.UserInfo
+	s.FillUserInfo(&u)
+	require.Equal(t, int64(26), u.ShareSize)
+	require.Equal(t, 3, u.ShareFiles)
+
+	real, err := s.Resolve("/Music/Artist/song.mp3")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "music", "Artist", "song.mp3"), real)
+	_, err = s.Resolve("/Music/.hidden")
+	require.Equal(t, ErrNotFound, err)
+	_, err = s.Resolve("/Music/../video/movie.mkv")
+	require.Equal(t, ErrNotFound, err)
+
+	vpath, ok := s.VirtualPath(filepath.Join(dir, "music", "Artist"))
+	require.True(t, ok)
+	require.Equal(t, "/Music/Artist", vpath)
+	_, ok = s.VirtualPath(dir)
+	require.False(t, ok)
+
+	f, fsize, err := s.OpenLegacy(`Music\readme.txt`)
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), fsize)
+	f.(*os.File).Close()
+	_, _, err = s.OpenLegacy(`Music\missing.txt`)
+	require.True(t, os.IsNotExist(err))
+
+	f2, _, err := s.OpenTTH(tth("movie data!"))
+	require.NoError(t, err)
+	f2.Close()
+}
+
+func TestShareSearch(t *testing.T) {
+	s, dir := testShare(t, &Config{SkipHidden: true})
+	defer os.RemoveAll(dir)
+
+	song := tth("song data")
+	res := s.SearchADC(&adc.SearchRequest{Token: "t", TTH: &song}, 0)
+	require.Equal(t, []adc.SearchResult{
+		{Token: "t", Path: "/Music/Artist/song.mp3", Size: 9, TTH: &song},
+	}, res)
+
+	res = s.SearchADC(&adc.SearchRequest{And: []string{"artist"}}, 0)
+	require.Equal(t, []adc.SearchResult{
+		{Path: "/Music/Artist/", Size: 9},
+		{Path: "/Music/Artist/song.mp3", Size: 9, TTH: &song},
+	}, res)
+
+	res = s.SearchADC(&adc.SearchRequest{And: []string{"music"}, Not: []string{"artist"}, Type: adc.FileTypeFile}, 0)
+	require.Len(t, res, 1)
+	require.Equal(t, "/Music/readme.txt", res[0].Path)
+
+	res = s.SearchADC(&adc.SearchRequest{And: []string{"m"}, Group: adc.ExtAudio}, 0)
+	require.Len(t, res, 1)
+	require.Equal(t, "/Music/Artist/song.mp3", res[0].Path)
+
+	res = s.SearchADC(&adc.SearchRequest{And: []string{"m"}, Ext: []string{"mkv"}, Ge: 10}, 0)
+	require.Len(t, res, 1)
+	require.Equal(t, "/Video/movie.mkv", res[0].Path)
+
+	sr := s.SearchNMDC(&nmdc.Search{
+		Address:  "127.0.0.1:412",
+		DataType: nmdc.DataTypeVideo,
+		Pattern:  "movie",
+	}, nmdc.SR{From: "me", FreeSlots: 1, TotalSlots: 2}, 0)
+	movie := tth("movie data!")
+	require.Equal(t, []nmdc.SR{{
+		From: "me", Path: []string{"Video", "movie.mkv"}, Size: 11, TTH: &movie,
+		FreeSlots: 1, TotalSlots: 2,
+	}}, sr)
+}
+
+func TestShareFileList(t *testing.T) {
+	s, dir := testShare(t, &Config{SkipHidden: true})
+	defer os.RemoveAll(dir)
+
+	l, err := s.FileList(filelist.Header{Base: "/Music/Artist/"})
+	require.NoError(t, err)
+	require.Equal(t, &filelist.FileListing{
+		Header: filelist.Header{Version: 1, Base: "/Music/Artist/"},
+		Files:  []filelist.File{{Name: "song.mp3", Size: 9, TTH: tth("song data")}},
+	}, l)
+
+	l, err = s.FileList(filelist.Header{Generator: "test"})
+	require.NoError(t, err)
+	require.Equal(t, "/", l.Base)
+	require.Len(t, l.Dirs, 2)
+	require.Equal(t, "Music", l.Dirs[0].Name)
+	require.Equal(t, "Video", l.Dirs[1].Name)
+}
+
+type countCache struct {
+	gets, puts int
+}
+
+func (c *countCache) Get(path string, fi os.FileInfo) (tiger.Hash, bool) {
+	c.gets++
+	return tiger.Hash{}, false
+}
+
+func (c *countCache) Put(path string, fi os.FileInfo, tth tiger.Hash, leaves tiger.Leaves) error {
+	c.puts++
+	return nil
+}
+
+func TestShareRefresh(t *testing.T) {
+	cache := &countCache{}
+	s, dir := testShare(t, &Config{Cache: cache})
+	defer os.RemoveAll(dir)
+	require.Equal(t, 4, cache.puts)
+
+	updates := 0
+	s.OnUpdate(func() { updates++ })
+
+	// unchanged files are not rehashed
+	err := s.Refresh(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 4, cache.puts)
+	require.Equal(t, 1, updates)
+
+	path := filepath.Join(dir, "music", "readme.txt")
+	writeFile(t, path, "new readme")
+	mod := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, mod, mod))
+	err = s.Refresh(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 5, cache.puts)
+	require.Len(t, s.SearchTTH(tth("new readme")), 1)
+
+	// saved index is restored without rehashing
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, s.Save(buf))
+	cache2 := &countCache{}
+	s2 := New(&Config{Cache: cache2})
+	require.NoError(t, s2.Load(buf))
+	require.Equal(t, s.Roots(), s2.Roots())
+	size, files := s2.Stats()
+	require.Equal(t, uint64(9+10+6+11), size)
+	require.Equal(t, 4, files)
+	require.NoError(t, s2.Refresh(context.Background()))
+	require.Equal(t, 0, cache2.puts)
+
+	s.RemoveRoot("Video")
+	require.NoError(t, s.Refresh(context.Background()))
+	_, files = s.Stats()
+	require.Equal(t, 3, files)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, context.Canceled, s.Refresh(ctx))
+}
+
+func TestShareRefreshRootError(t *testing.T) {
+	s, dir := testShare(t, nil)
+	defer os.RemoveAll(dir)
+	size, files := s.Stats()
+
+	// unreadable root keeps its previous state
+	video := filepath.Join(dir, "video")
+	require.NoError(t, os.Rename(video, video+".tmp"))
+	writeFile(t, filepath.Join(dir, "music", "new.txt"), "new")
+	err := s.Refresh(context.Background())
+	require.IsType(t, &RefreshError{}, err)
+	require.Contains(t, err.(*RefreshError).Roots, "Video")
+	require.Len(t, err.(*RefreshError).Roots, 1)
+
+	size2, files2 := s.Stats()
+	require.Equal(t, size+3, size2)
+	require.Equal(t, files+1, files2)
+	require.Len(t, s.SearchTTH(tth("movie data!")), 1)
+	require.Len(t, s.SearchTTH(tth("new")), 1)
+
+	// new roots that cannot be read are skipped
+	require.NoError(t, s.AddRoot("Missing", filepath.Join(dir, "missing")))
+	err = s.Refresh(context.Background())
+	require.IsType(t, &RefreshError{}, err)
+	require.Len(t, err.(*RefreshError).Roots, 2)
+	size3, files3 := s.Stats()
+	require.Equal(t, size2, size3)
+	require.Equal(t, files2, files3)
+
+	s.RemoveRoot("Missing")
+	require.NoError(t, os.Rename(video+".tmp", video))
+	require.NoError(t, s.Refresh(context.Background()))
+}
+
+func TestShareWatch(t *testing.T) {
+	s, dir := testShare(t, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.AddRoot("Missing", filepath.Join(dir, "missing")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Watch(ctx, 10*time.Millisecond, func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		})
+	}()
+	// watch continues after errors
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			require.IsType(t, &RefreshError{}, err)
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	writeFile(t, filepath.Join(dir, "missing", "file.txt"), "file")
+	deadline := time.Now().Add(time.Second)
+	for len(s.SearchTTH(tth("file"))) == 0 {
+		require.True(t, time.Now().Before(deadline), "timeout")
+		select {
+		case <-errs:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	cancel()
+	require.Equal(t, context.Canceled, <-done)
+}
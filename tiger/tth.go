@@ -30,11 +30,22 @@ func TreeLeaves(r io.Reader) (lvl Leaves, err error) {
 
 // TreeHash converts leaves into a hash.
 func (in Leaves) TreeHash() Hash {
+	return in.Reduce(1)[0]
+}
+
+// Reduce combines leaves into larger blocks, level by level, until there are at most max leaves.
+// The tree hash of the result is the same as of the original leaves. The original leaves are not modified.
+//
+// It can be used to store and send the leaves at a lower granularity than 1 KiB blocks.
+func (in Leaves) Reduce(max int) Leaves {
+	if max < 1 {
+		max = 1
+	}
 	// deep copy leaves since they must be modified in order to compute the hash
-	lvl := append([]Hash{}, in...)
+	lvl := append(Leaves{}, in...)
 	buf := make([]byte, 2*Size+1)
 
-	for len(lvl) > 1 {
+	for len(lvl) > max {
 		for i := 0; i < len(lvl); i += 2 {
 			if i+1 >= len(lvl) {
 				lvl[i/2] = lvl[i]
@@ -51,7 +62,7 @@ func (in Leaves) TreeHash() Hash {
 		}
 		lvl = lvl[:n]
 	}
-	return lvl[0]
+	return lvl
 }
 
 // TreeHash calculates a Tiger Tree Hash of a reader.
@@ -120,3 +120,24 @@ func TestTTH(t *testing.T) {
 		}
 	}
 }
+
+func TestTTHLeavesReduce(t *testing.T) {
+	data := bytes.Repeat([]byte{'a'}, 10*1024+5)
+	lvl, err := TreeLeaves(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := lvl.TreeHash()
+	for _, max := range []int{1, 2, 3, 6, 11, 20} {
+		r := lvl.Reduce(max)
+		if len(r) > max {
+			t.Errorf("too many leaves for %d: %d", max, len(r))
+		}
+		if h := r.TreeHash(); h != root {
+			t.Errorf("wrong hash for %d: %s vs %s", max, root, h)
+		}
+	}
+	if len(lvl) != 11 {
+		t.Errorf("original leaves were modified")
+	}
+}
@@ -0,0 +1,58 @@
+package translate
+
+import (
+	"strings"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/nmdc"
+)
+
+// mePrefix is used by NMDC clients for third person messages.
+const mePrefix = "/me "
+
+func (t *Translator) chatToADC(text string) adc.ChatMessage {
+	if strings.HasPrefix(text, mePrefix) {
+		return adc.ChatMessage{Text: strings.TrimPrefix(text, mePrefix), Me: true}
+	}
+	return adc.ChatMessage{Text: text}
+}
+
+func (t *Translator) chatToNMDC(m *adc.ChatMessage, lost *Lost) string {
+	text := t.text(m.Text, "#", lost)
+	if m.Me {
+		text = mePrefix + text
+	}
+	if m.TS != 0 {
+		lost.add("TS")
+	}
+	return text
+}
+
+// ChatToADC converts NMDC chat message to ADC. The sender should be set in the packet.
+func (t *Translator) ChatToADC(m *nmdc.ChatMessage) (adc.ChatMessage, Lost) {
+	return t.chatToADC(m.Text), nil
+}
+
+// ChatToNMDC converts ADC chat message to NMDC. The caller should set the sender name.
+func (t *Translator) ChatToNMDC(m *adc.ChatMessage) (nmdc.ChatMessage, Lost) {
+	var lost Lost
+	text := t.chatToNMDC(m, &lost)
+	return nmdc.ChatMessage{Text: text}, lost
+}
+
+// PMToADC converts NMDC private message to ADC. The caller should set the PM field and the packet routing.
+func (t *Translator) PMToADC(m *nmdc.PrivateMessage) (adc.ChatMessage, Lost) {
+	var lost Lost
+	if m.Name != m.From {
+		// message in a chat room, ADC uses PM field for it
+		lost.add("Name")
+	}
+	return t.chatToADC(m.Text), lost
+}
+
+// PMToNMDC converts ADC private message to NMDC. The caller should set the sender and the target.
+func (t *Translator) PMToNMDC(m *adc.ChatMessage) (nmdc.PrivateMessage, Lost) {
+	var lost Lost
+	text := t.chatToNMDC(m, &lost)
+	return nmdc.PrivateMessage{Text: text}, lost
+}
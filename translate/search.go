@@ -0,0 +1,206 @@
+package translate
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/nmdc"
+)
+
+// dataTypes is a list of NMDC data types that correspond to ADC extension groups.
+var dataTypes = []nmdc.DataType{
+	nmdc.DataTypeAudio,
+	nmdc.DataTypeCompressed,
+	nmdc.DataTypeDocument,
+	nmdc.DataTypeExecutable,
+	nmdc.DataTypePicture,
+	nmdc.DataTypeVideo,
+}
+
+// SearchToADC converts NMDC search request to ADC. The token must be provided by the bridge
+// to match the results, and the searcher address is not translated.
+func (t *Translator) SearchToADC(m *nmdc.Search, token string) (adc.SearchRequest, Lost) {
+	var lost Lost
+	s := adc.SearchRequest{Token: token}
+	if m.DataType == nmdc.DataTypeTTH {
+		s.TTH = m.TTH
+		return s, lost
+	}
+	s.And = strings.Fields(m.Pattern)
+	if m.SizeRestricted {
+		if m.IsMaxSize {
+			s.Le = int64(m.Size)
+		} else {
+			s.Ge = int64(m.Size)
+		}
+	}
+	switch m.DataType {
+	case 0, nmdc.DataTypeAny:
+	case nmdc.DataTypeFolders:
+		s.Type = adc.FileTypeDir
+	default:
+		if g, ok := m.DataType.ExtGroup(); ok {
+			s.Group = g
+		} else if exts := m.DataType.Extensions(); len(exts) != 0 {
+			s.Ext = exts
+		} else {
+			lost.add("DataType")
+		}
+	}
+	return s, lost
+}
+
+// SearchToNMDC converts ADC search request to NMDC. The caller should set the searcher address or name.
+func (t *Translator) SearchToNMDC(m *adc.SearchRequest) (nmdc.Search, Lost) {
+	var lost Lost
+	s := nmdc.Search{DataType: nmdc.DataTypeAny}
+	if m.Token != "" {
+		lost.add("TO")
+	}
+	if m.TTH != nil {
+		s.DataType = nmdc.DataTypeTTH
+		s.TTH = m.TTH
+		return s, lost
+	}
+	s.Pattern = t.text(strings.Join(m.And, " "), "AN", &lost)
+	switch {
+	case m.Eq != 0:
+		// NMDC has no exact size match, use the closest restriction
+		s.SizeRestricted, s.IsMaxSize, s.Size = true, true, uint64(m.Eq)
+		lost.add("EQ")
+		if m.Le != 0 {
+			lost.add("LE")
+		}
+		if m.Ge != 0 {
+			lost.add("GE")
+		}
+	case m.Le != 0:
+		s.SizeRestricted, s.IsMaxSize, s.Size = true, true, uint64(m.Le)
+		if m.Ge != 0 {
+			lost.add("GE")
+		}
+	case m.Ge != 0:
+		s.SizeRestricted, s.Size = true, uint64(m.Ge)
+	}
+	if m.Type == adc.FileTypeDir {
+		s.DataType = nmdc.DataTypeFolders
+	}
+	if m.Group != adc.ExtNone {
+		typ := nmdc.DataType(0)
+		for _, dt := range dataTypes {
+			if g, _ := dt.ExtGroup(); g == m.Group {
+				typ = dt
+				break
+			}
+		}
+		if typ == 0 || s.DataType == nmdc.DataTypeFolders {
+			lost.add("GR")
+		} else {
+			s.DataType = typ
+		}
+	}
+	if len(m.Ext) != 0 {
+		lost.add("EX")
+	}
+	if len(m.Not) != 0 {
+		lost.add("NO")
+	}
+	if len(m.NoExt) != 0 {
+		lost.add("RX")
+	}
+	return s, lost
+}
+
+// SRToADC converts NMDC search result to ADC. The token of the search must be provided by the bridge.
+func (t *Translator) SRToADC(m *nmdc.SR, token string) (adc.SearchResult, Lost) {
+	var lost Lost
+	r := adc.SearchResult{
+		Token: token,
+		Path:  "/" + strings.Join(m.Path, "/"),
+		Size:  int64(m.Size),
+		Slots: m.FreeSlots,
+		TTH:   m.TTH,
+	}
+	if m.IsDir {
+		r.Path += "/"
+	}
+	if m.TotalSlots != 0 {
+		lost.add("TotalSlots")
+	}
+	return r, lost
+}
+
+// SRToNMDC converts ADC search result to NMDC. The caller should set the sender, the target
+// and the hub information.
+//
+// ADC doesn't report the total number of slots, thus it's set to the number of free slots.
+func (t *Translator) SRToNMDC(m *adc.SearchResult) (nmdc.SR, Lost) {
+	var lost Lost
+	r := nmdc.SR{
+		FreeSlots:  m.Slots,
+		TotalSlots: m.Slots,
+		TTH:        m.TTH,
+	}
+	path := strings.TrimPrefix(m.Path, "/")
+	if strings.HasSuffix(path, "/") {
+		r.IsDir = true
+		path = strings.TrimSuffix(path, "/")
+	}
+	path = t.text(path, "FN", &lost)
+	r.Path = strings.Split(path, "/")
+	if !r.IsDir && m.Size > 0 {
+		r.Size = uint64(m.Size)
+	}
+	if m.Token != "" {
+		lost.add("TO")
+	}
+	return r, lost
+}
+
+// ConnectToMeToADC converts active NMDC connection request to ADC. The token must be provided by the bridge,
+// and the IP address of the user should be set in the user info.
+//
+// Passive requests (NAT traversal) cannot be represented in ADC.
+func (t *Translator) ConnectToMeToADC(m *nmdc.ConnectToMe, token string) (adc.ConnectRequest, Lost) {
+	var lost Lost
+	c := adc.ConnectRequest{Proto: adc.ProtoADC, Token: token}
+	if m.Secure {
+		c.Proto = adc.ProtoADCS
+	}
+	if m.Kind != nmdc.CTMActive {
+		lost.add("Kind")
+	}
+	host, port, err := net.SplitHostPort(m.Address)
+	if err == nil {
+		c.Port, err = strconv.Atoi(port)
+	}
+	if err != nil {
+		lost.add("Address")
+	} else if host != "" {
+		lost.add("IP")
+	}
+	return c, lost
+}
+
+// ConnectRequestToNMDC converts ADC connection request to NMDC. The IP is taken from the user info
+// of the sender. The caller should set the sender and target names.
+func (t *Translator) ConnectRequestToNMDC(m *adc.ConnectRequest, ip string) (nmdc.ConnectToMe, Lost) {
+	var lost Lost
+	c := nmdc.ConnectToMe{
+		Address: net.JoinHostPort(ip, strconv.Itoa(m.Port)),
+		Kind:    nmdc.CTMActive,
+	}
+	switch m.Proto {
+	case adc.ProtoADC:
+	case adc.ProtoADCS:
+		c.Secure = true
+	default:
+		lost.add("Proto")
+	}
+	if m.Token != "" {
+		lost.add("Token")
+	}
+	return c, lost
+}
@@ -0,0 +1,70 @@
+// Package translate converts messages between ADC and NMDC protocols, for example to bridge two hubs.
+//
+// Fields that identify users (SIDs, CIDs and names) and routing fields (PM targets, search
+// addresses) are not translated, since the mapping between users of two hubs is maintained by the bridge.
+//
+// Each conversion returns a list of fields of the source message that cannot be represented
+// in the target protocol, using the field names of the source protocol.
+//
+// Note that C-C connections still require both peers to speak the same protocol. ConnectToMe
+// translation is only useful for clients that support both protocols.
+package translate
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/direct-connect/go-dc/nmdc"
+)
+
+// Lost is a list of source message fields that cannot be represented in the target protocol.
+type Lost []string
+
+// Has checks if a given field was lost.
+func (l Lost) Has(field string) bool {
+	for _, f := range l {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Lost) add(field string) {
+	if !l.Has(field) {
+		*l = append(*l, field)
+	}
+}
+
+// Translator converts messages between ADC and NMDC protocols.
+//
+// It's not safe for concurrent use if the Encoder is set.
+type Translator struct {
+	// Encoder is the text encoding of the NMDC hub. If set, characters that cannot be represented
+	// in this encoding are replaced with '?' when converting to NMDC, and the field is reported as lost.
+	// If not set, UTF-8 is assumed.
+	Encoder *nmdc.TextEncoder
+}
+
+// text checks that the string can be encoded in the NMDC encoding and replaces unsupported characters.
+func (t *Translator) text(s string, field string, lost *Lost) string {
+	if t.Encoder == nil || s == "" {
+		return s
+	}
+	if _, err := t.Encoder.String(s); err == nil {
+		return s
+	}
+	lost.add(field)
+	var buf strings.Builder
+	buf.Grow(len(s))
+	for _, r := range s {
+		if r != utf8.RuneError {
+			if _, err := t.Encoder.String(string(r)); err == nil {
+				buf.WriteRune(r)
+				continue
+			}
+		}
+		buf.WriteByte('?')
+	}
+	return buf.String()
+}
@@ -0,0 +1,190 @@
+package translate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/charmap"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/nmdc"
+	"github.com/direct-connect/go-dc/tiger"
+	"github.com/direct-connect/go-dc/types"
+)
+
+func TestMyINFOToADC(t *testing.T) {
+	var tr Translator
+	u, lost := tr.MyINFOToADC(&nmdc.MyINFO{
+		Name:           "alice",
+		Desc:           "desc",
+		Client:         types.Software{Name: "++", Version: "0.868"},
+		Mode:           nmdc.UserModeActive,
+		HubsNormal:     1,
+		HubsRegistered: 2,
+		HubsOperator:   3,
+		Slots:          4,
+		Conn:           "100",
+		Flag:           nmdc.FlagStatusNormal | nmdc.FlagStatusAway | nmdc.FlagTLS,
+		Email:          "alice@example.com",
+		ShareSize:      1024,
+	})
+	require.Equal(t, adc.UserInfo{
+		Name:           "alice",
+		Desc:           "desc",
+		Email:          "alice@example.com",
+		ShareSize:      1024,
+		Slots:          4,
+		SlotsFree:      4,
+		HubsNormal:     1,
+		HubsRegistered: 2,
+		HubsOperator:   3,
+		Application:    "DC++",
+		Version:        "0.868",
+		MaxUpload:      "12500000",
+		Away:           adc.AwayTypeNormal,
+		Features:       adc.ExtFeatures{adc.FeaTCP4, adc.FeaADC0},
+	}, u)
+	require.Empty(t, lost)
+}
+
+func TestUserInfoToNMDC(t *testing.T) {
+	tr := Translator{Encoder: charmap.Windows1251.NewEncoder()}
+	m, lost := tr.UserInfoToNMDC(&adc.UserInfo{
+		Name:        "bob",
+		Desc:        "日本",
+		ShareSize:   2048,
+		Slots:       3,
+		SlotsFree:   1,
+		HubsNormal:  1,
+		Application: "AirDC++",
+		Version:     "3.60",
+		MaxUpload:   "1250000",
+		Ip4:         "10.0.0.1",
+		Features:    adc.ExtFeatures{adc.FeaTCP4, adc.FeaADC0},
+	})
+	require.Equal(t, nmdc.MyINFO{
+		Name:       "bob",
+		Desc:       "??",
+		Client:     types.Software{Name: "AirDC++", Version: "3.60"},
+		Mode:       nmdc.UserModeActive,
+		HubsNormal: 1,
+		Slots:      3,
+		Conn:       "10",
+		Flag:       nmdc.FlagStatusNormal | nmdc.FlagTLS,
+		ShareSize:  2048,
+	}, m)
+	require.True(t, lost.Has("DE"))
+	require.True(t, lost.Has("I4"))
+	require.True(t, lost.Has("FS"))
+	require.False(t, lost.Has("NI"))
+}
+
+func TestChat(t *testing.T) {
+	var tr Translator
+	c, lost := tr.ChatToADC(&nmdc.ChatMessage{Name: "alice", Text: "/me waves"})
+	require.Equal(t, adc.ChatMessage{Text: "waves", Me: true}, c)
+	require.Empty(t, lost)
+
+	m, lost := tr.ChatToNMDC(&adc.ChatMessage{Text: "waves", Me: true, TS: 100})
+	require.Equal(t, nmdc.ChatMessage{Text: "/me waves"}, m)
+	require.Equal(t, Lost{"TS"}, lost)
+
+	pm, lost := tr.PMToNMDC(&adc.ChatMessage{Text: "hi"})
+	require.Equal(t, nmdc.PrivateMessage{Text: "hi"}, pm)
+	require.Empty(t, lost)
+}
+
+func TestSearch(t *testing.T) {
+	var tr Translator
+	tth := tiger.HashBytes([]byte("data"))
+
+	s, lost := tr.SearchToADC(&nmdc.Search{
+		DataType:       nmdc.DataTypeVideo,
+		SizeRestricted: true,
+		IsMaxSize:      true,
+		Size:           100,
+		Pattern:        "some  movie",
+	}, "tok")
+	require.Equal(t, adc.SearchRequest{
+		Token: "tok",
+		And:   []string{"some", "movie"},
+		Le:    100,
+		Group: adc.ExtVideo,
+	}, s)
+	require.Empty(t, lost)
+
+	s, lost = tr.SearchToADC(&nmdc.Search{DataType: nmdc.DataTypeTTH, TTH: &tth}, "tok")
+	require.Equal(t, adc.SearchRequest{Token: "tok", TTH: &tth}, s)
+	require.Empty(t, lost)
+
+	s, _ = tr.SearchToADC(&nmdc.Search{DataType: nmdc.DataTypeFolders, Pattern: "dir"}, "")
+	require.Equal(t, adc.FileTypeDir, s.Type)
+
+	m, lost := tr.SearchToNMDC(&adc.SearchRequest{
+		Token: "tok",
+		And:   []string{"some", "movie"},
+		Not:   []string{"bad"},
+		Ge:    10,
+		Group: adc.ExtVideo,
+	})
+	require.Equal(t, nmdc.Search{
+		DataType:       nmdc.DataTypeVideo,
+		SizeRestricted: true,
+		Size:           10,
+		Pattern:        "some movie",
+	}, m)
+	require.Equal(t, Lost{"TO", "NO"}, lost)
+
+	m, lost = tr.SearchToNMDC(&adc.SearchRequest{TTH: &tth})
+	require.Equal(t, nmdc.Search{DataType: nmdc.DataTypeTTH, TTH: &tth}, m)
+	require.Empty(t, lost)
+}
+
+func TestSR(t *testing.T) {
+	var tr Translator
+	tth := tiger.HashBytes([]byte("data"))
+
+	r, lost := tr.SRToADC(&nmdc.SR{
+		From:       "alice",
+		Path:       []string{"dir", "file.txt"},
+		Size:       10,
+		FreeSlots:  1,
+		TotalSlots: 2,
+		TTH:        &tth,
+	}, "tok")
+	require.Equal(t, adc.SearchResult{
+		Token: "tok",
+		Path:  "/dir/file.txt",
+		Size:  10,
+		Slots: 1,
+		TTH:   &tth,
+	}, r)
+	require.Equal(t, Lost{"TotalSlots"}, lost)
+
+	m, lost := tr.SRToNMDC(&adc.SearchResult{Path: "/dir/sub/", Slots: 2})
+	require.Equal(t, nmdc.SR{
+		Path:       []string{"dir", "sub"},
+		IsDir:      true,
+		FreeSlots:  2,
+		TotalSlots: 2,
+	}, m)
+	require.Empty(t, lost)
+}
+
+func TestConnectToMe(t *testing.T) {
+	var tr Translator
+	c, lost := tr.ConnectToMeToADC(&nmdc.ConnectToMe{
+		Targ:    "bob",
+		Address: "10.0.0.1:412",
+		Secure:  true,
+	}, "tok")
+	require.Equal(t, adc.ConnectRequest{Proto: adc.ProtoADCS, Port: 412, Token: "tok"}, c)
+	require.Equal(t, Lost{"IP"}, lost)
+
+	_, lost = tr.ConnectToMeToADC(&nmdc.ConnectToMe{Targ: "bob", Src: "alice", Kind: nmdc.CTMPassiveReq}, "tok")
+	require.True(t, lost.Has("Kind"))
+
+	m, lost := tr.ConnectRequestToNMDC(&adc.ConnectRequest{Proto: adc.ProtoADC, Port: 412, Token: "tok"}, "10.0.0.2")
+	require.Equal(t, nmdc.ConnectToMe{Address: "10.0.0.2:412"}, m)
+	require.Equal(t, Lost{"Token"}, lost)
+}
@@ -0,0 +1,152 @@
+package translate
+
+import (
+	"strconv"
+
+	"github.com/direct-connect/go-dc/adc"
+	"github.com/direct-connect/go-dc/nmdc"
+	"github.com/direct-connect/go-dc/types"
+)
+
+// MyINFOToADC converts NMDC user info to ADC. The user CID and address are not set.
+//
+// The client name is normalized if the client is recognized by nmdc.DetectClient.
+// NMDC doesn't report free slots, thus SlotsFree is set to the number of slots.
+func (t *Translator) MyINFOToADC(m *nmdc.MyINFO) (adc.UserInfo, Lost) {
+	var lost Lost
+	u := adc.UserInfo{
+		Name:           m.Name,
+		Desc:           m.Desc,
+		Email:          m.Email,
+		ShareSize:      int64(m.ShareSize),
+		Slots:          m.Slots,
+		HubsNormal:     m.HubsNormal,
+		HubsRegistered: m.HubsRegistered,
+		HubsOperator:   m.HubsOperator,
+		Features:       adc.ExtFeatures{},
+	}
+	soft := m.Client
+	if ci := nmdc.DetectClient(m); ci.Known {
+		soft = ci.Software
+	}
+	u.Application, u.Version = soft.Name, soft.Version
+
+	// NMDC doesn't report free slots
+	u.SlotsFree = m.Slots
+
+	switch m.Mode {
+	case nmdc.UserModeActive:
+		u.Features = append(u.Features, adc.FeaTCP4)
+	case nmdc.UserModePassive, nmdc.UserModeUnknown:
+	default:
+		lost.add("Mode")
+	}
+	if m.Conn != "" {
+		if speed, err := m.ConnSpeed(); err == nil {
+			u.MaxUpload = strconv.FormatUint(speed, 10)
+		} else {
+			lost.add("Conn")
+		}
+	}
+	if m.Flag.IsSet(nmdc.FlagStatusAway) {
+		u.Away = adc.AwayTypeNormal
+	}
+	if m.Flag.IsSet(nmdc.FlagTLS) {
+		u.Features = append(u.Features, adc.FeaADC0)
+	}
+	if m.Flag.IsSet(nmdc.FlagStatusServer | nmdc.FlagStatusFireball) {
+		lost.add("Flag")
+	}
+	for k := range m.Extra {
+		if k == nmdc.TagAutoOpen {
+			if v, ok, err := m.TagInt(k); ok && err == nil {
+				// KiB/s -> bytes/s
+				u.AutoSlotLimit = v * 1024
+				continue
+			}
+		}
+		lost.add(k)
+	}
+	return u, lost
+}
+
+// UserInfoToNMDC converts ADC user info to NMDC. The IP address should be sent separately with UserIP,
+// and the user type should be reflected in OpList and BotList, thus they are reported as lost.
+func (t *Translator) UserInfoToNMDC(u *adc.UserInfo) (nmdc.MyINFO, Lost) {
+	var lost Lost
+	m := nmdc.MyINFO{
+		Name:           t.text(u.Name, "NI", &lost),
+		Desc:           t.text(u.Desc, "DE", &lost),
+		Email:          t.text(u.Email, "EM", &lost),
+		Slots:          u.Slots,
+		HubsNormal:     u.HubsNormal,
+		HubsRegistered: u.HubsRegistered,
+		HubsOperator:   u.HubsOperator,
+		Mode:           nmdc.UserModePassive,
+		Flag:           nmdc.FlagStatusNormal,
+	}
+	if u.ShareSize > 0 {
+		m.ShareSize = uint64(u.ShareSize)
+	}
+	nu := *u
+	nu.Normalize()
+	m.Client = types.Software{
+		Name:    t.text(nu.Application, "AP", &lost),
+		Version: t.text(nu.Version, "VE", &lost),
+	}
+	for _, f := range u.Features {
+		switch f {
+		case adc.FeaTCP4, adc.FeaTCP6:
+			m.Mode = nmdc.UserModeActive
+		case adc.FeaADC0:
+			m.Flag |= nmdc.FlagTLS
+		default:
+			lost.add("SU")
+		}
+	}
+	if u.Away != adc.AwayTypeNone {
+		m.Flag |= nmdc.FlagStatusAway
+	}
+	if u.MaxUpload != "" {
+		if speed, err := strconv.ParseUint(u.MaxUpload, 10, 64); err == nil {
+			// bytes/s -> Mbit/s
+			m.Conn = strconv.FormatFloat(float64(speed)*8/1e6, 'f', -1, 64)
+		} else {
+			lost.add("US")
+		}
+	}
+	if u.AutoSlotLimit > 0 {
+		m.Extra = map[string]string{nmdc.TagAutoOpen: strconv.Itoa(u.AutoSlotLimit / 1024)}
+	}
+	if !u.Id.IsZero() {
+		lost.add("ID")
+	}
+	if u.Ip4 != "" {
+		lost.add("I4")
+	}
+	if u.Ip6 != "" {
+		lost.add("I6")
+	}
+	if u.Udp4 != 0 {
+		lost.add("U4")
+	}
+	if u.Udp6 != 0 {
+		lost.add("U6")
+	}
+	if u.SlotsFree != u.Slots {
+		lost.add("FS")
+	}
+	if u.MaxDownload != "" {
+		lost.add("DS")
+	}
+	if u.Type != adc.UserTypeNone {
+		lost.add("CT")
+	}
+	if u.KP != "" {
+		lost.add("KP")
+	}
+	if u.Ref != "" {
+		lost.add("RF")
+	}
+	return m, lost
+}